@@ -0,0 +1,85 @@
+// Command asm assembles 6502 source into raw bytes or into an NROM .nes file.
+//
+// Usage:
+//
+//	asm [-o output] [-nes] [-chr file] [-vertical] file.s
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu/asm"
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+func main() {
+	output := flag.String("o", "", "the output file (default: the source file with a .bin or .nes extension)")
+	nes := flag.Bool("nes", false, "write an NROM .nes file instead of raw bytes")
+	chr := flag.String("chr", "", "the CHR ROM of the .nes file (default: CHR RAM)")
+	vertical := flag.Bool("vertical", false, "use vertical name table mirroring in the .nes file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-o output] [-nes] [-chr file] [-vertical] file.s\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src := flag.Arg(0)
+
+	if *output == "" {
+		ext := ".bin"
+		if *nes {
+			ext = ".nes"
+		}
+
+		*output = strings.TrimSuffix(src, filepath.Ext(src)) + ext
+	}
+
+	if err := run(src, *output, *nes, *chr, *vertical); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(src, output string, nes bool, chrFile string, vertical bool) error {
+	program, err := asm.AssembleFile(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+
+	if !nes {
+		_, data, err := program.Bytes()
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(output, data, 0o644)
+	}
+
+	var chr []uint8
+	if chrFile != "" {
+		if chr, err = os.ReadFile(chrFile); err != nil {
+			return err
+		}
+	}
+
+	mirroring := rom.HorizontalOrMapperControlled
+	if vertical {
+		mirroring = rom.Vertical
+	}
+
+	data, err := program.NROM(chr, mirroring)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(output, data, 0o644)
+}
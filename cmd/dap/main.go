@@ -0,0 +1,42 @@
+// Command dap is a Debug Adapter Protocol server for the emulator. It serves
+// over stdio, or over TCP with -listen. The ROM to debug is given as the
+// program of the launch request.
+//
+// Usage:
+//
+//	dap [-listen address]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pqkallio/nes-emulator/emulator/debugger/dap"
+)
+
+func main() {
+	listen := flag.String("listen", "", "serve over TCP on the address, e.g. localhost:4711, instead of stdio")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-listen address]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	if *listen != "" {
+		err = dap.ListenAndServe(*listen)
+	} else {
+		err = dap.NewServer().Serve(os.Stdin, os.Stdout)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
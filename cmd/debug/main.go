@@ -0,0 +1,172 @@
+// Command debug runs a .nes file in the terminal debugger.
+//
+// Usage:
+//
+//	debug [-rows n] [-symbols file,...] [-cdl file] [-wav file [-stems]] [-gdb address] file.nes
+//
+// Type h for the commands. Press Ctrl-C to pause a running program.
+//
+// With -gdb, the terminal UI isn't started; the CPU is served over the GDB
+// remote protocol on the address instead, e.g. localhost:2345.
+//
+// The symbol files are ld65 debug info (.dbg), asm6 listings (.lst) or FCEUX
+// name lists (.nl); their labels are shown in the disassembly.
+//
+// With -cdl, the code/data log of the session is saved to the file in the
+// FCEUX .cdl format when the debugger quits. The log in an existing file is
+// loaded first, so the log accumulates over sessions.
+//
+// With -wav, the audio of the session is recorded to the file, and with
+// -stems, each channel of the APU to a file of its own too.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/pqkallio/nes-emulator/emulator/cdl"
+	"github.com/pqkallio/nes-emulator/emulator/console"
+	"github.com/pqkallio/nes-emulator/emulator/debugger"
+	"github.com/pqkallio/nes-emulator/emulator/debugger/gdb"
+	"github.com/pqkallio/nes-emulator/emulator/debugger/tui"
+	"github.com/pqkallio/nes-emulator/emulator/recorder"
+	"github.com/pqkallio/nes-emulator/rom"
+	"github.com/pqkallio/nes-emulator/symbols"
+)
+
+func main() {
+	rows := flag.Int("rows", 24, "the number of rows of the terminal")
+	gdbAddr := flag.String("gdb", "", "serve GDB on the address instead of running the terminal UI")
+	symbolFiles := flag.String("symbols", "", "comma-separated list of symbol files")
+	cdlFile := flag.String("cdl", "", "save the code/data log to the file")
+	wavFile := flag.String("wav", "", "record the audio to the WAV file")
+	stems := flag.Bool("stems", false, "with -wav, record each channel to a file of its own too")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-rows n] [-symbols file,...] [-cdl file] [-wav file [-stems]] [-gdb address] file.nes\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *rows, *symbolFiles, *cdlFile, *wavFile, *stems, *gdbAddr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(filepath string, rows int, symbolFiles, cdlFile, wavFile string, stems bool, gdbAddr string) (err error) {
+	r, err := rom.ParseNesFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	nes, err := console.NewConsole(r)
+	if err != nil {
+		return err
+	}
+
+	nes.Reset()
+
+	if cdlFile != "" {
+		logger := cdl.NewLogger(len(r.PrgROM()), len(r.ChrROM()), nes.Mapper, nes.Bus)
+
+		if err := loadCdl(logger, cdlFile); err != nil {
+			return err
+		}
+
+		nes.Cpu.AddObserver(logger)
+		nes.Apu.DmcFetched = logger.LogPcm
+
+		defer func() {
+			if saveErr := saveCdl(logger, cdlFile); err == nil {
+				err = saveErr
+			}
+		}()
+	}
+
+	if wavFile != "" {
+		rec, startErr := recorder.Start(nes.Apu, wavFile, recorder.DefaultSampleRate, stems)
+		if startErr != nil {
+			return startErr
+		}
+
+		defer func() {
+			if stopErr := rec.Stop(); err == nil {
+				err = stopErr
+			}
+		}()
+	}
+
+	d := debugger.New(nes.Cpu, nes.Bus, nes.Ppu, nes.Tick)
+
+	if gdbAddr != "" {
+		return gdb.NewServer(d, nes.Cpu, nes.Bus).ListenAndServe(gdbAddr)
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+
+	go func() {
+		for range interrupts {
+			d.Pause()
+		}
+	}()
+
+	ui := tui.New(d, nes.Cpu, nes.Bus, nes.Ppu)
+	ui.Height = rows
+
+	if symbolFiles != "" {
+		table := symbols.NewTable()
+
+		for _, f := range strings.Split(symbolFiles, ",") {
+			if err := table.Load(f); err != nil {
+				return err
+			}
+		}
+
+		ui.Labels = table.View(nes.PrgBank)
+	}
+
+	return ui.Run(os.Stdin, os.Stdout)
+}
+
+// loadCdl loads the log in the file into the logger. A missing file is an
+// empty log.
+func loadCdl(logger *cdl.Logger, filename string) error {
+	f, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := logger.ReadFrom(f); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return nil
+}
+
+func saveCdl(logger *cdl.Logger, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if _, err := logger.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
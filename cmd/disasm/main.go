@@ -0,0 +1,146 @@
+// Command disasm disassembles the PRG ROM of a .nes file bank by bank.
+//
+// Usage:
+//
+//	disasm [-org address,...] [-symbols file,...] file.nes
+//
+// Each bank is disassembled at the address the mapper maps it to on the
+// power-on, e.g. $8000 and $C000 for the two banks of NROM-256, or at the
+// address given with -org: one for all the banks or one per bank. The banks
+// that aren't mapped on the power-on, or whose mapper isn't supported, are
+// disassembled at $8000.
+//
+// The symbol files are ld65 debug info (.dbg), asm6 listings (.lst) or FCEUX
+// name lists (.nl).
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu/disasm"
+	"github.com/pqkallio/nes-emulator/emulator/mapper"
+	"github.com/pqkallio/nes-emulator/rom"
+	"github.com/pqkallio/nes-emulator/symbols"
+)
+
+func main() {
+	org := flag.String("org", "", "comma-separated list of the addresses the banks are disassembled at, one for all the banks or one per bank (default the addresses the mapper maps them to)")
+	symbolFiles := flag.String("symbols", "", "comma-separated list of symbol files to label the listing with")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-org address,...] [-symbols file,...] file.nes\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *org, *symbolFiles); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(filepath string, org string, symbolFiles string) error {
+	r, err := rom.ParseNesFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	origins, err := bankOrigins(r, org)
+	if err != nil {
+		return err
+	}
+
+	table := symbols.NewTable()
+
+	if symbolFiles != "" {
+		for _, f := range strings.Split(symbolFiles, ",") {
+			if err := table.Load(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	prg := r.PrgROM()
+
+	for bank := 0; bank*rom.PrgROMBankSize < len(prg); bank++ {
+		data := prg[bank*rom.PrgROMBankSize : (bank+1)*rom.PrgROMBankSize]
+
+		fmt.Fprintf(w, "; PRG ROM bank %d\n", bank)
+
+		origin := origins[bank]
+		prgBank := disasm.Bank{Data: data, Origin: origin}
+		labels := table.View(func(addr uint16) int {
+			if int(addr) >= int(origin) && int(addr) < int(origin)+len(data) {
+				return bank
+			}
+
+			return symbols.NoBank
+		})
+
+		if err := disasm.Write(w, prgBank.Instructions(), labels); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	return w.Flush()
+}
+
+// bankOrigins returns the addresses the PRG ROM banks are disassembled at:
+// the ones given in org, or else the last 16 KiB window of $8000-$FFFF the
+// mapper maps each bank to on the power-on.
+func bankOrigins(r *rom.ROM, org string) ([]uint16, error) {
+	banks := len(r.PrgROM()) / rom.PrgROMBankSize
+	origins := make([]uint16, banks)
+
+	if org != "" {
+		fields := strings.Split(org, ",")
+		if len(fields) != 1 && len(fields) != banks {
+			return nil, fmt.Errorf("got %d origins for %d banks", len(fields), banks)
+		}
+
+		for bank := range origins {
+			field := fields[0]
+			if len(fields) == banks {
+				field = fields[bank]
+			}
+
+			addr, err := strconv.ParseUint(strings.TrimSpace(field), 0, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid origin %q", field)
+			}
+
+			origins[bank] = uint16(addr)
+		}
+
+		return origins, nil
+	}
+
+	for bank := range origins {
+		origins[bank] = 0x8000
+	}
+
+	m, err := mapper.NewMapper(r)
+	if err != nil {
+		return origins, nil
+	}
+
+	for addr := 0x8000; addr <= 0xffff; addr += rom.PrgROMBankSize {
+		if offset := m.PrgOffset(uint16(addr)); offset >= 0 && offset%rom.PrgROMBankSize == 0 {
+			origins[offset/rom.PrgROMBankSize] = uint16(addr)
+		}
+	}
+
+	return origins, nil
+}
@@ -0,0 +1,150 @@
+// Command profile runs a .nes file headless for a number of frames and
+// reports where the CPU cycles went.
+//
+// Usage:
+//
+//	profile [-frames n] [-top n] [-symbols file,...] [-idle address[-address]] [-pprof file] file.nes
+//
+// The report lists the most expensive routines and instructions, and how
+// much of the vertical blank the NMI handler used and of the frame the
+// program used. The idle range is the loop the program waits for the NMI
+// in; the cycles spent there don't count as used.
+//
+// With -pprof, the profile is also written in the pprof format, e.g. for
+// go tool pprof -top file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pqkallio/nes-emulator/emulator/console"
+	"github.com/pqkallio/nes-emulator/emulator/profiler"
+	"github.com/pqkallio/nes-emulator/rom"
+	"github.com/pqkallio/nes-emulator/symbols"
+)
+
+func main() {
+	frames := flag.Uint64("frames", 600, "the number of frames to run")
+	top := flag.Int("top", 20, "the number of routines and instructions to report")
+	symbolFiles := flag.String("symbols", "", "comma-separated list of symbol files")
+	idle := flag.String("idle", "", "the address range of the idle loop, e.g. $C010-$C015")
+	pprofFile := flag.String("pprof", "", "write a pprof profile to the file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-frames n] [-top n] [-symbols file,...] [-idle address[-address]] [-pprof file] file.nes\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *frames, *top, *symbolFiles, *idle, *pprofFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(filepath string, frames uint64, top int, symbolFiles, idle, pprofFile string) error {
+	r, err := rom.ParseNesFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	nes, err := console.NewConsole(r)
+	if err != nil {
+		return err
+	}
+
+	p := profiler.New(nes.Bus, nes.PrgBank)
+
+	if symbolFiles != "" {
+		table := symbols.NewTable()
+
+		for _, f := range strings.Split(symbolFiles, ",") {
+			if err := table.Load(f); err != nil {
+				return err
+			}
+		}
+
+		p.SetLabels(table.View(nes.PrgBank))
+	}
+
+	if idle != "" {
+		start, end, err := parseRange(idle)
+		if err != nil {
+			return err
+		}
+
+		p.AddIdle(start, end)
+	}
+
+	nes.Cpu.AddObserver(p)
+	nes.Reset()
+
+	for nes.Ppu.Frame() < frames {
+		nes.Tick()
+	}
+
+	if err := p.WriteReport(os.Stdout, top); err != nil {
+		return err
+	}
+
+	if pprofFile == "" {
+		return nil
+	}
+
+	f, err := os.Create(pprofFile)
+	if err != nil {
+		return err
+	}
+
+	if err := p.WritePprof(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// parseRange parses an address, or two separated by a dash. The addresses
+// are hexadecimal, optionally prefixed with $ or 0x.
+func parseRange(s string) (uint16, uint16, error) {
+	parts := strings.SplitN(s, "-", 2)
+
+	start, err := parseAddress(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(parts) == 1 {
+		return start, start, nil
+	}
+
+	end, err := parseAddress(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if end < start {
+		return 0, 0, fmt.Errorf("invalid address range %q", s)
+	}
+
+	return start, end, nil
+}
+
+func parseAddress(s string) (uint16, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "$"), "0x")
+
+	addr, err := strconv.ParseUint(s, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+
+	return uint16(addr), nil
+}
@@ -0,0 +1,66 @@
+// Command record runs a .nes file headless for a number of frames and
+// records its audio to a 16-bit PCM WAV file.
+//
+// Usage:
+//
+//	record [-frames n] [-rate hz] [-stems] file.nes file.wav
+//
+// With -stems, each channel of the APU is also recorded alone, to files
+// named after the WAV file and the channel, e.g. file.pulse1.wav.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pqkallio/nes-emulator/emulator/console"
+	"github.com/pqkallio/nes-emulator/emulator/recorder"
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+func main() {
+	frames := flag.Uint64("frames", 600, "the number of frames to run")
+	rate := flag.Int("rate", recorder.DefaultSampleRate, "the sample rate in Hz")
+	stems := flag.Bool("stems", false, "record each channel to a file of its own too")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-frames n] [-rate hz] [-stems] file.nes file.wav\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), flag.Arg(1), *frames, *rate, *stems); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(filepath, wavFile string, frames uint64, rate int, stems bool) error {
+	r, err := rom.ParseNesFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	nes, err := console.NewConsole(r)
+	if err != nil {
+		return err
+	}
+
+	nes.Reset()
+
+	rec, err := recorder.Start(nes.Apu, wavFile, rate, stems)
+	if err != nil {
+		return err
+	}
+
+	for nes.Ppu.Frame() < frames {
+		nes.Tick()
+	}
+
+	return rec.Stop()
+}
@@ -0,0 +1,292 @@
+// Package apu emulates the audio processing unit of the 2A03: the two pulse
+// channels, the triangle, the noise and the delta modulation channel, the
+// frame counter and its IRQ, and the $4015 status register.
+//
+// The APU is mapped over $4000-$4017 and ticked once per CPU cycle. The
+// registers are write-only except $4015; the other reads are open bus.
+//
+// The package also emulates the sound chips of the cartridges, whose output
+// is mixed with the APU's; see Expansion.
+package apu
+
+const (
+	statusRegister       uint16 = 0x4015
+	frameCounterRegister uint16 = 0x4017
+)
+
+// Status register flags.
+const (
+	dmcActiveFlag uint8 = 0b0001_0000
+	frameIrqFlag  uint8 = 0b0100_0000
+	dmcIrqFlag    uint8 = 0b1000_0000
+	// statusDriven are the bits of $4015 the APU drives; bit 5 is open bus.
+	statusDriven uint8 = 0b1101_1111
+)
+
+// Memory is the CPU address space the DMC fetches the samples from.
+// *bus.Bus implements it.
+type Memory interface {
+	ReadData(addr uint16) uint8
+}
+
+// Staller halts the CPU while the DMC fetches a sample byte. *cpu.Cpu
+// implements it.
+type Staller interface {
+	Stall(cycles int)
+}
+
+// Levels are the outputs of the channels: 0-15 for the pulses, the triangle
+// and the noise, and 0-127 for the DMC.
+type Levels struct {
+	Pulse1   uint8
+	Pulse2   uint8
+	Triangle uint8
+	Noise    uint8
+	Dmc      uint8
+}
+
+type Apu struct {
+	pulse1   pulse
+	pulse2   pulse
+	triangle triangle
+	noise    noise
+	dmc      dmc
+	frame    frameCounter
+
+	mem     Memory
+	staller Staller
+	cycles  uint64
+
+	// resampler produces the samples, if a sample rate is set.
+	resampler *resampler
+	// recordings are the outputs being recorded.
+	recordings []*Recording
+	// expansion is the sound chip of the cartridge, if any.
+	expansion Expansion
+
+	// DmcFetched, if set, is called with the address of every sample byte
+	// the DMC fetches, e.g. to log it as PCM data.
+	DmcFetched func(addr uint16)
+	// DmcDma, if set, is called when the DMC halts the CPU to fetch a
+	// sample byte, before the CPU is stalled, e.g. to repeat the read the
+	// DMA interrupts.
+	DmcDma func()
+}
+
+// NewApu returns an APU in the power-up state. The DMC fetches the samples
+// from mem and halts the CPU through staller, which may be nil.
+func NewApu(mem Memory, staller Staller) *Apu {
+	return &Apu{
+		pulse1:  pulse{onesComplement: true},
+		noise:   newNoise(),
+		dmc:     newDmc(),
+		mem:     mem,
+		staller: staller,
+	}
+}
+
+// Reset silences the channels and restarts the frame counter sequence, like
+// the reset button does.
+func (a *Apu) Reset() {
+	a.writeStatus(0)
+	a.frame.irqFlag = false
+	a.frame.resetDelay = 0
+	a.frame.cycle = 0
+	a.triangle.sequence = 0
+	a.dmc.level &= 0x01
+}
+
+// Power puts the channels and the frame counter in the power-up state, like
+// turning the console off and on. The outputs, the expansion chip and the
+// callbacks are kept.
+func (a *Apu) Power() {
+	a.pulse1 = pulse{onesComplement: true}
+	a.pulse2 = pulse{}
+	a.triangle = triangle{}
+	a.noise = newNoise()
+	a.dmc = newDmc()
+	a.frame = frameCounter{}
+	a.cycles = 0
+}
+
+// Tick advances the APU by one CPU cycle.
+func (a *Apu) Tick() {
+	a.cycles++
+
+	quarter, half := a.frame.tick()
+
+	if quarter {
+		a.pulse1.envelope.clock()
+		a.pulse2.envelope.clock()
+		a.noise.envelope.clock()
+		a.triangle.clockLinear()
+	}
+
+	if half {
+		a.pulse1.length.clock()
+		a.pulse2.length.clock()
+		a.triangle.length.clock()
+		a.noise.length.clock()
+		a.pulse1.clockSweep()
+		a.pulse2.clockSweep()
+	}
+
+	a.triangle.clockTimer()
+
+	if a.apuCycle() {
+		a.pulse1.clockTimer()
+		a.pulse2.clockTimer()
+	}
+
+	a.noise.clockTimer()
+	a.dmc.clockTimer()
+
+	if a.dmc.needsFetch() {
+		a.fetchSample()
+	}
+
+	if a.expansion != nil {
+		a.expansion.TickAudio()
+	}
+
+	if a.resampler == nil && len(a.recordings) == 0 {
+		return
+	}
+
+	levels := a.Levels()
+
+	var expansion float32
+	if a.expansion != nil {
+		expansion = a.expansion.AudioOutput()
+	}
+
+	if a.resampler != nil {
+		a.resampler.tick(mix(levels) + expansion)
+	}
+
+	for _, r := range a.recordings {
+		r.tick(levels, expansion)
+	}
+}
+
+// apuCycle tells whether the current CPU cycle is one the APU cycles,
+// which run at half the CPU clock, are clocked on.
+func (a *Apu) apuCycle() bool {
+	return a.cycles%2 == 0
+}
+
+func (a *Apu) fetchSample() {
+	if a.DmcDma != nil {
+		a.DmcDma()
+	}
+
+	if a.staller != nil {
+		a.staller.Stall(dmcStallCycles)
+	}
+
+	addr := a.dmc.addr
+	data := a.mem.ReadData(addr)
+
+	if a.DmcFetched != nil {
+		a.DmcFetched(addr)
+	}
+
+	a.dmc.fill(data)
+}
+
+// IrqLine tells whether the frame counter or the DMC asserts the IRQ line.
+func (a *Apu) IrqLine() bool {
+	return a.frame.irqFlag || a.dmc.irqRequested
+}
+
+// Levels returns the current outputs of the channels.
+func (a *Apu) Levels() Levels {
+	return Levels{
+		Pulse1:   a.pulse1.output(),
+		Pulse2:   a.pulse2.output(),
+		Triangle: a.triangle.output(),
+		Noise:    a.noise.output(),
+		Dmc:      a.dmc.output(),
+	}
+}
+
+func (a *Apu) Write(addr uint16, data uint8) {
+	switch {
+	case addr < 0x4004:
+		a.pulse1.write(addr&0x03, data)
+	case addr < 0x4008:
+		a.pulse2.write(addr&0x03, data)
+	case addr < 0x400c:
+		a.triangle.write(addr&0x03, data)
+	case addr < 0x4010:
+		a.noise.write(addr&0x03, data)
+	case addr < 0x4014:
+		a.dmc.write(addr&0x03, data)
+	case addr == statusRegister:
+		a.writeStatus(data)
+	case addr == frameCounterRegister:
+		a.frame.write(data, a.apuCycle())
+	}
+}
+
+// writeStatus enables the channels, ---D NT21. Writing it clears the DMC
+// IRQ.
+func (a *Apu) writeStatus(data uint8) {
+	a.pulse1.length.setEnabled(data&0x01 != 0)
+	a.pulse2.length.setEnabled(data&0x02 != 0)
+	a.triangle.length.setEnabled(data&0x04 != 0)
+	a.noise.length.setEnabled(data&0x08 != 0)
+	a.dmc.setEnabled(data&0x10 != 0)
+}
+
+func (a *Apu) Read(addr uint16) uint8 {
+	data, _ := a.ReadDriven(addr)
+	return data
+}
+
+// ReadDriven reads $4015, IF-D NT21, which tells the channels whose length
+// counters are non-zero, whether the DMC has bytes left and the IRQ flags.
+// Reading it clears the frame counter IRQ flag. The other registers are
+// write-only and don't drive the bus.
+func (a *Apu) ReadDriven(addr uint16) (uint8, uint8) {
+	data, driven := a.PeekDriven(addr)
+
+	if addr == statusRegister {
+		a.frame.irqFlag = false
+	}
+
+	return data, driven
+}
+
+func (a *Apu) PeekDriven(addr uint16) (uint8, uint8) {
+	if addr != statusRegister {
+		return 0, 0
+	}
+
+	var status uint8
+
+	for i, active := range []bool{
+		a.pulse1.length.active(),
+		a.pulse2.length.active(),
+		a.triangle.length.active(),
+		a.noise.length.active(),
+	} {
+		if active {
+			status |= 1 << i
+		}
+	}
+
+	if a.dmc.remaining > 0 {
+		status |= dmcActiveFlag
+	}
+
+	if a.frame.irqFlag {
+		status |= frameIrqFlag
+	}
+
+	if a.dmc.irqRequested {
+		status |= dmcIrqFlag
+	}
+
+	return status, statusDriven
+}
@@ -0,0 +1,469 @@
+package apu
+
+import "testing"
+
+// testMemory is the CPU address space the DMC fetches from. It logs the
+// addresses fetched.
+type testMemory struct {
+	data    [0x10000]uint8
+	fetched []uint16
+}
+
+func (m *testMemory) ReadData(addr uint16) uint8 {
+	m.fetched = append(m.fetched, addr)
+	return m.data[addr]
+}
+
+// testStaller counts the cycles the CPU is halted for.
+type testStaller struct {
+	cycles int
+}
+
+func (s *testStaller) Stall(cycles int) {
+	s.cycles += cycles
+}
+
+func tickApu(a *Apu, cycles int) {
+	for i := 0; i < cycles; i++ {
+		a.Tick()
+	}
+}
+
+func readStatus(a *Apu) uint8 {
+	data, _ := a.ReadDriven(statusRegister)
+	return data
+}
+
+func TestFrameCounterIrq(t *testing.T) {
+	a := NewApu(&testMemory{}, nil)
+
+	tickApu(a, fourStepIrqStart-1)
+
+	if a.IrqLine() {
+		t.Fatalf("the IRQ was raised at cycle %d", fourStepIrqStart-1)
+	}
+
+	// The flag is set on three consecutive cycles, so reading $4015 on the
+	// first two doesn't keep it cleared.
+	for cycle := fourStepIrqStart; cycle <= fourStepLength; cycle++ {
+		a.Tick()
+
+		if !a.IrqLine() {
+			t.Fatalf("no IRQ at cycle %d", cycle)
+		}
+
+		if status := readStatus(a); status&frameIrqFlag == 0 || a.IrqLine() {
+			t.Fatalf("cycle %d: got status $%02X and IRQ line %v after the read", cycle, status, a.IrqLine())
+		}
+	}
+
+	tickApu(a, fourStepIrqStart-1)
+
+	if a.IrqLine() {
+		t.Fatal("the IRQ was raised before the end of the second sequence")
+	}
+
+	a.Tick()
+
+	if !a.IrqLine() {
+		t.Fatal("no IRQ at the end of the second sequence")
+	}
+
+	// Setting the inhibit flag clears the flag.
+	a.Write(frameCounterRegister, 0x40)
+
+	if a.IrqLine() {
+		t.Fatal("the inhibit flag didn't clear the IRQ")
+	}
+
+	tickApu(a, 2*fourStepLength)
+
+	if a.IrqLine() {
+		t.Error("the IRQ was raised while inhibited")
+	}
+}
+
+func TestFrameCounterFiveStep(t *testing.T) {
+	a := NewApu(&testMemory{}, nil)
+	a.Write(statusRegister, 0x01)
+	// The length index 1 loads 254.
+	a.Write(0x4003, 0x08)
+
+	// The write lands on an APU cycle, so the sequence restarts 3 cycles
+	// later, and clocks the half frame units at once.
+	a.Write(frameCounterRegister, 0x80)
+	tickApu(a, 2)
+
+	if a.pulse1.length.count != 254 {
+		t.Fatalf("got length %d before the restart, want 254", a.pulse1.length.count)
+	}
+
+	a.Tick()
+
+	if a.pulse1.length.count != 253 {
+		t.Fatalf("got length %d after the restart, want 253", a.pulse1.length.count)
+	}
+
+	// The half frames of the 5-step sequence.
+	halfFrames := []int{firstHalfFrame, fiveStepHalfFrame, fiveStepLength + firstHalfFrame}
+	clocked := 0
+
+	for cycle := 1; cycle <= halfFrames[len(halfFrames)-1]; cycle++ {
+		before := a.pulse1.length.count
+		a.Tick()
+
+		if a.pulse1.length.count != before {
+			if clocked == len(halfFrames) || cycle != halfFrames[clocked] {
+				t.Fatalf("a half frame at cycle %d", cycle)
+			}
+
+			clocked++
+		}
+
+		if a.IrqLine() {
+			t.Fatalf("the 5-step sequence raised an IRQ at cycle %d", cycle)
+		}
+	}
+
+	if clocked != len(halfFrames) {
+		t.Errorf("got %d half frames, want %d", clocked, len(halfFrames))
+	}
+}
+
+func TestFrameCounterQuarterFrames(t *testing.T) {
+	a := NewApu(&testMemory{}, nil)
+	a.Write(statusRegister, 0x04)
+	// The triangle's linear counter reloads to 10 and counts down on the
+	// quarter frames.
+	a.Write(0x4008, 0x0a)
+	a.Write(0x400b, 0x08)
+
+	quarterFrames := []int{firstQuarterFrame, firstHalfFrame, thirdQuarterFrame, fourStepHalfFrame}
+	var got []int
+
+	for cycle := 1; cycle <= fourStepLength; cycle++ {
+		before := a.triangle.linear
+		a.Tick()
+
+		if a.triangle.linear != before {
+			got = append(got, cycle)
+		}
+	}
+
+	if len(got) != len(quarterFrames) {
+		t.Fatalf("got quarter frames at %v, want %v", got, quarterFrames)
+	}
+
+	for i := range got {
+		if got[i] != quarterFrames[i] {
+			t.Errorf("got quarter frames at %v, want %v", got, quarterFrames)
+			break
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	a := NewApu(&testMemory{}, nil)
+
+	if status, driven := a.ReadDriven(statusRegister); status != 0 || driven != statusDriven {
+		t.Errorf("got $%02X driven $%02X on power-on, want 0 driven $%02X", status, driven, statusDriven)
+	}
+
+	if _, driven := a.ReadDriven(0x4000); driven != 0 {
+		t.Errorf("$4000 drives $%02X, want open bus", driven)
+	}
+
+	a.Write(statusRegister, 0x0f)
+
+	for _, addr := range []uint16{0x4003, 0x4007, 0x400b, 0x400f} {
+		a.Write(addr, 0x08)
+	}
+
+	if status := readStatus(a); status != 0x0f {
+		t.Errorf("got $%02X with the four channels playing, want $0F", status)
+	}
+
+	// Disabling a channel clears its length counter at once.
+	a.Write(statusRegister, 0x05)
+
+	if status := readStatus(a); status != 0x05 {
+		t.Errorf("got $%02X after disabling the pulse 2 and the noise, want $05", status)
+	}
+
+	// Loading the length counter of a disabled channel does nothing.
+	a.Write(0x4007, 0x08)
+
+	if status := readStatus(a); status != 0x05 {
+		t.Errorf("got $%02X after loading a disabled channel, want $05", status)
+	}
+
+	a.Write(statusRegister, 0)
+
+	if status := readStatus(a); status != 0 {
+		t.Errorf("got $%02X with the channels disabled, want 0", status)
+	}
+}
+
+func TestLengthCounter(t *testing.T) {
+	var l lengthCounter
+
+	l.setEnabled(true)
+
+	for index, want := range lengthTable {
+		l.load(uint8(index) << 3)
+
+		if l.count != want {
+			t.Errorf("index %d: got %d, want %d", index, l.count, want)
+		}
+	}
+
+	// The index 3 loads 2.
+	l.load(3 << 3)
+	l.halt = true
+	l.clock()
+
+	if l.count != 2 {
+		t.Errorf("got %d after a halted clock, want 2", l.count)
+	}
+
+	l.halt = false
+	l.clock()
+	l.clock()
+	l.clock()
+
+	if l.count != 0 || l.active() {
+		t.Errorf("got %d after counting down, want 0", l.count)
+	}
+}
+
+func TestLengthCounterHalfFrames(t *testing.T) {
+	a := NewApu(&testMemory{}, nil)
+	a.Write(statusRegister, 0x08)
+	// The index 3 loads 2, which silences the noise on the second half
+	// frame.
+	a.Write(0x400f, 3<<3)
+
+	tickApu(a, firstHalfFrame)
+
+	if a.noise.length.count != 1 {
+		t.Fatalf("got length %d after the first half frame, want 1", a.noise.length.count)
+	}
+
+	tickApu(a, fourStepHalfFrame-firstHalfFrame-1)
+
+	if readStatus(a)&0x08 == 0 {
+		t.Fatal("the noise stopped before the second half frame")
+	}
+
+	a.Tick()
+
+	if readStatus(a)&0x08 != 0 {
+		t.Error("the noise plays after the second half frame")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	tests := []struct {
+		name    string
+		ones    bool
+		sweep   uint8
+		period  uint16
+		periods []uint16
+	}{
+		{"add", false, 0x81, 0x100, []uint16{0x180, 0x240, 0x360}},
+		{"subtract two's complement", false, 0x89, 0x100, []uint16{0x080, 0x040, 0x020}},
+		{"subtract one's complement", true, 0x89, 0x100, []uint16{0x07f, 0x03f, 0x01f}},
+		// The divider of period 2 updates on every third half frame.
+		{"divider", false, 0xa1, 0x100, []uint16{0x180, 0x180, 0x180, 0x240}},
+		{"disabled", false, 0x01, 0x100, []uint16{0x100, 0x100}},
+		{"zero shift", false, 0x80, 0x100, []uint16{0x100, 0x100}},
+		// The target period over $7FF mutes the channel and stops the
+		// sweep.
+		{"overflow", false, 0x81, 0x600, []uint16{0x600, 0x600}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := pulse{onesComplement: test.ones}
+			p.length.setEnabled(true)
+			p.write(1, test.sweep)
+			p.write(2, uint8(test.period))
+			p.write(3, uint8(test.period>>8))
+
+			for i, want := range test.periods {
+				p.clockSweep()
+
+				if p.period != want {
+					t.Fatalf("half frame %d: got period $%03X, want $%03X", i+1, p.period, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSweepMutes(t *testing.T) {
+	tests := []struct {
+		name   string
+		sweep  uint8
+		period uint16
+		muted  bool
+	}{
+		{"low period", 0x00, 0x007, true},
+		{"lowest audible period", 0x00, 0x008, false},
+		{"target overflow with the sweep disabled", 0x00, 0x400, true},
+		{"no overflow with a shift", 0x01, 0x500, false},
+		{"overflow with a shift", 0x01, 0x600, true},
+		{"negated", 0x08, 0x7ff, false},
+	}
+
+	for _, test := range tests {
+		p := pulse{}
+		p.length.setEnabled(true)
+		p.write(0, 0xbf)
+		p.write(1, test.sweep)
+		p.write(2, uint8(test.period))
+		p.write(3, uint8(test.period>>8))
+
+		if p.muted() != test.muted {
+			t.Errorf("%s: got muted %v, want %v", test.name, p.muted(), test.muted)
+		}
+
+		// The duty 2 sequence is high on the steps 1-4.
+		p.sequence = 1
+
+		want := uint8(15)
+		if test.muted {
+			want = 0
+		}
+
+		if p.output() != want {
+			t.Errorf("%s: got output %d, want %d", test.name, p.output(), want)
+		}
+	}
+}
+
+func TestDmcPlaysSample(t *testing.T) {
+	mem := &testMemory{}
+	staller := &testStaller{}
+	a := NewApu(mem, staller)
+
+	var logged []uint16
+	a.DmcFetched = func(addr uint16) { logged = append(logged, addr) }
+
+	for i := 0; i < 17; i++ {
+		mem.data[0xc040+i] = 0xff
+	}
+
+	// The sample at $C040 of 17 bytes, at the fastest rate with the IRQ
+	// enabled, from the level 64.
+	a.Write(0x4010, 0x8f)
+	a.Write(0x4011, 64)
+	a.Write(0x4012, 0x01)
+	a.Write(0x4013, 0x01)
+	a.Write(statusRegister, 0x10)
+
+	if status := readStatus(a); status != dmcActiveFlag {
+		t.Fatalf("got status $%02X after the start, want $%02X", status, dmcActiveFlag)
+	}
+
+	tickApu(a, 1)
+
+	if len(mem.fetched) != 1 || mem.fetched[0] != 0xc040 || staller.cycles != dmcStallCycles {
+		t.Fatalf("fetched %X and stalled for %d cycles, want the first byte at once", mem.fetched, staller.cycles)
+	}
+
+	// A byte is played in 8 periods of 54 cycles.
+	tickApu(a, 17*8*54)
+
+	if len(mem.fetched) != 17 || staller.cycles != 17*dmcStallCycles {
+		t.Fatalf("fetched %d bytes and stalled for %d cycles, want 17 bytes", len(mem.fetched), staller.cycles)
+	}
+
+	for i, addr := range mem.fetched {
+		if addr != 0xc040+uint16(i) || logged[i] != addr {
+			t.Fatalf("got fetches %X and logged %X", mem.fetched, logged)
+		}
+	}
+
+	// The level rises by 2 for every one bit until it reaches 126.
+	if level := a.Levels().Dmc; level != 126 {
+		t.Errorf("got level %d, want 126", level)
+	}
+
+	status := readStatus(a)
+	if status != dmcIrqFlag || !a.IrqLine() {
+		t.Fatalf("got status $%02X and IRQ line %v at the end, want $%02X", status, a.IrqLine(), dmcIrqFlag)
+	}
+
+	// Reading $4015 doesn't clear the DMC IRQ; writing it does.
+	if readStatus(a) != dmcIrqFlag {
+		t.Error("reading $4015 cleared the DMC IRQ")
+	}
+
+	a.Write(statusRegister, 0)
+
+	if readStatus(a) != 0 || a.IrqLine() {
+		t.Error("writing $4015 didn't clear the DMC IRQ")
+	}
+}
+
+func TestDmcLoops(t *testing.T) {
+	mem := &testMemory{}
+	a := NewApu(mem, nil)
+
+	a.Write(0x4010, 0xcf)
+	a.Write(0x4012, 0x00)
+	a.Write(0x4013, 0x00)
+	a.Write(statusRegister, 0x10)
+
+	tickApu(a, 4*8*54)
+
+	// The sample of a byte restarts instead of raising the IRQ.
+	if len(mem.fetched) < 4 || readStatus(a) != dmcActiveFlag || a.IrqLine() {
+		t.Errorf("fetched %X with status $%02X", mem.fetched, readStatus(a))
+	}
+
+	for _, addr := range mem.fetched {
+		if addr != 0xc000 {
+			t.Fatalf("got fetches %X, want $C000 over and over", mem.fetched)
+		}
+	}
+}
+
+func TestDmcAddressWraps(t *testing.T) {
+	d := newDmc()
+	d.addr = 0xffff
+	d.remaining = 2
+
+	d.fill(0)
+
+	if d.addr != 0x8000 || d.remaining != 1 {
+		t.Errorf("got address $%04X with %d bytes left, want $8000 and 1", d.addr, d.remaining)
+	}
+}
+
+func TestDmcLevelClamps(t *testing.T) {
+	d := newDmc()
+	d.write(1, 127)
+	d.fill(0xff)
+
+	// The first byte starts playing after the silent output unit ends.
+	for i := 0; i < 16*int(d.period); i++ {
+		d.clockTimer()
+	}
+
+	if d.level != 127 {
+		t.Errorf("got level %d, want 127 kept", d.level)
+	}
+
+	d.write(1, 1)
+	d.fill(0x00)
+
+	for i := 0; i < 16*int(d.period); i++ {
+		d.clockTimer()
+	}
+
+	if d.level != 1 {
+		t.Errorf("got level %d, want 1 kept", d.level)
+	}
+}
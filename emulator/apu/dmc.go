@@ -0,0 +1,144 @@
+package apu
+
+// dmcPeriods are the periods of the DMC output in CPU cycles (NTSC).
+var dmcPeriods = [16]uint16{
+	428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54,
+}
+
+// dmcStallCycles is the number of cycles the CPU is halted for a sample
+// fetch. It is 4 in the common case; the hardware takes 1-3 cycles in some
+// alignments with the CPU writes and the OAM DMA.
+const dmcStallCycles = 4
+
+// dmc is the delta modulation channel, $4010-$4013. It plays 1-bit delta
+// encoded samples fetched from the CPU address space, halting the CPU for
+// every byte, and its 7-bit output level can also be set directly.
+type dmc struct {
+	irqEnabled bool
+	loop       bool
+	period     uint16
+	timer      uint16
+
+	level uint8
+
+	sampleAddr   uint16
+	sampleLength uint16
+	addr         uint16
+	remaining    uint16
+
+	buffer      uint8
+	bufferEmpty bool
+
+	shift        uint8
+	bitsLeft     uint8
+	silence      bool
+	irqRequested bool
+}
+
+func newDmc() dmc {
+	return dmc{period: dmcPeriods[0], bufferEmpty: true, bitsLeft: 8, silence: true}
+}
+
+func (d *dmc) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		d.irqEnabled = data&0x80 != 0
+		d.loop = data&0x40 != 0
+		d.period = dmcPeriods[data&0x0f]
+
+		if !d.irqEnabled {
+			d.irqRequested = false
+		}
+	case 1:
+		d.level = data & 0x7f
+	case 2:
+		d.sampleAddr = 0xc000 | uint16(data)<<6
+	case 3:
+		d.sampleLength = uint16(data)<<4 | 1
+	}
+}
+
+// setEnabled starts the sample through $4015 if nothing is left to play,
+// or stops it.
+func (d *dmc) setEnabled(enabled bool) {
+	d.irqRequested = false
+
+	if !enabled {
+		d.remaining = 0
+	} else if d.remaining == 0 {
+		d.restart()
+	}
+}
+
+func (d *dmc) restart() {
+	d.addr = d.sampleAddr
+	d.remaining = d.sampleLength
+}
+
+// needsFetch tells whether the memory reader fetches the next sample byte.
+func (d *dmc) needsFetch() bool {
+	return d.bufferEmpty && d.remaining > 0
+}
+
+// fill puts the fetched byte in the sample buffer and advances the reader.
+// The address wraps from $FFFF to $8000.
+func (d *dmc) fill(data uint8) {
+	d.buffer = data
+	d.bufferEmpty = false
+
+	d.addr++
+	if d.addr == 0 {
+		d.addr = 0x8000
+	}
+
+	d.remaining--
+	if d.remaining > 0 {
+		return
+	}
+
+	if d.loop {
+		d.restart()
+	} else if d.irqEnabled {
+		d.irqRequested = true
+	}
+}
+
+// clockTimer is called on every CPU cycle.
+func (d *dmc) clockTimer() {
+	if d.timer > 0 {
+		d.timer--
+		return
+	}
+
+	d.timer = d.period - 1
+
+	if !d.silence {
+		if d.shift&1 != 0 {
+			if d.level <= 125 {
+				d.level += 2
+			}
+		} else if d.level >= 2 {
+			d.level -= 2
+		}
+	}
+
+	d.shift >>= 1
+	d.bitsLeft--
+
+	if d.bitsLeft > 0 {
+		return
+	}
+
+	d.bitsLeft = 8
+	d.silence = d.bufferEmpty
+
+	if !d.bufferEmpty {
+		d.shift = d.buffer
+		d.bufferEmpty = true
+	}
+}
+
+// output returns the level of the channel, 0-127.
+func (d *dmc) output() uint8 {
+	return d.level
+}
@@ -0,0 +1,27 @@
+package apu
+
+// Expansion is a sound chip on the cartridge, whose output the console mixes
+// with the APU's through the expansion audio pins. The mappers of the boards
+// with one implement it, usually by embedding the chip: Vrc6, Vrc7, Fds,
+// N163, Sunsoft5B or Mmc5. The mapper decodes the chip's registers and
+// passes the writes on. The console sets the mapper as the expansion if it
+// implements the interface; none of the mappers supported so far do.
+type Expansion interface {
+	// TickAudio advances the chip by one CPU cycle.
+	TickAudio()
+	// AudioOutput returns the output of the chip in the units of the APU's
+	// mixed output, so the two can be added.
+	AudioOutput() float32
+}
+
+// apuPulseStep is the output of a step of volume of an APU pulse channel,
+// in the linear approximation of the mixer. The levels of the expansion
+// chips are given relative to it, as measured on the consoles and the
+// boards; they vary from board to board, so they are approximations.
+const apuPulseStep = 0.00752
+
+// SetExpansion sets the sound chip of the cartridge, or nil for none. The
+// APU ticks the chip and mixes its output into its own.
+func (a *Apu) SetExpansion(e Expansion) {
+	a.expansion = e
+}
@@ -0,0 +1,106 @@
+package apu
+
+import (
+	"math"
+	"testing"
+)
+
+// tickAudio runs the chip for the cycles.
+func tickAudio(e Expansion, cycles int) {
+	for i := 0; i < cycles; i++ {
+		e.TickAudio()
+	}
+}
+
+// outputRange runs the chip for the cycles and returns the lowest and the
+// highest output.
+func outputRange(e Expansion, cycles int) (low, high float32) {
+	low, high = float32(math.Inf(1)), float32(math.Inf(-1))
+
+	for i := 0; i < cycles; i++ {
+		e.TickAudio()
+
+		out := e.AudioOutput()
+		if out < low {
+			low = out
+		}
+
+		if out > high {
+			high = out
+		}
+	}
+
+	return low, high
+}
+
+// checkLevel checks that the level is within the tolerance, a fraction of
+// the wanted level.
+func checkLevel(t *testing.T, name string, got, want, tolerance float64) {
+	t.Helper()
+
+	if math.Abs(got-want) > math.Abs(want)*tolerance {
+		t.Errorf("%s: got %.5f, want %.5f ±%.1f%%", name, got, want, 100*tolerance)
+	}
+}
+
+// apuPulseFull is the output of an APU pulse channel at full volume, which
+// the levels of the chips are given relative to.
+const apuPulseFull = 15 * apuPulseStep
+
+func TestExpansionsAreSilentOnPowerOn(t *testing.T) {
+	for name, e := range map[string]Expansion{
+		"VRC6":      NewVrc6(),
+		"VRC7":      NewVrc7(),
+		"FDS":       NewFds(),
+		"N163":      NewN163(),
+		"Sunsoft5B": NewSunsoft5B(),
+		"MMC5":      NewMmc5(),
+	} {
+		if low, high := outputRange(e, 100000); low != 0 || high != 0 {
+			t.Errorf("%s: got output %f to %f, want silence", name, low, high)
+		}
+	}
+}
+
+// countingExpansion counts its ticks and outputs a constant.
+type countingExpansion struct {
+	ticks int
+}
+
+func (e *countingExpansion) TickAudio() {
+	e.ticks++
+}
+
+func (e *countingExpansion) AudioOutput() float32 {
+	return 0.25
+}
+
+func TestApuTicksExpansion(t *testing.T) {
+	a := NewApu(nil, nil)
+	e := &countingExpansion{}
+	a.SetExpansion(e)
+
+	for i := 0; i < 100; i++ {
+		a.Tick()
+	}
+
+	if e.ticks != 100 {
+		t.Errorf("the expansion was ticked %d times in 100 cycles", e.ticks)
+	}
+}
+
+func TestOutputsMixExpansion(t *testing.T) {
+	levels := Levels{Pulse1: 15}
+
+	if got, want := MixedOutput.amplitude(levels, 0.25), pulseTable[15]+0.25; got != want {
+		t.Errorf("mixed: got %f, want %f", got, want)
+	}
+
+	if got := ExpansionOutput.amplitude(levels, 0.25); got != 0.25 {
+		t.Errorf("expansion: got %f, want 0.25", got)
+	}
+
+	if got := Pulse1Output.amplitude(levels, 0.25); got != pulseTable[15] {
+		t.Errorf("pulse 1: got %f, want it without the expansion", got)
+	}
+}
@@ -0,0 +1,295 @@
+package apu
+
+import "math"
+
+const (
+	// fdsStep is the output of a step of the wave times the gain at full
+	// master volume. A full-scale wave at full gain swings about 2.4 times
+	// as far as an APU pulse at full volume.
+	fdsStep = 2.4 * 15 * apuPulseStep / (63 * fdsMaxGain)
+	// fdsMaxGain is the largest gain applied to the wave and the most the
+	// envelopes ramp up to. The gain can be set up to 63 in the direct
+	// mode, but the output saturates at 32.
+	fdsMaxGain = 32
+	// fdsLowPassHz is the cutoff of the low-pass filter on the FDS's
+	// output.
+	fdsLowPassHz = 2000
+)
+
+// fdsMasterVolumes are the master volumes of $4089, 2/2, 2/3, 2/4 and 2/5,
+// in 30ths.
+var fdsMasterVolumes = [4]int{30, 20, 15, 12}
+
+// fdsModulation are the changes of the modulation counter for the entries
+// of the modulation table; the entry 4 resets the counter.
+var fdsModulation = [8]int{0, 1, 2, 4, 0, -4, -2, -1}
+
+// Fds is the sound of the Famicom Disk System: a wavetable channel playing
+// 64 6-bit samples, with a volume envelope and frequency modulation from a
+// second table. Its registers are at $4040-$408A and $4090-$4092.
+type Fds struct {
+	wave      [64]uint8
+	waveWrite bool
+	master    int
+
+	volume      fdsEnvelope
+	modEnvelope fdsEnvelope
+	// envelopeSpeed multiplies the periods of the envelopes. Zero stops
+	// them.
+	envelopeSpeed uint8
+
+	frequency  uint16
+	waveHalted bool
+	envHalted  bool
+	wavePos    uint8
+	waveAcc    uint32
+	// gain is the volume latched at the start of the wave.
+	gain int
+
+	modTable     [32]uint8
+	modPos       uint8
+	modFrequency uint16
+	modHalted    bool
+	modAcc       uint32
+	// modCounter is the signed 7-bit counter the table changes.
+	modCounter int
+
+	// out is the output through the low-pass filter.
+	out float32
+}
+
+// fdsEnvelope is the volume or the modulation envelope. In the direct mode
+// the gain is set by the register.
+type fdsEnvelope struct {
+	direct   bool
+	increase bool
+	speed    uint8
+	gain     int
+	timer    int
+}
+
+func (e *fdsEnvelope) write(data uint8) {
+	e.direct = data&0x80 != 0
+	e.increase = data&0x40 != 0
+	e.speed = data & 0x3f
+
+	if e.direct {
+		e.gain = int(e.speed)
+	}
+}
+
+// clock is called on every CPU cycle. The period of the envelope is
+// 8 * (speed+1) * the master speed.
+func (e *fdsEnvelope) clock(masterSpeed uint8) {
+	if e.direct || masterSpeed == 0 {
+		return
+	}
+
+	e.timer++
+	if e.timer < 8*(int(e.speed)+1)*int(masterSpeed) {
+		return
+	}
+
+	e.timer = 0
+
+	switch {
+	case e.increase && e.gain < fdsMaxGain:
+		e.gain++
+	case !e.increase && e.gain > 0:
+		e.gain--
+	}
+}
+
+// NewFds returns an FDS with its sound halted.
+func NewFds() *Fds {
+	return &Fds{
+		envelopeSpeed: 0xe8,
+		waveHalted:    true,
+		envHalted:     true,
+		modHalted:     true,
+	}
+}
+
+func (f *Fds) Write(addr uint16, data uint8) {
+	if addr >= 0x4040 && addr < 0x4080 {
+		if f.waveWrite {
+			f.wave[addr-0x4040] = data & 0x3f
+		}
+
+		return
+	}
+
+	switch addr {
+	case 0x4080:
+		f.volume.write(data)
+	case 0x4082:
+		f.frequency = f.frequency&0xf00 | uint16(data)
+	case 0x4083:
+		f.frequency = f.frequency&0x0ff | uint16(data&0x0f)<<8
+		f.waveHalted = data&0x80 != 0
+		f.envHalted = data&0x40 != 0
+
+		if f.waveHalted {
+			f.wavePos = 0
+			f.waveAcc = 0
+		}
+	case 0x4084:
+		f.modEnvelope.write(data)
+	case 0x4085:
+		f.modCounter = int(int8(data<<1)) >> 1
+	case 0x4086:
+		f.modFrequency = f.modFrequency&0xf00 | uint16(data)
+	case 0x4087:
+		f.modFrequency = f.modFrequency&0x0ff | uint16(data&0x0f)<<8
+		f.modHalted = data&0x80 != 0
+
+		if f.modHalted {
+			f.modAcc = 0
+		}
+	case 0x4088:
+		// The table is written two entries at a time while the modulation
+		// is halted.
+		if f.modHalted {
+			f.modTable[f.modPos] = data & 0x07
+			f.modTable[f.modPos+1] = data & 0x07
+			f.modPos = (f.modPos + 2) & 0x1f
+		}
+	case 0x4089:
+		f.waveWrite = data&0x80 != 0
+		f.master = int(data & 0x03)
+	case 0x408a:
+		f.envelopeSpeed = data
+	}
+}
+
+// Read reads the wave table at $4040-$407F and the gains of the volume and
+// the modulation envelopes at $4090 and $4092. The top two bits are open
+// bus; the mapper merges them.
+func (f *Fds) Read(addr uint16) uint8 {
+	switch {
+	case addr >= 0x4040 && addr < 0x4080:
+		return f.wave[addr-0x4040]
+	case addr == 0x4090:
+		return uint8(f.volume.gain)
+	case addr == 0x4092:
+		return uint8(f.modEnvelope.gain)
+	}
+
+	return 0
+}
+
+func (f *Fds) TickAudio() {
+	if !f.waveHalted && !f.envHalted {
+		f.volume.clock(f.envelopeSpeed)
+		f.modEnvelope.clock(f.envelopeSpeed)
+	}
+
+	f.clockModulation()
+
+	if !f.waveHalted && !f.waveWrite {
+		f.waveAcc += uint32(f.pitch())
+
+		// The wave advances a sample each time the 16-bit accumulator
+		// overflows.
+		for f.waveAcc >= 0x10000 {
+			f.waveAcc -= 0x10000
+			f.wavePos = (f.wavePos + 1) & 0x3f
+
+			if f.wavePos == 0 {
+				f.gain = f.volume.gain
+			}
+		}
+	}
+
+	var out float32
+	if !f.waveWrite {
+		gain := f.gain
+		if gain > fdsMaxGain {
+			gain = fdsMaxGain
+		}
+
+		out = float32(int(f.wave[f.wavePos])*gain*fdsMasterVolumes[f.master]/30) * fdsStep
+	}
+
+	f.out += fdsLowPassAlpha * (out - f.out)
+}
+
+// fdsLowPassAlpha is the coefficient of the FDS's low-pass filter run at the
+// CPU clock.
+var fdsLowPassAlpha = func() float32 {
+	rc := 1 / (2 * math.Pi * fdsLowPassHz)
+	dt := 1.0 / CpuFrequency
+
+	return float32(dt / (rc + dt))
+}()
+
+func (f *Fds) clockModulation() {
+	if f.modHalted || f.modFrequency == 0 {
+		return
+	}
+
+	f.modAcc += uint32(f.modFrequency)
+
+	for f.modAcc >= 0x10000 {
+		f.modAcc -= 0x10000
+
+		entry := f.modTable[f.modPos]
+		f.modPos = (f.modPos + 1) & 0x1f
+
+		if entry == 4 {
+			f.modCounter = 0
+		} else {
+			f.modCounter += fdsModulation[entry]
+		}
+
+		// The counter wraps around in 7 bits.
+		f.modCounter = int(int8(uint8(f.modCounter)<<1)) >> 1
+	}
+}
+
+// pitch returns the frequency of the wave modulated by the counter and the
+// gain of the modulation envelope, as the hardware computes it.
+func (f *Fds) pitch() int {
+	pitch := int(f.frequency)
+	if f.modHalted {
+		return pitch
+	}
+
+	temp := f.modCounter * f.modEnvelope.gain
+	remainder := temp & 0x0f
+	temp >>= 4
+
+	if remainder > 0 && temp&0x80 == 0 {
+		if f.modCounter < 0 {
+			temp--
+		} else {
+			temp += 2
+		}
+	}
+
+	switch {
+	case temp >= 192:
+		temp -= 256
+	case temp < -64:
+		temp += 256
+	}
+
+	temp *= pitch
+	remainder = temp & 0x3f
+	temp >>= 6
+
+	if remainder >= 32 {
+		temp++
+	}
+
+	pitch += temp
+	if pitch < 0 {
+		return 0
+	}
+
+	return pitch
+}
+
+func (f *Fds) AudioOutput() float32 {
+	return f.out
+}
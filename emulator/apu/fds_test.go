@@ -0,0 +1,259 @@
+package apu
+
+import "testing"
+
+func TestFdsWaveRam(t *testing.T) {
+	f := NewFds()
+
+	// The wave RAM is read-only unless enabled through $4089.
+	f.Write(0x4040, 0x3f)
+
+	if got := f.Read(0x4040); got != 0 {
+		t.Errorf("got $%02X, the write-protected wave was written", got)
+	}
+
+	f.Write(0x4089, 0x80)
+	f.Write(0x4040, 0xff)
+	f.Write(0x407f, 0x21)
+
+	if a, b := f.Read(0x4040), f.Read(0x407f); a != 0x3f || b != 0x21 {
+		t.Errorf("got $%02X $%02X, want the 6-bit samples $3F $21", a, b)
+	}
+}
+
+func TestFdsVolumeEnvelope(t *testing.T) {
+	f := NewFds()
+
+	// The direct mode sets the gain.
+	f.Write(0x4080, 0x80|0x25)
+
+	if gain := f.Read(0x4090); gain != 0x25 {
+		t.Fatalf("got gain %d, want 37", gain)
+	}
+
+	// An increasing envelope of speed 2 with the master speed 1 steps
+	// every 8*3 cycles up to 32. The envelopes run only while the wave
+	// and they are enabled.
+	f.Write(0x4080, 0x40|0x02)
+	f.Write(0x408a, 0x01)
+
+	tickAudio(f, 100)
+
+	if gain := f.Read(0x4090); gain != 0x25 {
+		t.Fatalf("the envelope ran while halted, got gain %d", gain)
+	}
+
+	f.Write(0x4080, 0x80)
+	f.Write(0x4080, 0x40|0x02)
+	f.Write(0x4083, 0x00)
+
+	tickAudio(f, 24*10-1)
+
+	if gain := f.Read(0x4090); gain != 9 {
+		t.Errorf("got gain %d a cycle before 10 steps, want 9", gain)
+	}
+
+	f.TickAudio()
+
+	if gain := f.Read(0x4090); gain != 10 {
+		t.Errorf("got gain %d after 10 steps, want 10", gain)
+	}
+
+	tickAudio(f, 24*100)
+
+	if gain := f.Read(0x4090); gain != fdsMaxGain {
+		t.Errorf("got gain %d, want the envelope to stop at %d", gain, fdsMaxGain)
+	}
+
+	// A decreasing one.
+	f.Write(0x4080, 0x00|0x02)
+	tickAudio(f, 24*5)
+
+	if gain := f.Read(0x4090); gain != fdsMaxGain-5 {
+		t.Errorf("got gain %d after 5 steps down, want %d", gain, fdsMaxGain-5)
+	}
+
+	// The master speed 0 stops the envelopes.
+	f.Write(0x408a, 0x00)
+	tickAudio(f, 24*5)
+
+	if gain := f.Read(0x4090); gain != fdsMaxGain-5 {
+		t.Errorf("got gain %d with the envelopes stopped", gain)
+	}
+}
+
+// setupFdsWave fills the wave RAM with the samples and starts the wave at the
+// frequency with the gain.
+func setupFdsWave(f *Fds, samples func(i int) uint8, frequency uint16, gain uint8) {
+	f.Write(0x4089, 0x80)
+
+	for i := 0; i < 64; i++ {
+		f.Write(0x4040+uint16(i), samples(i))
+	}
+
+	f.Write(0x4089, 0x00)
+	f.Write(0x4080, 0x80|gain)
+	f.Write(0x4082, uint8(frequency))
+	f.Write(0x4083, uint8(frequency>>8&0x0f))
+}
+
+func TestFdsWavePitch(t *testing.T) {
+	f := NewFds()
+	setupFdsWave(f, func(i int) uint8 { return uint8(i) }, 0x400, 0x20)
+
+	// The 16-bit accumulator adds the frequency every cycle and the wave
+	// steps on its overflows, every $10000/$400 = 64 cycles.
+	for step := 1; step <= 70; step++ {
+		tickAudio(f, 64)
+
+		if f.wavePos != uint8(step)&0x3f {
+			t.Fatalf("got position %d after %d*64 cycles", f.wavePos, step)
+		}
+	}
+
+	// Halting the wave resets its position.
+	f.Write(0x4083, 0x80)
+
+	if f.wavePos != 0 {
+		t.Errorf("got position %d after halting the wave", f.wavePos)
+	}
+}
+
+func TestFdsLevel(t *testing.T) {
+	f := NewFds()
+	setupFdsWave(f, func(int) uint8 { return 63 }, 0xfff, fdsMaxGain)
+
+	// The gain is latched at the start of the wave, and the filter
+	// settles in a few thousand cycles.
+	tickAudio(f, 20000)
+
+	// A full-scale wave at full gain is about 2.4 times as loud as an APU
+	// pulse at full volume.
+	full := float64(f.AudioOutput())
+	checkLevel(t, "full scale", full, 2.4*apuPulseFull, 1e-3)
+
+	// The gain saturates at 32.
+	f.Write(0x4080, 0x80|0x3f)
+	tickAudio(f, 20000)
+	checkLevel(t, "gain 63", float64(f.AudioOutput()), full, 1e-3)
+
+	// The master volumes are 2/2, 2/3, 2/4 and 2/5.
+	for master, want := range []float64{1, 2.0 / 3, 2.0 / 4, 2.0 / 5} {
+		f.Write(0x4089, uint8(master))
+		tickAudio(f, 20000)
+		checkLevel(t, "master volume", float64(f.AudioOutput()), want*full, 1e-2)
+	}
+
+	// Enabling the wave writes silences the wave.
+	f.Write(0x4089, 0x80)
+	tickAudio(f, 20000)
+
+	if out := f.AudioOutput(); out > 1e-6 {
+		t.Errorf("got %f while writing the wave", out)
+	}
+}
+
+func TestFdsModulationTable(t *testing.T) {
+	f := NewFds()
+
+	// The table is written two entries at a time while the modulation is
+	// halted.
+	f.Write(0x4087, 0x80)
+
+	for _, entry := range []uint8{1, 2, 4, 7, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0} {
+		f.Write(0x4088, entry)
+	}
+
+	want := [32]uint8{1, 1, 2, 2, 4, 4, 7, 7}
+	if f.modTable != want {
+		t.Fatalf("got table %v", f.modTable)
+	}
+
+	f.Write(0x4085, 0x05)
+
+	// A frequency of $800 steps the table every 32 cycles.
+	f.Write(0x4086, 0x00)
+	f.Write(0x4087, 0x08)
+
+	f.Write(0x4088, 0x03)
+
+	if f.modTable != want {
+		t.Errorf("the table was written while the modulation runs")
+	}
+
+	// The counter changes by +1, +1, +2, +2, resets, resets, -1, -1.
+	for i, counter := range []int{6, 7, 9, 11, 0, 0, -1, -2, -2} {
+		tickAudio(f, 32)
+
+		if f.modCounter != counter {
+			t.Errorf("step %d: got counter %d, want %d", i, f.modCounter, counter)
+		}
+	}
+}
+
+func TestFdsModulationCounterWraps(t *testing.T) {
+	f := NewFds()
+	f.Write(0x4087, 0x80)
+
+	for i := 0; i < 16; i++ {
+		f.Write(0x4088, 0x01)
+	}
+
+	f.Write(0x4085, 0x3f)
+	f.Write(0x4087, 0x08)
+
+	tickAudio(f, 32)
+
+	// The counter is a signed 7-bit value.
+	if f.modCounter != -64 {
+		t.Errorf("got counter %d after 63+1, want -64", f.modCounter)
+	}
+
+	// Writes are sign extended from 7 bits.
+	f.Write(0x4085, 0x7f)
+
+	if f.modCounter != -1 {
+		t.Errorf("got counter %d after writing $7F, want -1", f.modCounter)
+	}
+}
+
+func TestFdsModulatedPitch(t *testing.T) {
+	f := NewFds()
+	f.Write(0x4082, 0x00)
+	f.Write(0x4083, 0x01)
+	f.Write(0x4087, 0x00)
+
+	for _, test := range []struct {
+		counter uint8
+		gain    uint8
+		pitch   int
+	}{
+		{0x00, 0x20, 0x100},
+		// The counter times the gain /16, times the frequency /64: the
+		// pitch rises by 2*256/64.
+		{0x01, 0x20, 0x108},
+		{0x7f, 0x20, 0xf8},
+		{0x03, 0x20, 0x118},
+		// A positive remainder of the product rounds it up by two, a
+		// negative one is truncated.
+		{0x01, 0x01, 0x108},
+		{0x7f, 0x01, 0xfc},
+		// 63*63/16 = 248 wraps to -8.
+		{0x3f, 0x3f, 0xe0},
+	} {
+		f.Write(0x4084, 0x80|test.gain)
+		f.Write(0x4085, test.counter)
+
+		if got := f.pitch(); got != test.pitch {
+			t.Errorf("counter $%02X, gain %d: got pitch $%X, want $%X", test.counter, test.gain, got, test.pitch)
+		}
+	}
+
+	// Halting the modulation unmodulates the pitch.
+	f.Write(0x4085, 0x01)
+	f.Write(0x4087, 0x80)
+
+	if got := f.pitch(); got != 0x100 {
+		t.Errorf("got pitch $%X with the modulation halted", got)
+	}
+}
@@ -0,0 +1,100 @@
+package apu
+
+// The steps of the frame counter sequences in CPU cycles (NTSC), counted
+// from the start of the sequence.
+const (
+	firstQuarterFrame = 7457
+	firstHalfFrame    = 14913
+	thirdQuarterFrame = 22371
+	// The 4-step sequence sets the IRQ flag on three consecutive cycles,
+	// clocking the last half frame on the middle one.
+	fourStepIrqStart  = 29828
+	fourStepHalfFrame = 29829
+	fourStepLength    = 29830
+	fiveStepHalfFrame = 37281
+	fiveStepLength    = 37282
+)
+
+// frameCounter clocks the envelopes and the linear counter on the quarter
+// frames, and the length counters and the sweep units on the half frames,
+// in either a 4-step sequence that can raise an IRQ at its end or a 5-step
+// sequence that can't.
+type frameCounter struct {
+	fiveStep   bool
+	irqInhibit bool
+	irqFlag    bool
+	cycle      int
+	// resetDelay is the number of cycles until a write to $4017 restarts
+	// the sequence, or zero if none is pending.
+	resetDelay int
+}
+
+// write writes $4017, MI-- ----. The sequence restarts 3 CPU cycles after
+// the write if it lands on an APU cycle and 4 cycles after otherwise.
+func (f *frameCounter) write(data uint8, apuCycle bool) {
+	f.fiveStep = data&0x80 != 0
+	f.irqInhibit = data&0x40 != 0
+
+	if f.irqInhibit {
+		f.irqFlag = false
+	}
+
+	f.resetDelay = 4
+	if apuCycle {
+		f.resetDelay = 3
+	}
+}
+
+// tick advances the frame counter by a CPU cycle and tells whether a
+// quarter frame and a half frame are clocked on it.
+func (f *frameCounter) tick() (quarter, half bool) {
+	if f.resetDelay > 0 {
+		f.resetDelay--
+
+		if f.resetDelay == 0 {
+			f.cycle = 0
+
+			// Switching to the 5-step sequence clocks the units at once.
+			return f.fiveStep, f.fiveStep
+		}
+	}
+
+	f.cycle++
+
+	switch f.cycle {
+	case firstQuarterFrame, thirdQuarterFrame:
+		return true, false
+	case firstHalfFrame:
+		return true, true
+	}
+
+	if f.fiveStep {
+		switch f.cycle {
+		case fiveStepHalfFrame:
+			return true, true
+		case fiveStepLength:
+			f.cycle = 0
+		}
+
+		return false, false
+	}
+
+	switch f.cycle {
+	case fourStepIrqStart:
+		f.raiseIrq()
+	case fourStepHalfFrame:
+		f.raiseIrq()
+		return true, true
+	case fourStepLength:
+		f.raiseIrq()
+		f.cycle = 0
+	}
+
+	return false, false
+}
+
+func (f *frameCounter) raiseIrq() {
+	if !f.irqInhibit {
+		f.irqFlag = true
+	}
+}
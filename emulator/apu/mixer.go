@@ -0,0 +1,29 @@
+package apu
+
+// The mixer of the 2A03 is a resistor network whose output is not linear in
+// the channel levels: the louder the other channels, the quieter a channel.
+// It is emulated with the two lookup tables of the usual approximation,
+//
+//	pulse = 95.52 / (8128 / (pulse1 + pulse2) + 100)
+//	tnd   = 163.67 / (24329 / (3*triangle + 2*noise + dmc) + 100)
+//
+// whose sum is the output, 0 to about 1.
+var (
+	pulseTable [31]float32
+	tndTable   [203]float32
+)
+
+func init() {
+	for i := 1; i < len(pulseTable); i++ {
+		pulseTable[i] = float32(95.52 / (8128.0/float64(i) + 100))
+	}
+
+	for i := 1; i < len(tndTable); i++ {
+		tndTable[i] = float32(163.67 / (24329.0/float64(i) + 100))
+	}
+}
+
+// mix returns the output of the mixer for the levels of the channels.
+func mix(l Levels) float32 {
+	return pulseTable[l.Pulse1+l.Pulse2] + tndTable[3*int(l.Triangle)+2*int(l.Noise)+int(l.Dmc)]
+}
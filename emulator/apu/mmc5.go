@@ -0,0 +1,136 @@
+package apu
+
+// mmc5FramePeriod is the number of CPU cycles between the clocks of the
+// MMC5's envelopes and length counters, which run at a fixed 240 Hz instead
+// of following the APU's frame counter.
+const mmc5FramePeriod = 7457
+
+// Mmc5 is the sound of the Nintendo MMC5: two pulse channels like the APU's
+// but without the sweep, and an 8-bit PCM channel. Its registers are at
+// $5000-$5015.
+//
+// In the PCM read mode the channel plays the bytes the CPU reads from
+// $8000-$BFFF, which the mapper passes to PcmRead.
+type Mmc5 struct {
+	pulse1 pulse
+	pulse2 pulse
+
+	cycles     uint64
+	frameTimer int
+
+	pcm           uint8
+	pcmReadMode   bool
+	pcmIrqEnabled bool
+	pcmIrq        bool
+}
+
+// NewMmc5 returns an MMC5 with its channels disabled.
+func NewMmc5() *Mmc5 {
+	return &Mmc5{
+		pulse1: pulse{sweepless: true},
+		pulse2: pulse{sweepless: true},
+	}
+}
+
+func (m *Mmc5) Write(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x5000 && addr < 0x5004:
+		m.pulse1.write(addr&0x03, data)
+	case addr >= 0x5004 && addr < 0x5008:
+		m.pulse2.write(addr&0x03, data)
+	case addr == 0x5010:
+		m.pcmReadMode = data&0x01 != 0
+		m.pcmIrqEnabled = data&0x80 != 0
+	case addr == 0x5011:
+		// A zero can't be written; it's the end marker of the read mode.
+		if !m.pcmReadMode && data != 0 {
+			m.pcm = data
+		}
+	case addr == 0x5015:
+		m.pulse1.length.setEnabled(data&0x01 != 0)
+		m.pulse2.length.setEnabled(data&0x02 != 0)
+	}
+}
+
+// Read reads $5010, I--- ---M, whose IRQ flag reading clears, and $5015,
+// ---- --21, the pulse channels whose length counters are non-zero.
+func (m *Mmc5) Read(addr uint16) uint8 {
+	switch addr {
+	case 0x5010:
+		var data uint8
+
+		if m.pcmIrq {
+			data |= 0x80
+		}
+
+		if m.pcmReadMode {
+			data |= 0x01
+		}
+
+		m.pcmIrq = false
+
+		return data
+	case 0x5015:
+		var data uint8
+
+		if m.pulse1.length.active() {
+			data |= 0x01
+		}
+
+		if m.pulse2.length.active() {
+			data |= 0x02
+		}
+
+		return data
+	}
+
+	return 0
+}
+
+// PcmRead is called by the mapper with every byte the CPU reads from
+// $8000-$BFFF. In the read mode it's played; a zero raises the IRQ instead.
+func (m *Mmc5) PcmRead(data uint8) {
+	if !m.pcmReadMode {
+		return
+	}
+
+	if data == 0 {
+		m.pcmIrq = true
+		return
+	}
+
+	m.pcm = data
+}
+
+// IrqLine tells whether the PCM channel asserts the IRQ line. The mapper
+// combines it with its scanline IRQ.
+func (m *Mmc5) IrqLine() bool {
+	return m.pcmIrq && m.pcmIrqEnabled
+}
+
+func (m *Mmc5) TickAudio() {
+	m.cycles++
+
+	if m.cycles%2 == 0 {
+		m.pulse1.clockTimer()
+		m.pulse2.clockTimer()
+	}
+
+	m.frameTimer++
+	if m.frameTimer < mmc5FramePeriod {
+		return
+	}
+
+	m.frameTimer = 0
+
+	for _, p := range []*pulse{&m.pulse1, &m.pulse2} {
+		p.envelope.clock()
+		p.length.clock()
+	}
+}
+
+// AudioOutput mixes the pulse channels like the APU's and the PCM channel
+// about as loud as the DMC at the same level.
+func (m *Mmc5) AudioOutput() float32 {
+	return pulseTable[m.pulse1.output()+m.pulse2.output()] + tndTable[m.pcm>>1]
+}
@@ -0,0 +1,149 @@
+package apu
+
+import "testing"
+
+func TestMmc5PulseLevel(t *testing.T) {
+	m := NewMmc5()
+	m.Write(0x5015, 0x01)
+	// 50% duty, halted length counter, constant volume 15.
+	m.Write(0x5000, 0xbf)
+	// A period below 8, which would mute an APU pulse through its sweep.
+	m.Write(0x5002, 0x02)
+	m.Write(0x5003, 0x08)
+
+	low, high := outputRange(m, 64)
+
+	// The pulses are mixed like the APU's.
+	if low != 0 || high != pulseTable[15] {
+		t.Errorf("got %f to %f, want 0 to %f", low, high, pulseTable[15])
+	}
+
+	m.Write(0x5015, 0x03)
+	m.Write(0x5004, 0xbf)
+	m.Write(0x5006, 0x02)
+	m.Write(0x5007, 0x08)
+
+	if _, high := outputRange(m, 64); high != pulseTable[30] {
+		t.Errorf("got %f with both pulses, want %f", high, pulseTable[30])
+	}
+}
+
+func TestMmc5LengthCounters(t *testing.T) {
+	m := NewMmc5()
+
+	// Loading a disabled channel's counter does nothing.
+	m.Write(0x5003, 0x18)
+
+	if status := m.Read(0x5015); status != 0x00 {
+		t.Fatalf("got status $%02X before enabling the channels", status)
+	}
+
+	m.Write(0x5015, 0x03)
+	m.Write(0x5000, 0x1f)
+	// The length index 3 is 2 frames.
+	m.Write(0x5003, 0x18)
+	m.Write(0x5004, 0x1f)
+	m.Write(0x5007, 0x08)
+
+	if status := m.Read(0x5015); status != 0x03 {
+		t.Fatalf("got status $%02X, want both pulses active", status)
+	}
+
+	// The counters are clocked at 240 Hz, not by the APU's frame counter.
+	tickAudio(m, 2*mmc5FramePeriod-1)
+
+	if status := m.Read(0x5015); status != 0x03 {
+		t.Errorf("got status $%02X a cycle before the second clock", status)
+	}
+
+	m.TickAudio()
+
+	if status := m.Read(0x5015); status != 0x02 {
+		t.Errorf("got status $%02X after two clocks, want the second pulse only", status)
+	}
+
+	m.Write(0x5015, 0x00)
+
+	if status := m.Read(0x5015); status != 0x00 {
+		t.Errorf("got status $%02X after disabling the channels", status)
+	}
+}
+
+func TestMmc5Envelope(t *testing.T) {
+	m := NewMmc5()
+	m.Write(0x5015, 0x01)
+	// 75% duty, halted length counter, decaying envelope of period 0.
+	m.Write(0x5000, 0xe0)
+	m.Write(0x5003, 0x08)
+
+	// The first clock starts the decay from 15, every clock after it
+	// decays a step.
+	for clock := 1; clock <= 3; clock++ {
+		tickAudio(m, mmc5FramePeriod)
+
+		if got, want := m.pulse1.envelope.volume(), uint8(16-clock); got != want {
+			t.Errorf("clock %d: got volume %d, want %d", clock, got, want)
+		}
+	}
+}
+
+func TestMmc5Pcm(t *testing.T) {
+	m := NewMmc5()
+
+	m.Write(0x5011, 0x80)
+
+	if got := m.AudioOutput(); got != tndTable[0x40] {
+		t.Errorf("got %f, want the PCM level of $80, %f", got, tndTable[0x40])
+	}
+
+	// A zero can't be written.
+	m.Write(0x5011, 0x00)
+
+	if got := m.AudioOutput(); got != tndTable[0x40] {
+		t.Errorf("got %f after writing a zero", got)
+	}
+
+	// The read mode plays the bytes read and ignores the writes.
+	m.Write(0x5010, 0x81)
+	m.Write(0x5011, 0x10)
+	m.PcmRead(0x20)
+
+	if got := m.AudioOutput(); got != tndTable[0x10] {
+		t.Errorf("got %f, want the level of the byte read, %f", got, tndTable[0x10])
+	}
+
+	if m.IrqLine() {
+		t.Fatal("the IRQ is asserted before a zero is read")
+	}
+
+	// A zero raises the IRQ, which reading $5010 acknowledges.
+	m.PcmRead(0x00)
+
+	if !m.IrqLine() {
+		t.Fatal("the IRQ isn't asserted after a zero is read")
+	}
+
+	if got := m.AudioOutput(); got != tndTable[0x10] {
+		t.Errorf("got %f, the zero changed the level", got)
+	}
+
+	if status := m.Read(0x5010); status != 0x81 {
+		t.Errorf("got $5010 $%02X, want $81", status)
+	}
+
+	if m.IrqLine() {
+		t.Error("the IRQ is asserted after reading $5010")
+	}
+
+	if status := m.Read(0x5010); status != 0x01 {
+		t.Errorf("got $5010 $%02X after the acknowledgement, want $01", status)
+	}
+
+	// Without the IRQ enabled the flag is set but the line isn't asserted.
+	m.Write(0x5010, 0x01)
+	m.PcmRead(0x00)
+
+	if m.IrqLine() {
+		t.Error("the IRQ is asserted while disabled")
+	}
+}
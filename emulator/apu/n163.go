@@ -0,0 +1,144 @@
+package apu
+
+const (
+	// n163UpdateCycles is the number of CPU cycles the N163 spends updating
+	// a channel.
+	n163UpdateCycles = 15
+	// n163ChannelRegisters is the address of the registers of the first
+	// channel in the internal RAM; channel 7's are at the end of it.
+	n163ChannelRegisters = 0x40
+	// n163Step is the output of a step of the sample times the volume. A
+	// single channel at full volume swings about 2.5 times as far as an
+	// APU pulse at full volume; the level varies a lot between boards.
+	n163Step = 2.5 * 15 * apuPulseStep / 225
+)
+
+// N163 is the sound of the Namco 163: up to eight wavetable channels
+// playing 4-bit samples from the chip's 128 bytes of RAM, which also holds
+// their registers. The RAM is accessed through the address port at
+// $F800-$FFFF and the data port at $4800-$4FFF; bit 6 of $E000-$E7FF
+// disables the sound.
+//
+// The chip updates one channel at a time and outputs only that channel, so
+// the more channels are enabled, the quieter and the more aliased they are.
+type N163 struct {
+	ram [128]uint8
+
+	addr          uint8
+	autoIncrement bool
+	disabled      bool
+
+	timer int
+	// channel is the channel being updated and output.
+	channel int
+	out     int
+}
+
+// NewN163 returns an N163 with a cleared RAM.
+func NewN163() *N163 {
+	return &N163{}
+}
+
+// RAM returns the internal RAM of the chip, which some boards back with a
+// battery for saves.
+func (n *N163) RAM() []uint8 {
+	return n.ram[:]
+}
+
+func (n *N163) Write(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x4800 && addr < 0x5000:
+		n.ram[n.addr] = data
+		n.advance()
+	case addr >= 0xe000 && addr < 0xe800:
+		n.disabled = data&0x40 != 0
+	case addr >= 0xf800:
+		n.addr = data & 0x7f
+		n.autoIncrement = data&0x80 != 0
+	}
+}
+
+// Read reads the data port.
+func (n *N163) Read(addr uint16) uint8 {
+	if addr < 0x4800 || addr >= 0x5000 {
+		return 0
+	}
+
+	data := n.ram[n.addr]
+	n.advance()
+
+	return data
+}
+
+func (n *N163) advance() {
+	if n.autoIncrement {
+		n.addr = (n.addr + 1) & 0x7f
+	}
+}
+
+// channels returns the number of enabled channels, from the top bits of
+// the last register. The channels enabled are the last ones.
+func (n *N163) channels() int {
+	return int(n.ram[0x7f]>>4&0x07) + 1
+}
+
+func (n *N163) TickAudio() {
+	n.timer++
+	if n.timer < n163UpdateCycles {
+		return
+	}
+
+	n.timer = 0
+
+	if n.disabled {
+		n.out = 0
+		return
+	}
+
+	first := 8 - n.channels()
+	if n.channel < first {
+		n.channel = first
+	}
+
+	n.out = n.update(n.channel)
+
+	n.channel++
+	if n.channel == 8 {
+		n.channel = first
+	}
+}
+
+// update advances the phase of the channel and returns its output, the
+// sample centered on zero times the volume.
+//
+// The registers of a channel are the frequency low, phase low, frequency
+// middle, phase middle, LLLL LLFF for the length and the frequency high,
+// phase high, the wave address in samples and the volume.
+func (n *N163) update(channel int) int {
+	regs := n.ram[n163ChannelRegisters+8*channel : n163ChannelRegisters+8*channel+8]
+
+	frequency := uint32(regs[4]&0x03)<<16 | uint32(regs[2])<<8 | uint32(regs[0])
+	phase := uint32(regs[5])<<16 | uint32(regs[3])<<8 | uint32(regs[1])
+	length := 256 - uint32(regs[4]&0xfc)
+
+	phase = (phase + frequency) % (length << 16)
+
+	regs[1] = uint8(phase)
+	regs[3] = uint8(phase >> 8)
+	regs[5] = uint8(phase >> 16)
+
+	index := uint8(phase>>16) + regs[6]
+
+	sample := n.ram[index>>1&0x7f]
+	if index&1 == 0 {
+		sample &= 0x0f
+	} else {
+		sample >>= 4
+	}
+
+	return (int(sample) - 8) * int(regs[7]&0x0f)
+}
+
+func (n *N163) AudioOutput() float32 {
+	return float32(n.out) * n163Step
+}
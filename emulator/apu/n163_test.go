@@ -0,0 +1,141 @@
+package apu
+
+import "testing"
+
+// writeN163 writes the data to the N163's RAM from the address on.
+func writeN163(n *N163, addr uint8, data ...uint8) {
+	n.Write(0xf800, 0x80|addr)
+
+	for _, d := range data {
+		n.Write(0x4800, d)
+	}
+}
+
+func TestN163RamPorts(t *testing.T) {
+	n := NewN163()
+	writeN163(n, 0x7e, 0x12, 0x34, 0x56)
+
+	// The address wraps around in 7 bits.
+	if got := n.RAM()[0x7e:]; got[0] != 0x12 || got[1] != 0x34 || n.RAM()[0x00] != 0x56 {
+		t.Fatalf("got RAM % X ... % X", n.RAM()[:1], got)
+	}
+
+	// Without the auto-increment the address stays.
+	n.Write(0xf800, 0x7e)
+
+	if a, b := n.Read(0x4800), n.Read(0x4fff); a != 0x12 || b != 0x12 {
+		t.Errorf("got $%02X $%02X without auto-increment, want $12 $12", a, b)
+	}
+
+	n.Write(0xf800, 0xfe)
+
+	if a, b := n.Read(0x4800), n.Read(0x4800); a != 0x12 || b != 0x34 {
+		t.Errorf("got $%02X $%02X with auto-increment, want $12 $34", a, b)
+	}
+
+	if got := n.Read(0x5000); got != 0 {
+		t.Errorf("got $%02X outside of the data port", got)
+	}
+}
+
+// setupN163Channel sets up a channel playing a 4 sample wave, a sample per
+// update, at the volume.
+func setupN163Channel(n *N163, channel int, wave uint8, volume uint8) {
+	regs := uint8(n163ChannelRegisters + 8*channel)
+
+	// A frequency of $10000 advances the phase a sample per update; the
+	// length is 256-252 samples.
+	writeN163(n, regs, 0x00, 0x00, 0x00, 0x00, 0xfc|0x01, 0x00, wave, volume)
+}
+
+func TestN163Wave(t *testing.T) {
+	n := NewN163()
+
+	// The samples 0, F, 4, 8 at the sample address 0, low nibble first.
+	writeN163(n, 0x00, 0xf0, 0x84)
+	setupN163Channel(n, 7, 0x00, 0x0f)
+
+	// The phase is advanced before the sample is output, so the first
+	// update outputs the second sample. The samples are centered on 8.
+	want := []int{7 * 15, -4 * 15, 0, -8 * 15}
+
+	for update := 0; update < 2*len(want); update++ {
+		tickAudio(n, n163UpdateCycles-1)
+
+		if update > 0 && n.AudioOutput() != float32(want[(update-1)%len(want)])*n163Step {
+			t.Errorf("update %d: the output changed before the update", update)
+		}
+
+		n.TickAudio()
+
+		if got := n.AudioOutput(); got != float32(want[update%len(want)])*n163Step {
+			t.Errorf("update %d: got %f, want %d steps", update, got, want[update%len(want)])
+		}
+	}
+
+	// The channel's phase is kept in its registers.
+	if phase := n.RAM()[0x7d]; phase != uint8(2*len(want))%4 {
+		t.Errorf("got phase %d", phase)
+	}
+}
+
+func TestN163TimeMultiplexing(t *testing.T) {
+	n := NewN163()
+
+	// A constant wave of F at the sample address 0 and of 0 at 8.
+	writeN163(n, 0x00, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00)
+	setupN163Channel(n, 6, 0x00, 0x0f)
+	// Two channels enabled, 6 and 7.
+	setupN163Channel(n, 7, 0x08, 0x1f)
+
+	for update := 0; update < 8; update++ {
+		tickAudio(n, n163UpdateCycles)
+
+		// The channels are updated and output one at a time.
+		want := 7 * 15
+		if update%2 == 1 {
+			want = -8 * 15
+		}
+
+		if got := n.AudioOutput(); got != float32(want)*n163Step {
+			t.Errorf("update %d: got %f, want %d steps", update, got, want)
+		}
+	}
+
+	// Channel 5 isn't enabled.
+	if phase := n.RAM()[n163ChannelRegisters+8*5+5]; phase != 0 {
+		t.Errorf("a disabled channel was updated")
+	}
+}
+
+func TestN163Disable(t *testing.T) {
+	n := NewN163()
+	writeN163(n, 0x00, 0xff, 0xff)
+	setupN163Channel(n, 7, 0x00, 0x0f)
+
+	tickAudio(n, n163UpdateCycles)
+
+	if n.AudioOutput() == 0 {
+		t.Fatal("the channel is silent")
+	}
+
+	n.Write(0xe000, 0x40)
+	tickAudio(n, n163UpdateCycles)
+
+	if got := n.AudioOutput(); got != 0 {
+		t.Errorf("got %f with the sound disabled", got)
+	}
+}
+
+func TestN163Level(t *testing.T) {
+	n := NewN163()
+	// Samples 0 and F.
+	writeN163(n, 0x00, 0xf0, 0xf0)
+	setupN163Channel(n, 7, 0x00, 0x0f)
+
+	low, high := outputRange(n, 4*n163UpdateCycles)
+
+	// A single channel at full volume swings about 2.5 times as far as an
+	// APU pulse at full volume.
+	checkLevel(t, "swing", float64(high-low), 2.5*apuPulseFull, 1e-6)
+}
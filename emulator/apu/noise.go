@@ -0,0 +1,64 @@
+package apu
+
+// noisePeriods are the periods of the noise channel in CPU cycles (NTSC).
+var noisePeriods = [16]uint16{
+	4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068,
+}
+
+// noise is the pseudo-random noise channel, $400C-$400F. The noise comes
+// from a 15-bit linear feedback shift register, which in the short mode
+// taps bit 6 instead of bit 1 for a metallic 93-step sequence.
+type noise struct {
+	length   lengthCounter
+	envelope envelope
+
+	shortMode bool
+	shift     uint16
+	period    uint16
+	timer     uint16
+}
+
+func newNoise() noise {
+	return noise{shift: 1, period: noisePeriods[0]}
+}
+
+func (n *noise) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		n.length.halt = data&0x20 != 0
+		n.envelope.write(data)
+	case 2:
+		n.shortMode = data&0x80 != 0
+		n.period = noisePeriods[data&0x0f]
+	case 3:
+		n.length.load(data)
+		n.envelope.start = true
+	}
+}
+
+// clockTimer is called on every CPU cycle.
+func (n *noise) clockTimer() {
+	if n.timer > 0 {
+		n.timer--
+		return
+	}
+
+	n.timer = n.period - 1
+
+	tap := uint16(1)
+	if n.shortMode {
+		tap = 6
+	}
+
+	feedback := (n.shift ^ n.shift>>tap) & 1
+	n.shift = n.shift>>1 | feedback<<14
+}
+
+// output returns the level of the channel, 0-15.
+func (n *noise) output() uint8 {
+	if !n.length.active() || n.shift&1 != 0 {
+		return 0
+	}
+
+	return n.envelope.volume()
+}
@@ -0,0 +1,122 @@
+package apu
+
+// dutyTable holds the waveforms of the four duty cycles of the pulse
+// channels, 12.5%, 25%, 50% and 25% negated.
+var dutyTable = [4][8]uint8{
+	{0, 1, 0, 0, 0, 0, 0, 0},
+	{0, 1, 1, 0, 0, 0, 0, 0},
+	{0, 1, 1, 1, 1, 0, 0, 0},
+	{1, 0, 0, 1, 1, 1, 1, 1},
+}
+
+// pulse is one of the two square wave channels, $4000-$4003 and
+// $4004-$4007.
+type pulse struct {
+	// onesComplement is set for the first pulse channel, whose sweep unit
+	// negates with one's complement and so subtracts one more than the
+	// second channel's.
+	onesComplement bool
+	// sweepless is set for the pulse channels of the MMC5, which have no
+	// sweep unit and so are never muted by it.
+	sweepless bool
+
+	length   lengthCounter
+	envelope envelope
+
+	duty     uint8
+	sequence uint8
+	period   uint16
+	timer    uint16
+
+	sweepEnabled bool
+	sweepPeriod  uint8
+	sweepNegate  bool
+	sweepShift   uint8
+	sweepDivider uint8
+	sweepReload  bool
+}
+
+func (p *pulse) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		p.duty = data >> 6
+		p.length.halt = data&0x20 != 0
+		p.envelope.write(data)
+	case 1:
+		p.sweepEnabled = data&0x80 != 0
+		p.sweepPeriod = data >> 4 & 0x07
+		p.sweepNegate = data&0x08 != 0
+		p.sweepShift = data & 0x07
+		p.sweepReload = true
+	case 2:
+		p.period = p.period&0x700 | uint16(data)
+	case 3:
+		p.period = p.period&0xff | uint16(data&0x07)<<8
+		p.length.load(data)
+		p.sequence = 0
+		p.envelope.start = true
+	}
+}
+
+// clockTimer is called on every APU cycle, every other CPU cycle.
+func (p *pulse) clockTimer() {
+	if p.timer > 0 {
+		p.timer--
+		return
+	}
+
+	p.timer = p.period
+	p.sequence = (p.sequence + 1) & 0x07
+}
+
+// targetPeriod returns the period the sweep unit would set.
+func (p *pulse) targetPeriod() uint16 {
+	change := p.period >> p.sweepShift
+
+	if !p.sweepNegate {
+		return p.period + change
+	}
+
+	if p.onesComplement {
+		change++
+	}
+
+	if change > p.period {
+		return 0
+	}
+
+	return p.period - change
+}
+
+// muted tells whether the sweep unit silences the channel. It does so even
+// when the sweep is disabled.
+func (p *pulse) muted() bool {
+	if p.sweepless {
+		return false
+	}
+
+	return p.period < 8 || p.targetPeriod() > 0x7ff
+}
+
+// clockSweep is called on the half frames.
+func (p *pulse) clockSweep() {
+	if p.sweepDivider == 0 && p.sweepEnabled && p.sweepShift > 0 && !p.muted() {
+		p.period = p.targetPeriod()
+	}
+
+	if p.sweepDivider == 0 || p.sweepReload {
+		p.sweepDivider = p.sweepPeriod
+		p.sweepReload = false
+	} else {
+		p.sweepDivider--
+	}
+}
+
+// output returns the level of the channel, 0-15.
+func (p *pulse) output() uint8 {
+	if !p.length.active() || p.muted() || dutyTable[p.duty][p.sequence] == 0 {
+		return 0
+	}
+
+	return p.envelope.volume()
+}
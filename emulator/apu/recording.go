@@ -0,0 +1,145 @@
+package apu
+
+import "fmt"
+
+// Output is an output of the APU a recording records: the mixed output, or
+// a channel alone. The expansion output is the sound chip of the cartridge.
+type Output int
+
+const (
+	MixedOutput Output = iota
+	Pulse1Output
+	Pulse2Output
+	TriangleOutput
+	NoiseOutput
+	DmcOutput
+	ExpansionOutput
+)
+
+// Stems are the outputs of the channels alone.
+var Stems = []Output{Pulse1Output, Pulse2Output, TriangleOutput, NoiseOutput, DmcOutput, ExpansionOutput}
+
+var outputNames = map[Output]string{
+	MixedOutput:     "mixed",
+	Pulse1Output:    "pulse1",
+	Pulse2Output:    "pulse2",
+	TriangleOutput:  "triangle",
+	NoiseOutput:     "noise",
+	DmcOutput:       "dmc",
+	ExpansionOutput: "expansion",
+}
+
+func (o Output) String() string {
+	if name, ok := outputNames[o]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// amplitude returns the output for the levels and the output of the
+// expansion chip. A channel alone goes through the mixer with the other
+// channels silent, so its stem sounds like it does in the mix, apart from the
+// non-linearity of the mixer.
+func (o Output) amplitude(l Levels, expansion float32) float32 {
+	switch o {
+	case Pulse1Output:
+		return pulseTable[l.Pulse1]
+	case Pulse2Output:
+		return pulseTable[l.Pulse2]
+	case TriangleOutput:
+		return tndTable[3*int(l.Triangle)]
+	case NoiseOutput:
+		return tndTable[2*int(l.Noise)]
+	case DmcOutput:
+		return tndTable[l.Dmc]
+	case ExpansionOutput:
+		return expansion
+	default:
+		return mix(l) + expansion
+	}
+}
+
+// SampleWriter is where a recording writes its samples. *wav.Writer
+// implements it.
+type SampleWriter interface {
+	WriteSamples(samples []float32) error
+}
+
+// recordingBufferSize is the number of samples a recording passes to its
+// writer at a time.
+const recordingBufferSize = 4096
+
+// Recording records an output of the APU. The samples are produced like
+// the ones of ReadSamples, but none are dropped.
+type Recording struct {
+	output    Output
+	resampler *resampler
+	w         SampleWriter
+	buf       []float32
+	// err is the first error of the writer. The samples after it are
+	// discarded.
+	err error
+}
+
+// Record starts recording the output at the sample rate in Hz to w. The
+// recording runs until StopRecording.
+func (a *Apu) Record(output Output, rate int, w SampleWriter) (*Recording, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d Hz", rate)
+	}
+
+	r := &Recording{
+		output:    output,
+		resampler: newResampler(rate),
+		w:         w,
+		buf:       make([]float32, 0, recordingBufferSize),
+	}
+
+	r.resampler.samples = nil
+	r.resampler.sink = r.write
+
+	a.recordings = append(a.recordings, r)
+
+	return r, nil
+}
+
+// StopRecording stops the recording and writes the samples still
+// buffered. It returns the first error of the writer.
+func (a *Apu) StopRecording(r *Recording) error {
+	for i, rec := range a.recordings {
+		if rec == r {
+			a.recordings = append(a.recordings[:i], a.recordings[i+1:]...)
+			break
+		}
+	}
+
+	r.flush()
+
+	return r.err
+}
+
+// Output returns the output the recording records.
+func (r *Recording) Output() Output {
+	return r.output
+}
+
+func (r *Recording) tick(l Levels, expansion float32) {
+	r.resampler.tick(r.output.amplitude(l, expansion))
+}
+
+func (r *Recording) write(sample float32) {
+	r.buf = append(r.buf, sample)
+
+	if len(r.buf) == cap(r.buf) {
+		r.flush()
+	}
+}
+
+func (r *Recording) flush() {
+	if r.err == nil && len(r.buf) > 0 {
+		r.err = r.w.WriteSamples(r.buf)
+	}
+
+	r.buf = r.buf[:0]
+}
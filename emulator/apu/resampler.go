@@ -0,0 +1,236 @@
+package apu
+
+import (
+	"math"
+	"sync"
+)
+
+// CpuFrequency is the clock rate of the NTSC CPU in Hz, the rate the APU
+// output changes at.
+const CpuFrequency = 1789773
+
+// The band-limited steps are synthesized with a windowed sinc kernel of
+// kernelTaps samples, precomputed for kernelPhases fractional positions.
+// The output is delayed by half the kernel.
+const (
+	kernelTaps   = 16
+	kernelPhases = 64
+	// kernelCutoff is the cutoff of the kernel relative to the sample rate,
+	// a little below the Nyquist frequency.
+	kernelCutoff = 0.45
+	// deltaRingSize is the size of the ring of pending deltas, a power of
+	// two larger than the kernel.
+	deltaRingSize = 64
+)
+
+// The filters of the console's audio output: two high-pass filters and a
+// low-pass filter, all first order.
+const (
+	highPass1Hz = 90
+	highPass2Hz = 440
+	lowPassHz   = 14000
+)
+
+// bufferSeconds is how long a stretch of samples is buffered for reading.
+// When the buffer is full, the oldest samples are dropped.
+const bufferSeconds = 0.25
+
+var kernel = makeKernel()
+
+// makeKernel returns the band-limited impulse for each phase: the taps of
+// an impulse between samples 0 and 1, at phase/kernelPhases, shifted by
+// half the kernel.
+func makeKernel() [kernelPhases][kernelTaps]float32 {
+	var k [kernelPhases][kernelTaps]float32
+
+	for phase := 0; phase < kernelPhases; phase++ {
+		frac := float64(phase) / kernelPhases
+		sum := 0.0
+
+		var taps [kernelTaps]float64
+
+		for i := range taps {
+			x := float64(i) - (kernelTaps/2 - 1) - frac
+			taps[i] = sinc(2*kernelCutoff*x) * blackman(x/kernelTaps+0.5)
+			sum += taps[i]
+		}
+
+		// Normalize every phase, so a step always adds up to its height.
+		for i := range taps {
+			k[phase][i] = float32(taps[i] / sum)
+		}
+	}
+
+	return k
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman returns the Blackman window at x, 0 <= x <= 1.
+func blackman(x float64) float64 {
+	if x < 0 || x > 1 {
+		return 0
+	}
+
+	return 0.42 - 0.5*math.Cos(2*math.Pi*x) + 0.08*math.Cos(4*math.Pi*x)
+}
+
+// highPass is a first-order high-pass filter.
+type highPass struct {
+	alpha      float32
+	prevInput  float32
+	prevOutput float32
+}
+
+func newHighPass(cutoff, rate float64) highPass {
+	rc := 1 / (2 * math.Pi * cutoff)
+	return highPass{alpha: float32(rc / (rc + 1/rate))}
+}
+
+func (f *highPass) filter(x float32) float32 {
+	f.prevOutput = f.alpha * (f.prevOutput + x - f.prevInput)
+	f.prevInput = x
+
+	return f.prevOutput
+}
+
+// lowPass is a first-order low-pass filter.
+type lowPass struct {
+	alpha      float32
+	prevOutput float32
+}
+
+func newLowPass(cutoff, rate float64) lowPass {
+	rc := 1 / (2 * math.Pi * cutoff)
+	dt := 1 / rate
+
+	return lowPass{alpha: float32(dt / (rc + dt))}
+}
+
+func (f *lowPass) filter(x float32) float32 {
+	f.prevOutput += f.alpha * (x - f.prevOutput)
+	return f.prevOutput
+}
+
+// resampler converts an amplitude that changes on CPU cycles to samples at
+// the host rate. Every change is added to the output as a band-limited
+// step, so the square waves don't alias, and the samples are filtered like
+// the console's output and buffered in a ring for ReadSamples, or passed to
+// the sink if there is one.
+type resampler struct {
+	// step is the length of a CPU cycle in output samples.
+	step float64
+	// time is the current time in output samples.
+	time float64
+	// next is the index of the next output sample.
+	next      int64
+	amplitude float32
+	// deltas are the kernel taps added to the samples not yet output.
+	deltas [deltaRingSize]float32
+	// sum integrates the deltas into the amplitude of the samples.
+	sum float32
+
+	highPass1 highPass
+	highPass2 highPass
+	lowPass   lowPass
+
+	sink func(sample float32)
+
+	mu      sync.Mutex
+	samples []float32
+	read    int
+	count   int
+}
+
+func newResampler(rate int) *resampler {
+	r := float64(rate)
+
+	return &resampler{
+		step:      r / CpuFrequency,
+		highPass1: newHighPass(highPass1Hz, r),
+		highPass2: newHighPass(highPass2Hz, r),
+		lowPass:   newLowPass(lowPassHz, r),
+		samples:   make([]float32, int(r*bufferSeconds)+1),
+	}
+}
+
+// tick advances the resampler by a CPU cycle, with the amplitude the cycle
+// ends with.
+func (r *resampler) tick(amplitude float32) {
+	r.time += r.step
+	pos := int64(r.time)
+
+	// The samples before the current one get no more deltas.
+	for r.next < pos {
+		r.output()
+	}
+
+	if amplitude == r.amplitude {
+		return
+	}
+
+	delta := amplitude - r.amplitude
+	r.amplitude = amplitude
+
+	taps := &kernel[int((r.time-float64(pos))*kernelPhases)]
+	for i, tap := range taps {
+		r.deltas[(pos+int64(i))&(deltaRingSize-1)] += delta * tap
+	}
+}
+
+// output outputs the next sample.
+func (r *resampler) output() {
+	i := r.next & (deltaRingSize - 1)
+	r.sum += r.deltas[i]
+	r.deltas[i] = 0
+	r.next++
+
+	sample := r.lowPass.filter(r.highPass2.filter(r.highPass1.filter(r.sum)))
+
+	if r.sink != nil {
+		r.sink(sample)
+		return
+	}
+
+	r.mu.Lock()
+
+	if r.count == len(r.samples) {
+		r.read = (r.read + 1) % len(r.samples)
+		r.count--
+	}
+
+	r.samples[(r.read+r.count)%len(r.samples)] = sample
+	r.count++
+
+	r.mu.Unlock()
+}
+
+// readSamples moves the buffered samples to buf and returns their number.
+func (r *resampler) readSamples(buf []float32) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+
+	for n < len(buf) && r.count > 0 {
+		buf[n] = r.samples[r.read]
+		r.read = (r.read + 1) % len(r.samples)
+		r.count--
+		n++
+	}
+
+	return n
+}
+
+func (r *resampler) buffered() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.count
+}
@@ -0,0 +1,245 @@
+package apu
+
+import (
+	"math"
+	"testing"
+)
+
+const testSampleRate = 44100
+
+// unfiltered makes the filters of the resampler pass the samples as they
+// are, leaving the band-limited steps alone.
+func unfiltered(r *resampler) *resampler {
+	r.highPass1.alpha = 1
+	r.highPass2.alpha = 1
+	r.lowPass.alpha = 1
+
+	return r
+}
+
+// collect makes the resampler pass its samples to the returned slice.
+func collect(r *resampler) *[]float32 {
+	var samples []float32
+	r.sink = func(sample float32) { samples = append(samples, sample) }
+
+	return &samples
+}
+
+func TestResamplerStepResponse(t *testing.T) {
+	r := unfiltered(newResampler(testSampleRate))
+	samples := collect(r)
+
+	const height = 0.5
+
+	// The step lands in the middle of the 1000th sample.
+	cycles := int(1000.5 / r.step)
+	for i := 0; i < cycles; i++ {
+		r.tick(0)
+	}
+
+	pos := int(r.time + r.step)
+
+	for i := 0; i < CpuFrequency/100; i++ {
+		r.tick(height)
+	}
+
+	s := *samples
+
+	for i := 0; i < pos; i++ {
+		if s[i] != 0 {
+			t.Fatalf("sample %d before the step is %f, want 0", i, s[i])
+		}
+	}
+
+	// The step is delayed by half the kernel and rises over its taps,
+	// ringing like the Gibbs phenomenon.
+	half := pos + kernelTaps/2 - 1
+	if s[half-1] >= height/2 || s[half+1] <= height/2 {
+		t.Errorf("the step is at %f, %f, %f around sample %d, want the middle of the rise", s[half-1], s[half], s[half+1], half)
+	}
+
+	for i := pos; i < len(s); i++ {
+		if s[i] < -0.15*height || s[i] > 1.15*height {
+			t.Fatalf("sample %d of the step is %f, want 0 to %f ±15%%", i, s[i], height)
+		}
+	}
+
+	for i := pos + kernelTaps; i < len(s); i++ {
+		if math.Abs(float64(s[i]-height)) > 1e-5 {
+			t.Fatalf("sample %d after the step is %f, want %f", i, s[i], height)
+		}
+	}
+}
+
+func TestResamplerRate(t *testing.T) {
+	r := newResampler(testSampleRate)
+	samples := collect(r)
+
+	for i := 0; i < CpuFrequency; i++ {
+		r.tick(0)
+	}
+
+	if n := len(*samples); n < testSampleRate-1 || n > testSampleRate {
+		t.Errorf("got %d samples for a second, want %d", n, testSampleRate)
+	}
+}
+
+func TestResamplerFiltersDc(t *testing.T) {
+	r := newResampler(testSampleRate)
+	samples := collect(r)
+
+	for i := 0; i < CpuFrequency/2; i++ {
+		r.tick(0.5)
+	}
+
+	s := *samples
+
+	// The step passes the low-pass filter, and the high-pass filters
+	// decay it to nothing.
+	peak := float32(0)
+	for _, sample := range s {
+		if sample > peak {
+			peak = sample
+		}
+	}
+
+	if peak < 0.25 {
+		t.Errorf("got a peak of %f, want the step through", peak)
+	}
+
+	if last := s[len(s)-1]; math.Abs(float64(last)) > 1e-3 {
+		t.Errorf("got %f after half a second of DC, want 0", last)
+	}
+}
+
+func TestResamplerDropsOldestSamples(t *testing.T) {
+	const rate = 8000
+
+	// The twin resampler gets the same input and passes all the samples to
+	// its sink.
+	r := newResampler(rate)
+	twin := newResampler(rate)
+	all := collect(twin)
+
+	size := len(r.samples)
+
+	tick := func(cycles int) {
+		for i := 0; i < cycles; i++ {
+			amplitude := float32((i / 200) % 2)
+			r.tick(amplitude)
+			twin.tick(amplitude)
+		}
+	}
+
+	tick(CpuFrequency / 2)
+
+	if len(*all) <= size+100 {
+		t.Fatalf("got %d samples, want more than the %d buffered", len(*all), size)
+	}
+
+	if r.buffered() != size {
+		t.Fatalf("got %d samples buffered, want the buffer of %d full", r.buffered(), size)
+	}
+
+	// The buffer holds the latest samples, read in parts across the end of
+	// the ring.
+	buf := make([]float32, size/3)
+	var got []float32
+
+	for {
+		n := r.readSamples(buf)
+		if n == 0 {
+			break
+		}
+
+		got = append(got, buf[:n]...)
+	}
+
+	want := (*all)[len(*all)-size:]
+	if len(got) != len(want) {
+		t.Fatalf("read %d samples, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %d: got %f, want %f", i, got[i], want[i])
+		}
+	}
+
+	if r.buffered() != 0 {
+		t.Errorf("got %d samples buffered after reading them", r.buffered())
+	}
+
+	// The samples after the read are buffered from where the read ended.
+	read := len(*all)
+	tick(2000)
+
+	n := r.readSamples(buf)
+	if n == 0 || n != len(*all)-read {
+		t.Fatalf("read %d samples, want %d", n, len(*all)-read)
+	}
+
+	for i := 0; i < n; i++ {
+		if buf[i] != (*all)[read+i] {
+			t.Fatalf("sample %d after the read: got %f, want %f", i, buf[i], (*all)[read+i])
+		}
+	}
+}
+
+func TestReadSamples(t *testing.T) {
+	a := NewApu(&testMemory{}, nil)
+
+	if n := a.ReadSamples(make([]float32, 10)); n != 0 || a.BufferedSamples() != 0 {
+		t.Errorf("read %d samples without a sample rate", n)
+	}
+
+	a.SetSampleRate(testSampleRate)
+	tickApu(a, CpuFrequency/10)
+
+	if n := a.BufferedSamples(); n < testSampleRate/10-kernelTaps || n > testSampleRate/10 {
+		t.Errorf("got %d samples buffered for a tenth of a second, want %d", n, testSampleRate/10)
+	}
+
+	a.SetSampleRate(0)
+
+	if a.BufferedSamples() != 0 {
+		t.Error("samples are buffered after the rate was set to zero")
+	}
+}
+
+// testSampleWriter collects the samples written to it.
+type testSampleWriter struct {
+	samples []float32
+}
+
+func (w *testSampleWriter) WriteSamples(samples []float32) error {
+	w.samples = append(w.samples, samples...)
+	return nil
+}
+
+func TestRecord(t *testing.T) {
+	a := NewApu(&testMemory{}, nil)
+	w := &testSampleWriter{}
+
+	for _, rate := range []int{0, -1} {
+		if _, err := a.Record(MixedOutput, rate, w); err == nil {
+			t.Errorf("recorded at %d Hz", rate)
+		}
+	}
+
+	r, err := a.Record(MixedOutput, testSampleRate, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tickApu(a, CpuFrequency/10)
+
+	if err := a.StopRecording(r); err != nil {
+		t.Fatal(err)
+	}
+
+	// The samples still buffered are written when the recording stops.
+	if n := len(w.samples); n < testSampleRate/10-kernelTaps || n > testSampleRate/10 {
+		t.Errorf("got %d samples recorded for a tenth of a second, want %d", n, testSampleRate/10)
+	}
+}
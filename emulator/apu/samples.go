@@ -0,0 +1,37 @@
+package apu
+
+// SetSampleRate starts producing the audio output at the sample rate in Hz,
+// e.g. 44100 or 48000, for ReadSamples. A rate of zero stops it. No samples
+// are produced until a rate is set. It must not be called concurrently with
+// ReadSamples.
+func (a *Apu) SetSampleRate(rate int) {
+	if rate <= 0 {
+		a.resampler = nil
+		return
+	}
+
+	a.resampler = newResampler(rate)
+}
+
+// ReadSamples moves the buffered samples, mono in about -1 to 1, to buf and
+// returns the number of samples moved. It may be called from another
+// goroutine than the one running the APU, e.g. an audio callback.
+//
+// About a quarter of a second of samples is buffered; if they aren't read
+// in time, the oldest samples are dropped.
+func (a *Apu) ReadSamples(buf []float32) int {
+	if a.resampler == nil {
+		return 0
+	}
+
+	return a.resampler.readSamples(buf)
+}
+
+// BufferedSamples returns the number of samples ReadSamples can return.
+func (a *Apu) BufferedSamples() int {
+	if a.resampler == nil {
+		return 0
+	}
+
+	return a.resampler.buffered()
+}
@@ -0,0 +1,226 @@
+package apu
+
+import "math"
+
+const (
+	// sunsoft5bPrescaler is the number of CPU cycles per step of the 5B's
+	// tone, noise and envelope counters. A tone of period P has a frequency
+	// of the CPU clock / (32 * P).
+	sunsoft5bPrescaler = 16
+	// sunsoft5bScale is the output of a channel at full volume, about 1.5
+	// times an APU pulse at full volume.
+	sunsoft5bScale = 1.5 * 15 * apuPulseStep
+)
+
+// sunsoft5bVolumes maps the 5-bit volume of the 5B, in steps of 1.5 dB, to
+// the amplitude. Zero is silent.
+var sunsoft5bVolumes = func() [32]float32 {
+	var v [32]float32
+
+	for i := 1; i < len(v); i++ {
+		v[i] = float32(math.Pow(10, -1.5*float64(31-i)/20))
+	}
+
+	return v
+}()
+
+// Sunsoft5B is the sound of the Sunsoft 5B, a YM2149F (an AY-3-8910
+// variant): three square wave channels, each with the noise mixed in or
+// not, and a shared envelope. The register is selected at $C000-$DFFF and
+// written at $E000-$FFFF.
+type Sunsoft5B struct {
+	reg uint8
+
+	prescaler int
+
+	tones [3]sunsoft5bTone
+
+	noisePeriod  uint8
+	noiseCounter uint8
+	// noiseHalf divides the noise clock by two.
+	noiseHalf bool
+	lfsr      uint32
+
+	envelopePeriod  uint16
+	envelopeCounter uint16
+	envelopeShape   uint8
+	// envelopeStep is the position in the current 32-step ramp.
+	envelopeStep uint8
+	envelopeHeld bool
+	// envelopeUp tells whether the current ramp rises.
+	envelopeUp bool
+}
+
+type sunsoft5bTone struct {
+	period  uint16
+	counter uint16
+	high    bool
+
+	toneOff  bool
+	noiseOff bool
+	// volume is the 4-bit volume, unless envelope is set.
+	volume   uint8
+	envelope bool
+}
+
+// NewSunsoft5B returns a 5B with its channels silent.
+func NewSunsoft5B() *Sunsoft5B {
+	return &Sunsoft5B{lfsr: 1}
+}
+
+func (s *Sunsoft5B) Write(addr uint16, data uint8) {
+	switch addr & 0xe000 {
+	case 0xc000:
+		s.reg = data & 0x0f
+	case 0xe000:
+		s.writeRegister(s.reg, data)
+	}
+}
+
+func (s *Sunsoft5B) writeRegister(reg, data uint8) {
+	switch {
+	case reg < 6:
+		t := &s.tones[reg/2]
+
+		if reg%2 == 0 {
+			t.period = t.period&0xf00 | uint16(data)
+		} else {
+			t.period = t.period&0x0ff | uint16(data&0x0f)<<8
+		}
+	case reg == 6:
+		s.noisePeriod = data & 0x1f
+	case reg == 7:
+		for i := range s.tones {
+			s.tones[i].toneOff = data&(1<<i) != 0
+			s.tones[i].noiseOff = data&(8<<i) != 0
+		}
+	case reg < 11:
+		t := &s.tones[reg-8]
+		t.volume = data & 0x0f
+		t.envelope = data&0x10 != 0
+	case reg == 11:
+		s.envelopePeriod = s.envelopePeriod&0xff00 | uint16(data)
+	case reg == 12:
+		s.envelopePeriod = s.envelopePeriod&0x00ff | uint16(data)<<8
+	case reg == 13:
+		s.envelopeShape = data & 0x0f
+		s.envelopeCounter = 0
+		s.envelopeStep = 0
+		s.envelopeHeld = false
+		s.envelopeUp = s.envelopeShape&0x04 != 0
+	}
+}
+
+func (s *Sunsoft5B) TickAudio() {
+	s.prescaler++
+	if s.prescaler < sunsoft5bPrescaler {
+		return
+	}
+
+	s.prescaler = 0
+
+	for i := range s.tones {
+		t := &s.tones[i]
+
+		t.counter++
+		if t.counter >= t.period {
+			t.counter = 0
+			t.high = !t.high
+		}
+	}
+
+	s.noiseHalf = !s.noiseHalf
+	if s.noiseHalf {
+		s.noiseCounter++
+		if s.noiseCounter >= s.noisePeriod {
+			s.noiseCounter = 0
+			// The 17-bit LFSR of the AY-3-8910, taps 0 and 3.
+			bit := (s.lfsr ^ s.lfsr>>3) & 1
+			s.lfsr = s.lfsr>>1 | bit<<16
+		}
+	}
+
+	s.envelopeCounter++
+	if s.envelopeCounter >= s.envelopePeriod {
+		s.envelopeCounter = 0
+		s.clockEnvelope()
+	}
+}
+
+// clockEnvelope steps the envelope. The shape is CAAH: continue, attack,
+// alternate and hold. Without continue, the envelope drops to zero and
+// holds after the first ramp; with hold, it holds at the end of the ramp,
+// or at its start with alternate.
+func (s *Sunsoft5B) clockEnvelope() {
+	if s.envelopeHeld {
+		return
+	}
+
+	s.envelopeStep++
+	if s.envelopeStep < 32 {
+		return
+	}
+
+	s.envelopeStep = 0
+
+	shape := s.envelopeShape
+
+	switch {
+	case shape&0x08 == 0:
+		s.holdEnvelope(0)
+	case shape&0x01 != 0:
+		var end uint8
+		if s.envelopeUp {
+			end = 31
+		}
+
+		if shape&0x02 != 0 {
+			end = 31 - end
+		}
+
+		s.holdEnvelope(end)
+	case shape&0x02 != 0:
+		s.envelopeUp = !s.envelopeUp
+	}
+}
+
+// holdEnvelope holds the envelope at the volume, 0 or 31.
+func (s *Sunsoft5B) holdEnvelope(volume uint8) {
+	s.envelopeHeld = true
+	s.envelopeStep = 31
+	s.envelopeUp = volume == 31
+}
+
+// envelopeVolume returns the 5-bit volume of the envelope.
+func (s *Sunsoft5B) envelopeVolume() uint8 {
+	if s.envelopeUp {
+		return s.envelopeStep
+	}
+
+	return 31 - s.envelopeStep
+}
+
+func (s *Sunsoft5B) AudioOutput() float32 {
+	noise := s.lfsr&1 != 0
+
+	var out float32
+
+	for i := range s.tones {
+		t := &s.tones[i]
+
+		if !(t.high || t.toneOff) || !(noise || t.noiseOff) {
+			continue
+		}
+
+		volume := t.volume<<1 | 1
+		if t.envelope {
+			volume = s.envelopeVolume()
+		} else if t.volume == 0 {
+			volume = 0
+		}
+
+		out += sunsoft5bVolumes[volume]
+	}
+
+	return out * sunsoft5bScale
+}
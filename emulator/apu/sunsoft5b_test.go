@@ -0,0 +1,220 @@
+package apu
+
+import (
+	"math"
+	"testing"
+)
+
+// writeSunsoft5B writes the data to the register of the 5B.
+func writeSunsoft5B(s *Sunsoft5B, reg, data uint8) {
+	s.Write(0xc000, reg)
+	s.Write(0xe000, data)
+}
+
+func TestSunsoft5BRegisters(t *testing.T) {
+	s := NewSunsoft5B()
+	writeSunsoft5B(s, 0x02, 0x34)
+	writeSunsoft5B(s, 0x03, 0xf2)
+	writeSunsoft5B(s, 0x06, 0xff)
+	writeSunsoft5B(s, 0x07, 0x0a)
+	writeSunsoft5B(s, 0x0a, 0x1f)
+	writeSunsoft5B(s, 0x0b, 0x34)
+	writeSunsoft5B(s, 0x0c, 0x12)
+	// The register select ignores the top bits and the writes are
+	// decoded on A13-A15 only.
+	s.Write(0xdfff, 0x18)
+	s.Write(0xffff, 0x05)
+
+	if tone := s.tones[1]; tone.period != 0x234 {
+		t.Errorf("got the period $%03X of tone B, want $234", tone.period)
+	}
+
+	if s.noisePeriod != 0x1f {
+		t.Errorf("got the noise period $%02X, want $1F", s.noisePeriod)
+	}
+
+	if !s.tones[1].toneOff || s.tones[0].toneOff || !s.tones[0].noiseOff || s.tones[1].noiseOff {
+		t.Errorf("got the mixer %+v", s.tones)
+	}
+
+	if tone := s.tones[2]; !tone.envelope || tone.volume != 0x0f {
+		t.Errorf("got tone C %+v, want the envelope", tone)
+	}
+
+	if s.tones[0].volume != 0x05 {
+		t.Errorf("got volume %d of tone A through register 8, want 5", s.tones[0].volume)
+	}
+
+	if s.envelopePeriod != 0x1234 {
+		t.Errorf("got the envelope period $%04X, want $1234", s.envelopePeriod)
+	}
+}
+
+func TestSunsoft5BTone(t *testing.T) {
+	s := NewSunsoft5B()
+	// Tone A of period 3 at full volume, without the noise.
+	writeSunsoft5B(s, 0x00, 0x03)
+	writeSunsoft5B(s, 0x07, 0x3e)
+	writeSunsoft5B(s, 0x08, 0x0f)
+
+	// The tone toggles every 16*period cycles, for the CPU clock / (32 *
+	// period).
+	const half = sunsoft5bPrescaler * 3
+
+	prev := s.AudioOutput()
+	changes := 0
+
+	for cycle := 1; cycle <= 8*half; cycle++ {
+		s.TickAudio()
+
+		if out := s.AudioOutput(); out != prev {
+			if cycle%half != 0 {
+				t.Fatalf("the output changed on cycle %d", cycle)
+			}
+
+			changes++
+			prev = out
+		}
+	}
+
+	if changes != 8 {
+		t.Errorf("got %d changes in 4 periods, want 8", changes)
+	}
+}
+
+func TestSunsoft5BVolume(t *testing.T) {
+	s := NewSunsoft5B()
+	// Tone A disabled in the mixer outputs a constant level.
+	writeSunsoft5B(s, 0x07, 0x3f)
+	writeSunsoft5B(s, 0x08, 0x0f)
+
+	// A channel at full volume is about 1.5 times as loud as an APU pulse
+	// at full volume.
+	full := float64(s.AudioOutput())
+	checkLevel(t, "full volume", full, 1.5*apuPulseFull, 1e-6)
+
+	// A step of the 4-bit volume is 3 dB.
+	for volume := uint8(14); volume > 0; volume-- {
+		writeSunsoft5B(s, 0x08, volume)
+
+		want := full * math.Pow(10, -3*float64(15-volume)/20)
+		checkLevel(t, "volume", float64(s.AudioOutput()), want, 1e-5)
+	}
+
+	writeSunsoft5B(s, 0x08, 0x00)
+
+	if out := s.AudioOutput(); out != 0 {
+		t.Errorf("got %f at volume 0", out)
+	}
+}
+
+func TestSunsoft5BEnvelope(t *testing.T) {
+	for _, test := range []struct {
+		shape uint8
+		// want are the volumes at the start of the first three ramps and
+		// at their ends.
+		want [6]uint8
+	}{
+		// \___
+		{0x00, [6]uint8{31, 0, 0, 0, 0, 0}},
+		// /___
+		{0x04, [6]uint8{0, 31, 0, 0, 0, 0}},
+		// \\\\
+		{0x08, [6]uint8{31, 0, 31, 0, 31, 0}},
+		// \___ with hold
+		{0x09, [6]uint8{31, 0, 0, 0, 0, 0}},
+		// \/\/
+		{0x0a, [6]uint8{31, 0, 0, 31, 31, 0}},
+		// \--- held high
+		{0x0b, [6]uint8{31, 0, 31, 31, 31, 31}},
+		// ////
+		{0x0c, [6]uint8{0, 31, 0, 31, 0, 31}},
+		// /--- held high
+		{0x0d, [6]uint8{0, 31, 31, 31, 31, 31}},
+		// /\/\
+		{0x0e, [6]uint8{0, 31, 31, 0, 0, 31}},
+		// /___ held low
+		{0x0f, [6]uint8{0, 31, 0, 0, 0, 0}},
+	} {
+		s := NewSunsoft5B()
+		writeSunsoft5B(s, 0x0b, 0x01)
+		writeSunsoft5B(s, 0x0d, test.shape)
+
+		var got [6]uint8
+
+		for ramp := 0; ramp < 3; ramp++ {
+			got[2*ramp] = s.envelopeVolume()
+
+			// The envelope steps every prescaler * period cycles.
+			tickAudio(s, 31*sunsoft5bPrescaler)
+			got[2*ramp+1] = s.envelopeVolume()
+			tickAudio(s, sunsoft5bPrescaler)
+		}
+
+		if got != test.want {
+			t.Errorf("shape $%X: got %v, want %v", test.shape, got, test.want)
+		}
+	}
+}
+
+func TestSunsoft5BEnvelopeVolume(t *testing.T) {
+	s := NewSunsoft5B()
+	writeSunsoft5B(s, 0x07, 0x3f)
+	writeSunsoft5B(s, 0x08, 0x10)
+	writeSunsoft5B(s, 0x0b, 0x01)
+	writeSunsoft5B(s, 0x0d, 0x0d)
+
+	if out := s.AudioOutput(); out != 0 {
+		t.Errorf("got %f at the start of the attack", out)
+	}
+
+	tickAudio(s, 31*sunsoft5bPrescaler)
+
+	// The envelope has 32 steps of 1.5 dB.
+	checkLevel(t, "top of the attack", float64(s.AudioOutput()), 1.5*apuPulseFull, 1e-6)
+
+	writeSunsoft5B(s, 0x0d, 0x00)
+	tickAudio(s, sunsoft5bPrescaler)
+
+	checkLevel(t, "a step of the decay", float64(s.AudioOutput()), 1.5*apuPulseFull*math.Pow(10, -1.5/20), 1e-5)
+}
+
+func TestSunsoft5BNoise(t *testing.T) {
+	s := NewSunsoft5B()
+	// The noise of period 1 on tone A, without the tone.
+	writeSunsoft5B(s, 0x06, 0x01)
+	writeSunsoft5B(s, 0x07, 0x37)
+	writeSunsoft5B(s, 0x08, 0x0f)
+
+	high := 0
+	changes := 0
+	prev := s.AudioOutput()
+
+	// The noise is clocked at half the rate of the tones.
+	const clocks = 4096
+
+	for clock := 0; clock < clocks; clock++ {
+		tickAudio(s, 2*sunsoft5bPrescaler)
+
+		out := s.AudioOutput()
+		if out != 0 {
+			high++
+		}
+
+		if out != prev {
+			changes++
+		}
+
+		prev = out
+	}
+
+	// The output of a maximal length LFSR is high about half the time and
+	// changes on about every other clock.
+	if high < clocks*4/10 || high > clocks*6/10 {
+		t.Errorf("high on %d of %d clocks", high, clocks)
+	}
+
+	if changes < clocks*4/10 || changes > clocks*6/10 {
+		t.Errorf("%d changes in %d clocks", changes, clocks)
+	}
+}
@@ -0,0 +1,72 @@
+package apu
+
+// triangleTable is the 32-step sequence of the triangle channel.
+var triangleTable = [32]uint8{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// triangle is the triangle wave channel, $4008-$400B. Besides the length
+// counter, it has a linear counter clocked by the quarter frames.
+type triangle struct {
+	length lengthCounter
+
+	// control halts the length counter and keeps the linear counter
+	// reloading.
+	control      bool
+	linearReload uint8
+	linear       uint8
+	reloadLinear bool
+
+	sequence uint8
+	period   uint16
+	timer    uint16
+}
+
+func (t *triangle) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		t.control = data&0x80 != 0
+		t.length.halt = t.control
+		t.linearReload = data & 0x7f
+	case 2:
+		t.period = t.period&0x700 | uint16(data)
+	case 3:
+		t.period = t.period&0xff | uint16(data&0x07)<<8
+		t.length.load(data)
+		t.reloadLinear = true
+	}
+}
+
+// clockTimer is called on every CPU cycle. The sequencer only advances
+// while both counters are non-zero, so a silenced triangle holds its level.
+func (t *triangle) clockTimer() {
+	if t.timer > 0 {
+		t.timer--
+		return
+	}
+
+	t.timer = t.period
+
+	if t.length.active() && t.linear > 0 {
+		t.sequence = (t.sequence + 1) & 0x1f
+	}
+}
+
+// clockLinear is called on the quarter frames.
+func (t *triangle) clockLinear() {
+	if t.reloadLinear {
+		t.linear = t.linearReload
+	} else if t.linear > 0 {
+		t.linear--
+	}
+
+	if !t.control {
+		t.reloadLinear = false
+	}
+}
+
+// output returns the level of the channel, 0-15.
+func (t *triangle) output() uint8 {
+	return triangleTable[t.sequence]
+}
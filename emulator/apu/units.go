@@ -0,0 +1,94 @@
+package apu
+
+// lengthTable maps the 5-bit index written to the length counter load
+// registers to the number of half frames the note plays for.
+var lengthTable = [32]uint8{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+// lengthCounter silences a channel when it counts down to zero. It is
+// clocked by the half frames of the frame counter.
+type lengthCounter struct {
+	enabled bool
+	halt    bool
+	count   uint8
+}
+
+// load loads the counter from the length table with the index in the top 5
+// bits of the data, if the channel is enabled.
+func (l *lengthCounter) load(data uint8) {
+	if l.enabled {
+		l.count = lengthTable[data>>3]
+	}
+}
+
+// setEnabled enables or disables the channel through $4015. Disabling it
+// clears the counter at once.
+func (l *lengthCounter) setEnabled(enabled bool) {
+	l.enabled = enabled
+	if !enabled {
+		l.count = 0
+	}
+}
+
+func (l *lengthCounter) clock() {
+	if l.count > 0 && !l.halt {
+		l.count--
+	}
+}
+
+func (l *lengthCounter) active() bool {
+	return l.count > 0
+}
+
+// envelope generates the volume of the pulse and the noise channels: either
+// a constant volume or a sawtooth decaying from 15 to 0, optionally looping.
+// It is clocked by the quarter frames of the frame counter.
+type envelope struct {
+	start    bool
+	loop     bool
+	constant bool
+	// period is the constant volume, or the period of the decay.
+	period  uint8
+	divider uint8
+	decay   uint8
+}
+
+// write writes the envelope bits of the channel's first register, --LC VVVV.
+func (e *envelope) write(data uint8) {
+	e.loop = data&0x20 != 0
+	e.constant = data&0x10 != 0
+	e.period = data & 0x0f
+}
+
+func (e *envelope) clock() {
+	if e.start {
+		e.start = false
+		e.decay = 15
+		e.divider = e.period
+
+		return
+	}
+
+	if e.divider > 0 {
+		e.divider--
+		return
+	}
+
+	e.divider = e.period
+
+	if e.decay > 0 {
+		e.decay--
+	} else if e.loop {
+		e.decay = 15
+	}
+}
+
+func (e *envelope) volume() uint8 {
+	if e.constant {
+		return e.period
+	}
+
+	return e.decay
+}
@@ -0,0 +1,175 @@
+package apu
+
+// vrc6Step is the output of a step of volume of the VRC6, about the same as
+// a step of an APU pulse channel.
+const vrc6Step = apuPulseStep
+
+// Vrc6 is the sound of the Konami VRC6: two pulse channels with eight duty
+// cycles and a sawtooth channel. Its registers are at $9000-$9003,
+// $A000-$A002 and $B000-$B002 as on mapper 24; the boards of mapper 26 swap
+// address lines A0 and A1, which their mapper undoes before the write.
+type Vrc6 struct {
+	pulse1 vrc6Pulse
+	pulse2 vrc6Pulse
+	saw    vrc6Saw
+
+	// halt stops all the channels' timers.
+	halt bool
+	// shift divides the periods by 16 or 256.
+	shift uint8
+}
+
+// NewVrc6 returns a VRC6 with its channels disabled.
+func NewVrc6() *Vrc6 {
+	return &Vrc6{
+		pulse1: vrc6Pulse{step: 15},
+		pulse2: vrc6Pulse{step: 15},
+	}
+}
+
+func (v *Vrc6) Write(addr uint16, data uint8) {
+	reg := addr & 0x0003
+
+	switch addr & 0xf003 {
+	case 0x9000, 0x9001, 0x9002:
+		v.pulse1.write(reg, data)
+	case 0x9003:
+		v.halt = data&0x01 != 0
+
+		switch {
+		case data&0x04 != 0:
+			v.shift = 8
+		case data&0x02 != 0:
+			v.shift = 4
+		default:
+			v.shift = 0
+		}
+	case 0xa000, 0xa001, 0xa002:
+		v.pulse2.write(reg, data)
+	case 0xb000, 0xb001, 0xb002:
+		v.saw.write(reg, data)
+	}
+}
+
+func (v *Vrc6) TickAudio() {
+	if v.halt {
+		return
+	}
+
+	v.pulse1.clock(v.shift)
+	v.pulse2.clock(v.shift)
+	v.saw.clock(v.shift)
+}
+
+func (v *Vrc6) AudioOutput() float32 {
+	return float32(v.pulse1.output()+v.pulse2.output()+v.saw.output()) * vrc6Step
+}
+
+// vrc6Pulse is a pulse channel of the VRC6. The duty cycle is 1/16 to 8/16,
+// or always on in the digital mode.
+type vrc6Pulse struct {
+	digital bool
+	duty    uint8
+	volume  uint8
+	enabled bool
+	period  uint16
+	timer   uint16
+	// step counts down from 15; the output is on for the steps up to the
+	// duty.
+	step uint8
+}
+
+func (p *vrc6Pulse) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		p.digital = data&0x80 != 0
+		p.duty = data >> 4 & 0x07
+		p.volume = data & 0x0f
+	case 1:
+		p.period = p.period&0xf00 | uint16(data)
+	case 2:
+		p.period = p.period&0x0ff | uint16(data&0x0f)<<8
+		p.enabled = data&0x80 != 0
+
+		if !p.enabled {
+			p.step = 15
+		}
+	}
+}
+
+func (p *vrc6Pulse) clock(shift uint8) {
+	if !p.enabled {
+		return
+	}
+
+	if p.timer > 0 {
+		p.timer--
+		return
+	}
+
+	p.timer = p.period >> shift
+	p.step = (p.step - 1) & 0x0f
+}
+
+func (p *vrc6Pulse) output() int {
+	if !p.enabled || (!p.digital && p.step > p.duty) {
+		return 0
+	}
+
+	return int(p.volume)
+}
+
+// vrc6Saw is the sawtooth channel of the VRC6. Its accumulator adds the rate
+// on every other step and is cleared on the 14th, so the output, its top 5
+// bits, ramps up over seven steps.
+type vrc6Saw struct {
+	rate        uint8
+	enabled     bool
+	period      uint16
+	timer       uint16
+	step        uint8
+	accumulator uint8
+}
+
+func (s *vrc6Saw) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		s.rate = data & 0x3f
+	case 1:
+		s.period = s.period&0xf00 | uint16(data)
+	case 2:
+		s.period = s.period&0x0ff | uint16(data&0x0f)<<8
+		s.enabled = data&0x80 != 0
+
+		if !s.enabled {
+			s.step = 0
+			s.accumulator = 0
+		}
+	}
+}
+
+func (s *vrc6Saw) clock(shift uint8) {
+	if !s.enabled {
+		return
+	}
+
+	if s.timer > 0 {
+		s.timer--
+		return
+	}
+
+	s.timer = s.period >> shift
+	s.step++
+
+	switch {
+	case s.step == 14:
+		s.step = 0
+		s.accumulator = 0
+	case s.step&1 == 0:
+		s.accumulator += s.rate
+	}
+}
+
+func (s *vrc6Saw) output() int {
+	return int(s.accumulator >> 3)
+}
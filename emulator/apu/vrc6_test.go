@@ -0,0 +1,171 @@
+package apu
+
+import "testing"
+
+// vrc6Outputs returns the outputs of the VRC6 over the cycles.
+func vrc6Outputs(v *Vrc6, cycles int) []float32 {
+	out := make([]float32, cycles)
+
+	for i := range out {
+		v.TickAudio()
+		out[i] = v.AudioOutput()
+	}
+
+	return out
+}
+
+func TestVrc6PulseDuty(t *testing.T) {
+	for duty := 0; duty < 8; duty++ {
+		v := NewVrc6()
+		v.Write(0x9000, uint8(duty)<<4|0x0f)
+		v.Write(0x9001, 0x00)
+		v.Write(0x9002, 0x80)
+
+		// With a period of 0 the pulse steps on every cycle; the output is
+		// on for duty+1 of the 16 steps.
+		on := 0
+		for _, out := range vrc6Outputs(v, 16) {
+			switch out {
+			case 15 * vrc6Step:
+				on++
+			case 0:
+			default:
+				t.Fatalf("duty %d: got output %f", duty, out)
+			}
+		}
+
+		if on != duty+1 {
+			t.Errorf("duty %d: on for %d of 16 steps, want %d", duty, on, duty+1)
+		}
+	}
+}
+
+func TestVrc6PulseDigitalMode(t *testing.T) {
+	v := NewVrc6()
+	v.Write(0xa000, 0x87)
+	v.Write(0xa002, 0x80)
+
+	for i, out := range vrc6Outputs(v, 32) {
+		if out != 7*vrc6Step {
+			t.Fatalf("cycle %d: got %f, want the volume 7 on every step", i, out)
+		}
+	}
+
+	// Disabling the channel silences it.
+	v.Write(0xa002, 0x00)
+
+	if out := v.AudioOutput(); out != 0 {
+		t.Errorf("got %f after disabling the channel", out)
+	}
+}
+
+func TestVrc6PulsePeriod(t *testing.T) {
+	v := NewVrc6()
+	// Duty 8/16 and a period of $102, so a step lasts $103 cycles.
+	v.Write(0x9000, 0x7f)
+	v.Write(0x9001, 0x02)
+	v.Write(0x9002, 0x81)
+
+	changes := 0
+	prev := v.AudioOutput()
+
+	for _, out := range vrc6Outputs(v, 16*0x103) {
+		if out != prev {
+			changes++
+		}
+
+		prev = out
+	}
+
+	// A full period of the wave.
+	if changes != 2 {
+		t.Errorf("got %d changes in 16 steps, want 2", changes)
+	}
+}
+
+func TestVrc6FrequencyControl(t *testing.T) {
+	const cycles = 0x1000
+
+	for _, test := range []struct {
+		control uint8
+		period  int
+	}{
+		{0x00, 0x100},
+		// The periods shifted right by 4 and 8 bits.
+		{0x02, 0x10},
+		{0x04, 0x01},
+		// Halted.
+		{0x01, -1},
+	} {
+		v := NewVrc6()
+		v.Write(0x9003, test.control)
+		v.Write(0x9000, 0x8f)
+		v.Write(0x9001, 0x00)
+		v.Write(0x9002, 0x81)
+
+		steps := 0
+
+		for i := 0; i < cycles; i++ {
+			prev := v.pulse1.step
+			v.TickAudio()
+
+			if v.pulse1.step != prev {
+				steps++
+			}
+		}
+
+		// The first step is taken on the first cycle, then one every
+		// period+1 cycles.
+		want := 0
+		if test.period >= 0 {
+			want = (cycles-1)/(test.period+1) + 1
+		}
+
+		if steps != want {
+			t.Errorf("control $%02X: %d steps in %d cycles, want %d", test.control, steps, cycles, want)
+		}
+	}
+}
+
+func TestVrc6SawRamp(t *testing.T) {
+	v := NewVrc6()
+	v.Write(0xb000, 42)
+	v.Write(0xb001, 0x00)
+	v.Write(0xb002, 0x80)
+
+	// The accumulator adds 42 on every other step and is cleared on the
+	// 14th; the output is its top 5 bits.
+	want := []int{0, 5, 5, 10, 10, 15, 15, 21, 21, 26, 26, 31, 31, 0}
+
+	for cycle := 0; cycle < 2*len(want); cycle++ {
+		v.TickAudio()
+
+		if got := v.AudioOutput(); got != float32(want[cycle%len(want)])*vrc6Step {
+			t.Errorf("step %d: got %f, want %d steps", cycle+1, got, want[cycle%len(want)])
+		}
+	}
+
+	v.Write(0xb002, 0x00)
+
+	if out := v.AudioOutput(); out != 0 {
+		t.Errorf("got %f after disabling the saw", out)
+	}
+}
+
+func TestVrc6Level(t *testing.T) {
+	v := NewVrc6()
+	v.Write(0x9000, 0x8f)
+	v.Write(0x9002, 0x80)
+
+	// A pulse of the VRC6 at full volume is about as loud as an APU pulse.
+	checkLevel(t, "pulse", float64(v.AudioOutput()), apuPulseFull, 1e-6)
+
+	v.Write(0xa000, 0x8f)
+	v.Write(0xa002, 0x80)
+	v.Write(0xb000, 42)
+	v.Write(0xb002, 0x80)
+
+	_, high := outputRange(v, 14)
+
+	checkLevel(t, "all channels", float64(high), (15+15+31)*apuPulseStep, 1e-6)
+}
@@ -0,0 +1,462 @@
+package apu
+
+import "math"
+
+const (
+	// vrc7SampleCycles is the number of CPU cycles per sample of the
+	// VRC7, which runs its 3.58 MHz clock through the OPLL's divider of 72
+	// to a rate of about 49716 Hz.
+	vrc7SampleCycles = 36
+	// vrc7Scale is the output of a channel at full volume, which peaks
+	// about as high as an APU pulse at full volume.
+	vrc7Scale = 15 * apuPulseStep
+	// vrc7PhaseBits is the size of the phase accumulator; the top
+	// vrc7SineBits of it index the sine table.
+	vrc7PhaseBits = 18
+	vrc7SineBits  = 10
+	// vrc7MaxLevel is the attenuation of the envelope when it's off, in
+	// steps of 0.375 dB.
+	vrc7MaxLevel = 127
+	// vrc7AttenuationSteps is the size of the table of amplitudes by
+	// attenuation; a larger attenuation is silent.
+	vrc7AttenuationSteps = 512
+)
+
+// vrc7Patches are the built-in instruments of the VRC7. Instrument 0 is the
+// custom one, defined by registers $00-$07.
+var vrc7Patches = [16][8]uint8{
+	{},
+	{0x03, 0x21, 0x05, 0x06, 0xe8, 0x81, 0x42, 0x27},
+	{0x13, 0x41, 0x14, 0x0d, 0xd8, 0xf6, 0x23, 0x12},
+	{0x11, 0x11, 0x08, 0x08, 0xfa, 0xb2, 0x20, 0x12},
+	{0x31, 0x61, 0x0c, 0x07, 0xa8, 0x64, 0x61, 0x27},
+	{0x32, 0x21, 0x1e, 0x06, 0xe1, 0x76, 0x01, 0x28},
+	{0x02, 0x01, 0x06, 0x00, 0xa3, 0xe2, 0xf4, 0xf4},
+	{0x21, 0x61, 0x1d, 0x07, 0x82, 0x81, 0x11, 0x07},
+	{0x23, 0x21, 0x22, 0x17, 0xa2, 0x72, 0x01, 0x17},
+	{0x35, 0x11, 0x25, 0x00, 0x40, 0x73, 0x72, 0x01},
+	{0xb5, 0x01, 0x0f, 0x0f, 0xa8, 0xa5, 0x51, 0x02},
+	{0x17, 0xc1, 0x24, 0x07, 0xf8, 0xf8, 0x22, 0x12},
+	{0x71, 0x23, 0x11, 0x06, 0x65, 0x74, 0x18, 0x16},
+	{0x01, 0x02, 0xd3, 0x05, 0xc9, 0x95, 0x03, 0x02},
+	{0x61, 0x63, 0x0c, 0x00, 0x94, 0xc0, 0x33, 0xf6},
+	{0x21, 0x72, 0x0d, 0x00, 0xc1, 0xd5, 0x56, 0x06},
+}
+
+// vrc7Multipliers are the frequency multipliers of the operators, doubled.
+var vrc7Multipliers = [16]uint32{1, 2, 4, 6, 8, 10, 12, 14, 16, 18, 20, 20, 24, 24, 30, 30}
+
+// vrc7KeyScaleLevels are the attenuations in dB of the top four bits of the
+// F-number in block 7. They drop 6 dB per block below.
+var vrc7KeyScaleLevels = [16]float64{
+	0, 9, 12, 13.875, 15, 16.125, 16.875, 17.625,
+	18, 18.75, 19.125, 19.5, 19.875, 20.25, 20.625, 21,
+}
+
+// vrc7EnvelopeIncrements are the patterns of the envelope steps for the low
+// two bits of the rate.
+var vrc7EnvelopeIncrements = [4][8]int{
+	{0, 1, 0, 1, 0, 1, 0, 1},
+	{0, 1, 0, 1, 1, 1, 0, 1},
+	{0, 1, 1, 1, 0, 1, 1, 1},
+	{0, 1, 1, 1, 1, 1, 1, 1},
+}
+
+// vrc7Vibrato is the shape of the vibrato, in 256ths of the F-number,
+// stepped every 1024 samples for about 6.1 Hz.
+var vrc7Vibrato = [8]int{0, 1, 2, 1, 0, -1, -2, -1}
+
+// The tremolo is a triangle up to vrc7TremoloDepth steps of attenuation,
+// about 4.8 dB, stepped every 512 samples for about 3.7 Hz.
+const (
+	vrc7TremoloDepth = 13
+	vrc7TremoloSteps = 2 * vrc7TremoloDepth
+)
+
+var (
+	vrc7Sine       [1 << vrc7SineBits]float32
+	vrc7Amplitudes [vrc7AttenuationSteps]float32
+)
+
+func init() {
+	for i := range vrc7Sine {
+		vrc7Sine[i] = float32(math.Sin(2 * math.Pi * float64(i) / float64(len(vrc7Sine))))
+	}
+
+	for i := range vrc7Amplitudes {
+		vrc7Amplitudes[i] = float32(math.Pow(10, -0.375*float64(i)/20))
+	}
+}
+
+// Vrc7 is the sound of the Konami VRC7: six channels of two-operator FM
+// synthesis, a cut-down Yamaha YM2413 (OPLL) with its own set of built-in
+// instruments and one custom instrument. The register is selected at $9010
+// and written at $9030; bit 6 of $E000 silences the chip.
+type Vrc7 struct {
+	reg      uint8
+	custom   [8]uint8
+	channels [6]vrc7Channel
+	silenced bool
+
+	timer int
+	// samples counts the samples, the clock of the envelopes, the vibrato
+	// and the tremolo.
+	samples uint32
+	out     float32
+}
+
+type vrc7Channel struct {
+	fnum       uint16
+	block      uint8
+	key        bool
+	sustain    bool
+	instrument uint8
+	volume     uint8
+
+	modulator vrc7Operator
+	carrier   vrc7Operator
+}
+
+type vrc7EnvelopeState int
+
+const (
+	vrc7Off vrc7EnvelopeState = iota
+	vrc7Attack
+	vrc7Decay
+	vrc7Sustain
+	vrc7Release
+)
+
+type vrc7Operator struct {
+	phase uint32
+	state vrc7EnvelopeState
+	// level is the attenuation of the envelope, 0 to vrc7MaxLevel.
+	level int
+	// out are the last two outputs, for the feedback of the modulator.
+	out [2]float32
+}
+
+// vrc7Params are the parameters of an operator, decoded from a patch.
+type vrc7Params struct {
+	tremolo  bool
+	vibrato  bool
+	sustains bool
+	ksr      bool
+	mult     uint32
+	ksl      uint8
+	rectify  bool
+	attack   uint8
+	decay    uint8
+	sustain  uint8
+	release  uint8
+}
+
+func decodeVrc7Params(patch *[8]uint8, op int) vrc7Params {
+	b := patch[op]
+
+	p := vrc7Params{
+		tremolo:  b&0x80 != 0,
+		vibrato:  b&0x40 != 0,
+		sustains: b&0x20 != 0,
+		ksr:      b&0x10 != 0,
+		mult:     vrc7Multipliers[b&0x0f],
+		ksl:      patch[2+op] >> 6,
+		attack:   patch[4+op] >> 4,
+		decay:    patch[4+op] & 0x0f,
+		sustain:  patch[6+op] >> 4,
+		release:  patch[6+op] & 0x0f,
+	}
+
+	if op == 0 {
+		p.rectify = patch[3]&0x08 != 0
+	} else {
+		p.rectify = patch[3]&0x10 != 0
+	}
+
+	return p
+}
+
+// NewVrc7 returns a VRC7 with its channels keyed off.
+func NewVrc7() *Vrc7 {
+	v := &Vrc7{}
+
+	for i := range v.channels {
+		v.channels[i].modulator.level = vrc7MaxLevel
+		v.channels[i].carrier.level = vrc7MaxLevel
+	}
+
+	return v
+}
+
+func (v *Vrc7) Write(addr uint16, data uint8) {
+	switch addr & 0xf030 {
+	case 0x9010:
+		v.reg = data
+	case 0x9030:
+		v.writeRegister(v.reg, data)
+	}
+
+	if addr&0xf000 == 0xe000 {
+		v.silenced = data&0x40 != 0
+	}
+}
+
+func (v *Vrc7) writeRegister(reg, data uint8) {
+	if reg < 8 {
+		v.custom[reg] = data
+		return
+	}
+
+	ch := int(reg & 0x0f)
+	if ch >= len(v.channels) {
+		return
+	}
+
+	c := &v.channels[ch]
+
+	switch reg & 0xf0 {
+	case 0x10:
+		c.fnum = c.fnum&0x100 | uint16(data)
+	case 0x20:
+		c.fnum = c.fnum&0x0ff | uint16(data&0x01)<<8
+		c.block = data >> 1 & 0x07
+		c.sustain = data&0x20 != 0
+
+		key := data&0x10 != 0
+		if key && !c.key {
+			c.keyOn()
+		} else if !key && c.key {
+			c.keyOff()
+		}
+
+		c.key = key
+	case 0x30:
+		c.instrument = data >> 4
+		c.volume = data & 0x0f
+	}
+}
+
+func (c *vrc7Channel) keyOn() {
+	for _, op := range []*vrc7Operator{&c.modulator, &c.carrier} {
+		op.phase = 0
+		op.state = vrc7Attack
+	}
+}
+
+func (c *vrc7Channel) keyOff() {
+	for _, op := range []*vrc7Operator{&c.modulator, &c.carrier} {
+		if op.state != vrc7Off {
+			op.state = vrc7Release
+		}
+	}
+}
+
+func (v *Vrc7) TickAudio() {
+	v.timer++
+	if v.timer < vrc7SampleCycles {
+		return
+	}
+
+	v.timer = 0
+	v.samples++
+
+	var out float32
+
+	for i := range v.channels {
+		out += v.sample(&v.channels[i])
+	}
+
+	if v.silenced {
+		out = 0
+	}
+
+	v.out = out * vrc7Scale
+}
+
+// sample advances the channel by a sample and returns its output, the
+// output of the carrier modulated by the modulator.
+func (v *Vrc7) sample(c *vrc7Channel) float32 {
+	patch := &vrc7Patches[c.instrument]
+	if c.instrument == 0 {
+		patch = &v.custom
+	}
+
+	mod := decodeVrc7Params(patch, 0)
+	car := decodeVrc7Params(patch, 1)
+
+	// The modulator is attenuated by its total level in steps of 0.75 dB,
+	// the carrier by the channel's volume in steps of 3 dB.
+	modLevel := int(patch[2]&0x3f) * 2
+	carLevel := int(c.volume) * 8
+
+	feedback := patch[3] & 0x07
+
+	var modulation float32
+	if feedback > 0 {
+		modulation = (c.modulator.out[0] + c.modulator.out[1]) / float32(int(1)<<(7-feedback))
+	}
+
+	m := v.operator(c, &c.modulator, mod, modLevel, modulation)
+	c.modulator.out[1] = c.modulator.out[0]
+	c.modulator.out[0] = m
+
+	// The modulator at full scale shifts the carrier by four cycles.
+	return v.operator(c, &c.carrier, car, carLevel, 4*m)
+}
+
+// operator advances the operator by a sample and returns its output, -1 to
+// 1. The modulation is the shift of its phase in cycles.
+func (v *Vrc7) operator(c *vrc7Channel, op *vrc7Operator, p vrc7Params, level int, modulation float32) float32 {
+	v.clockEnvelope(c, op, p)
+
+	fnum := int(c.fnum)
+	if p.vibrato {
+		fnum += fnum * vrc7Vibrato[v.samples>>10&0x07] >> 8
+	}
+
+	op.phase += uint32(fnum) << c.block * p.mult >> 2
+	op.phase &= 1<<vrc7PhaseBits - 1
+
+	if op.state == vrc7Off {
+		return 0
+	}
+
+	attenuation := op.level + level + v.keyScale(c, p.ksl)
+	if p.tremolo {
+		attenuation += v.tremolo()
+	}
+
+	if attenuation >= vrc7AttenuationSteps {
+		return 0
+	}
+
+	shift := int32(modulation * (1 << vrc7PhaseBits))
+	phase := uint32(int32(op.phase) + shift)
+	sine := vrc7Sine[phase>>(vrc7PhaseBits-vrc7SineBits)&(1<<vrc7SineBits-1)]
+
+	if p.rectify && sine < 0 {
+		return 0
+	}
+
+	return sine * vrc7Amplitudes[attenuation]
+}
+
+// keyScale returns the attenuation of the key scale level for the pitch of
+// the channel, in steps of 0.375 dB: none, or 1.5, 3 or 6 dB per octave.
+func (v *Vrc7) keyScale(c *vrc7Channel, ksl uint8) int {
+	if ksl == 0 {
+		return 0
+	}
+
+	db := vrc7KeyScaleLevels[c.fnum>>5] - 6*float64(7-c.block)
+	if db <= 0 {
+		return 0
+	}
+
+	return int(db/0.375) >> (3 - ksl)
+}
+
+// tremolo returns the attenuation of the tremolo in steps of 0.375 dB.
+func (v *Vrc7) tremolo() int {
+	step := int(v.samples>>9) % vrc7TremoloSteps
+	if step > vrc7TremoloDepth {
+		return vrc7TremoloSteps - step
+	}
+
+	return step
+}
+
+// clockEnvelope advances the envelope of the operator by a sample. The
+// envelope attacks to full volume, decays to the sustain level, then holds
+// there for a sustained instrument or keeps decaying at the release rate
+// for a percussive one, and releases when the key goes off.
+func (v *Vrc7) clockEnvelope(c *vrc7Channel, op *vrc7Operator, p vrc7Params) {
+	// The key scale rate speeds the envelope up for the higher notes.
+	keyCode := int(c.block)<<1 | int(c.fnum>>8)
+	if !p.ksr {
+		keyCode >>= 2
+	}
+
+	var r uint8
+
+	switch op.state {
+	case vrc7Off:
+		return
+	case vrc7Attack:
+		r = p.attack
+	case vrc7Decay:
+		r = p.decay
+	case vrc7Sustain:
+		if p.sustains {
+			return
+		}
+
+		r = p.release
+	case vrc7Release:
+		switch {
+		case c.sustain:
+			r = 5
+		case p.sustains:
+			r = p.release
+		default:
+			r = 7
+		}
+	}
+
+	if r == 0 {
+		return
+	}
+
+	rate := 4*int(r) + keyCode
+	if rate > 63 {
+		rate = 63
+	}
+
+	if op.state == vrc7Attack {
+		if rate >= 60 {
+			op.level = 0
+		} else if inc := v.envelopeIncrement(rate); inc > 0 {
+			op.level -= (op.level*inc + 7) >> 3
+		}
+
+		if op.level <= 0 {
+			op.level = 0
+			op.state = vrc7Decay
+		}
+
+		return
+	}
+
+	op.level += v.envelopeIncrement(rate)
+
+	if op.state == vrc7Decay && op.level >= int(p.sustain)*8 {
+		op.state = vrc7Sustain
+	}
+
+	if op.level >= vrc7MaxLevel {
+		op.level = vrc7MaxLevel
+		op.state = vrc7Off
+	}
+}
+
+// envelopeIncrement returns the step of the envelope at the rate on the
+// current sample. The low rates step every 2^n samples; the highest ones
+// several steps a sample.
+func (v *Vrc7) envelopeIncrement(rate int) int {
+	shift := 13 - rate>>2
+	pattern := &vrc7EnvelopeIncrements[rate&3]
+
+	if shift > 0 {
+		if v.samples&(1<<shift-1) != 0 {
+			return 0
+		}
+
+		return pattern[v.samples>>shift&0x07]
+	}
+
+	return pattern[v.samples&0x07] << -shift
+}
+
+func (v *Vrc7) AudioOutput() float32 {
+	return v.out
+}
@@ -0,0 +1,199 @@
+package apu
+
+import (
+	"math"
+	"testing"
+)
+
+// writeVrc7 writes the data to the register of the VRC7.
+func writeVrc7(v *Vrc7, reg, data uint8) {
+	v.Write(0x9010, reg)
+	v.Write(0x9030, data)
+}
+
+// vrc7SinePatch is a custom instrument whose carrier is a plain sine that
+// attacks at once and sustains at full volume. The modulator is attenuated
+// by 47 dB and never attacks, so it is silent.
+var vrc7SinePatch = [8]uint8{
+	0x01, 0x21, 0x3f, 0x00,
+	0x00, 0xf0, 0x00, 0x0f,
+}
+
+// playVrc7Sine plays the sine patch on the channel at the volume, with the
+// F-number 256 in block 4: a period of 128 samples.
+func playVrc7Sine(v *Vrc7, channel, volume uint8) {
+	for reg, data := range vrc7SinePatch {
+		writeVrc7(v, uint8(reg), data)
+	}
+
+	writeVrc7(v, 0x30+channel, volume)
+	writeVrc7(v, 0x10+channel, 0x00)
+	writeVrc7(v, 0x20+channel, 0x10|4<<1|0x01)
+}
+
+func TestVrc7Registers(t *testing.T) {
+	v := NewVrc7()
+
+	writeVrc7(v, 0x05, 0xab)
+	writeVrc7(v, 0x15, 0x34)
+	writeVrc7(v, 0x25, 0x3b)
+	writeVrc7(v, 0x35, 0x7c)
+	// There are only six channels.
+	writeVrc7(v, 0x16, 0xff)
+	writeVrc7(v, 0x26, 0xff)
+
+	if v.custom[5] != 0xab {
+		t.Errorf("got custom patch % X", v.custom)
+	}
+
+	c := v.channels[5]
+
+	if c.fnum != 0x134 || c.block != 5 || !c.key || !c.sustain || c.instrument != 7 || c.volume != 0x0c {
+		t.Errorf("got channel %+v", c)
+	}
+
+	if c.carrier.state != vrc7Attack || c.modulator.state != vrc7Attack {
+		t.Errorf("the key on didn't start the attack")
+	}
+
+	writeVrc7(v, 0x25, 0x0b)
+
+	if c := v.channels[5]; c.key || c.carrier.state != vrc7Release {
+		t.Errorf("the key off didn't start the release")
+	}
+
+	// The ports are decoded on A12-A15 and A4-A5.
+	v.Write(0x9f1f, 0x10)
+	v.Write(0x9f3f, 0x80)
+
+	if v.channels[0].fnum != 0x80 {
+		t.Errorf("got F-number $%X through the mirrors, want $80", v.channels[0].fnum)
+	}
+}
+
+func TestVrc7SamplesAtChipRate(t *testing.T) {
+	v := NewVrc7()
+	playVrc7Sine(v, 0, 0)
+
+	prev := v.AudioOutput()
+
+	for cycle := 1; cycle <= 64*vrc7SampleCycles; cycle++ {
+		v.TickAudio()
+
+		if out := v.AudioOutput(); out != prev && cycle%vrc7SampleCycles != 0 {
+			t.Fatalf("the output changed on cycle %d, between the samples", cycle)
+		}
+
+		prev = v.AudioOutput()
+	}
+}
+
+func TestVrc7Level(t *testing.T) {
+	v := NewVrc7()
+	playVrc7Sine(v, 0, 0)
+
+	// A channel at full volume peaks about as high as an APU pulse at full
+	// volume.
+	low, high := outputRange(v, 256*vrc7SampleCycles)
+	checkLevel(t, "peak", float64(high), apuPulseFull, 1e-2)
+	checkLevel(t, "trough", float64(low), -apuPulseFull, 1e-2)
+
+	// The volume attenuates the carrier in steps of 3 dB.
+	for volume := uint8(1); volume < 4; volume++ {
+		writeVrc7(v, 0x30, volume)
+
+		_, high := outputRange(v, 256*vrc7SampleCycles)
+		checkLevel(t, "volume", float64(high), apuPulseFull*math.Pow(10, -3*float64(volume)/20), 1e-2)
+	}
+
+	// The channels add up.
+	writeVrc7(v, 0x30, 0x00)
+	playVrc7Sine(v, 1, 0)
+
+	_, high = outputRange(v, 256*vrc7SampleCycles)
+	checkLevel(t, "two channels", float64(high), 2*apuPulseFull, 1e-2)
+}
+
+func TestVrc7Pitch(t *testing.T) {
+	v := NewVrc7()
+	playVrc7Sine(v, 0, 0)
+
+	// The phase advances F-number << block * multiple / 4 every sample:
+	// 256 << 4 * 2 / 4 = 2048 of 2^18, a period of 128 samples.
+	crossings := 0
+	prev := v.AudioOutput()
+
+	for sample := 0; sample < 128*8; sample++ {
+		tickAudio(v, vrc7SampleCycles)
+
+		if out := v.AudioOutput(); prev < 0 && out >= 0 {
+			crossings++
+		}
+
+		prev = v.AudioOutput()
+	}
+
+	if crossings != 8 {
+		t.Errorf("got %d periods in 8*128 samples, want 8", crossings)
+	}
+}
+
+func TestVrc7Release(t *testing.T) {
+	v := NewVrc7()
+	playVrc7Sine(v, 0, 0)
+	tickAudio(v, 16*vrc7SampleCycles)
+
+	writeVrc7(v, 0x20, 4<<1|0x01)
+
+	// The release rate 15 takes the envelope to off in a few dozen
+	// samples.
+	tickAudio(v, 64*vrc7SampleCycles)
+
+	if v.channels[0].carrier.state != vrc7Off {
+		t.Errorf("the carrier is in state %d after the release", v.channels[0].carrier.state)
+	}
+
+	if low, high := outputRange(v, 256*vrc7SampleCycles); low != 0 || high != 0 {
+		t.Errorf("got %f to %f after the release", low, high)
+	}
+}
+
+func TestVrc7Silence(t *testing.T) {
+	v := NewVrc7()
+	playVrc7Sine(v, 0, 0)
+
+	v.Write(0xe000, 0x40)
+
+	if low, high := outputRange(v, 256*vrc7SampleCycles); low != 0 || high != 0 {
+		t.Errorf("got %f to %f while silenced", low, high)
+	}
+
+	v.Write(0xe000, 0x00)
+
+	if _, high := outputRange(v, 256*vrc7SampleCycles); high == 0 {
+		t.Error("silent after the sound was enabled again")
+	}
+}
+
+func TestVrc7BuiltInInstruments(t *testing.T) {
+	// Every built-in instrument sounds and stays within the level of a
+	// channel, whatever its modulation adds.
+	for instrument := uint8(1); instrument < 16; instrument++ {
+		v := NewVrc7()
+		writeVrc7(v, 0x30, instrument<<4)
+		writeVrc7(v, 0x10, 0x00)
+		writeVrc7(v, 0x20, 0x10|4<<1|0x01)
+
+		low, high := outputRange(v, 4096*vrc7SampleCycles)
+
+		// Some instruments rectify the carrier, so only the peak is
+		// checked.
+		if high <= 0 {
+			t.Errorf("instrument %d: got %f to %f, want a wave", instrument, low, high)
+		}
+
+		if high > apuPulseFull*1.0001 || low < -apuPulseFull*1.0001 {
+			t.Errorf("instrument %d: got %f to %f, louder than a channel", instrument, low, high)
+		}
+	}
+}
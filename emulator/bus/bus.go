@@ -1,17 +1,216 @@
 package bus
 
-import (
-	"github.com/pqkallio/nes-emulator/emulator/ram"
-)
+import "fmt"
 
+// Device is a component mapped to the CPU address space. The address passed
+// to it is the full CPU address with the mirroring mask of the mapping
+// applied.
+type Device interface {
+	Read(addr uint16) uint8
+	Write(addr uint16, data uint8)
+}
+
+// OpenBusDevice is implemented by devices that don't drive all the data
+// lines on a read, e.g. the controller ports. ReadDriven returns the value
+// and a mask of the bits the device drives; the other bits read as the value
+// last driven on the data bus.
+type OpenBusDevice interface {
+	Device
+	ReadDriven(addr uint16) (data uint8, driven uint8)
+}
+
+// Peeker is implemented by devices whose reads have side effects, e.g. the
+// PPU status register. Peek returns the value a read would return without
+// the side effects.
+type Peeker interface {
+	Peek(addr uint16) uint8
+}
+
+// OpenBusPeeker is implemented by open bus devices whose reads have side
+// effects, e.g. the APU status register. PeekDriven returns what ReadDriven
+// would return without the side effects.
+type OpenBusPeeker interface {
+	PeekDriven(addr uint16) (data uint8, driven uint8)
+}
+
+type mapping struct {
+	start   uint16
+	end     uint16
+	mask    uint16
+	device  Device
+	openBus OpenBusDevice
+	peeker  Peeker
+	// openBusPeeker is set if the device implements OpenBusPeeker.
+	openBusPeeker OpenBusPeeker
+}
+
+// page lists the mappings that overlap a 256 byte page of the address space,
+// the most recently registered first. If a single mapping covers the whole
+// page, it is stored in whole and the list isn't searched.
+type page struct {
+	whole    *mapping
+	mappings []*mapping
+}
+
+// Bus is the CPU address decoder. Devices are registered over address ranges
+// and the reads and writes are routed to them through a page table.
 type Bus struct {
-	ram *ram.Ram
+	mappings []*mapping
+	pages    [256]page
+	// dataBus is the value last driven on the data bus. The capacitance of
+	// the bus holds it long enough to be read back when nothing drives the
+	// bus during a read.
+	dataBus uint8
+
+	clock            Clock
+	watchpoints      []watchpoint
+	nextWatchpointId int
+	accessLog        *AccessLog
+	// hooked tells whether there are watchpoints or an access log to notify
+	// of the accesses.
+	hooked bool
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Map registers the device over the address range from start to end,
+// inclusive. The address is ANDed with the mask before it is passed to the
+// device, so e.g. the internal RAM is mapped with
+//
+//	b.Map(0x0000, 0x1fff, 0x07ff, ram)
+//
+// to be mirrored every 2 KiB. A mapping registered later takes precedence
+// over the earlier ones where they overlap.
+func (b *Bus) Map(start, end, mask uint16, device Device) error {
+	if start > end {
+		return fmt.Errorf("invalid address range $%04X-$%04X", start, end)
+	}
+
+	if device == nil {
+		return fmt.Errorf("no device given for $%04X-$%04X", start, end)
+	}
+
+	m := &mapping{start: start, end: end, mask: mask, device: device}
+	m.openBus, _ = device.(OpenBusDevice)
+	m.peeker, _ = device.(Peeker)
+	m.openBusPeeker, _ = device.(OpenBusPeeker)
+	b.mappings = append(b.mappings, m)
+
+	for p := int(start >> 8); p <= int(end>>8); p++ {
+		b.updatePage(p)
+	}
+
+	return nil
+}
+
+func (b *Bus) updatePage(p int) {
+	pageStart, pageEnd := uint16(p<<8), uint16(p<<8|0xff)
+
+	pg := page{}
+
+	for i := len(b.mappings) - 1; i >= 0; i-- {
+		m := b.mappings[i]
+
+		if m.end < pageStart || m.start > pageEnd {
+			continue
+		}
+
+		if len(pg.mappings) == 0 && m.start <= pageStart && m.end >= pageEnd {
+			pg.whole = m
+			break
+		}
+
+		pg.mappings = append(pg.mappings, m)
+
+		if m.start <= pageStart && m.end >= pageEnd {
+			// Nothing below a mapping covering the whole page is reachable.
+			break
+		}
+	}
+
+	b.pages[p] = pg
+}
+
+func (b *Bus) lookup(addr uint16) *mapping {
+	pg := &b.pages[addr>>8]
+	if pg.whole != nil {
+		return pg.whole
+	}
+
+	for _, m := range pg.mappings {
+		if addr >= m.start && addr <= m.end {
+			return m
+		}
+	}
+
+	return nil
 }
 
 func (b *Bus) WriteData(addr uint16, data uint8) {
-	b.ram.Write(addr, data)
+	b.dataBus = data
+
+	if m := b.lookup(addr); m != nil {
+		m.device.Write(addr&m.mask, data)
+	}
+
+	if b.hooked {
+		b.notify(addr, data, Write)
+	}
 }
 
+// ReadData reads from the device mapped to the address. The bits that no
+// device drives, e.g. on a read from an unmapped address, read as the value
+// last driven on the data bus.
 func (b *Bus) ReadData(addr uint16) uint8 {
-	return b.ram.Read(addr)
+	return b.readAs(addr, Read)
+}
+
+// readAs reads from the device mapped to the address and reports the access
+// as the given kind.
+func (b *Bus) readAs(addr uint16, kind AccessKind) uint8 {
+	m := b.lookup(addr)
+
+	switch {
+	case m == nil:
+	case m.openBus != nil:
+		data, driven := m.openBus.ReadDriven(addr & m.mask)
+		b.dataBus = data&driven | b.dataBus&^driven
+	default:
+		b.dataBus = m.device.Read(addr & m.mask)
+	}
+
+	if b.hooked {
+		b.notify(addr, b.dataBus, kind)
+	}
+
+	return b.dataBus
+}
+
+// Peek returns the value at the address without side effects, for debuggers
+// and the like. The access isn't reported to the watchpoints or the access
+// log, and the open bus isn't updated.
+func (b *Bus) Peek(addr uint16) uint8 {
+	m := b.lookup(addr)
+
+	switch {
+	case m == nil:
+		return b.dataBus
+	case m.openBusPeeker != nil:
+		data, driven := m.openBusPeeker.PeekDriven(addr & m.mask)
+		return data&driven | b.dataBus&^driven
+	case m.peeker != nil:
+		return m.peeker.Peek(addr & m.mask)
+	case m.openBus != nil:
+		data, driven := m.openBus.ReadDriven(addr & m.mask)
+		return data&driven | b.dataBus&^driven
+	default:
+		return m.device.Read(addr & m.mask)
+	}
+}
+
+// OpenBus returns the value last driven on the data bus.
+func (b *Bus) OpenBus() uint8 {
+	return b.dataBus
 }
@@ -0,0 +1,274 @@
+package bus
+
+import "testing"
+
+// tagDevice reads as its tag and records the addresses passed to it.
+type tagDevice struct {
+	tag   uint8
+	addrs []uint16
+}
+
+func (d *tagDevice) Read(addr uint16) uint8 {
+	d.addrs = append(d.addrs, addr)
+	return d.tag
+}
+
+func (d *tagDevice) Write(addr uint16, data uint8) {
+	d.addrs = append(d.addrs, addr)
+}
+
+// statusDevice is a register whose reads clear bit 7, like the PPU status
+// register.
+type statusDevice struct {
+	status uint8
+}
+
+func (d *statusDevice) Read(addr uint16) uint8 {
+	status := d.status
+	d.status &^= 0x80
+
+	return status
+}
+
+func (d *statusDevice) Write(addr uint16, data uint8) {}
+
+func (d *statusDevice) Peek(addr uint16) uint8 {
+	return d.status
+}
+
+// portDevice drives only the bit 0, like a controller port.
+type portDevice struct {
+	bit uint8
+}
+
+func (d *portDevice) Read(addr uint16) uint8 {
+	data, _ := d.ReadDriven(addr)
+	return data
+}
+
+func (d *portDevice) Write(addr uint16, data uint8) {}
+
+func (d *portDevice) ReadDriven(addr uint16) (uint8, uint8) {
+	return d.bit, 0x01
+}
+
+// irqDevice drives all the bits but 5, and its reads clear bit 6, like the
+// APU status register.
+type irqDevice struct {
+	status uint8
+}
+
+func (d *irqDevice) Read(addr uint16) uint8 {
+	data, _ := d.ReadDriven(addr)
+	return data
+}
+
+func (d *irqDevice) Write(addr uint16, data uint8) {}
+
+func (d *irqDevice) ReadDriven(addr uint16) (uint8, uint8) {
+	status := d.status
+	d.status &^= 0x40
+
+	return status, 0xdf
+}
+
+func (d *irqDevice) PeekDriven(addr uint16) (uint8, uint8) {
+	return d.status, 0xdf
+}
+
+func mapDevice(t *testing.T, b *Bus, start, end, mask uint16, device Device) {
+	t.Helper()
+
+	if err := b.Map(start, end, mask, device); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMapPrecedence(t *testing.T) {
+	b := NewBus()
+
+	mapDevice(t, b, 0x0000, 0xffff, 0xffff, &tagDevice{tag: 'a'})
+	mapDevice(t, b, 0x2000, 0x3fff, 0xffff, &tagDevice{tag: 'b'})
+	// A part of a page over a mapping of whole pages.
+	mapDevice(t, b, 0x2408, 0x2410, 0xffff, &tagDevice{tag: 'c'})
+	// A range across the boundary of two pages, partly over c.
+	mapDevice(t, b, 0x24f0, 0x2507, 0xffff, &tagDevice{tag: 'd'})
+	mapDevice(t, b, 0x2410, 0x2418, 0xffff, &tagDevice{tag: 'e'})
+	// A whole page over the partial mappings of the page.
+	mapDevice(t, b, 0x2600, 0x2620, 0xffff, &tagDevice{tag: 'f'})
+	mapDevice(t, b, 0x2600, 0x26ff, 0xffff, &tagDevice{tag: 'g'})
+	// A partial mapping over the whole page mapped before.
+	mapDevice(t, b, 0x2680, 0x2680, 0xffff, &tagDevice{tag: 'h'})
+
+	tests := []struct {
+		addr uint16
+		want uint8
+	}{
+		{0x1fff, 'a'},
+		{0x2000, 'b'},
+		{0x2407, 'b'},
+		{0x2408, 'c'},
+		{0x240f, 'c'},
+		{0x2410, 'e'},
+		{0x2418, 'e'},
+		{0x2419, 'b'},
+		{0x24ef, 'b'},
+		{0x24f0, 'd'},
+		{0x2500, 'd'},
+		{0x2507, 'd'},
+		{0x2508, 'b'},
+		{0x2600, 'g'},
+		{0x2620, 'g'},
+		{0x267f, 'g'},
+		{0x2680, 'h'},
+		{0x2681, 'g'},
+		{0x3fff, 'b'},
+		{0x4000, 'a'},
+		{0xffff, 'a'},
+	}
+
+	for _, test := range tests {
+		if got := b.ReadData(test.addr); got != test.want {
+			t.Errorf("$%04X: got %c, want %c", test.addr, got, test.want)
+		}
+	}
+}
+
+func TestMapMirroring(t *testing.T) {
+	b := NewBus()
+	ram := &testMemory{}
+	ppu := &tagDevice{}
+
+	mapDevice(t, b, 0x0000, 0x1fff, 0x07ff, ram)
+	mapDevice(t, b, 0x2000, 0x3fff, 0x2007, ppu)
+
+	b.WriteData(0x1801, 0x42)
+
+	if ram.data[0x0001] != 0x42 {
+		t.Errorf("got $%02X at $0001, want $42", ram.data[0x0001])
+	}
+
+	for _, addr := range []uint16{0x0001, 0x0801, 0x1001} {
+		if got := b.ReadData(addr); got != 0x42 {
+			t.Errorf("$%04X: got $%02X, want $42", addr, got)
+		}
+	}
+
+	b.ReadData(0x2002)
+	b.ReadData(0x3ffa)
+	b.WriteData(0x2009, 0)
+
+	want := []uint16{0x2002, 0x2002, 0x2001}
+	if len(ppu.addrs) != len(want) {
+		t.Fatalf("got addresses %X, want %X", ppu.addrs, want)
+	}
+
+	for i := range want {
+		if ppu.addrs[i] != want[i] {
+			t.Errorf("access %d: got $%04X, want $%04X", i, ppu.addrs[i], want[i])
+		}
+	}
+}
+
+func TestMapErrors(t *testing.T) {
+	b := NewBus()
+
+	if err := b.Map(0x2000, 0x1fff, 0xffff, &tagDevice{}); err == nil {
+		t.Error("a range ending before its start was accepted")
+	}
+
+	if err := b.Map(0x0000, 0x1fff, 0xffff, nil); err == nil {
+		t.Error("a mapping without a device was accepted")
+	}
+
+	if got := b.ReadData(0x1000); got != 0 {
+		t.Errorf("got $%02X from a rejected mapping, want the open bus", got)
+	}
+}
+
+func TestOpenBus(t *testing.T) {
+	b := NewBus()
+	port := &portDevice{bit: 1}
+
+	mapDevice(t, b, 0x0000, 0x07ff, 0x07ff, &testMemory{})
+	mapDevice(t, b, 0x4016, 0x4016, 0xffff, port)
+
+	// LDA $4016 leaves the high byte of the address, $40, on the bus
+	// before the port is read.
+	b.WriteData(0x0000, 0x40)
+
+	if got := b.ReadData(0x4016); got != 0x41 {
+		t.Errorf("got $%02X from the port, want $41", got)
+	}
+
+	if got := b.ReadData(0x5000); got != 0x41 {
+		t.Errorf("got $%02X from an unmapped address, want the open bus $41", got)
+	}
+
+	b.WriteData(0x6000, 0x5a)
+
+	if got := b.ReadData(0x6000); got != 0x5a {
+		t.Errorf("got $%02X after a write to an unmapped address, want $5A", got)
+	}
+
+	if got := b.ReadData(0x0000); got != 0x40 || b.OpenBus() != 0x40 {
+		t.Errorf("got $%02X and an open bus of $%02X, want $40", got, b.OpenBus())
+	}
+}
+
+func TestPeekHasNoSideEffects(t *testing.T) {
+	b := NewBus()
+	ram := &testMemory{}
+	status := &statusDevice{status: 0x80}
+	port := &portDevice{bit: 1}
+	irq := &irqDevice{status: 0x40}
+
+	mapDevice(t, b, 0x0000, 0x07ff, 0x07ff, ram)
+	mapDevice(t, b, 0x2002, 0x2002, 0xffff, status)
+	mapDevice(t, b, 0x4015, 0x4015, 0xffff, irq)
+	mapDevice(t, b, 0x4016, 0x4016, 0xffff, port)
+
+	var watched int
+	b.AddWatchpoint(Watchpoint{Start: 0x0000, End: 0xffff, Kind: Read | Write | Execute, Callback: func(Access) { watched++ }})
+
+	ram.data[0x10] = 0x22
+	b.WriteData(0x0000, 0xe0)
+	watched = 0
+
+	tests := []struct {
+		name string
+		addr uint16
+		want uint8
+	}{
+		{"memory", 0x0010, 0x22},
+		{"peeker", 0x2002, 0x80},
+		{"open bus peeker", 0x4015, 0x60},
+		{"open bus device", 0x4016, 0xe1},
+		{"unmapped", 0x5000, 0xe0},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 2; i++ {
+			if got := b.Peek(test.addr); got != test.want {
+				t.Errorf("%s: peek %d got $%02X, want $%02X", test.name, i, got, test.want)
+			}
+		}
+	}
+
+	if b.OpenBus() != 0xe0 || watched != 0 {
+		t.Errorf("peeking changed the open bus to $%02X and notified %d watchpoints", b.OpenBus(), watched)
+	}
+
+	// The reads have the side effects.
+	if got := b.ReadData(0x2002); got != 0x80 || b.Peek(0x2002) != 0x00 {
+		t.Errorf("got $%02X and then $%02X from the status register, want $80 and $00", got, b.Peek(0x2002))
+	}
+
+	if got := b.ReadData(0x4015); got != 0x40 || b.Peek(0x4015) != 0x00 {
+		t.Errorf("got $%02X and then $%02X from the IRQ status, want $40 and $00", got, b.Peek(0x4015))
+	}
+
+	if watched != 2 {
+		t.Errorf("notified %d watchpoints for 2 reads", watched)
+	}
+}
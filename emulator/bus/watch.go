@@ -0,0 +1,196 @@
+package bus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AccessKind is the kind of a bus access. The kinds are bit flags, so a
+// watchpoint can watch several kinds at once.
+type AccessKind uint8
+
+const (
+	Read AccessKind = 1 << iota
+	Write
+	// Execute is a read of an opcode.
+	Execute
+)
+
+func (k AccessKind) String() string {
+	var kinds []string
+
+	if k&Read != 0 {
+		kinds = append(kinds, "read")
+	}
+
+	if k&Write != 0 {
+		kinds = append(kinds, "write")
+	}
+
+	if k&Execute != 0 {
+		kinds = append(kinds, "execute")
+	}
+
+	return strings.Join(kinds, "|")
+}
+
+// Access is a single access on the bus.
+type Access struct {
+	Cycle uint64
+	Addr  uint16
+	Value uint8
+	Kind  AccessKind
+}
+
+func (a Access) String() string {
+	return fmt.Sprintf("%d $%04X $%02X %s", a.Cycle, a.Addr, a.Value, a.Kind)
+}
+
+// Clock provides the cycle count the accesses are stamped with. *cpu.Cpu
+// implements it.
+type Clock interface {
+	Cycles() uint64
+}
+
+// Watchpoint calls Callback on the accesses of the given kinds to the address
+// range from Start to End, inclusive. If Condition is set, it is called with
+// the value read or written and the watchpoint triggers only if it returns
+// true.
+type Watchpoint struct {
+	Start     uint16
+	End       uint16
+	Kind      AccessKind
+	Condition func(value uint8) bool
+	Callback  func(a Access)
+}
+
+func (w *Watchpoint) matches(a Access) bool {
+	return w.Kind&a.Kind != 0 &&
+		a.Addr >= w.Start && a.Addr <= w.End &&
+		(w.Condition == nil || w.Condition(a.Value))
+}
+
+// AccessLog keeps the latest accesses on the bus in a ring buffer.
+type AccessLog struct {
+	entries []Access
+	next    int
+	full    bool
+}
+
+// NewAccessLog returns a log that holds the given number of the latest
+// accesses.
+func NewAccessLog(size int) *AccessLog {
+	if size <= 0 {
+		panic(fmt.Sprintf("invalid access log size %d", size))
+	}
+
+	return &AccessLog{entries: make([]Access, size)}
+}
+
+func (l *AccessLog) add(a Access) {
+	l.entries[l.next] = a
+	l.next++
+
+	if l.next == len(l.entries) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// Entries returns the logged accesses, the oldest first.
+func (l *AccessLog) Entries() []Access {
+	if !l.full {
+		return append([]Access(nil), l.entries[:l.next]...)
+	}
+
+	entries := make([]Access, 0, len(l.entries))
+	entries = append(entries, l.entries[l.next:]...)
+
+	return append(entries, l.entries[:l.next]...)
+}
+
+// Clear empties the log.
+func (l *AccessLog) Clear() {
+	l.next = 0
+	l.full = false
+}
+
+// SetClock sets the clock the accesses are stamped with.
+func (b *Bus) SetClock(clock Clock) {
+	b.clock = clock
+}
+
+// AddWatchpoint registers a watchpoint and returns an id to remove it with.
+func (b *Bus) AddWatchpoint(w Watchpoint) int {
+	b.nextWatchpointId++
+	id := b.nextWatchpointId
+
+	b.watchpoints = append(b.watchpoints, watchpoint{id: id, Watchpoint: w})
+	b.updateHooked()
+
+	return id
+}
+
+// RemoveWatchpoint removes the watchpoint with the given id. It returns
+// false if there is no such watchpoint. It can be called from a callback;
+// the watchpoints are notified of the access in progress as they were when
+// it started.
+func (b *Bus) RemoveWatchpoint(id int) bool {
+	for i := range b.watchpoints {
+		if b.watchpoints[i].id == id {
+			// The list is copied, not changed in place, so the one notify
+			// is iterating over stays intact.
+			watchpoints := make([]watchpoint, 0, len(b.watchpoints)-1)
+			watchpoints = append(watchpoints, b.watchpoints[:i]...)
+			b.watchpoints = append(watchpoints, b.watchpoints[i+1:]...)
+			b.updateHooked()
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetAccessLog makes the bus log every access to the log. A nil log turns
+// the logging off.
+func (b *Bus) SetAccessLog(log *AccessLog) {
+	b.accessLog = log
+	b.updateHooked()
+}
+
+// FetchOpCode reads an opcode. It is a normal read, but the access is
+// reported as an execution to the watchpoints and the access log.
+func (b *Bus) FetchOpCode(addr uint16) uint8 {
+	return b.readAs(addr, Execute)
+}
+
+type watchpoint struct {
+	id int
+	Watchpoint
+}
+
+func (b *Bus) updateHooked() {
+	b.hooked = len(b.watchpoints) != 0 || b.accessLog != nil
+}
+
+func (b *Bus) notify(addr uint16, data uint8, kind AccessKind) {
+	a := Access{Addr: addr, Value: data, Kind: kind}
+	if b.clock != nil {
+		a.Cycle = b.clock.Cycles()
+	}
+
+	if b.accessLog != nil {
+		b.accessLog.add(a)
+	}
+
+	// The callbacks may add and remove watchpoints, which changes
+	// b.watchpoints but not the snapshot.
+	watchpoints := b.watchpoints
+
+	for i := range watchpoints {
+		if w := &watchpoints[i]; w.matches(a) {
+			w.Callback(a)
+		}
+	}
+}
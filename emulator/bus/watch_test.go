@@ -0,0 +1,156 @@
+package bus
+
+import "testing"
+
+// testMemory is a device of plain memory.
+type testMemory struct {
+	data [0x10000]uint8
+}
+
+func (m *testMemory) Read(addr uint16) uint8 {
+	return m.data[addr]
+}
+
+func (m *testMemory) Write(addr uint16, data uint8) {
+	m.data[addr] = data
+}
+
+func newTestBus(t *testing.T) (*Bus, *testMemory) {
+	t.Helper()
+
+	b := NewBus()
+	mem := &testMemory{}
+
+	if err := b.Map(0x0000, 0xffff, 0xffff, mem); err != nil {
+		t.Fatal(err)
+	}
+
+	return b, mem
+}
+
+func TestWatchpointTriggersOnKindAndRange(t *testing.T) {
+	b, _ := newTestBus(t)
+
+	var got []Access
+
+	b.AddWatchpoint(Watchpoint{
+		Start:     0x0200,
+		End:       0x02ff,
+		Kind:      Write | Execute,
+		Condition: func(value uint8) bool { return value != 0 },
+		Callback:  func(a Access) { got = append(got, a) },
+	})
+
+	b.WriteData(0x0200, 0x01)
+	b.WriteData(0x0300, 0x02)
+	b.WriteData(0x02ff, 0x00)
+	b.ReadData(0x0200)
+	b.FetchOpCode(0x0200)
+
+	want := []Access{{Addr: 0x0200, Value: 0x01, Kind: Write}, {Addr: 0x0200, Value: 0x01, Kind: Execute}}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWatchpointRemovedByCallback(t *testing.T) {
+	b, _ := newTestBus(t)
+
+	var ids []int
+	calls := make([]int, 3)
+
+	for i := range calls {
+		i := i
+
+		ids = append(ids, b.AddWatchpoint(Watchpoint{
+			Start: 0x0000,
+			End:   0xffff,
+			Kind:  Write,
+			Callback: func(Access) {
+				calls[i]++
+
+				// The first one removes itself and the last one.
+				if i == 0 {
+					b.RemoveWatchpoint(ids[0])
+					b.RemoveWatchpoint(ids[2])
+				}
+			},
+		}))
+	}
+
+	b.WriteData(0x0000, 0x01)
+
+	// The watchpoints are notified as they were when the write started.
+	for i, want := range []int{1, 1, 1} {
+		if calls[i] != want {
+			t.Errorf("watchpoint %d called %d times, want %d", i, calls[i], want)
+		}
+	}
+
+	b.WriteData(0x0000, 0x01)
+
+	for i, want := range []int{1, 2, 1} {
+		if calls[i] != want {
+			t.Errorf("watchpoint %d called %d times after the removals, want %d", i, calls[i], want)
+		}
+	}
+}
+
+func TestWatchpointAddedByCallback(t *testing.T) {
+	b, _ := newTestBus(t)
+
+	added := 0
+
+	b.AddWatchpoint(Watchpoint{
+		Start: 0x0000,
+		End:   0xffff,
+		Kind:  Read,
+		Callback: func(Access) {
+			b.AddWatchpoint(Watchpoint{Start: 0x0000, End: 0xffff, Kind: Read, Callback: func(Access) { added++ }})
+		},
+	})
+
+	b.ReadData(0x0000)
+
+	if added != 0 {
+		t.Errorf("a watchpoint added during a read was notified of it")
+	}
+
+	b.ReadData(0x0000)
+
+	if added != 1 {
+		t.Errorf("the added watchpoint was called %d times, want once", added)
+	}
+}
+
+func TestAccessLogKeepsLatestAccesses(t *testing.T) {
+	b, _ := newTestBus(t)
+
+	log := NewAccessLog(2)
+	b.SetAccessLog(log)
+
+	b.WriteData(0x0001, 0x10)
+	b.ReadData(0x0001)
+	b.FetchOpCode(0x0002)
+
+	want := []Access{{Addr: 0x0001, Value: 0x10, Kind: Read}, {Addr: 0x0002, Kind: Execute}}
+	got := log.Entries()
+
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	b.SetAccessLog(nil)
+	b.ReadData(0x0001)
+
+	if len(log.Entries()) != 2 || log.Entries()[1] != want[1] {
+		t.Errorf("logged after the log was turned off: %v", log.Entries())
+	}
+}
@@ -0,0 +1,211 @@
+// Package cdl is a code/data logger. It records how every byte of the PRG
+// ROM is used while a program runs, and saves the log in the .cdl format of
+// FCEUX: a flag byte per PRG ROM byte followed by a flag byte per CHR ROM
+// byte.
+//
+// Only the PRG ROM is logged; the PPU has no pattern fetches or $2007 reads
+// to log the CHR ROM from yet. The CHR ROM part of the file is kept as it
+// was read with ReadFrom, so that the logs of FCEUX survive a session.
+package cdl
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+)
+
+// The flags of a PRG ROM byte.
+const (
+	// Code is set for the opcodes and the operands of the executed
+	// instructions.
+	Code uint8 = 0x01
+	// Data is set for the bytes read by the instructions.
+	Data uint8 = 0x02
+	// The bits 2-3 tell the 8 KiB window of the CPU address space the byte
+	// was last accessed through, $8000 being 0 and $E000 3.
+	windowMask  uint8 = 0x0c
+	windowShift       = 2
+	// IndirectCode is set for the targets of the indirect jumps.
+	IndirectCode uint8 = 0x10
+	// IndirectData is set for the data read through a pointer, with the
+	// (zp,X) and (zp),Y addressing modes.
+	IndirectData uint8 = 0x20
+	// PcmData is set for the samples played by the DMC.
+	PcmData uint8 = 0x40
+)
+
+// Mapper reports the PRG ROM offsets the CPU addresses are mapped to.
+// mapper.Mapper implements it.
+type Mapper interface {
+	PrgOffset(addr uint16) int
+}
+
+// Memory is the memory the instructions are read from. *bus.Bus implements
+// it.
+type Memory interface {
+	Peek(addr uint16) uint8
+}
+
+// Logger logs the accesses to the ROM. It observes the instructions of the
+// CPU; add it with AddObserver of the CPU.
+type Logger struct {
+	prg    []uint8
+	chr    []uint8
+	mapper Mapper
+	mem    Memory
+}
+
+// NewLogger returns a logger for a ROM of the given PRG and CHR ROM sizes.
+// The CHR ROM size is zero for the boards with CHR RAM.
+func NewLogger(prgSize, chrSize int, mapper Mapper, mem Memory) *Logger {
+	return &Logger{
+		prg:    make([]uint8, prgSize),
+		chr:    make([]uint8, chrSize),
+		mapper: mapper,
+		mem:    mem,
+	}
+}
+
+// BeforeInstruction logs the instruction at the program counter and the
+// data it reads.
+func (l *Logger) BeforeInstruction(c *cpu.Cpu) {
+	r := c.Registers()
+	opCode := cpu.Lookup(l.mem.Peek(r.PC))
+
+	for i := uint16(0); i < opCode.Mode.Length(); i++ {
+		l.logPrg(r.PC+i, Code)
+	}
+
+	read := func(addr uint16) uint8 {
+		l.logPrg(addr, Data)
+		return l.mem.Peek(addr)
+	}
+
+	lo := l.mem.Peek(r.PC + 1)
+	word := uint16(lo) | uint16(l.mem.Peek(r.PC+2))<<8
+
+	pointer := func(ptr uint8) uint16 {
+		return uint16(read(uint16(ptr))) | uint16(read(uint16(ptr+1)))<<8
+	}
+
+	var addr uint16
+	flags := Data
+
+	switch opCode.Mode {
+	case cpu.ZeroPage:
+		addr = uint16(lo)
+	case cpu.XIndexedZeroPage:
+		addr = uint16(lo + r.X)
+	case cpu.YIndexedZeroPage:
+		addr = uint16(lo + r.Y)
+	case cpu.Absolute:
+		addr = word
+	case cpu.XIndexedAbsolute:
+		addr = word + uint16(r.X)
+	case cpu.YIndexedAbsolute:
+		addr = word + uint16(r.Y)
+	case cpu.IndexedIndirect:
+		addr = pointer(lo + r.X)
+		flags |= IndirectData
+	case cpu.IndirectIndexed:
+		addr = pointer(lo) + uint16(r.Y)
+		flags |= IndirectData
+	case cpu.AbsoluteIndirect:
+		// The pointer is read as data and the target is code reached
+		// indirectly. The high byte of the pointer doesn't carry into
+		// the page.
+		target := uint16(read(word)) | uint16(read(word&0xff00|uint16(lo+1)))<<8
+		l.logPrg(target, IndirectCode)
+
+		return
+	default:
+		return
+	}
+
+	if readsOperand(opCode.Name) {
+		l.logPrg(addr, flags)
+	}
+}
+
+// readsOperand tells whether an instruction with a memory operand reads
+// it. The stores only write it, and the jumps only use its address.
+func readsOperand(name string) bool {
+	switch name {
+	case "STA", "STX", "STY", "SAX", "SHX", "SHY", "AHX", "TAS", "JMP", "JSR":
+		return false
+	default:
+		return true
+	}
+}
+
+func (l *Logger) logPrg(addr uint16, flags uint8) {
+	offset := l.mapper.PrgOffset(addr)
+	if offset < 0 || offset >= len(l.prg) {
+		return
+	}
+
+	window := uint8(addr>>13) & 0x03
+	l.prg[offset] = l.prg[offset]&^windowMask | flags | window<<windowShift
+}
+
+// LogPcm logs a sample byte fetched by the DMC.
+func (l *Logger) LogPcm(addr uint16) {
+	l.logPrg(addr, Data|PcmData)
+}
+
+// Prg returns the flags of the PRG ROM bytes.
+func (l *Logger) Prg() []uint8 {
+	return l.prg
+}
+
+// Chr returns the flags of the CHR ROM bytes, the ones of the logs read.
+func (l *Logger) Chr() []uint8 {
+	return l.chr
+}
+
+// Clear clears the log.
+func (l *Logger) Clear() {
+	for i := range l.prg {
+		l.prg[i] = 0
+	}
+
+	for i := range l.chr {
+		l.chr[i] = 0
+	}
+}
+
+// WriteTo writes the log in the .cdl format.
+func (l *Logger) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(l.prg)
+	if err != nil {
+		return int64(n), err
+	}
+
+	m, err := w.Write(l.chr)
+
+	return int64(n + m), err
+}
+
+// ReadFrom reads a log in the .cdl format, e.g. one saved in an earlier
+// session, and merges it into the log. The sizes of the ROMs must match.
+func (l *Logger) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+
+	if len(data) != len(l.prg)+len(l.chr) {
+		return int64(len(data)), fmt.Errorf("the log is %d bytes, want %d bytes for the ROM", len(data), len(l.prg)+len(l.chr))
+	}
+
+	for i, flags := range data[:len(l.prg)] {
+		l.prg[i] |= flags
+	}
+
+	for i, flags := range data[len(l.prg):] {
+		l.chr[i] |= flags
+	}
+
+	return int64(len(data)), nil
+}
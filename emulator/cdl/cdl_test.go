@@ -0,0 +1,173 @@
+package cdl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/emulator/cpu/asm"
+)
+
+// testMemory is a flat 64 KiB address space with a 32 KiB PRG ROM mapped
+// over $8000-$FFFF.
+type testMemory [0x10000]uint8
+
+func (m *testMemory) ReadData(addr uint16) uint8 {
+	return m[addr]
+}
+
+func (m *testMemory) WriteData(addr uint16, data uint8) {
+	m[addr] = data
+}
+
+func (m *testMemory) Peek(addr uint16) uint8 {
+	return m[addr]
+}
+
+func (m *testMemory) PrgOffset(addr uint16) int {
+	if addr < 0x8000 {
+		return -1
+	}
+
+	return int(addr - 0x8000)
+}
+
+const testProgram = `
+	.org $8000
+reset:
+	LDA $9000
+	LDY #$00
+	LDA ($10),Y
+	STA $9001
+	JMP ($8100)
+
+	.org $8100
+	.word target
+
+	.org $e000
+target:
+	JMP target
+
+	.org $fffc
+	.word reset
+`
+
+func newTestLogger(t *testing.T) *Logger {
+	t.Helper()
+
+	p, err := asm.Assemble(testProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem := &testMemory{}
+	p.Load(mem)
+	// The pointer at $10 points to $C000.
+	mem[0x10] = 0x00
+	mem[0x11] = 0xc0
+
+	l := NewLogger(0x8000, 0x2000, mem, mem)
+
+	c := cpu.NewCpu(mem)
+	c.AddObserver(l)
+	c.Reset()
+
+	for i := 0; i < 100; i++ {
+		c.Tick()
+	}
+
+	return l
+}
+
+func TestLogger(t *testing.T) {
+	l := newTestLogger(t)
+	l.LogPcm(0xc100)
+
+	tests := []struct {
+		name string
+		addr uint16
+		want uint8
+	}{
+		{"opcode", 0x8000, Code},
+		{"operand", 0x8002, Code},
+		{"last instruction byte", 0x800c, Code},
+		{"data read", 0x9000, Data},
+		{"data written", 0x9001, 0},
+		{"indirect data", 0xc000, Data | IndirectData | 2<<windowShift},
+		{"jump pointer", 0x8100, Data},
+		{"jump pointer high byte", 0x8101, Data},
+		{"indirect jump target", 0xe000, Code | IndirectCode | 3<<windowShift},
+		{"instruction at the target", 0xe001, Code | 3<<windowShift},
+		{"sample", 0xc100, Data | PcmData | 2<<windowShift},
+		{"unused", 0x800d, 0},
+	}
+
+	for _, test := range tests {
+		if got := l.Prg()[test.addr-0x8000]; got != test.want {
+			t.Errorf("%s at $%04X: got $%02X, want $%02X", test.name, test.addr, got, test.want)
+		}
+	}
+
+	for i, flags := range l.Chr() {
+		if flags != 0 {
+			t.Fatalf("CHR ROM byte %d: got $%02X, want 0", i, flags)
+		}
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	l := newTestLogger(t)
+	l.Chr()[0x10] = 0x01
+
+	var buf bytes.Buffer
+
+	n, err := l.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	if n != 0xa000 || len(data) != 0xa000 {
+		t.Fatalf("wrote %d and %d bytes, want %d", n, len(data), 0xa000)
+	}
+
+	// The PRG ROM flags come first, then the CHR ROM ones.
+	if !bytes.Equal(data[:0x8000], l.Prg()) || data[0x6000] != Code|IndirectCode|3<<windowShift {
+		t.Error("the PRG ROM flags differ")
+	}
+
+	if !bytes.Equal(data[0x8000:], l.Chr()) || data[0x8010] != 0x01 {
+		t.Error("the CHR ROM flags differ")
+	}
+}
+
+func TestReadFrom(t *testing.T) {
+	l := NewLogger(4, 2, &testMemory{}, &testMemory{})
+	copy(l.Prg(), []uint8{Code, Data, 0, PcmData})
+	copy(l.Chr(), []uint8{0x01, 0})
+
+	n, err := l.ReadFrom(bytes.NewReader([]uint8{Data, Data, IndirectCode, 0, 0x02, 0x02}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The loaded flags are merged into the logged ones.
+	if n != 6 || !bytes.Equal(l.Prg(), []uint8{Code | Data, Data, IndirectCode, PcmData}) ||
+		!bytes.Equal(l.Chr(), []uint8{0x03, 0x02}) {
+		t.Errorf("got %d bytes, PRG % X and CHR % X", n, l.Prg(), l.Chr())
+	}
+
+	if _, err := l.ReadFrom(bytes.NewReader(make([]uint8, 5))); err == nil {
+		t.Error("a log of another size was accepted")
+	}
+
+	if !bytes.Equal(l.Prg(), []uint8{Code | Data, Data, IndirectCode, PcmData}) {
+		t.Errorf("a rejected log changed the PRG flags to % X", l.Prg())
+	}
+
+	l.Clear()
+
+	if !bytes.Equal(l.Prg(), make([]uint8, 4)) || !bytes.Equal(l.Chr(), make([]uint8, 2)) {
+		t.Errorf("got PRG % X and CHR % X after Clear", l.Prg(), l.Chr())
+	}
+}
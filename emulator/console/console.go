@@ -0,0 +1,139 @@
+// Package console wires the components of the NES together.
+package console
+
+import (
+	"github.com/pqkallio/nes-emulator/emulator/apu"
+	"github.com/pqkallio/nes-emulator/emulator/bus"
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/emulator/input"
+	"github.com/pqkallio/nes-emulator/emulator/mapper"
+	"github.com/pqkallio/nes-emulator/emulator/ppu"
+	"github.com/pqkallio/nes-emulator/emulator/ram"
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+// internalRamSize is the size of the RAM of the console. It is mirrored over
+// $0000-$1FFF.
+const internalRamSize = 0x800
+
+// Console is an NES with a cartridge inserted.
+type Console struct {
+	Cpu    *cpu.Cpu
+	Ppu    *ppu.Ppu
+	Apu    *apu.Apu
+	Input  *input.Ports
+	Bus    *bus.Bus
+	Mapper mapper.Mapper
+
+	ram *ram.Ram
+	// cycles is the number of CPU cycles run, which a reset doesn't clear.
+	cycles uint64
+}
+
+// NewConsole returns a console with the ROM inserted and the input devices
+// the ROM's header names plugged in, joypads by default. Call Reset to power
+// it on.
+func NewConsole(r *rom.ROM) (*Console, error) {
+	m, err := mapper.NewMapper(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := bus.NewBus()
+	c := cpu.NewCpu(b)
+	p := ppu.NewPpu()
+	a := apu.NewApu(b, c)
+
+	if e, ok := m.(apu.Expansion); ok {
+		a.SetExpansion(e)
+	}
+
+	ports := input.NewPorts(c, a)
+	c.AddObserver(ports)
+	a.DmcDma = ports.DmcDma
+
+	n := &Console{
+		Cpu:    c,
+		Ppu:    p,
+		Apu:    a,
+		Input:  ports,
+		Bus:    b,
+		Mapper: m,
+		ram:    ram.NewRam(internalRamSize),
+	}
+
+	ports.PlugDefault(r.DefaultExpansionDevice(), p, n)
+
+	mappings := []struct {
+		start, end, mask uint16
+		device           bus.Device
+	}{
+		{0x0000, 0x1fff, internalRamSize - 1, n.ram},
+		{0x2000, 0x3fff, 0x2007, p},
+		{0x4000, 0x4017, 0xffff, a},
+		{0x4016, 0x4017, 0xffff, ports},
+		{0x6000, 0xffff, 0xffff, m},
+	}
+
+	for _, mapping := range mappings {
+		if err := b.Map(mapping.start, mapping.end, mapping.mask, mapping.device); err != nil {
+			return nil, err
+		}
+	}
+
+	b.SetClock(c)
+
+	return n, nil
+}
+
+// Tick advances the console by one CPU cycle, which is three PPU dots.
+func (n *Console) Tick() {
+	n.cycles++
+
+	n.Cpu.Tick()
+
+	n.Ppu.Tick()
+	n.Ppu.Tick()
+	n.Ppu.Tick()
+
+	n.Apu.Tick()
+
+	n.Cpu.SetNmiLine(n.Ppu.NmiLine())
+	n.Cpu.SetIrqLine(n.Apu.IrqLine())
+}
+
+// Cycles returns the number of CPU cycles the console has run. Unlike the
+// CPU's count, it isn't cleared by a reset or a power cycle.
+func (n *Console) Cycles() uint64 {
+	return n.cycles
+}
+
+// PrgBank returns the 16 KiB PRG ROM bank mapped at the address, or -1 if no
+// PRG ROM is mapped at the address.
+func (n *Console) PrgBank(addr uint16) int {
+	offset := n.Mapper.PrgOffset(addr)
+	if offset < 0 {
+		return -1
+	}
+
+	return offset / rom.PrgROMBankSize
+}
+
+// Reset presses the reset button of the console.
+func (n *Console) Reset() {
+	n.Ppu.Reset()
+	n.Apu.Reset()
+	n.Cpu.Reset()
+}
+
+// Power turns the console off and on: the internal RAM is cleared and the
+// CPU, the PPU, the APU, the controller ports and the cartridge start from
+// the power-up state. Only battery-backed PRG RAM is kept.
+func (n *Console) Power() {
+	n.ram.Clear()
+	n.Mapper.Power()
+	n.Ppu.Power()
+	n.Apu.Power()
+	n.Input.Power()
+	n.Cpu.Reset()
+}
@@ -1,15 +1,54 @@
 package cpu
 
-// accumulator accumulator addressing mode is represented with a one byte instruction,
-// implying an operation on the accumulator.
-func (c *Cpu) accumulator() uint8 {
-	return 0
+// resolveAddress reads the operand bytes of the current instruction and
+// computes the effective address for the addressing mode. It returns 1 if
+// the address computation may take an extra cycle.
+//
+// The implied and accumulator addressing modes are represented with a one
+// byte instruction and have no operand to resolve, but the CPU still reads
+// the byte following the opcode.
+func (c *Cpu) resolveAddress(mode AddressingMode) uint8 {
+	switch mode {
+	case Implied, Accumulator:
+		c.bus.ReadData(c.pc)
+		return 0
+	case Immediate:
+		return c.immAddr()
+	case ZeroPage:
+		return c.zeroPageAddr()
+	case XIndexedZeroPage:
+		return c.xIndexedZeroPageAddr()
+	case YIndexedZeroPage:
+		return c.yIndexedZeroPageAddr()
+	case Absolute:
+		if c.opCode == jsrOpCode {
+			// JSR reads the high byte of the address only after it has
+			// pushed the return address, see jsr.
+			return 0
+		}
+
+		return c.absAddr()
+	case XIndexedAbsolute:
+		return c.xIndexedAbsAddr()
+	case YIndexedAbsolute:
+		return c.yIndexedAbsAddr()
+	case AbsoluteIndirect:
+		return c.absIndirectAddr()
+	case IndexedIndirect:
+		return c.indexedIndirectAddr()
+	case IndirectIndexed:
+		return c.indirectIndexedAddr()
+	case Relative:
+		return c.relAddr()
+	default:
+		return 0
+	}
 }
 
 // immAddr the second byte of the instruction contains the operand.
 func (c *Cpu) immAddr() uint8 {
-	c.pc++
 	c.absoluteAddr = c.pc
+	c.pc++
 
 	return 0
 }
@@ -30,7 +69,10 @@ func (c *Cpu) absAddr() uint8 {
 // zeroPageAddr the second byte contains the eight lower bits of the effective
 // address. The higher order bits are assumed to be zero.
 func (c *Cpu) zeroPageAddr() uint8 {
-	return c.indexedZeroPageAddr(0)
+	c.absoluteAddr = uint16(c.bus.ReadData(c.pc))
+	c.pc++
+
+	return 0
 }
 
 func (c *Cpu) xIndexedZeroPageAddr() uint8 {
@@ -42,9 +84,13 @@ func (c *Cpu) yIndexedZeroPageAddr() uint8 {
 }
 
 func (c *Cpu) indexedZeroPageAddr(idx uint8) uint8 {
-	c.absoluteAddr = uint16(c.bus.ReadData(c.pc) + idx)
+	base := c.bus.ReadData(c.pc)
 	c.pc++
-	c.absoluteAddr &= 0x00FF
+
+	// The CPU reads from the unindexed address while adding the index.
+	c.bus.ReadData(uint16(base))
+
+	c.absoluteAddr = uint16(base + idx)
 
 	return 0
 }
@@ -63,28 +109,39 @@ func (c *Cpu) indexedAbsAddr(idx uint8) uint8 {
 	hi := uint16(c.bus.ReadData(c.pc)) << 8
 	c.pc++
 
-	c.absoluteAddr = (lo | hi) + uint16(idx)
+	base := lo | hi
+	c.absoluteAddr = base + uint16(idx)
+
+	return c.fixUpAddr(base)
+}
+
+// fixUpAddr handles the cycle the CPU spends adding the carry of an indexed
+// address to its high byte. Meanwhile the CPU reads from the address with the
+// high byte not yet fixed up. Instructions that only read their operand skip
+// the cycle if there is no carry.
+func (c *Cpu) fixUpAddr(base uint16) uint8 {
+	crossed := base&0xff00 != c.absoluteAddr&0xff00
+
+	if crossed || !c.pageCrossCycle {
+		c.bus.ReadData(base&0xff00 | c.absoluteAddr&0x00ff)
+	}
 
-	switch {
-	case hi != (c.absoluteAddr & 0xff00):
+	if crossed {
 		return 1
-	default:
-		return 0
 	}
-}
 
-func (c *Cpu) impliedAddr() uint8 {
 	return 0
 }
 
 func (c *Cpu) relAddr() uint8 {
 	jump := c.bus.ReadData(c.pc)
+	c.pc++
 
 	relativeAddr := uint16(jump)
 	if jump&signMask != 0 {
 		// If the 8-bit value is to be interpreted as a negative number,
 		// the high byte should be all ones (2's complement).
-		relativeAddr = 0xff00 & relativeAddr
+		relativeAddr = 0xff00 | relativeAddr
 	}
 
 	c.relativeAddr = relativeAddr
@@ -96,10 +153,12 @@ func (c *Cpu) indexedIndirectAddr() uint8 {
 	ptr := uint16(c.bus.ReadData(c.pc))
 	c.pc++
 
+	c.bus.ReadData(ptr)
+
 	loPtr := (ptr + uint16(c.xReg)) & 0x00ff
 	hiPtr := (ptr + uint16(c.xReg) + 1) & 0x00ff
 
-	addr := uint16(loPtr) | uint16(hiPtr)<<8
+	addr := uint16(c.bus.ReadData(loPtr)) | uint16(c.bus.ReadData(hiPtr))<<8
 
 	c.absoluteAddr = addr
 
@@ -113,13 +172,10 @@ func (c *Cpu) indirectIndexedAddr() uint8 {
 	ptrLo := uint16(c.bus.ReadData(ptr & 0x00ff))
 	ptrHi := uint16(c.bus.ReadData((ptr+1)&0x00ff)) << 8
 
-	c.absoluteAddr = (ptrLo | ptrHi) + uint16(c.yReg)
-
-	if c.absoluteAddr&0xff00 != ptrHi {
-		return 1
-	}
+	base := ptrLo | ptrHi
+	c.absoluteAddr = base + uint16(c.yReg)
 
-	return 0
+	return c.fixUpAddr(base)
 }
 
 func (c *Cpu) absIndirectAddr() uint8 {
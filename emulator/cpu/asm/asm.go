@@ -0,0 +1,567 @@
+// Package asm is a small two-pass 6502 assembler for writing test programs
+// and fixtures as source instead of raw opcodes.
+//
+// The syntax is the common one:
+//
+//	        .org $8000
+//	reset:  LDX #$00        ; comments start with a semicolon
+//	loop:   LDA data,X
+//	        STA ($20),Y
+//	        INX
+//	        BNE loop
+//	        JMP reset
+//	ptr = $20
+//	data:   .byte 1, 2, "text"
+//	        .word reset, <data, >data
+//	        .incbin "tiles.chr"
+//
+// Numbers are decimal, $hexadecimal, %binary or 'c'haracters, and * is the
+// address of the current statement. Expressions can add and subtract terms,
+// and < and > take the low and the high byte of an expression. All the
+// addressing modes and the unofficial opcode mnemonics are supported; a zero
+// page operand is used whenever the address is known to fit in one byte on
+// the first pass.
+package asm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+)
+
+// Error is an error in the source.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Segment is a block of bytes assembled at Origin.
+type Segment struct {
+	Origin uint16
+	Data   []uint8
+}
+
+// Memory is the memory a program can be loaded to. *bus.Bus implements it.
+type Memory interface {
+	WriteData(addr uint16, data uint8)
+}
+
+// Program is the output of the assembler.
+type Program struct {
+	// Segments are the blocks of bytes in the order they were assembled. A
+	// new segment is started by every .org directive.
+	Segments []Segment
+	// Symbols are the labels and the constants defined in the source.
+	Symbols map[string]uint16
+}
+
+// Load writes the segments of the program to the memory.
+func (p *Program) Load(mem Memory) {
+	for _, segment := range p.Segments {
+		for i, data := range segment.Data {
+			mem.WriteData(segment.Origin+uint16(i), data)
+		}
+	}
+}
+
+// Bytes returns the program as one block of bytes starting from the lowest
+// address assembled to, with the gaps between the segments filled with $FF.
+// A segment that runs past $FFFF is an error.
+func (p *Program) Bytes() (origin uint16, data []uint8, err error) {
+	start, end := 0x10000, 0
+
+	for _, segment := range p.Segments {
+		if len(segment.Data) == 0 {
+			continue
+		}
+
+		if int(segment.Origin)+len(segment.Data) > 0x10000 {
+			return 0, nil, fmt.Errorf("the segment at $%04X overflows the address space", segment.Origin)
+		}
+
+		if int(segment.Origin) < start {
+			start = int(segment.Origin)
+		}
+
+		if int(segment.Origin)+len(segment.Data) > end {
+			end = int(segment.Origin) + len(segment.Data)
+		}
+	}
+
+	if start >= end {
+		return 0, nil, nil
+	}
+
+	data = make([]uint8, end-start)
+	for i := range data {
+		data[i] = 0xff
+	}
+
+	for _, segment := range p.Segments {
+		copy(data[int(segment.Origin)-start:], segment.Data)
+	}
+
+	return uint16(start), data, nil
+}
+
+// Assemble assembles the source. Files included with .incbin are read
+// relative to the working directory.
+func Assemble(src string) (*Program, error) {
+	return assemble(src, ".")
+}
+
+// AssembleFile assembles a source file. Files included with .incbin are read
+// relative to the directory of the source file.
+func AssembleFile(path string) (*Program, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return assemble(string(src), filepath.Dir(path))
+}
+
+type assembler struct {
+	dir     string
+	lines   []string
+	pass    int
+	line    int
+	pc      uint16
+	symbols map[string]uint16
+	modes   map[int]cpu.AddressingMode
+	program *Program
+}
+
+func assemble(src, dir string) (*Program, error) {
+	a := &assembler{
+		dir:     dir,
+		lines:   strings.Split(src, "\n"),
+		symbols: map[string]uint16{},
+		modes:   map[int]cpu.AddressingMode{},
+	}
+
+	for a.pass = 1; a.pass <= 2; a.pass++ {
+		a.pc = 0
+		a.program = &Program{Segments: []Segment{{}}}
+
+		for i, line := range a.lines {
+			a.line = i + 1
+
+			if err := a.statement(line); err != nil {
+				return nil, &Error{Line: a.line, Msg: err.Error()}
+			}
+		}
+	}
+
+	a.program.Symbols = a.symbols
+
+	segments := a.program.Segments[:0]
+	for _, segment := range a.program.Segments {
+		if len(segment.Data) > 0 {
+			segments = append(segments, segment)
+		}
+	}
+
+	a.program.Segments = segments
+
+	return a.program, nil
+}
+
+var (
+	labelRe    = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*):`)
+	constantRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*=(.*)$`)
+)
+
+func (a *assembler) statement(line string) error {
+	line = strings.TrimSpace(stripComment(line))
+
+	if m := constantRe.FindStringSubmatch(line); m != nil {
+		val, known, err := a.eval(m[2])
+		if err != nil {
+			return err
+		}
+
+		if known {
+			return a.define(m[1], uint16(val))
+		}
+
+		if a.pass == 2 {
+			return fmt.Errorf("undefined symbol in the value of %s", m[1])
+		}
+
+		return nil
+	}
+
+	if m := labelRe.FindStringSubmatch(line); m != nil {
+		if err := a.define(m[1], a.pc); err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line[len(m[0]):])
+	}
+
+	if line == "" {
+		return nil
+	}
+
+	keyword, operand := line, ""
+
+	if idx := strings.IndexAny(line, " \t"); idx >= 0 {
+		keyword, operand = line[:idx], strings.TrimSpace(line[idx:])
+	}
+
+	keyword = strings.ToUpper(keyword)
+
+	if strings.HasPrefix(keyword, ".") {
+		return a.directive(keyword, operand)
+	}
+
+	return a.instruction(keyword, operand)
+}
+
+func (a *assembler) define(name string, val uint16) error {
+	if isRegister(name) {
+		return fmt.Errorf("%s is a reserved name", name)
+	}
+
+	if prev, ok := a.symbols[name]; ok && a.pass == 1 && prev != val {
+		return fmt.Errorf("%s is already defined", name)
+	}
+
+	a.symbols[name] = val
+
+	return nil
+}
+
+func (a *assembler) emit(data ...uint8) {
+	segment := &a.program.Segments[len(a.program.Segments)-1]
+
+	if a.pass == 2 {
+		segment.Data = append(segment.Data, data...)
+	}
+
+	a.pc += uint16(len(data))
+}
+
+func (a *assembler) directive(keyword, operand string) error {
+	args := splitArgs(operand)
+
+	switch keyword {
+	case ".ORG":
+		if len(args) != 1 {
+			return fmt.Errorf(".org takes one argument")
+		}
+
+		val, known, err := a.eval(args[0])
+		if err != nil {
+			return err
+		}
+
+		if !known {
+			return fmt.Errorf("the address of .org must be known on the first pass")
+		}
+
+		a.pc = uint16(val)
+		a.program.Segments = append(a.program.Segments, Segment{Origin: a.pc})
+	case ".BYTE", ".DB":
+		for _, arg := range args {
+			if s, ok := unquote(arg); ok {
+				a.emit([]uint8(s)...)
+				continue
+			}
+
+			val, err := a.evalByte(arg)
+			if err != nil {
+				return err
+			}
+
+			a.emit(val)
+		}
+	case ".WORD", ".DW":
+		for _, arg := range args {
+			val, _, err := a.evalKnown(arg)
+			if err != nil {
+				return err
+			}
+
+			a.emit(uint8(val), uint8(val>>8))
+		}
+	case ".INCBIN":
+		return a.incbin(args)
+	default:
+		return fmt.Errorf("unknown directive %s", strings.ToLower(keyword))
+	}
+
+	return nil
+}
+
+func (a *assembler) incbin(args []string) error {
+	if len(args) < 1 || len(args) > 3 {
+		return fmt.Errorf(".incbin takes a file name, and an optional offset and length")
+	}
+
+	name, ok := unquote(args[0])
+	if !ok {
+		return fmt.Errorf("the file name of .incbin must be quoted")
+	}
+
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(a.dir, name)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	offset, length := 0, len(data)
+
+	if len(args) > 1 {
+		if offset, _, err = a.evalKnown(args[1]); err != nil {
+			return err
+		}
+
+		length = len(data) - offset
+	}
+
+	if len(args) > 2 {
+		if length, _, err = a.evalKnown(args[2]); err != nil {
+			return err
+		}
+	}
+
+	if offset < 0 || length < 0 || offset+length > len(data) {
+		return fmt.Errorf("the range %d-%d is outside of %s", offset, offset+length, args[0])
+	}
+
+	a.emit(data[offset : offset+length]...)
+
+	return nil
+}
+
+var (
+	indexedIndirectRe = regexp.MustCompile(`(?i)^\((.*),\s*X\s*\)$`)
+	indirectIndexedRe = regexp.MustCompile(`(?i)^\((.*)\)\s*,\s*Y$`)
+	indirectRe        = regexp.MustCompile(`^\((.*)\)$`)
+	indexedRe         = regexp.MustCompile(`(?i)^(.*),\s*([XY])$`)
+)
+
+func (a *assembler) instruction(mnemonic, operand string) error {
+	if alias, ok := aliases[mnemonic]; ok {
+		mnemonic = alias
+	}
+
+	modes, ok := opCodes[mnemonic]
+	if !ok {
+		return fmt.Errorf("unknown mnemonic %s", mnemonic)
+	}
+
+	var (
+		mode cpu.AddressingMode
+		expr string
+	)
+
+	switch {
+	case operand == "":
+		mode = cpu.Implied
+		if _, ok := modes[cpu.Implied]; !ok {
+			mode = cpu.Accumulator
+		}
+	case strings.EqualFold(operand, "A"):
+		mode = cpu.Accumulator
+	case strings.HasPrefix(operand, "#"):
+		mode, expr = cpu.Immediate, operand[1:]
+	case indexedIndirectRe.MatchString(operand):
+		mode, expr = cpu.IndexedIndirect, indexedIndirectRe.FindStringSubmatch(operand)[1]
+	case indirectIndexedRe.MatchString(operand):
+		mode, expr = cpu.IndirectIndexed, indirectIndexedRe.FindStringSubmatch(operand)[1]
+	case indirectRe.MatchString(operand):
+		mode, expr = cpu.AbsoluteIndirect, indirectRe.FindStringSubmatch(operand)[1]
+	case indexedRe.MatchString(operand):
+		m := indexedRe.FindStringSubmatch(operand)
+		expr = m[1]
+
+		if strings.EqualFold(m[2], "X") {
+			mode = a.chooseMode(modes, cpu.XIndexedZeroPage, cpu.XIndexedAbsolute, expr)
+		} else {
+			mode = a.chooseMode(modes, cpu.YIndexedZeroPage, cpu.YIndexedAbsolute, expr)
+		}
+	default:
+		expr = operand
+
+		if _, ok := modes[cpu.Relative]; ok {
+			mode = cpu.Relative
+		} else {
+			mode = a.chooseMode(modes, cpu.ZeroPage, cpu.Absolute, expr)
+		}
+	}
+
+	opCode, ok := modes[mode]
+	if !ok {
+		return fmt.Errorf("%s doesn't support the operand %s", mnemonic, operand)
+	}
+
+	switch mode.Length() {
+	case 1:
+		a.emit(opCode)
+	case 2:
+		val, err := a.operandByte(mode, expr)
+		if err != nil {
+			return err
+		}
+
+		a.emit(opCode, val)
+	default:
+		val, _, err := a.evalKnown(expr)
+		if err != nil {
+			return err
+		}
+
+		a.emit(opCode, uint8(val), uint8(val>>8))
+	}
+
+	return nil
+}
+
+// chooseMode chooses between the zero page and the absolute form of an
+// addressing mode. The choice is made on the first pass and reused on the
+// second one, so that the addresses of the labels don't change in between.
+func (a *assembler) chooseMode(modes map[cpu.AddressingMode]uint8, zeroPage, absolute cpu.AddressingMode, expr string) cpu.AddressingMode {
+	if a.pass == 2 {
+		if mode, ok := a.modes[a.line]; ok {
+			return mode
+		}
+	}
+
+	_, hasZeroPage := modes[zeroPage]
+	_, hasAbsolute := modes[absolute]
+
+	mode := absolute
+
+	if val, known, err := a.eval(expr); hasZeroPage && (!hasAbsolute || (err == nil && known && val >= 0 && val <= 0xff)) {
+		mode = zeroPage
+	}
+
+	a.modes[a.line] = mode
+
+	return mode
+}
+
+func (a *assembler) operandByte(mode cpu.AddressingMode, expr string) (uint8, error) {
+	if mode != cpu.Relative {
+		return a.evalByte(expr)
+	}
+
+	target, _, err := a.evalKnown(expr)
+	if err != nil {
+		return 0, err
+	}
+
+	offset := target - int(a.pc+2)
+
+	if a.pass == 2 && (offset < -128 || offset > 127) {
+		return 0, fmt.Errorf("branch target is out of range by %d bytes", offset)
+	}
+
+	return uint8(offset), nil
+}
+
+// evalKnown evaluates an expression that must be known on the second pass.
+func (a *assembler) evalKnown(expr string) (int, bool, error) {
+	val, known, err := a.eval(expr)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if !known && a.pass == 2 {
+		return 0, false, fmt.Errorf("undefined symbol in %s", strings.TrimSpace(expr))
+	}
+
+	return val, known, nil
+}
+
+func (a *assembler) evalByte(expr string) (uint8, error) {
+	val, _, err := a.evalKnown(expr)
+	if err != nil {
+		return 0, err
+	}
+
+	if a.pass == 2 && (val < -128 || val > 0xff) {
+		return 0, fmt.Errorf("value $%X doesn't fit in a byte", val)
+	}
+
+	return uint8(val), nil
+}
+
+func stripComment(line string) string {
+	quote := byte(0)
+
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+		case ch == '"':
+			quote = ch
+		case ch == '\'' && i+2 < len(line) && line[i+2] == '\'':
+			i += 2
+		case ch == ';':
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// splitArgs splits the arguments of a directive at the commas that are not
+// inside quotes.
+func splitArgs(operand string) []string {
+	if strings.TrimSpace(operand) == "" {
+		return nil
+	}
+
+	var (
+		args  []string
+		start int
+		quote bool
+	)
+
+	for i := 0; i < len(operand); i++ {
+		switch operand[i] {
+		case '"':
+			quote = !quote
+		case ',':
+			if !quote {
+				args = append(args, strings.TrimSpace(operand[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	return append(args, strings.TrimSpace(operand[start:]))
+}
+
+func unquote(arg string) (string, bool) {
+	if len(arg) < 2 || arg[0] != '"' || arg[len(arg)-1] != '"' {
+		return "", false
+	}
+
+	return arg[1 : len(arg)-1], true
+}
+
+func isRegister(name string) bool {
+	switch strings.ToUpper(name) {
+	case "A", "X", "Y":
+		return true
+	default:
+		return false
+	}
+}
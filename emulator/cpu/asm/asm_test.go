@@ -0,0 +1,234 @@
+package asm
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []uint8
+	}{
+		// The addressing modes.
+		{"implied", "INX", []uint8{0xe8}},
+		{"accumulator", "ASL A", []uint8{0x0a}},
+		{"accumulator without operand", "ASL", []uint8{0x0a}},
+		{"immediate", "LDA #$05", []uint8{0xa9, 0x05}},
+		{"zero page", "LDA $10", []uint8{0xa5, 0x10}},
+		{"x-indexed zero page", "LDA $10,X", []uint8{0xb5, 0x10}},
+		{"y-indexed zero page", "LDX $10, y", []uint8{0xb6, 0x10}},
+		{"absolute", "LDA $1234", []uint8{0xad, 0x34, 0x12}},
+		{"x-indexed absolute", "LDA $1234,X", []uint8{0xbd, 0x34, 0x12}},
+		{"y-indexed absolute", "LDA $1234,Y", []uint8{0xb9, 0x34, 0x12}},
+		{"absolute without zero page form", "JMP $0010", []uint8{0x4c, 0x10, 0x00}},
+		{"y-indexed absolute without zero page form", "LDA $10,Y", []uint8{0xb9, 0x10, 0x00}},
+		{"absolute indirect", "JMP ($1234)", []uint8{0x6c, 0x34, 0x12}},
+		{"indexed indirect", "LDA ($20,X)", []uint8{0xa1, 0x20}},
+		{"indirect indexed", "LDA ($20),Y", []uint8{0xb1, 0x20}},
+		{"relative backwards", "loop: DEX\nBNE loop", []uint8{0xca, 0xd0, 0xfd}},
+		{"relative forwards", "BEQ skip\nNOP\nskip: RTS", []uint8{0xf0, 0x01, 0xea, 0x60}},
+		{"unofficial", "LAX $10", []uint8{0xa7, 0x10}},
+		{"unofficial alias", "ISC $10", []uint8{0xe7, 0x10}},
+		{"official encoding preferred", "SBC #$01\nNOP", []uint8{0xe9, 0x01, 0xea}},
+		{"lower case", "lda #$05\nsta $0200,x", []uint8{0xa9, 0x05, 0x9d, 0x00, 0x02}},
+
+		// The forward references.
+		{"forward jump", "JMP end\nend: RTS", []uint8{0x4c, 0x03, 0x80, 0x60}},
+		{"forward constant is absolute", "LDA zp\nzp = $10", []uint8{0xad, 0x10, 0x00}},
+		{"backward constant is zero page", "zp = $10\nLDA zp", []uint8{0xa5, 0x10}},
+		{"forward word", ".word data\ndata: .byte 7", []uint8{0x02, 0x80, 0x07}},
+
+		// The expressions.
+		{"decimal", "LDA #10", []uint8{0xa9, 0x0a}},
+		{"binary", "LDA #%1010", []uint8{0xa9, 0x0a}},
+		{"character", "LDA #'A'", []uint8{0xa9, 0x41}},
+		{"negative", "LDA #-1", []uint8{0xa9, 0xff}},
+		{"addition and subtraction", "base = $20\nLDA base+2-1", []uint8{0xa5, 0x21}},
+		{"low and high byte", "addr = $1234\nLDA #<addr\nLDX #>addr", []uint8{0xa9, 0x34, 0xa2, 0x12}},
+		{"high byte of a sum", "LDA #>$12ff+1", []uint8{0xa9, 0x13}},
+		{"current address", "NOP\nJMP *", []uint8{0xea, 0x4c, 0x01, 0x80}},
+		{"current address offset", "BNE *+4", []uint8{0xd0, 0x02}},
+
+		// The directives and the comments.
+		{"bytes", ".byte 1, \"ab\", ';'", []uint8{0x01, 0x61, 0x62, 0x3b}},
+		{"bytes alias", ".db $ff", []uint8{0xff}},
+		{"words", "label: .word $1234, label\n.dw 1", []uint8{0x34, 0x12, 0x00, 0x80, 0x01, 0x00}},
+		{"comment", "LDA #$05 ; load \"5\"", []uint8{0xa9, 0x05}},
+		{"label on its own line", "start:\n  JMP start", []uint8{0x4c, 0x00, 0x80}},
+		{"gap filled", "NOP\n.org $8003\nRTS", []uint8{0xea, 0xff, 0xff, 0x60}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := Assemble(".org $8000\n" + test.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			origin, data, err := p.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if origin != 0x8000 || !bytes.Equal(data, test.want) {
+				t.Errorf("got $%04X % X, want $8000 % X", origin, data, test.want)
+			}
+		})
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		line int
+		msg  string
+	}{
+		{"unknown mnemonic", "NOP\nFOO", 2, "unknown mnemonic FOO"},
+		{"missing operand", "LDA", 1, "doesn't support"},
+		{"unsupported mode", "STA #$05", 1, "doesn't support the operand #$05"},
+		{"byte overflow", "LDA #$100", 1, "doesn't fit in a byte"},
+		{"undefined symbol", "JMP nowhere", 1, "undefined symbol"},
+		{"undefined constant", "a = b + 1", 1, "undefined symbol in the value of a"},
+		{"branch out of range", ".org $8000\nBNE $8100", 2, "out of range"},
+		{"duplicate label", "twice: NOP\ntwice: NOP", 2, "twice is already defined"},
+		{"reserved name", "X = 1", 1, "reserved name"},
+		{"unknown directive", ".foo 1", 1, "unknown directive .foo"},
+		{"unknown origin", ".org later\nlater = $8000", 1, "must be known on the first pass"},
+		{"missing term", "LDA #$05+", 1, "missing term"},
+		{"invalid number", "LDA #$GG", 1, "invalid number"},
+		{"invalid term", "LDA #1+?", 1, "invalid term"},
+		{"unquoted incbin", ".incbin data.bin", 1, "must be quoted"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Assemble(test.src)
+
+			var asmErr *Error
+			if !errors.As(err, &asmErr) {
+				t.Fatalf("got %v, want an *Error", err)
+			}
+
+			if asmErr.Line != test.line || !strings.Contains(asmErr.Msg, test.msg) {
+				t.Errorf("got %q, want line %d: ...%s...", err, test.line, test.msg)
+			}
+		})
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	p, err := Assemble(".org $c000\nreset: NOP\nloop: JMP loop\nptr = $20")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]uint16{"reset": 0xc000, "loop": 0xc001, "ptr": 0x20} {
+		if got, ok := p.Symbols[name]; !ok || got != want {
+			t.Errorf("%s = $%04X, %v, want $%04X", name, got, ok, want)
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	p, err := Assemble(".org $8000\nNOP\n.org $fffc\n.word $8000, $8000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Segments) != 2 ||
+		p.Segments[0].Origin != 0x8000 || !bytes.Equal(p.Segments[0].Data, []uint8{0xea}) ||
+		p.Segments[1].Origin != 0xfffc || !bytes.Equal(p.Segments[1].Data, []uint8{0x00, 0x80, 0x00, 0x80}) {
+		t.Errorf("got segments %+v", p.Segments)
+	}
+
+	origin, data, err := p.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if origin != 0x8000 || len(data) != 0x8000 || data[0] != 0xea || data[1] != 0xff || data[0x7ffc] != 0x00 || data[0x7ffd] != 0x80 {
+		t.Errorf("got $%04X and %d bytes", origin, len(data))
+	}
+}
+
+func TestBytesRejectsOverflow(t *testing.T) {
+	p, err := Assemble(".org $fffe\n.byte 1, 2, 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := p.Bytes(); err == nil {
+		t.Error("a segment running past $FFFF was accepted")
+	}
+
+	if _, err := p.NROM(nil, 0); err == nil {
+		t.Error("a segment running past $FFFF was accepted as NROM")
+	}
+}
+
+func TestIncbin(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "data.bin"), []uint8{1, 2, 3, 4, 5}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := ".org $8000\n.incbin \"data.bin\"\n.incbin \"data.bin\", 1, 2\n.incbin \"data.bin\", 3\n"
+	if err := os.WriteFile(filepath.Join(dir, "test.s"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := AssembleFile(filepath.Join(dir, "test.s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, data, _ := p.Bytes(); !bytes.Equal(data, []uint8{1, 2, 3, 4, 5, 2, 3, 4, 5}) {
+		t.Errorf("got % X", data)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "test.s"), []byte(".incbin \"data.bin\", 4, 2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AssembleFile(filepath.Join(dir, "test.s")); err == nil {
+		t.Error("a range outside of the file was accepted")
+	}
+}
+
+func TestNROM(t *testing.T) {
+	p, err := Assemble(".org $c000\nreset: JMP reset\n.org $fffc\n.word reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nes, err := p.NROM(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nes) != 16+0x4000 || string(nes[:4]) != "NES\x1a" || nes[4] != 1 || nes[5] != 0 || nes[7] != 0x08 {
+		t.Fatalf("got a header of % X and %d bytes", nes[:16], len(nes))
+	}
+
+	prg := nes[16:]
+	if !bytes.Equal(prg[:3], []uint8{0x4c, 0x00, 0xc0}) || prg[0x3ffc] != 0x00 || prg[0x3ffd] != 0xc0 {
+		t.Errorf("got PRG ROM % X ... % X", prg[:3], prg[0x3ffc:])
+	}
+
+	p, err = Assemble(".org $6000\nNOP")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.NROM(nil, 0); err == nil {
+		t.Error("a segment outside of the PRG ROM was accepted")
+	}
+}
@@ -0,0 +1,124 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// eval evaluates an expression. The value is unknown if the expression refers
+// to a symbol that hasn't been defined yet, which is an error only on the
+// second pass.
+func (a *assembler) eval(expr string) (val int, known bool, err error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return 0, false, fmt.Errorf("missing operand")
+	}
+
+	var selector byte
+	if expr[0] == '<' || expr[0] == '>' {
+		selector = expr[0]
+		expr = strings.TrimSpace(expr[1:])
+	}
+
+	known = true
+	sign := 1
+
+	if strings.HasPrefix(expr, "-") {
+		sign = -1
+		expr = strings.TrimSpace(expr[1:])
+	}
+
+	for expr != "" {
+		var (
+			term      string
+			termKnown bool
+			termVal   int
+		)
+
+		term, expr = nextTerm(expr)
+
+		termVal, termKnown, err = a.term(term)
+		if err != nil {
+			return 0, false, err
+		}
+
+		known = known && termKnown
+		val += sign * termVal
+
+		if expr == "" {
+			break
+		}
+
+		switch expr[0] {
+		case '+':
+			sign = 1
+		case '-':
+			sign = -1
+		default:
+			return 0, false, fmt.Errorf("unexpected %q in expression", expr)
+		}
+
+		expr = strings.TrimSpace(expr[1:])
+		if expr == "" {
+			return 0, false, fmt.Errorf("missing term after the operator")
+		}
+	}
+
+	switch selector {
+	case '<':
+		val &= 0xff
+	case '>':
+		val = (val >> 8) & 0xff
+	}
+
+	return val, known, nil
+}
+
+// nextTerm splits the first term of the expression from the rest of it.
+func nextTerm(expr string) (string, string) {
+	if len(expr) >= 3 && expr[0] == '\'' && expr[2] == '\'' {
+		return expr[:3], strings.TrimSpace(expr[3:])
+	}
+
+	end := strings.IndexAny(expr[1:], "+-")
+	if end < 0 {
+		return strings.TrimSpace(expr), ""
+	}
+
+	return strings.TrimSpace(expr[:end+1]), strings.TrimSpace(expr[end+1:])
+}
+
+func (a *assembler) term(term string) (int, bool, error) {
+	var (
+		val uint64
+		err error
+	)
+
+	switch {
+	case term == "*":
+		return int(a.pc), true, nil
+	case len(term) == 3 && term[0] == '\'' && term[2] == '\'':
+		return int(term[1]), true, nil
+	case strings.HasPrefix(term, "$"):
+		val, err = strconv.ParseUint(term[1:], 16, 16)
+	case strings.HasPrefix(term, "%"):
+		val, err = strconv.ParseUint(term[1:], 2, 16)
+	case term[0] >= '0' && term[0] <= '9':
+		val, err = strconv.ParseUint(term, 10, 16)
+	default:
+		if !labelRe.MatchString(term + ":") {
+			return 0, false, fmt.Errorf("invalid term %q", term)
+		}
+
+		sym, ok := a.symbols[term]
+
+		return int(sym), ok, nil
+	}
+
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid number %q", term)
+	}
+
+	return int(val), true, nil
+}
@@ -0,0 +1,62 @@
+package asm
+
+import (
+	"fmt"
+
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+const chrRomBankSize = 8192
+
+// NROM returns the program as a .nes file for mapper 0 with an NES 2.0
+// header. The program must be assembled to $8000-$FFFF; if it fits in
+// $C000-$FFFF, a single 16 KiB PRG ROM bank is used. The CHR ROM can be
+// empty, in which case the cartridge has 8 KiB of CHR RAM instead.
+func (p *Program) NROM(chr []uint8, mirroring rom.NameTableMirroringType) ([]uint8, error) {
+	prgStart := 0xc000
+
+	for _, segment := range p.Segments {
+		if segment.Origin < 0x8000 {
+			return nil, fmt.Errorf("the segment at $%04X is outside of the PRG ROM", segment.Origin)
+		}
+
+		if int(segment.Origin)+len(segment.Data) > 0x10000 {
+			return nil, fmt.Errorf("the segment at $%04X overflows the address space", segment.Origin)
+		}
+
+		if int(segment.Origin) < prgStart {
+			prgStart = 0x8000
+		}
+	}
+
+	if len(chr) > chrRomBankSize || len(chr)%chrRomBankSize != 0 {
+		return nil, fmt.Errorf("NROM takes zero or one %d byte CHR ROM bank, got %d bytes", chrRomBankSize, len(chr))
+	}
+
+	prg := make([]uint8, 0x10000-prgStart)
+	for i := range prg {
+		prg[i] = 0xff
+	}
+
+	for _, segment := range p.Segments {
+		copy(prg[int(segment.Origin)-prgStart:], segment.Data)
+	}
+
+	header := []uint8{
+		'N', 'E', 'S', 0x1a,
+		uint8(len(prg) / rom.PrgROMBankSize),
+		uint8(len(chr) / chrRomBankSize),
+		uint8(mirroring) & 0x01,
+		0x08, // NES 2.0
+		0, 0, 0, 0, 0, 0, 0, 0,
+	}
+
+	if len(chr) == 0 {
+		// 64 << 7 bytes of CHR RAM.
+		header[11] = 0x07
+	}
+
+	nes := append(header, prg...)
+
+	return append(nes, chr...), nil
+}
@@ -0,0 +1,40 @@
+package asm
+
+import "github.com/pqkallio/nes-emulator/emulator/cpu"
+
+// opCodes maps the mnemonics and their addressing modes to opcodes. It is
+// built from the opcode table of the CPU. When there are several encodings
+// for the same instruction, the official one is preferred over the
+// unofficial ones, and the lowest opcode over the higher ones.
+var opCodes = map[string]map[cpu.AddressingMode]uint8{}
+
+// aliases are the other names the unofficial opcodes are known by.
+var aliases = map[string]string{
+	"ANE": "XAA",
+	"ASR": "ALR",
+	"DCM": "DCP",
+	"ISC": "ISB",
+	"KIL": "JAM",
+	"LXA": "LAX",
+	"SBX": "AXS",
+	"SHA": "AHX",
+	"SHS": "TAS",
+}
+
+func init() {
+	for i := 0; i < 256; i++ {
+		opCode := cpu.Lookup(uint8(i))
+
+		modes, ok := opCodes[opCode.Name]
+		if !ok {
+			modes = map[cpu.AddressingMode]uint8{}
+			opCodes[opCode.Name] = modes
+		}
+
+		if prev, ok := modes[opCode.Mode]; ok && (opCode.Unofficial || !cpu.Lookup(prev).Unofficial) {
+			continue
+		}
+
+		modes[opCode.Mode] = uint8(i)
+	}
+}
@@ -1,11 +1,5 @@
 package cpu
 
-import (
-	"reflect"
-
-	"github.com/pqkallio/nes-emulator/emulator/bus"
-)
-
 type cpuFlag uint8
 
 // Status register flags.
@@ -25,6 +19,41 @@ const (
 	signMask  uint8  = 0x80
 )
 
+const jsrOpCode uint8 = 0x20
+
+// Interrupt vectors.
+const (
+	nmiVector uint16 = 0xfffa
+	irqVector uint16 = 0xfffe
+)
+
+// vectorFetchCycle is the number of cycles left in an interrupt sequence when
+// the interrupt vector is selected.
+const vectorFetchCycle = 3
+
+// Bus is the address space the CPU reads and writes through. Every call is
+// one bus cycle; the CPU performs the same dummy reads and writes as the
+// hardware does.
+type Bus interface {
+	ReadData(addr uint16) uint8
+	WriteData(addr uint16, data uint8)
+}
+
+// OpCodeFetcher is implemented by buses that tell opcode fetches apart from
+// the other reads, e.g. to break on the execution of an address. If the bus
+// implements it, the CPU fetches the opcodes with FetchOpCode.
+type OpCodeFetcher interface {
+	FetchOpCode(addr uint16) uint8
+}
+
+// Peeker is implemented by buses that can read without side effects, e.g.
+// without clearing the PPU's vblank flag. If the bus implements it, the
+// tracer reads the instructions and their operands with Peek, so tracing
+// doesn't change the run.
+type Peeker interface {
+	Peek(addr uint16) uint8
+}
+
 type Cpu struct {
 	aReg         uint8
 	xReg         uint8
@@ -37,16 +66,39 @@ type Cpu struct {
 	relativeAddr uint16
 	fetchedData  uint8
 	opCode       uint8
-	opCodeLookup [256]instruction
-	bus          *bus.Bus
+	mode         AddressingMode
+	cycles       uint64
+	bus          Bus
+	fetcher      OpCodeFetcher
+	peeker       Peeker
+	tracer       *Tracer
+	observers    []Observer
+
+	pageCrossCycle bool
+	// stallCycles is the number of cycles the CPU is halted for, see Stall.
+	stallCycles int
+
+	nmiLine          bool
+	nmiPrevLine      bool
+	nmiPending       bool
+	irqLine          bool
+	irqSignal        bool
+	interruptPending bool
+	pollInterrupts   bool
+	pollCycle        uint8
+	iFlagLatched     bool
+	iFlagAtPoll      bool
+	vectorPending    bool
+	brkSequence      bool
+	interrupted      Interrupt
 }
 
-func NewCpu(bus *bus.Bus) *Cpu {
-	cpu := &Cpu{bus: bus}
-
-	setOpCodeLookups(cpu)
+func NewCpu(bus Bus) *Cpu {
+	c := &Cpu{bus: bus}
+	c.fetcher, _ = bus.(OpCodeFetcher)
+	c.peeker, _ = bus.(Peeker)
 
-	return cpu
+	return c
 }
 
 func (c *Cpu) setFlag(flag cpuFlag, value bool) {
@@ -62,25 +114,77 @@ func (c *Cpu) getFlag(flag cpuFlag) bool {
 }
 
 // Tick is called by the emulator to advance the CPU by one cycle.
+//
+// An instruction is executed on the first cycle it occupies and the remaining
+// cycles are spent idle, but the interrupt inputs are still sampled on the
+// cycle the real hardware samples them on.
 func (c *Cpu) Tick() {
-	if c.nCycles == 0 {
-		opCode := c.bus.ReadData(c.pc)
-		c.opCode = opCode
-		c.pc++
+	c.interrupted = NoInterrupt
 
-		instruction := c.opCodeLookup[opCode]
-		c.nCycles = instruction.nCycles
+	if c.stallCycles > 0 {
+		c.stallCycles--
+		c.cycles++
+		c.detectInterrupts()
 
-		additionalAddrCycles := instruction.addr()
-		additionalOpCycles := instruction.op()
+		return
+	}
 
-		if additionalAddrCycles != 0 && additionalOpCycles != 0 {
-			c.nCycles += additionalAddrCycles + additionalOpCycles
+	if c.nCycles == 0 {
+		if c.interruptPending {
+			c.interrupt()
+		} else {
+			c.execute()
 		}
-
 	}
 
 	c.nCycles--
+	c.cycles++
+
+	if c.pollInterrupts && c.nCycles == c.pollCycle {
+		c.poll()
+	}
+
+	c.detectInterrupts()
+
+	if c.vectorPending && c.nCycles == vectorFetchCycle {
+		c.fetchVector()
+	}
+}
+
+func (c *Cpu) execute() {
+	if c.tracer != nil {
+		c.tracer.trace(c)
+	}
+
+	for _, o := range c.observers {
+		o.BeforeInstruction(c)
+	}
+
+	var opCode uint8
+	if c.fetcher != nil {
+		opCode = c.fetcher.FetchOpCode(c.pc)
+	} else {
+		opCode = c.bus.ReadData(c.pc)
+	}
+
+	c.opCode = opCode
+	c.pc++
+
+	instruction := &opCodeLookup[opCode]
+	c.mode = instruction.mode
+	c.pageCrossCycle = instruction.pageCrossCycle()
+	c.nCycles = instruction.nCycles
+
+	c.pollInterrupts = true
+	c.pollCycle = 1
+	c.iFlagLatched = false
+
+	additionalAddrCycles := c.resolveAddress(instruction.mode)
+	additionalOpCycles := instruction.op(c)
+
+	// An extra cycle is taken only if both the addressing mode crossed a page
+	// and the operation is one that can't skip the fix-up cycle.
+	c.nCycles += additionalAddrCycles & additionalOpCycles
 }
 
 // Reset resets the CPU.
@@ -90,7 +194,7 @@ func (c *Cpu) Reset() {
 	c.yReg = 0
 
 	c.sp = 0xfd
-	c.status = 0x00 | uint8(unusedFlag)
+	c.status = uint8(unusedFlag | disableInterruptsFlag)
 
 	// Fetch the address of the first instruction from memory location 0xfffc
 	c.absoluteAddr = 0xfffc
@@ -102,64 +206,138 @@ func (c *Cpu) Reset() {
 	c.absoluteAddr = 0
 	c.fetchedData = 0
 
-	c.nCycles = 8
+	c.nmiPending = false
+	c.irqSignal = false
+	c.interruptPending = false
+	c.pollInterrupts = false
+	c.vectorPending = false
+
+	c.cycles = 0
+	c.nCycles = 7
+	c.stallCycles = 0
 }
 
-// Nmi is called when the cpu receives a non-maskable interrupt.
-// A nmi is always handled.
-func (c *Cpu) Nmi() {
-	c.bus.WriteData(stackBase+uint16(c.sp), uint8(c.pc>>8))
-	c.sp--
-	c.bus.WriteData(stackBase+uint16(c.sp), uint8(c.pc&0xff))
-	c.sp--
+// Cycles returns the number of cycles the CPU has run since the reset.
+func (c *Cpu) Cycles() uint64 {
+	return c.cycles
+}
 
-	c.setFlag(breakFlag, false)
-	c.setFlag(unusedFlag, true)
-	c.setFlag(disableInterruptsFlag, true)
-	c.bus.WriteData(stackBase+uint16(c.sp), c.status)
-	c.sp--
+// Stall halts the CPU for the given number of cycles, e.g. while a DMA unit
+// uses the bus. The cycles are added after the cycle in progress; the
+// interrupt inputs are still sampled while the CPU is halted.
+func (c *Cpu) Stall(cycles int) {
+	c.stallCycles += cycles
+}
 
-	c.absoluteAddr = 0xfffa
-	addrLo := uint16(c.bus.ReadData(c.absoluteAddr))
-	addrHi := uint16(c.bus.ReadData(c.absoluteAddr+1)) << 8
-	addr := addrLo | addrHi
+// SetNmiLine sets the level of the non-maskable interrupt input. The NMI is
+// edge triggered: an interrupt is latched when the line goes from released
+// to asserted, and it stays pending until it has been serviced.
+func (c *Cpu) SetNmiLine(asserted bool) {
+	c.nmiLine = asserted
+}
 
-	c.pc = addr
+// SetIrqLine sets the level of the interrupt request input. The IRQ is level
+// triggered: the interrupt is serviced only if the line is still asserted when
+// the CPU polls for interrupts and the interrupts are not disabled.
+func (c *Cpu) SetIrqLine(asserted bool) {
+	c.irqLine = asserted
+}
+
+// detectInterrupts runs the NMI edge detector and the IRQ level detector.
+// Their outputs become visible to the interrupt polling on the next cycle.
+func (c *Cpu) detectInterrupts() {
+	if c.nmiLine && !c.nmiPrevLine {
+		c.nmiPending = true
+	}
 
-	c.nCycles = 8
+	c.nmiPrevLine = c.nmiLine
+	c.irqSignal = c.irqLine
 }
 
-// Irq is called to request an interrupt.
-// If the interrupts are disabled, the interrupt is ignored.
-func (c *Cpu) Irq() {
-	if c.getFlag(disableInterruptsFlag) {
-		return
+// poll decides whether an interrupt sequence is run after the current
+// instruction instead of fetching the next opcode.
+func (c *Cpu) poll() {
+	interruptsDisabled := c.getFlag(disableInterruptsFlag)
+	if c.iFlagLatched {
+		// CLI, SEI and PLP change the flag after the polling has happened.
+		interruptsDisabled = c.iFlagAtPoll
 	}
 
+	c.interruptPending = c.nmiPending || (c.irqSignal && !interruptsDisabled)
+}
+
+// interrupt runs the hardware interrupt sequence. It is identical to BRK,
+// except that the opcode fetch is suppressed, the program counter is not
+// incremented and the break flag is cleared in the pushed status.
+func (c *Cpu) interrupt() {
+	c.bus.ReadData(c.pc)
+	c.bus.ReadData(c.pc)
+
+	c.interruptPending = false
+	c.pollInterrupts = false
+	c.nCycles = 7
+
+	c.pushInterruptFrame(false)
+}
+
+// pushInterruptFrame pushes the program counter and the status register to
+// the stack, and schedules the fetch of the interrupt vector.
+func (c *Cpu) pushInterruptFrame(brk bool) {
 	c.bus.WriteData(stackBase+uint16(c.sp), uint8(c.pc>>8))
 	c.sp--
 	c.bus.WriteData(stackBase+uint16(c.sp), uint8(c.pc&0xff))
 	c.sp--
 
-	c.setFlag(breakFlag, false)
-	c.setFlag(unusedFlag, true)
-	c.setFlag(disableInterruptsFlag, true)
-	c.bus.WriteData(stackBase+uint16(c.sp), c.status)
+	status := c.status | uint8(unusedFlag)
+	if brk {
+		status |= uint8(breakFlag)
+	} else {
+		status &= ^uint8(breakFlag)
+	}
+
+	c.bus.WriteData(stackBase+uint16(c.sp), status)
 	c.sp--
 
-	c.absoluteAddr = 0xfffe
+	c.setFlag(disableInterruptsFlag, true)
+
+	c.brkSequence = brk
+	c.vectorPending = true
+}
+
+// fetchVector loads the program counter from the interrupt vector. The
+// vector is chosen only now, so an NMI that is detected during the first
+// cycles of a BRK or an IRQ hijacks the sequence and the NMI handler is run
+// instead.
+func (c *Cpu) fetchVector() {
+	c.vectorPending = false
+
+	c.absoluteAddr = irqVector
+	c.interrupted = IrqInterrupt
+	if c.brkSequence {
+		c.interrupted = BrkInterrupt
+	}
+
+	if c.nmiPending {
+		c.nmiPending = false
+		c.absoluteAddr = nmiVector
+		c.interrupted = NmiInterrupt
+	}
+
 	addrLo := uint16(c.bus.ReadData(c.absoluteAddr))
 	addrHi := uint16(c.bus.ReadData(c.absoluteAddr+1)) << 8
-	addr := addrLo | addrHi
 
-	c.pc = addr
+	c.pc = addrLo | addrHi
 
-	c.nCycles = 7
+	for _, o := range c.observers {
+		if obs, ok := o.(InterruptObserver); ok {
+			obs.AfterInterrupt(c, c.interrupted)
+		}
+	}
 }
 
 func (c *Cpu) fetchData() {
-	switch reflect.ValueOf(c.opCodeLookup[c.opCode].addr).Pointer() {
-	case reflect.ValueOf(c.accumulator).Pointer():
+	switch c.mode {
+	case Accumulator:
 		c.fetchedData = c.aReg
 	default:
 		c.fetchedData = c.bus.ReadData(c.absoluteAddr)
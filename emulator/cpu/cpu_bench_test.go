@@ -0,0 +1,106 @@
+package cpu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pqkallio/nes-emulator/emulator/bus"
+	"github.com/pqkallio/nes-emulator/emulator/ram"
+)
+
+// benchProgram is a loop that exercises the common addressing modes:
+//
+//	$8000  LDX #$00
+//	$8002  LDA $0200,X
+//	$8005  ADC #$01
+//	$8007  STA $0200,X
+//	$800A  ASL A
+//	$800B  LDY $10
+//	$800D  STA ($20),Y
+//	$800F  INX
+//	$8010  BNE $8002
+//	$8012  JMP $8000
+var benchProgram = []uint8{
+	0xa2, 0x00,
+	0xbd, 0x00, 0x02,
+	0x69, 0x01,
+	0x9d, 0x00, 0x02,
+	0x0a,
+	0xa4, 0x10,
+	0x91, 0x20,
+	0xe8,
+	0xd0, 0xf0,
+	0x4c, 0x00, 0x80,
+}
+
+func newBenchCpu() *Cpu {
+	b := bus.NewBus()
+	_ = b.Map(0x0000, 0x1fff, 0x07ff, ram.NewRam(0x800))
+	_ = b.Map(0x8000, 0xffff, 0xffff, ram.NewRam(0x8000))
+
+	for i, data := range benchProgram {
+		b.WriteData(0x8000+uint16(i), data)
+	}
+
+	b.WriteData(0x0020, 0x00)
+	b.WriteData(0x0021, 0x03)
+	b.WriteData(0xfffc, 0x00)
+	b.WriteData(0xfffd, 0x80)
+
+	c := NewCpu(b)
+	c.Reset()
+
+	return c
+}
+
+func BenchmarkTick(b *testing.B) {
+	c := newBenchCpu()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c.Tick()
+	}
+}
+
+func BenchmarkInstruction(b *testing.B) {
+	c := newBenchCpu()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	start := time.Now()
+
+	for i := 0; i < b.N; i++ {
+		c.Tick()
+		for c.nCycles != 0 {
+			c.Tick()
+		}
+	}
+
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "instr/s")
+}
+
+func TestTickDoesNotAllocate(t *testing.T) {
+	c := newBenchCpu()
+
+	if allocs := testing.AllocsPerRun(1000, c.Tick); allocs != 0 {
+		t.Errorf("Tick allocated %v times, want 0", allocs)
+	}
+}
+
+func TestInstructionDoesNotAllocate(t *testing.T) {
+	c := newBenchCpu()
+
+	instruction := func() {
+		c.Tick()
+		for c.nCycles != 0 {
+			c.Tick()
+		}
+	}
+
+	if allocs := testing.AllocsPerRun(1000, instruction); allocs != 0 {
+		t.Errorf("an instruction allocated %v times, want 0", allocs)
+	}
+}
@@ -0,0 +1,233 @@
+// Package disasm disassembles 6502 machine code using the opcode table of the
+// CPU.
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+)
+
+// Memory is the memory the instructions are decoded from. It is read with
+// Peek, so the live memory can be disassembled without the side effects of
+// the reads; *bus.Bus implements it.
+type Memory interface {
+	Peek(addr uint16) uint8
+}
+
+// Instruction is a decoded instruction.
+type Instruction struct {
+	Addr   uint16
+	Bytes  []uint8
+	OpCode cpu.OpCode
+}
+
+// Decode decodes the instruction at addr.
+func Decode(mem Memory, addr uint16) Instruction {
+	opCode := cpu.Lookup(mem.Peek(addr))
+
+	bytes := make([]uint8, opCode.Mode.Length())
+	for i := range bytes {
+		bytes[i] = mem.Peek(addr + uint16(i))
+	}
+
+	return Instruction{Addr: addr, Bytes: bytes, OpCode: opCode}
+}
+
+// Backtrack returns an address the given number of instructions before the
+// address. The instruction boundaries can't be known when disassembling
+// backwards, so the nearest address whose instructions line up with the
+// address is chosen. If there is none, the address itself is returned.
+func Backtrack(mem Memory, addr uint16, n int) uint16 {
+	for back := n; back <= 3*n; back++ {
+		start := addr - uint16(back)
+		remaining, count := back, 0
+
+		for a := start; remaining > 0; count++ {
+			length := Decode(mem, a).Length()
+			a += uint16(length)
+			remaining -= length
+		}
+
+		if remaining == 0 && count == n {
+			return start
+		}
+	}
+
+	return addr
+}
+
+// Length returns the length of the instruction in bytes.
+func (i Instruction) Length() int {
+	return len(i.Bytes)
+}
+
+// Operand returns the value of the operand bytes of the instruction.
+func (i Instruction) Operand() uint16 {
+	switch len(i.Bytes) {
+	case 2:
+		return uint16(i.Bytes[1])
+	case 3:
+		return uint16(i.Bytes[1]) | uint16(i.Bytes[2])<<8
+	default:
+		return 0
+	}
+}
+
+// IsData tells whether the instruction is a single byte that doesn't form a
+// complete instruction.
+func (i Instruction) IsData() bool {
+	return uint16(len(i.Bytes)) < i.OpCode.Mode.Length()
+}
+
+// Target returns the address a relative branch jumps to when taken.
+func (i Instruction) Target() uint16 {
+	return i.Addr + 2 + uint16(int8(i.Operand()))
+}
+
+// Cycles returns the cycle count of the instruction, e.g. "4+1" for an
+// instruction that takes an extra cycle on a page crossing.
+func (i Instruction) Cycles() string {
+	switch {
+	case i.IsData():
+		return ""
+	case i.OpCode.Mode == cpu.Relative:
+		return fmt.Sprintf("%d+1+1", i.OpCode.Cycles)
+	case i.OpCode.PageCrossCycle:
+		return fmt.Sprintf("%d+1", i.OpCode.Cycles)
+	default:
+		return fmt.Sprintf("%d", i.OpCode.Cycles)
+	}
+}
+
+// String returns the instruction in assembler syntax, e.g. "LDA ($20),Y".
+// A byte that doesn't form a complete instruction is returned as a .byte
+// directive.
+func (i Instruction) String() string {
+	return i.Format(nil)
+}
+
+// Format returns the instruction in assembler syntax like String, with the
+// addresses of the operand replaced with their labels.
+func (i Instruction) Format(labels cpu.Labels) string {
+	if i.IsData() {
+		return fmt.Sprintf(".byte $%02X", i.Bytes[0])
+	}
+
+	operand := i.Operand()
+	name := i.OpCode.Name
+
+	addr := func(format string) string {
+		if labels != nil {
+			if label, ok := labels.Label(operand); ok {
+				return label
+			}
+		}
+
+		return fmt.Sprintf(format, operand)
+	}
+
+	switch i.OpCode.Mode {
+	case cpu.Accumulator:
+		return name + " A"
+	case cpu.Immediate:
+		return fmt.Sprintf("%s #$%02X", name, operand)
+	case cpu.ZeroPage:
+		return fmt.Sprintf("%s %s", name, addr("$%02X"))
+	case cpu.XIndexedZeroPage:
+		return fmt.Sprintf("%s %s,X", name, addr("$%02X"))
+	case cpu.YIndexedZeroPage:
+		return fmt.Sprintf("%s %s,Y", name, addr("$%02X"))
+	case cpu.Absolute:
+		return fmt.Sprintf("%s %s", name, addr("$%04X"))
+	case cpu.XIndexedAbsolute:
+		return fmt.Sprintf("%s %s,X", name, addr("$%04X"))
+	case cpu.YIndexedAbsolute:
+		return fmt.Sprintf("%s %s,Y", name, addr("$%04X"))
+	case cpu.AbsoluteIndirect:
+		return fmt.Sprintf("%s (%s)", name, addr("$%04X"))
+	case cpu.IndexedIndirect:
+		return fmt.Sprintf("%s (%s,X)", name, addr("$%02X"))
+	case cpu.IndirectIndexed:
+		return fmt.Sprintf("%s (%s),Y", name, addr("$%02X"))
+	case cpu.Relative:
+		operand = i.Target()
+		return fmt.Sprintf("%s %s", name, addr("$%04X"))
+	default:
+		return name
+	}
+}
+
+// Bank is a raw block of memory, e.g. a PRG ROM bank, mapped at Origin.
+// Reads outside of the bank return zero.
+type Bank struct {
+	Data   []uint8
+	Origin uint16
+}
+
+func (b Bank) Peek(addr uint16) uint8 {
+	offset := int(addr) - int(b.Origin)
+	if offset < 0 || offset >= len(b.Data) {
+		return 0
+	}
+
+	return b.Data[offset]
+}
+
+// Instructions decodes all the instructions in the bank in sequence. The
+// bytes of an instruction that would extend past the end of the bank are
+// returned as data.
+func (b Bank) Instructions() []Instruction {
+	var instructions []Instruction
+
+	for offset := 0; offset < len(b.Data); {
+		addr := b.Origin + uint16(offset)
+		instruction := Decode(b, addr)
+
+		if offset+instruction.Length() > len(b.Data) {
+			instruction.Bytes = instruction.Bytes[:1]
+		}
+
+		instructions = append(instructions, instruction)
+		offset += instruction.Length()
+	}
+
+	return instructions
+}
+
+// Write writes a listing of the instructions to w, one instruction per line:
+//
+//	C000  4C F5 C5  JMP $C5F5        ; 3
+//
+// If labels are given, the labels of the operands are printed instead of the
+// addresses, and the label of an instruction on a line of its own before
+// the instruction.
+func Write(w io.Writer, instructions []Instruction, labels cpu.Labels) error {
+	for _, instruction := range instructions {
+		if labels != nil {
+			if label, ok := labels.Label(instruction.Addr); ok {
+				if _, err := fmt.Fprintf(w, "%s:\n", label); err != nil {
+					return err
+				}
+			}
+		}
+
+		bytes := make([]string, len(instruction.Bytes))
+		for i, b := range instruction.Bytes {
+			bytes[i] = fmt.Sprintf("%02X", b)
+		}
+
+		line := fmt.Sprintf("%04X  %-8s  %-16s", instruction.Addr, strings.Join(bytes, " "), instruction.Format(labels))
+		if cycles := instruction.Cycles(); cycles != "" {
+			line += " ; " + cycles
+		}
+
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line, " ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
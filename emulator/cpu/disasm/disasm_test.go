@@ -0,0 +1,181 @@
+package disasm
+
+import (
+	"strings"
+	"testing"
+)
+
+type testLabels map[uint16]string
+
+func (l testLabels) Label(addr uint16) (string, bool) {
+	label, ok := l[addr]
+	return label, ok
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name       string
+		addr       uint16
+		bytes      []uint8
+		want       string
+		cycles     string
+		unofficial bool
+	}{
+		{"implied", 0xc000, []uint8{0xe8}, "INX", "2", false},
+		{"accumulator", 0xc000, []uint8{0x0a}, "ASL A", "2", false},
+		{"immediate", 0xc000, []uint8{0xa9, 0x05}, "LDA #$05", "2", false},
+		{"zero page", 0xc000, []uint8{0xa5, 0x10}, "LDA $10", "3", false},
+		{"x-indexed zero page", 0xc000, []uint8{0xb5, 0x10}, "LDA $10,X", "4", false},
+		{"y-indexed zero page", 0xc000, []uint8{0xb6, 0x10}, "LDX $10,Y", "4", false},
+		{"absolute", 0xc000, []uint8{0xad, 0x34, 0x12}, "LDA $1234", "4", false},
+		{"x-indexed absolute", 0xc000, []uint8{0xbd, 0x34, 0x12}, "LDA $1234,X", "4+1", false},
+		{"y-indexed absolute", 0xc000, []uint8{0xb9, 0x34, 0x12}, "LDA $1234,Y", "4+1", false},
+		{"store without page cross cycle", 0xc000, []uint8{0x9d, 0x34, 0x12}, "STA $1234,X", "5", false},
+		{"absolute indirect", 0xc000, []uint8{0x6c, 0x34, 0x12}, "JMP ($1234)", "5", false},
+		{"indexed indirect", 0xc000, []uint8{0xa1, 0x20}, "LDA ($20,X)", "6", false},
+		{"indirect indexed", 0xc000, []uint8{0xb1, 0x20}, "LDA ($20),Y", "5+1", false},
+		{"relative forwards", 0xc000, []uint8{0xd0, 0x10}, "BNE $C012", "2+1+1", false},
+		{"relative backwards", 0xc000, []uint8{0xd0, 0xfe}, "BNE $C000", "2+1+1", false},
+		{"relative across the end", 0xfff0, []uint8{0xf0, 0x7f}, "BEQ $0071", "2+1+1", false},
+		{"unofficial", 0xc000, []uint8{0xa7, 0x10}, "LAX $10", "3", true},
+		{"unofficial implied", 0xc000, []uint8{0x1a}, "NOP", "2", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := Bank{Data: test.bytes, Origin: test.addr}
+			i := Decode(b, test.addr)
+
+			if i.Addr != test.addr || i.Length() != len(test.bytes) || string(i.Bytes) != string(test.bytes) {
+				t.Errorf("got $%04X % X, want $%04X % X", i.Addr, i.Bytes, test.addr, test.bytes)
+			}
+
+			if i.String() != test.want || i.Cycles() != test.cycles || i.OpCode.Unofficial != test.unofficial {
+				t.Errorf("got %q ; %s, unofficial %v, want %q ; %s, unofficial %v",
+					i.String(), i.Cycles(), i.OpCode.Unofficial, test.want, test.cycles, test.unofficial)
+			}
+		})
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	labels := testLabels{0x10: "ptr", 0x1234: "table", 0xc012: "loop"}
+
+	tests := []struct {
+		bytes []uint8
+		want  string
+	}{
+		{[]uint8{0xa5, 0x10}, "LDA ptr"},
+		{[]uint8{0xb1, 0x10}, "LDA (ptr),Y"},
+		{[]uint8{0xa1, 0x10}, "LDA (ptr,X)"},
+		{[]uint8{0xbd, 0x34, 0x12}, "LDA table,X"},
+		{[]uint8{0x6c, 0x34, 0x12}, "JMP (table)"},
+		{[]uint8{0xd0, 0x10}, "BNE loop"},
+		// Immediate values aren't addresses.
+		{[]uint8{0xa9, 0x10}, "LDA #$10"},
+		{[]uint8{0xad, 0x35, 0x12}, "LDA $1235"},
+	}
+
+	for _, test := range tests {
+		i := Decode(Bank{Data: test.bytes, Origin: 0xc000}, 0xc000)
+
+		if got := i.Format(labels); got != test.want {
+			t.Errorf("% X: got %q, want %q", test.bytes, got, test.want)
+		}
+	}
+}
+
+func TestBankInstructions(t *testing.T) {
+	// LDA #$05 / STA $0200 / INX and the first byte of a JMP cut off by
+	// the end of the bank.
+	b := Bank{Data: []uint8{0xa9, 0x05, 0x8d, 0x00, 0x02, 0xe8, 0x4c, 0x00}, Origin: 0x8000}
+
+	want := []struct {
+		addr uint16
+		text string
+	}{
+		{0x8000, "LDA #$05"},
+		{0x8002, "STA $0200"},
+		{0x8005, "INX"},
+		{0x8006, ".byte $4C"},
+		{0x8007, "BRK"},
+	}
+
+	got := b.Instructions()
+	if len(got) != len(want) {
+		t.Fatalf("got %d instructions, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i].Addr != want[i].addr || got[i].String() != want[i].text {
+			t.Errorf("%d: got $%04X %q, want $%04X %q", i, got[i].Addr, got[i].String(), want[i].addr, want[i].text)
+		}
+	}
+
+	if !got[3].IsData() || got[3].Cycles() != "" {
+		t.Errorf("the cut off JMP isn't data: %+v", got[3])
+	}
+
+	// A read outside of the bank is zero.
+	if b.Peek(0x7fff) != 0 || b.Peek(0x8008) != 0 {
+		t.Error("read a byte outside of the bank")
+	}
+}
+
+func TestBacktrack(t *testing.T) {
+	// $8000 JMP $2020, $8003 INX, $8004 INX, $8005 JSR $2020, $8008 NOP.
+	// The operands are JSR opcodes, so only the instruction boundaries line
+	// up.
+	b := Bank{Data: []uint8{0x4c, 0x20, 0x20, 0xe8, 0xe8, 0x20, 0x20, 0x20, 0xea}, Origin: 0x8000}
+
+	tests := []struct {
+		addr uint16
+		n    int
+		want uint16
+	}{
+		{0x8003, 1, 0x8000},
+		{0x8005, 1, 0x8004},
+		{0x8005, 3, 0x8000},
+		{0x8008, 1, 0x8005},
+		{0x8008, 2, 0x8004},
+		{0x8008, 0, 0x8008},
+	}
+
+	for _, test := range tests {
+		if got := Backtrack(b, test.addr, test.n); got != test.want {
+			t.Errorf("%d before $%04X: got $%04X, want $%04X", test.n, test.addr, got, test.want)
+		}
+	}
+
+	// The operand bytes of JMP $8005 decode as ORA $80, which lines up
+	// nearer than the JMP.
+	jmp := Bank{Data: []uint8{0x4c, 0x05, 0x80, 0xea}, Origin: 0x8000}
+	if got := Backtrack(jmp, 0x8003, 1); got != 0x8001 {
+		t.Errorf("got $%04X, want $8001", got)
+	}
+
+	// Nothing lines up with $8001 after three byte instructions, so the
+	// address is returned as it is.
+	jsrs := Bank{Data: []uint8{0x20, 0x20, 0x20, 0x20}, Origin: 0x8000}
+	if got := Backtrack(jsrs, 0x8001, 1); got != 0x8001 {
+		t.Errorf("got $%04X, want $8001", got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	b := Bank{Data: []uint8{0xa9, 0x05, 0xd0, 0xfc, 0x4c}, Origin: 0xc000}
+
+	var sb strings.Builder
+	if err := Write(&sb, b.Instructions(), testLabels{0xc000: "reset"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "reset:\n" +
+		"C000  A9 05     LDA #$05         ; 2\n" +
+		"C002  D0 FC     BNE reset        ; 2+1+1\n" +
+		"C004  4C        .byte $4C\n"
+
+	if sb.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", sb.String(), want)
+	}
+}
@@ -1,291 +1,365 @@
 package cpu
 
-type operationFn func() uint8
-type addressModeFn func() uint8
+type operationFn func(c *Cpu) uint8
+
+type AddressingMode uint8
+
+// Addressing modes.
+const (
+	Implied AddressingMode = iota
+	Accumulator
+	Immediate
+	ZeroPage
+	XIndexedZeroPage
+	YIndexedZeroPage
+	Absolute
+	XIndexedAbsolute
+	YIndexedAbsolute
+	AbsoluteIndirect
+	IndexedIndirect
+	IndirectIndexed
+	Relative
+)
+
+// Length returns the length in bytes of an instruction using the addressing
+// mode, including the opcode.
+func (m AddressingMode) Length() uint16 {
+	switch m {
+	case Implied, Accumulator:
+		return 1
+	case Absolute, XIndexedAbsolute, YIndexedAbsolute, AbsoluteIndirect:
+		return 3
+	default:
+		return 2
+	}
+}
 
 type instruction struct {
-	name    string
-	op      operationFn
-	addr    addressModeFn
-	nCycles uint8
+	name       string
+	op         operationFn
+	mode       AddressingMode
+	nCycles    uint8
+	unofficial bool
 }
 
-func setOpCodeLookups(cpu *Cpu) {
-	illegal := instruction{"???", cpu.illegal, cpu.impliedAddr, 2}
+// OpCode describes an opcode as it is decoded by the CPU.
+type OpCode struct {
+	Name string
+	Mode AddressingMode
+	// Cycles is the number of cycles the instruction takes at least.
+	Cycles uint8
+	// PageCrossCycle tells whether the instruction takes an extra cycle when
+	// the indexed effective address crosses a page boundary. Branches take
+	// an extra cycle when taken and another one if the target is on another
+	// page, which is not included here.
+	PageCrossCycle bool
+	// Unofficial is set for the opcodes that are not part of the documented
+	// instruction set.
+	Unofficial bool
+}
 
-	cpu.opCodeLookup = [256]instruction{
-		// 0x00-0x0F
-		{"BRK", cpu.brk, cpu.impliedAddr, 7},
-		{"ORA", cpu.ora, cpu.indexedIndirectAddr, 6},
-		illegal,
-		illegal,
-		illegal,
-		{"ORA", cpu.ora, cpu.zeroPageAddr, 3},
-		{"ASL", cpu.asl, cpu.zeroPageAddr, 5},
-		illegal,
-		{"PHP", cpu.php, cpu.impliedAddr, 3},
-		{"ORA", cpu.ora, cpu.immAddr, 2},
-		{"ASL", cpu.asl, cpu.accumulator, 2},
-		illegal,
-		illegal,
-		{"ORA", cpu.ora, cpu.absAddr, 4},
-		{"ASL", cpu.asl, cpu.absAddr, 6},
-		illegal,
-		// 0x10-0x1F
-		{"BPL", cpu.bpl, cpu.relAddr, 2},
-		{"ORA", cpu.ora, cpu.indirectIndexedAddr, 5},
-		illegal,
-		illegal,
-		illegal,
-		{"ORA", cpu.ora, cpu.xIndexedZeroPageAddr, 4},
-		{"ASL", cpu.asl, cpu.xIndexedZeroPageAddr, 6},
-		illegal,
-		{"CLC", cpu.clc, cpu.impliedAddr, 2},
-		{"ORA", cpu.ora, cpu.yIndexedAbsAddr, 4},
-		illegal,
-		illegal,
-		illegal,
-		{"ORA", cpu.ora, cpu.xIndexedAbsAddr, 4},
-		{"ASL", cpu.asl, cpu.xIndexedAbsAddr, 7},
-		illegal,
-		// 0x20-0x2F
-		{"JSR", cpu.jsr, cpu.absAddr, 6},
-		{"AND", cpu.and, cpu.indexedIndirectAddr, 6},
-		illegal,
-		illegal,
-		{"BIT", cpu.bit, cpu.zeroPageAddr, 3},
-		{"AND", cpu.and, cpu.zeroPageAddr, 3},
-		{"ROL", cpu.rol, cpu.zeroPageAddr, 5},
-		illegal,
-		{"PLP", cpu.plp, cpu.impliedAddr, 4},
-		{"AND", cpu.and, cpu.immAddr, 2},
-		{"ROL", cpu.rol, cpu.accumulator, 2},
-		illegal,
-		{"BIT", cpu.bit, cpu.absAddr, 4},
-		{"AND", cpu.and, cpu.absAddr, 4},
-		{"ROL", cpu.rol, cpu.absAddr, 6},
-		illegal,
-		// 0x30-0x3F
-		{"BMI", cpu.bmi, cpu.relAddr, 2},
-		{"AND", cpu.and, cpu.indirectIndexedAddr, 5},
-		illegal,
-		illegal,
-		illegal,
-		{"AND", cpu.and, cpu.xIndexedZeroPageAddr, 4},
-		{"ROL", cpu.rol, cpu.xIndexedZeroPageAddr, 6},
-		illegal,
-		{"SEC", cpu.sec, cpu.impliedAddr, 2},
-		{"AND", cpu.and, cpu.yIndexedAbsAddr, 4},
-		illegal,
-		illegal,
-		illegal,
-		{"AND", cpu.and, cpu.xIndexedAbsAddr, 4},
-		{"ROL", cpu.rol, cpu.xIndexedAbsAddr, 7},
-		illegal,
-		// 0x40-0x4F
-		{"RTI", cpu.rti, cpu.impliedAddr, 6},
-		{"EOR", cpu.eor, cpu.indexedIndirectAddr, 6},
-		illegal,
-		illegal,
-		illegal,
-		{"EOR", cpu.eor, cpu.zeroPageAddr, 3},
-		{"LSR", cpu.lsr, cpu.zeroPageAddr, 5},
-		illegal,
-		{"PHA", cpu.pha, cpu.impliedAddr, 3},
-		{"EOR", cpu.eor, cpu.immAddr, 2},
-		{"LSR", cpu.lsr, cpu.accumulator, 2},
-		illegal,
-		{"JMP", cpu.jmp, cpu.absAddr, 3},
-		{"EOR", cpu.eor, cpu.absAddr, 4},
-		{"LSR", cpu.lsr, cpu.absAddr, 6},
-		illegal,
-		// 0x50-0x5F
-		{"BVC", cpu.bvc, cpu.relAddr, 2},
-		{"EOR", cpu.eor, cpu.indirectIndexedAddr, 5},
-		illegal,
-		illegal,
-		illegal,
-		{"EOR", cpu.eor, cpu.xIndexedZeroPageAddr, 4},
-		{"LSR", cpu.lsr, cpu.xIndexedZeroPageAddr, 6},
-		illegal,
-		{"CLI", cpu.cli, cpu.impliedAddr, 2},
-		{"EOR", cpu.eor, cpu.yIndexedAbsAddr, 4},
-		illegal,
-		illegal,
-		illegal,
-		{"EOR", cpu.eor, cpu.xIndexedAbsAddr, 4},
-		{"LSR", cpu.lsr, cpu.xIndexedAbsAddr, 7},
-		illegal,
-		// 0x60-0x6F
-		{"RTS", cpu.rts, cpu.impliedAddr, 6},
-		{"ADC", cpu.adc, cpu.indexedIndirectAddr, 6},
-		illegal,
-		illegal,
-		illegal,
-		{"ADC", cpu.adc, cpu.zeroPageAddr, 3},
-		{"ROR", cpu.ror, cpu.zeroPageAddr, 5},
-		illegal,
-		{"PLA", cpu.pla, cpu.impliedAddr, 4},
-		{"ADC", cpu.adc, cpu.immAddr, 2},
-		{"ROR", cpu.ror, cpu.accumulator, 2},
-		illegal,
-		{"JMP", cpu.jmp, cpu.absIndirectAddr, 5},
-		{"ADC", cpu.adc, cpu.absAddr, 4},
-		{"ROR", cpu.ror, cpu.absAddr, 6},
-		illegal,
-		// 0x70-0x7F
-		{"BVS", cpu.bvs, cpu.relAddr, 2},
-		{"ADC", cpu.adc, cpu.indirectIndexedAddr, 5},
-		illegal,
-		illegal,
-		illegal,
-		{"ADC", cpu.adc, cpu.xIndexedZeroPageAddr, 4},
-		{"ROR", cpu.ror, cpu.xIndexedZeroPageAddr, 6},
-		illegal,
-		{"SEI", cpu.sei, cpu.impliedAddr, 2},
-		{"ADC", cpu.adc, cpu.yIndexedAbsAddr, 4},
-		illegal,
-		illegal,
-		illegal,
-		{"ADC", cpu.adc, cpu.xIndexedAbsAddr, 4},
-		{"ROR", cpu.ror, cpu.xIndexedAbsAddr, 7},
-		illegal,
-		// 0x80-0x8F
-		illegal,
-		{"STA", cpu.sta, cpu.indexedIndirectAddr, 6},
-		illegal,
-		illegal,
-		{"STY", cpu.sty, cpu.zeroPageAddr, 3},
-		{"STA", cpu.sta, cpu.zeroPageAddr, 3},
-		{"STX", cpu.stx, cpu.zeroPageAddr, 3},
-		illegal,
-		{"DEY", cpu.dey, cpu.impliedAddr, 2},
-		illegal,
-		{"TXA", cpu.txa, cpu.impliedAddr, 2},
-		illegal,
-		{"STY", cpu.sty, cpu.absAddr, 4},
-		{"STA", cpu.sta, cpu.absAddr, 4},
-		{"STX", cpu.stx, cpu.absAddr, 4},
-		illegal,
-		// 0x90-0x9F
-		{"BCC", cpu.bcc, cpu.relAddr, 2},
-		{"STA", cpu.sta, cpu.indirectIndexedAddr, 6},
-		illegal,
-		illegal,
-		{"STY", cpu.sty, cpu.xIndexedZeroPageAddr, 4},
-		{"STA", cpu.sta, cpu.xIndexedZeroPageAddr, 4},
-		{"STX", cpu.stx, cpu.yIndexedZeroPageAddr, 4},
-		illegal,
-		{"TYA", cpu.tya, cpu.impliedAddr, 2},
-		{"STA", cpu.sta, cpu.yIndexedAbsAddr, 5},
-		{"TXS", cpu.txs, cpu.impliedAddr, 2},
-		illegal,
-		illegal,
-		{"STA", cpu.sta, cpu.xIndexedAbsAddr, 5},
-		illegal,
-		illegal,
-		// 0xA0-0xAF
-		{"LDY", cpu.ldy, cpu.immAddr, 2},
-		{"LDA", cpu.lda, cpu.indexedIndirectAddr, 6},
-		{"LDX", cpu.ldx, cpu.immAddr, 2},
-		illegal,
-		{"LDY", cpu.ldy, cpu.zeroPageAddr, 3},
-		{"LDA", cpu.lda, cpu.zeroPageAddr, 3},
-		{"LDX", cpu.ldx, cpu.zeroPageAddr, 3},
-		illegal,
-		{"TAY", cpu.tay, cpu.impliedAddr, 2},
-		{"LDA", cpu.lda, cpu.immAddr, 2},
-		{"TAX", cpu.tax, cpu.impliedAddr, 2},
-		illegal,
-		{"LDY", cpu.ldy, cpu.absAddr, 4},
-		{"LDA", cpu.lda, cpu.absAddr, 4},
-		{"LDX", cpu.ldx, cpu.absAddr, 4},
-		illegal,
-		// 0xB0-0xBF
-		{"BCS", cpu.bcs, cpu.relAddr, 2},
-		{"LDA", cpu.lda, cpu.indirectIndexedAddr, 5},
-		illegal,
-		illegal,
-		{"LDY", cpu.ldy, cpu.xIndexedZeroPageAddr, 4},
-		{"LDA", cpu.lda, cpu.xIndexedZeroPageAddr, 4},
-		{"LDX", cpu.ldx, cpu.yIndexedZeroPageAddr, 4},
-		illegal,
-		{"CLV", cpu.clv, cpu.impliedAddr, 2},
-		{"LDA", cpu.lda, cpu.yIndexedAbsAddr, 4},
-		{"TSX", cpu.tsx, cpu.impliedAddr, 2},
-		illegal,
-		{"LDY", cpu.ldy, cpu.xIndexedAbsAddr, 4},
-		{"LDA", cpu.lda, cpu.xIndexedAbsAddr, 4},
-		{"LDX", cpu.ldx, cpu.yIndexedAbsAddr, 4},
-		illegal,
-		// 0xC0-0xCF
-		{"CPY", cpu.cpy, cpu.immAddr, 2},
-		{"CMP", cpu.cmp, cpu.indexedIndirectAddr, 6},
-		illegal,
-		illegal,
-		{"CPY", cpu.cpy, cpu.zeroPageAddr, 3},
-		{"CMP", cpu.cmp, cpu.zeroPageAddr, 3},
-		{"DEC", cpu.dec, cpu.zeroPageAddr, 5},
-		illegal,
-		{"INY", cpu.iny, cpu.impliedAddr, 2},
-		{"CMP", cpu.cmp, cpu.immAddr, 2},
-		{"DEX", cpu.dex, cpu.impliedAddr, 2},
-		illegal,
-		{"CPY", cpu.cpy, cpu.absAddr, 4},
-		{"CMP", cpu.cmp, cpu.absAddr, 4},
-		{"DEC", cpu.dec, cpu.absAddr, 6},
-		illegal,
-		// 0xD0-0xDF
-		{"BNE", cpu.bne, cpu.relAddr, 2},
-		{"CMP", cpu.cmp, cpu.indirectIndexedAddr, 5},
-		illegal,
-		illegal,
-		illegal,
-		{"CMP", cpu.cmp, cpu.xIndexedZeroPageAddr, 4},
-		{"DEC", cpu.dec, cpu.xIndexedZeroPageAddr, 6},
-		illegal,
-		{"CLD", cpu.cld, cpu.impliedAddr, 2},
-		{"CMP", cpu.cmp, cpu.yIndexedAbsAddr, 4},
-		illegal,
-		illegal,
-		illegal,
-		{"CMP", cpu.cmp, cpu.xIndexedAbsAddr, 4},
-		{"DEC", cpu.dec, cpu.xIndexedAbsAddr, 7},
-		illegal,
-		// 0xE0-0xEF
-		{"CPX", cpu.cpx, cpu.immAddr, 2},
-		{"SBC", cpu.sbc, cpu.indexedIndirectAddr, 6},
-		illegal,
-		illegal,
-		{"CPX", cpu.cpx, cpu.zeroPageAddr, 3},
-		{"SBC", cpu.sbc, cpu.zeroPageAddr, 3},
-		{"INC", cpu.inc, cpu.zeroPageAddr, 5},
-		illegal,
-		{"INX", cpu.inx, cpu.impliedAddr, 2},
-		{"SBC", cpu.sbc, cpu.immAddr, 2},
-		{"NOP", cpu.nop, cpu.impliedAddr, 2},
-		illegal,
-		{"CPX", cpu.cpx, cpu.absAddr, 4},
-		{"SBC", cpu.sbc, cpu.absAddr, 4},
-		{"INC", cpu.inc, cpu.absAddr, 6},
-		illegal,
-		// 0xF0-0xFF
-		{"BEQ", cpu.beq, cpu.relAddr, 2},
-		{"SBC", cpu.sbc, cpu.indirectIndexedAddr, 5},
-		illegal,
-		illegal,
-		illegal,
-		{"SBC", cpu.sbc, cpu.xIndexedZeroPageAddr, 4},
-		{"INC", cpu.inc, cpu.xIndexedZeroPageAddr, 6},
-		illegal,
-		{"SED", cpu.sed, cpu.impliedAddr, 2},
-		{"SBC", cpu.sbc, cpu.yIndexedAbsAddr, 4},
-		illegal,
-		illegal,
-		illegal,
-		{"SBC", cpu.sbc, cpu.xIndexedAbsAddr, 4},
-		{"INC", cpu.inc, cpu.xIndexedAbsAddr, 7},
-		illegal,
+// Lookup returns the description of an opcode.
+func Lookup(opCode uint8) OpCode {
+	instruction := &opCodeLookup[opCode]
+
+	return OpCode{
+		Name:           instruction.name,
+		Mode:           instruction.mode,
+		Cycles:         instruction.nCycles,
+		PageCrossCycle: instruction.pageCrossCycle(),
+		Unofficial:     instruction.unofficial,
 	}
+}
+
+// pageCrossCycle tells whether the instruction takes an extra cycle on a page
+// crossing. Only the instructions that read their operand do; writes and
+// read-modify-writes always spend the fix-up cycle, which is already counted
+// in their cycle count.
+func (i *instruction) pageCrossCycle() bool {
+	switch i.mode {
+	case XIndexedAbsolute, YIndexedAbsolute:
+		return i.nCycles == 4
+	case IndirectIndexed:
+		return i.nCycles == 5
+	default:
+		return false
+	}
+}
 
+// opCodeLookup decodes an opcode into the operation, its addressing mode and
+// its base cycle count. All the 256 opcodes are decoded, including the
+// unofficial ones.
+var opCodeLookup = [256]instruction{
+	// 0x00-0x0F
+	{"BRK", (*Cpu).brk, Implied, 7, false},
+	{"ORA", (*Cpu).ora, IndexedIndirect, 6, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"SLO", (*Cpu).slo, IndexedIndirect, 8, true},
+	{"NOP", (*Cpu).ign, ZeroPage, 3, true},
+	{"ORA", (*Cpu).ora, ZeroPage, 3, false},
+	{"ASL", (*Cpu).asl, ZeroPage, 5, false},
+	{"SLO", (*Cpu).slo, ZeroPage, 5, true},
+	{"PHP", (*Cpu).php, Implied, 3, false},
+	{"ORA", (*Cpu).ora, Immediate, 2, false},
+	{"ASL", (*Cpu).asl, Accumulator, 2, false},
+	{"ANC", (*Cpu).anc, Immediate, 2, true},
+	{"NOP", (*Cpu).ign, Absolute, 4, true},
+	{"ORA", (*Cpu).ora, Absolute, 4, false},
+	{"ASL", (*Cpu).asl, Absolute, 6, false},
+	{"SLO", (*Cpu).slo, Absolute, 6, true},
+	// 0x10-0x1F
+	{"BPL", (*Cpu).bpl, Relative, 2, false},
+	{"ORA", (*Cpu).ora, IndirectIndexed, 5, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"SLO", (*Cpu).slo, IndirectIndexed, 8, true},
+	{"NOP", (*Cpu).ign, XIndexedZeroPage, 4, true},
+	{"ORA", (*Cpu).ora, XIndexedZeroPage, 4, false},
+	{"ASL", (*Cpu).asl, XIndexedZeroPage, 6, false},
+	{"SLO", (*Cpu).slo, XIndexedZeroPage, 6, true},
+	{"CLC", (*Cpu).clc, Implied, 2, false},
+	{"ORA", (*Cpu).ora, YIndexedAbsolute, 4, false},
+	{"NOP", (*Cpu).nop, Implied, 2, true},
+	{"SLO", (*Cpu).slo, YIndexedAbsolute, 7, true},
+	{"NOP", (*Cpu).ign, XIndexedAbsolute, 4, true},
+	{"ORA", (*Cpu).ora, XIndexedAbsolute, 4, false},
+	{"ASL", (*Cpu).asl, XIndexedAbsolute, 7, false},
+	{"SLO", (*Cpu).slo, XIndexedAbsolute, 7, true},
+	// 0x20-0x2F
+	{"JSR", (*Cpu).jsr, Absolute, 6, false},
+	{"AND", (*Cpu).and, IndexedIndirect, 6, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"RLA", (*Cpu).rla, IndexedIndirect, 8, true},
+	{"BIT", (*Cpu).bit, ZeroPage, 3, false},
+	{"AND", (*Cpu).and, ZeroPage, 3, false},
+	{"ROL", (*Cpu).rol, ZeroPage, 5, false},
+	{"RLA", (*Cpu).rla, ZeroPage, 5, true},
+	{"PLP", (*Cpu).plp, Implied, 4, false},
+	{"AND", (*Cpu).and, Immediate, 2, false},
+	{"ROL", (*Cpu).rol, Accumulator, 2, false},
+	{"ANC", (*Cpu).anc, Immediate, 2, true},
+	{"BIT", (*Cpu).bit, Absolute, 4, false},
+	{"AND", (*Cpu).and, Absolute, 4, false},
+	{"ROL", (*Cpu).rol, Absolute, 6, false},
+	{"RLA", (*Cpu).rla, Absolute, 6, true},
+	// 0x30-0x3F
+	{"BMI", (*Cpu).bmi, Relative, 2, false},
+	{"AND", (*Cpu).and, IndirectIndexed, 5, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"RLA", (*Cpu).rla, IndirectIndexed, 8, true},
+	{"NOP", (*Cpu).ign, XIndexedZeroPage, 4, true},
+	{"AND", (*Cpu).and, XIndexedZeroPage, 4, false},
+	{"ROL", (*Cpu).rol, XIndexedZeroPage, 6, false},
+	{"RLA", (*Cpu).rla, XIndexedZeroPage, 6, true},
+	{"SEC", (*Cpu).sec, Implied, 2, false},
+	{"AND", (*Cpu).and, YIndexedAbsolute, 4, false},
+	{"NOP", (*Cpu).nop, Implied, 2, true},
+	{"RLA", (*Cpu).rla, YIndexedAbsolute, 7, true},
+	{"NOP", (*Cpu).ign, XIndexedAbsolute, 4, true},
+	{"AND", (*Cpu).and, XIndexedAbsolute, 4, false},
+	{"ROL", (*Cpu).rol, XIndexedAbsolute, 7, false},
+	{"RLA", (*Cpu).rla, XIndexedAbsolute, 7, true},
+	// 0x40-0x4F
+	{"RTI", (*Cpu).rti, Implied, 6, false},
+	{"EOR", (*Cpu).eor, IndexedIndirect, 6, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"SRE", (*Cpu).sre, IndexedIndirect, 8, true},
+	{"NOP", (*Cpu).ign, ZeroPage, 3, true},
+	{"EOR", (*Cpu).eor, ZeroPage, 3, false},
+	{"LSR", (*Cpu).lsr, ZeroPage, 5, false},
+	{"SRE", (*Cpu).sre, ZeroPage, 5, true},
+	{"PHA", (*Cpu).pha, Implied, 3, false},
+	{"EOR", (*Cpu).eor, Immediate, 2, false},
+	{"LSR", (*Cpu).lsr, Accumulator, 2, false},
+	{"ALR", (*Cpu).alr, Immediate, 2, true},
+	{"JMP", (*Cpu).jmp, Absolute, 3, false},
+	{"EOR", (*Cpu).eor, Absolute, 4, false},
+	{"LSR", (*Cpu).lsr, Absolute, 6, false},
+	{"SRE", (*Cpu).sre, Absolute, 6, true},
+	// 0x50-0x5F
+	{"BVC", (*Cpu).bvc, Relative, 2, false},
+	{"EOR", (*Cpu).eor, IndirectIndexed, 5, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"SRE", (*Cpu).sre, IndirectIndexed, 8, true},
+	{"NOP", (*Cpu).ign, XIndexedZeroPage, 4, true},
+	{"EOR", (*Cpu).eor, XIndexedZeroPage, 4, false},
+	{"LSR", (*Cpu).lsr, XIndexedZeroPage, 6, false},
+	{"SRE", (*Cpu).sre, XIndexedZeroPage, 6, true},
+	{"CLI", (*Cpu).cli, Implied, 2, false},
+	{"EOR", (*Cpu).eor, YIndexedAbsolute, 4, false},
+	{"NOP", (*Cpu).nop, Implied, 2, true},
+	{"SRE", (*Cpu).sre, YIndexedAbsolute, 7, true},
+	{"NOP", (*Cpu).ign, XIndexedAbsolute, 4, true},
+	{"EOR", (*Cpu).eor, XIndexedAbsolute, 4, false},
+	{"LSR", (*Cpu).lsr, XIndexedAbsolute, 7, false},
+	{"SRE", (*Cpu).sre, XIndexedAbsolute, 7, true},
+	// 0x60-0x6F
+	{"RTS", (*Cpu).rts, Implied, 6, false},
+	{"ADC", (*Cpu).adc, IndexedIndirect, 6, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"RRA", (*Cpu).rra, IndexedIndirect, 8, true},
+	{"NOP", (*Cpu).ign, ZeroPage, 3, true},
+	{"ADC", (*Cpu).adc, ZeroPage, 3, false},
+	{"ROR", (*Cpu).ror, ZeroPage, 5, false},
+	{"RRA", (*Cpu).rra, ZeroPage, 5, true},
+	{"PLA", (*Cpu).pla, Implied, 4, false},
+	{"ADC", (*Cpu).adc, Immediate, 2, false},
+	{"ROR", (*Cpu).ror, Accumulator, 2, false},
+	{"ARR", (*Cpu).arr, Immediate, 2, true},
+	{"JMP", (*Cpu).jmp, AbsoluteIndirect, 5, false},
+	{"ADC", (*Cpu).adc, Absolute, 4, false},
+	{"ROR", (*Cpu).ror, Absolute, 6, false},
+	{"RRA", (*Cpu).rra, Absolute, 6, true},
+	// 0x70-0x7F
+	{"BVS", (*Cpu).bvs, Relative, 2, false},
+	{"ADC", (*Cpu).adc, IndirectIndexed, 5, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"RRA", (*Cpu).rra, IndirectIndexed, 8, true},
+	{"NOP", (*Cpu).ign, XIndexedZeroPage, 4, true},
+	{"ADC", (*Cpu).adc, XIndexedZeroPage, 4, false},
+	{"ROR", (*Cpu).ror, XIndexedZeroPage, 6, false},
+	{"RRA", (*Cpu).rra, XIndexedZeroPage, 6, true},
+	{"SEI", (*Cpu).sei, Implied, 2, false},
+	{"ADC", (*Cpu).adc, YIndexedAbsolute, 4, false},
+	{"NOP", (*Cpu).nop, Implied, 2, true},
+	{"RRA", (*Cpu).rra, YIndexedAbsolute, 7, true},
+	{"NOP", (*Cpu).ign, XIndexedAbsolute, 4, true},
+	{"ADC", (*Cpu).adc, XIndexedAbsolute, 4, false},
+	{"ROR", (*Cpu).ror, XIndexedAbsolute, 7, false},
+	{"RRA", (*Cpu).rra, XIndexedAbsolute, 7, true},
+	// 0x80-0x8F
+	{"NOP", (*Cpu).ign, Immediate, 2, true},
+	{"STA", (*Cpu).sta, IndexedIndirect, 6, false},
+	{"NOP", (*Cpu).ign, Immediate, 2, true},
+	{"SAX", (*Cpu).sax, IndexedIndirect, 6, true},
+	{"STY", (*Cpu).sty, ZeroPage, 3, false},
+	{"STA", (*Cpu).sta, ZeroPage, 3, false},
+	{"STX", (*Cpu).stx, ZeroPage, 3, false},
+	{"SAX", (*Cpu).sax, ZeroPage, 3, true},
+	{"DEY", (*Cpu).dey, Implied, 2, false},
+	{"NOP", (*Cpu).ign, Immediate, 2, true},
+	{"TXA", (*Cpu).txa, Implied, 2, false},
+	{"XAA", (*Cpu).xaa, Immediate, 2, true},
+	{"STY", (*Cpu).sty, Absolute, 4, false},
+	{"STA", (*Cpu).sta, Absolute, 4, false},
+	{"STX", (*Cpu).stx, Absolute, 4, false},
+	{"SAX", (*Cpu).sax, Absolute, 4, true},
+	// 0x90-0x9F
+	{"BCC", (*Cpu).bcc, Relative, 2, false},
+	{"STA", (*Cpu).sta, IndirectIndexed, 6, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"AHX", (*Cpu).ahx, IndirectIndexed, 6, true},
+	{"STY", (*Cpu).sty, XIndexedZeroPage, 4, false},
+	{"STA", (*Cpu).sta, XIndexedZeroPage, 4, false},
+	{"STX", (*Cpu).stx, YIndexedZeroPage, 4, false},
+	{"SAX", (*Cpu).sax, YIndexedZeroPage, 4, true},
+	{"TYA", (*Cpu).tya, Implied, 2, false},
+	{"STA", (*Cpu).sta, YIndexedAbsolute, 5, false},
+	{"TXS", (*Cpu).txs, Implied, 2, false},
+	{"TAS", (*Cpu).tas, YIndexedAbsolute, 5, true},
+	{"SHY", (*Cpu).shy, XIndexedAbsolute, 5, true},
+	{"STA", (*Cpu).sta, XIndexedAbsolute, 5, false},
+	{"SHX", (*Cpu).shx, YIndexedAbsolute, 5, true},
+	{"AHX", (*Cpu).ahx, YIndexedAbsolute, 5, true},
+	// 0xA0-0xAF
+	{"LDY", (*Cpu).ldy, Immediate, 2, false},
+	{"LDA", (*Cpu).lda, IndexedIndirect, 6, false},
+	{"LDX", (*Cpu).ldx, Immediate, 2, false},
+	{"LAX", (*Cpu).lax, IndexedIndirect, 6, true},
+	{"LDY", (*Cpu).ldy, ZeroPage, 3, false},
+	{"LDA", (*Cpu).lda, ZeroPage, 3, false},
+	{"LDX", (*Cpu).ldx, ZeroPage, 3, false},
+	{"LAX", (*Cpu).lax, ZeroPage, 3, true},
+	{"TAY", (*Cpu).tay, Implied, 2, false},
+	{"LDA", (*Cpu).lda, Immediate, 2, false},
+	{"TAX", (*Cpu).tax, Implied, 2, false},
+	{"LAX", (*Cpu).lxa, Immediate, 2, true},
+	{"LDY", (*Cpu).ldy, Absolute, 4, false},
+	{"LDA", (*Cpu).lda, Absolute, 4, false},
+	{"LDX", (*Cpu).ldx, Absolute, 4, false},
+	{"LAX", (*Cpu).lax, Absolute, 4, true},
+	// 0xB0-0xBF
+	{"BCS", (*Cpu).bcs, Relative, 2, false},
+	{"LDA", (*Cpu).lda, IndirectIndexed, 5, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"LAX", (*Cpu).lax, IndirectIndexed, 5, true},
+	{"LDY", (*Cpu).ldy, XIndexedZeroPage, 4, false},
+	{"LDA", (*Cpu).lda, XIndexedZeroPage, 4, false},
+	{"LDX", (*Cpu).ldx, YIndexedZeroPage, 4, false},
+	{"LAX", (*Cpu).lax, YIndexedZeroPage, 4, true},
+	{"CLV", (*Cpu).clv, Implied, 2, false},
+	{"LDA", (*Cpu).lda, YIndexedAbsolute, 4, false},
+	{"TSX", (*Cpu).tsx, Implied, 2, false},
+	{"LAS", (*Cpu).las, YIndexedAbsolute, 4, true},
+	{"LDY", (*Cpu).ldy, XIndexedAbsolute, 4, false},
+	{"LDA", (*Cpu).lda, XIndexedAbsolute, 4, false},
+	{"LDX", (*Cpu).ldx, YIndexedAbsolute, 4, false},
+	{"LAX", (*Cpu).lax, YIndexedAbsolute, 4, true},
+	// 0xC0-0xCF
+	{"CPY", (*Cpu).cpy, Immediate, 2, false},
+	{"CMP", (*Cpu).cmp, IndexedIndirect, 6, false},
+	{"NOP", (*Cpu).ign, Immediate, 2, true},
+	{"DCP", (*Cpu).dcp, IndexedIndirect, 8, true},
+	{"CPY", (*Cpu).cpy, ZeroPage, 3, false},
+	{"CMP", (*Cpu).cmp, ZeroPage, 3, false},
+	{"DEC", (*Cpu).dec, ZeroPage, 5, false},
+	{"DCP", (*Cpu).dcp, ZeroPage, 5, true},
+	{"INY", (*Cpu).iny, Implied, 2, false},
+	{"CMP", (*Cpu).cmp, Immediate, 2, false},
+	{"DEX", (*Cpu).dex, Implied, 2, false},
+	{"AXS", (*Cpu).axs, Immediate, 2, true},
+	{"CPY", (*Cpu).cpy, Absolute, 4, false},
+	{"CMP", (*Cpu).cmp, Absolute, 4, false},
+	{"DEC", (*Cpu).dec, Absolute, 6, false},
+	{"DCP", (*Cpu).dcp, Absolute, 6, true},
+	// 0xD0-0xDF
+	{"BNE", (*Cpu).bne, Relative, 2, false},
+	{"CMP", (*Cpu).cmp, IndirectIndexed, 5, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"DCP", (*Cpu).dcp, IndirectIndexed, 8, true},
+	{"NOP", (*Cpu).ign, XIndexedZeroPage, 4, true},
+	{"CMP", (*Cpu).cmp, XIndexedZeroPage, 4, false},
+	{"DEC", (*Cpu).dec, XIndexedZeroPage, 6, false},
+	{"DCP", (*Cpu).dcp, XIndexedZeroPage, 6, true},
+	{"CLD", (*Cpu).cld, Implied, 2, false},
+	{"CMP", (*Cpu).cmp, YIndexedAbsolute, 4, false},
+	{"NOP", (*Cpu).nop, Implied, 2, true},
+	{"DCP", (*Cpu).dcp, YIndexedAbsolute, 7, true},
+	{"NOP", (*Cpu).ign, XIndexedAbsolute, 4, true},
+	{"CMP", (*Cpu).cmp, XIndexedAbsolute, 4, false},
+	{"DEC", (*Cpu).dec, XIndexedAbsolute, 7, false},
+	{"DCP", (*Cpu).dcp, XIndexedAbsolute, 7, true},
+	// 0xE0-0xEF
+	{"CPX", (*Cpu).cpx, Immediate, 2, false},
+	{"SBC", (*Cpu).sbc, IndexedIndirect, 6, false},
+	{"NOP", (*Cpu).ign, Immediate, 2, true},
+	{"ISB", (*Cpu).isb, IndexedIndirect, 8, true},
+	{"CPX", (*Cpu).cpx, ZeroPage, 3, false},
+	{"SBC", (*Cpu).sbc, ZeroPage, 3, false},
+	{"INC", (*Cpu).inc, ZeroPage, 5, false},
+	{"ISB", (*Cpu).isb, ZeroPage, 5, true},
+	{"INX", (*Cpu).inx, Implied, 2, false},
+	{"SBC", (*Cpu).sbc, Immediate, 2, false},
+	{"NOP", (*Cpu).nop, Implied, 2, false},
+	{"SBC", (*Cpu).sbc, Immediate, 2, true},
+	{"CPX", (*Cpu).cpx, Absolute, 4, false},
+	{"SBC", (*Cpu).sbc, Absolute, 4, false},
+	{"INC", (*Cpu).inc, Absolute, 6, false},
+	{"ISB", (*Cpu).isb, Absolute, 6, true},
+	// 0xF0-0xFF
+	{"BEQ", (*Cpu).beq, Relative, 2, false},
+	{"SBC", (*Cpu).sbc, IndirectIndexed, 5, false},
+	{"JAM", (*Cpu).jam, Implied, 2, true},
+	{"ISB", (*Cpu).isb, IndirectIndexed, 8, true},
+	{"NOP", (*Cpu).ign, XIndexedZeroPage, 4, true},
+	{"SBC", (*Cpu).sbc, XIndexedZeroPage, 4, false},
+	{"INC", (*Cpu).inc, XIndexedZeroPage, 6, false},
+	{"ISB", (*Cpu).isb, XIndexedZeroPage, 6, true},
+	{"SED", (*Cpu).sed, Implied, 2, false},
+	{"SBC", (*Cpu).sbc, YIndexedAbsolute, 4, false},
+	{"NOP", (*Cpu).nop, Implied, 2, true},
+	{"ISB", (*Cpu).isb, YIndexedAbsolute, 7, true},
+	{"NOP", (*Cpu).ign, XIndexedAbsolute, 4, true},
+	{"SBC", (*Cpu).sbc, XIndexedAbsolute, 4, false},
+	{"INC", (*Cpu).inc, XIndexedAbsolute, 7, false},
+	{"ISB", (*Cpu).isb, XIndexedAbsolute, 7, true},
 }
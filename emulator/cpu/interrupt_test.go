@@ -0,0 +1,425 @@
+// The interrupt tests assemble their programs with the asm package, which
+// imports cpu, so they are in the external test package.
+package cpu_test
+
+import (
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/emulator/cpu/asm"
+)
+
+// interruptProgram has an entry point for each test. The handlers run one
+// instruction before returning.
+const interruptProgram = `
+        .org $8000
+reset:  JMP reset
+
+ldaabs: LDA $0200
+        NOP
+        NOP
+ldazp:  LDA $10
+        NOP
+branch: LDA $10
+        BEQ near
+near:   NOP
+        NOP
+clitest:
+        NOP
+        CLI
+        NOP
+        NOP
+seitest:
+        NOP
+        CLI
+        SEI
+        NOP
+plptest:
+        NOP
+        LDA #$00
+        PHA
+        PLP
+        NOP
+        NOP
+brktest:
+        BRK
+        .byte $ff
+        NOP
+
+nmi:    NOP
+        RTI
+irq:    NOP
+        RTI
+
+        .org $80f0
+far:    NOP
+        NOP
+        .org $80fc
+cross:  LDX #$01
+        BNE far
+
+        .org $fffa
+        .word nmi, reset, irq
+`
+
+type testMemory [0x10000]uint8
+
+func (m *testMemory) ReadData(addr uint16) uint8 {
+	return m[addr]
+}
+
+func (m *testMemory) WriteData(addr uint16, data uint8) {
+	m[addr] = data
+}
+
+// newInterruptCpu returns a CPU that has run the reset sequence and is about
+// to run the code at the label with the status register p.
+func newInterruptCpu(t *testing.T, label string, p uint8) (*cpu.Cpu, *testMemory, map[string]uint16) {
+	t.Helper()
+
+	program, err := asm.Assemble(interruptProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem := &testMemory{}
+	program.Load(mem)
+	mem[0x0200] = 0x01
+
+	c := cpu.NewCpu(mem)
+	c.Reset()
+	step(c)
+
+	regs := c.Registers()
+	regs.PC = program.Symbols[label]
+	regs.P = p
+	c.SetRegisters(regs)
+
+	return c, mem, program.Symbols
+}
+
+// tick runs the CPU for n cycles and returns the interrupt whose vector was
+// fetched meanwhile, if any.
+func tick(c *cpu.Cpu, n int) cpu.Interrupt {
+	interrupt := cpu.NoInterrupt
+
+	for i := 0; i < n; i++ {
+		c.Tick()
+
+		if c.Interrupted() != cpu.NoInterrupt {
+			interrupt = c.Interrupted()
+		}
+	}
+
+	return interrupt
+}
+
+// step runs the next instruction or interrupt sequence and returns the
+// interrupt whose vector was fetched, if any.
+func step(c *cpu.Cpu) cpu.Interrupt {
+	interrupt := tick(c, 1)
+
+	for !c.InstructionBoundary() {
+		if i := tick(c, 1); i != cpu.NoInterrupt {
+			interrupt = i
+		}
+	}
+
+	return interrupt
+}
+
+// checkInterrupt runs the pending interrupt sequence and checks it, see
+// checkFrame.
+func checkInterrupt(t *testing.T, c *cpu.Cpu, mem *testMemory, want cpu.Interrupt, wantPc, wantReturn uint16, wantP uint8) {
+	t.Helper()
+
+	if !c.InterruptPending() {
+		t.Fatal("no interrupt pending")
+	}
+
+	checkFrame(t, c, mem, step(c), want, wantPc, wantReturn, wantP)
+}
+
+// checkFrame checks the interrupt whose vector was fetched, the handler
+// run, and the return address and the status pushed.
+func checkFrame(t *testing.T, c *cpu.Cpu, mem *testMemory, got, want cpu.Interrupt, wantPc, wantReturn uint16, wantP uint8) {
+	t.Helper()
+
+	if got != want {
+		t.Errorf("got interrupt %s, want %s", got, want)
+	}
+
+	regs := c.Registers()
+
+	if regs.PC != wantPc {
+		t.Errorf("got PC $%04X, want $%04X", regs.PC, wantPc)
+	}
+
+	if regs.P&0x04 == 0 {
+		t.Errorf("got P $%02X, want the interrupts disabled", regs.P)
+	}
+
+	p := mem[0x0100+uint16(regs.SP+1)]
+	ret := uint16(mem[0x0100+uint16(regs.SP+2)]) | uint16(mem[0x0100+uint16(regs.SP+3)])<<8
+
+	if ret != wantReturn {
+		t.Errorf("got return address $%04X, want $%04X", ret, wantReturn)
+	}
+
+	if p != wantP {
+		t.Errorf("got pushed P $%02X, want $%02X", p, wantP)
+	}
+}
+
+func TestInterruptPolling(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		// skip is the number of instructions run before the one tested.
+		skip int
+		// assert is the cycle of the instruction before which the IRQ
+		// line is asserted.
+		assert  int
+		cycles  uint64
+		pending bool
+	}{
+		// The interrupt is polled on the second to last cycle, and the
+		// line is seen by the polling on the cycle after it is asserted.
+		{"absolute load, first cycle", "ldaabs", 0, 1, 4, true},
+		{"absolute load, second cycle", "ldaabs", 0, 2, 4, true},
+		{"absolute load, third cycle", "ldaabs", 0, 3, 4, false},
+		{"absolute load, last cycle", "ldaabs", 0, 4, 4, false},
+		{"zero page load", "ldazp", 0, 1, 3, true},
+		// A taken branch that doesn't cross a page polls one cycle
+		// earlier.
+		{"taken branch", "branch", 1, 1, 3, false},
+		{"page crossing branch", "cross", 1, 2, 4, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, mem, symbols := newInterruptCpu(t, tt.entry, 0x20)
+
+			for i := 0; i < tt.skip; i++ {
+				step(c)
+			}
+
+			start := c.Cycles()
+
+			tick(c, tt.assert-1)
+			c.SetIrqLine(true)
+			step(c)
+
+			if got := c.Cycles() - start; got != tt.cycles {
+				t.Errorf("got %d cycles, want %d", got, tt.cycles)
+			}
+
+			if c.InterruptPending() != tt.pending {
+				t.Fatalf("got pending %t, want %t", c.InterruptPending(), tt.pending)
+			}
+
+			if !tt.pending {
+				// The interrupt is taken after the next instruction.
+				step(c)
+			}
+
+			ret := c.Registers().PC
+			checkInterrupt(t, c, mem, cpu.IrqInterrupt, symbols["irq"], ret, c.Registers().P|0x20)
+		})
+	}
+}
+
+func TestIrqIsLevelTriggered(t *testing.T) {
+	c, mem, symbols := newInterruptCpu(t, "ldaabs", 0x24)
+
+	// The interrupts are disabled.
+	c.SetIrqLine(true)
+	step(c)
+
+	if c.InterruptPending() {
+		t.Fatal("IRQ pending with the interrupts disabled")
+	}
+
+	// The line is released before the polling.
+	c, mem, symbols = newInterruptCpu(t, "ldaabs", 0x20)
+	c.SetIrqLine(true)
+	tick(c, 1)
+	c.SetIrqLine(false)
+	step(c)
+
+	if c.InterruptPending() {
+		t.Fatal("IRQ pending after the line was released")
+	}
+
+	// The two cycle NOP polls before it sees the line.
+	c.SetIrqLine(true)
+	step(c)
+	step(c)
+	checkInterrupt(t, c, mem, cpu.IrqInterrupt, symbols["irq"], symbols["ldaabs"]+5, 0x20)
+
+	// The handler runs with the interrupts disabled, and RTI enables them
+	// without a delay while the line is still asserted.
+	step(c)
+
+	if c.InterruptPending() {
+		t.Fatal("IRQ pending in the handler")
+	}
+
+	step(c)
+	checkInterrupt(t, c, mem, cpu.IrqInterrupt, symbols["irq"], symbols["ldaabs"]+5, 0x20)
+}
+
+func TestInterruptFlagLatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		// before is the number of instructions run before the interrupt
+		// is pending.
+		before int
+		// after is the length of the instructions run before the
+		// interrupt.
+		after uint16
+		wantP uint8
+	}{
+		// The tests start with a NOP, so the line has been detected when
+		// the flag is changed. CLI enables the interrupts after the next
+		// instruction.
+		{"CLI", "clitest", 3, 3, 0x20},
+		// An interrupt polled before SEI is taken after it, with the
+		// interrupts disabled in the pushed status.
+		{"SEI", "seitest", 3, 3, 0x24},
+		// PLP changes the flag after the polling, like CLI and SEI.
+		{"PLP", "plptest", 5, 6, 0x20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, mem, symbols := newInterruptCpu(t, tt.entry, 0x24)
+			c.SetIrqLine(true)
+
+			for i := 0; i < tt.before; i++ {
+				if c.InterruptPending() {
+					t.Fatalf("IRQ pending after %d instructions", i)
+				}
+
+				step(c)
+			}
+
+			checkInterrupt(t, c, mem, cpu.IrqInterrupt, symbols["irq"], symbols[tt.entry]+tt.after, tt.wantP)
+		})
+	}
+}
+
+func TestNmiIsEdgeTriggered(t *testing.T) {
+	c, mem, symbols := newInterruptCpu(t, "ldaabs", 0x24)
+
+	// The NMI can't be disabled.
+	c.SetNmiLine(true)
+	step(c)
+	checkInterrupt(t, c, mem, cpu.NmiInterrupt, symbols["nmi"], symbols["ldaabs"]+3, 0x24)
+
+	// The line is held asserted, which doesn't trigger another NMI.
+	for i := 0; i < 4; i++ {
+		step(c)
+
+		if c.InterruptPending() {
+			t.Fatalf("NMI pending after %d instructions with the line held", i+1)
+		}
+	}
+
+	// A pulse of one cycle is latched until the NMI is polled after the
+	// next instruction.
+	c.SetNmiLine(false)
+	step(c)
+	c.SetNmiLine(true)
+	tick(c, 1)
+	c.SetNmiLine(false)
+	step(c)
+
+	if c.InterruptPending() {
+		t.Fatal("NMI pending before it was polled")
+	}
+
+	step(c)
+
+	ret := c.Registers().PC
+	checkInterrupt(t, c, mem, cpu.NmiInterrupt, symbols["nmi"], ret, c.Registers().P|0x20)
+}
+
+func TestBrkAndNmiHijack(t *testing.T) {
+	tests := []struct {
+		name string
+		// assert is the cycle of the BRK before which the NMI line is
+		// asserted, or 0.
+		assert int
+		want   cpu.Interrupt
+		vector string
+	}{
+		{"BRK", 0, cpu.BrkInterrupt, "irq"},
+		// The vector is fetched on the fourth cycle, so an NMI detected
+		// until then runs the NMI handler.
+		{"hijacked", 4, cpu.NmiInterrupt, "nmi"},
+		{"not hijacked", 5, cpu.BrkInterrupt, "irq"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, mem, symbols := newInterruptCpu(t, "brktest", 0x20)
+
+			got := cpu.NoInterrupt
+			if tt.assert != 0 {
+				got = tick(c, tt.assert-1)
+				c.SetNmiLine(true)
+			}
+
+			if i := step(c); i != cpu.NoInterrupt {
+				got = i
+			}
+
+			if got != tt.want {
+				t.Errorf("got interrupt %s, want %s", got, tt.want)
+			}
+
+			regs := c.Registers()
+			if regs.PC != symbols[tt.vector] || regs.P&0x04 == 0 {
+				t.Errorf("got PC $%04X P $%02X, want the %s handler with the interrupts disabled", regs.PC, regs.P, tt.vector)
+			}
+
+			// The return address skips the byte after BRK, and the pushed
+			// status has the break flag set even if the NMI hijacked it.
+			ret := uint16(mem[0x0100+uint16(regs.SP+2)]) | uint16(mem[0x0100+uint16(regs.SP+3)])<<8
+			if p := mem[0x0100+uint16(regs.SP+1)]; ret != symbols["brktest"]+2 || p != 0x30 {
+				t.Errorf("got return address $%04X P $%02X, want $%04X $30", ret, p, symbols["brktest"]+2)
+			}
+
+			if tt.assert == 5 {
+				// The NMI is taken after the first instruction of the
+				// handler.
+				step(c)
+				checkInterrupt(t, c, mem, cpu.NmiInterrupt, symbols["nmi"], symbols["irq"]+1, 0x24)
+			}
+		})
+	}
+}
+
+func TestNmiHijacksIrq(t *testing.T) {
+	c, mem, symbols := newInterruptCpu(t, "ldaabs", 0x20)
+
+	c.SetIrqLine(true)
+	step(c)
+
+	if !c.InterruptPending() {
+		t.Fatal("no IRQ pending")
+	}
+
+	got := tick(c, 3)
+	c.SetNmiLine(true)
+
+	if i := step(c); i != cpu.NoInterrupt {
+		got = i
+	}
+
+	// The IRQ sequence fetches the NMI vector, and the pushed status has the
+	// break flag cleared.
+	checkFrame(t, c, mem, got, cpu.NmiInterrupt, symbols["nmi"], symbols["ldaabs"]+3, 0x20)
+}
@@ -1,31 +1,8 @@
 package cpu
 
-import "reflect"
-
 func (c *Cpu) adc() uint8 {
 	c.fetchData()
-	data := c.fetchedData
-
-	carry := uint16(0)
-	if c.getFlag(carryFlag) {
-		carry = 1
-	}
-
-	result := uint16(c.aReg) + uint16(data) + carry
-
-	// Set status flags
-	c.setFlag(carryFlag, result > 0xff)                      // if the result didn't fit in one byte, set the carry flag
-	c.setFlag(zeroFlag, result&0x00ff == 0)                  // if the result is zero, set the zero flag
-	c.setFlag(negativeFlag, result&uint16(signMask) != 0x00) // if the leftmost bit in the result is set, set the negative flag
-	// if the accumulator and operand are negative and the result is positive,
-	// or if the accumulator and operand are positive and the result is negative, set the overflow flag
-	c.setFlag(
-		overflowFlag,
-		(c.aReg&signMask != 0 && data&signMask != 0 && result&uint16(signMask) == 0) ||
-			(c.aReg&signMask == 0 && data&signMask == 0 && result&uint16(signMask) != 0),
-	)
-
-	c.aReg = uint8(result & 0x00ff)
+	c.addWithCarry(c.fetchedData)
 
 	return 1
 }
@@ -50,7 +27,7 @@ func (c *Cpu) asl() uint8 {
 	c.setFlag(zeroFlag, data == 0)
 	c.setFlag(negativeFlag, data&signMask != 0)
 
-	c.writeToMem(data)
+	c.modifyMem(data)
 
 	return 0
 }
@@ -91,8 +68,13 @@ func (c *Cpu) bpl() uint8 {
 }
 
 func (c *Cpu) brk() uint8 {
-	c.setFlag(breakFlag, true)
+	// The byte following the opcode is skipped, so the pushed return address
+	// is the address of the BRK plus two.
 	c.pc++
+
+	c.pollInterrupts = false
+	c.pushInterruptFrame(true)
+
 	return 0
 }
 
@@ -115,6 +97,7 @@ func (c *Cpu) cld() uint8 {
 }
 
 func (c *Cpu) cli() uint8 {
+	c.latchIFlag()
 	c.setFlag(disableInterruptsFlag, false)
 	return 0
 }
@@ -126,33 +109,21 @@ func (c *Cpu) clv() uint8 {
 
 func (c *Cpu) cmp() uint8 {
 	c.fetchData()
-	data := c.fetchedData
+	c.compare(c.aReg, c.fetchedData)
 
-	c.setFlag(carryFlag, c.aReg >= data)
-	c.setFlag(zeroFlag, c.aReg == data)
-	c.setFlag(negativeFlag, c.aReg&signMask != 0)
-
-	return 0
+	return 1
 }
 
 func (c *Cpu) cpx() uint8 {
 	c.fetchData()
-	data := c.fetchedData
-
-	c.setFlag(carryFlag, c.xReg >= data)
-	c.setFlag(zeroFlag, c.xReg == data)
-	c.setFlag(negativeFlag, c.xReg&signMask != 0)
+	c.compare(c.xReg, c.fetchedData)
 
 	return 0
 }
 
 func (c *Cpu) cpy() uint8 {
 	c.fetchData()
-	data := c.fetchedData
-
-	c.setFlag(carryFlag, c.yReg >= data)
-	c.setFlag(zeroFlag, c.yReg == data)
-	c.setFlag(negativeFlag, c.yReg&signMask != 0)
+	c.compare(c.yReg, c.fetchedData)
 
 	return 0
 }
@@ -166,7 +137,7 @@ func (c *Cpu) dec() uint8 {
 	c.setFlag(negativeFlag, result&signMask != 0)
 	c.setFlag(zeroFlag, result == 0)
 
-	c.writeToMem(result)
+	c.modifyMem(result)
 
 	return 0
 }
@@ -216,7 +187,7 @@ func (c *Cpu) inc() uint8 {
 	c.setFlag(negativeFlag, result&signMask != 0)
 	c.setFlag(zeroFlag, result == 0)
 
-	c.writeToMem(result)
+	c.modifyMem(result)
 
 	return 0
 }
@@ -250,11 +221,21 @@ func (c *Cpu) jmp() uint8 {
 }
 
 func (c *Cpu) jsr() uint8 {
+	lo := uint16(c.bus.ReadData(c.pc))
+	c.pc++
+
+	c.bus.ReadData(stackBase | uint16(c.sp))
+
+	// The pushed return address is the address of the last byte of the JSR,
+	// which is incremented by RTS.
 	c.bus.WriteData(stackBase|uint16(c.sp), uint8(c.pc>>8))
 	c.sp--
 	c.bus.WriteData(stackBase|uint16(c.sp), uint8(c.pc))
 	c.sp--
 
+	hi := uint16(c.bus.ReadData(c.pc)) << 8
+
+	c.absoluteAddr = lo | hi
 	c.pc = c.absoluteAddr
 
 	return 0
@@ -263,22 +244,25 @@ func (c *Cpu) jsr() uint8 {
 func (c *Cpu) lda() uint8 {
 	c.fetchData()
 	c.aReg = c.fetchedData
+	c.setZeroAndNegative(c.aReg)
 
-	return 0
+	return 1
 }
 
 func (c *Cpu) ldx() uint8 {
 	c.fetchData()
 	c.xReg = c.fetchedData
+	c.setZeroAndNegative(c.xReg)
 
-	return 0
+	return 1
 }
 
 func (c *Cpu) ldy() uint8 {
 	c.fetchData()
 	c.yReg = c.fetchedData
+	c.setZeroAndNegative(c.yReg)
 
-	return 0
+	return 1
 }
 
 func (c *Cpu) lsr() uint8 {
@@ -290,7 +274,7 @@ func (c *Cpu) lsr() uint8 {
 	c.setFlag(zeroFlag, data == 0)
 	c.setFlag(negativeFlag, false)
 
-	c.writeToMem(data)
+	c.modifyMem(data)
 
 	return 0
 }
@@ -304,8 +288,9 @@ func (c *Cpu) ora() uint8 {
 	data := c.fetchedData
 
 	c.aReg = c.aReg | data
+	c.setZeroAndNegative(c.aReg)
 
-	return 0
+	return 1
 }
 
 func (c *Cpu) pha() uint8 {
@@ -315,12 +300,13 @@ func (c *Cpu) pha() uint8 {
 }
 
 func (c *Cpu) php() uint8 {
-	c.bus.WriteData(stackBase+uint16(c.sp), c.status)
+	c.bus.WriteData(stackBase+uint16(c.sp), c.status|uint8(breakFlag|unusedFlag))
 	c.sp--
 	return 0
 }
 
 func (c *Cpu) pla() uint8 {
+	c.bus.ReadData(stackBase + uint16(c.sp))
 	c.sp++
 	c.aReg = c.bus.ReadData(stackBase + uint16(c.sp))
 
@@ -331,8 +317,10 @@ func (c *Cpu) pla() uint8 {
 }
 
 func (c *Cpu) plp() uint8 {
+	c.latchIFlag()
+	c.bus.ReadData(stackBase + uint16(c.sp))
 	c.sp++
-	c.status = c.bus.ReadData(stackBase + uint16(c.sp))
+	c.status = c.pulledStatus(c.bus.ReadData(stackBase + uint16(c.sp)))
 
 	return 0
 }
@@ -355,7 +343,7 @@ func (c *Cpu) rol() uint8 {
 	c.setFlag(zeroFlag, data == 0)
 	c.setFlag(negativeFlag, data&signMask != 0)
 
-	c.writeToMem(data)
+	c.modifyMem(data)
 
 	return 0
 }
@@ -378,20 +366,19 @@ func (c *Cpu) ror() uint8 {
 	c.setFlag(zeroFlag, data == 0)
 	c.setFlag(negativeFlag, data&signMask != 0)
 
-	c.writeToMem(data)
+	c.modifyMem(data)
 
 	return 0
 }
 
 func (c *Cpu) rti() uint8 {
+	c.bus.ReadData(stackBase | uint16(c.sp))
 	c.sp++
-	status := c.bus.ReadData(stackBase | uint16(c.sp))
-	status &= ^uint8(breakFlag)
-	status &= ^uint8(unusedFlag)
+	status := c.pulledStatus(c.bus.ReadData(stackBase | uint16(c.sp)))
 	c.sp++
-	addrHi := uint16(c.bus.ReadData(stackBase | uint16(c.sp)))
+	addrLo := uint16(c.bus.ReadData(stackBase | uint16(c.sp)))
 	c.sp++
-	addrLo := uint16(c.bus.ReadData(stackBase|uint16(c.sp))) << 8
+	addrHi := uint16(c.bus.ReadData(stackBase|uint16(c.sp))) << 8
 
 	addr := addrHi | addrLo
 
@@ -402,13 +389,15 @@ func (c *Cpu) rti() uint8 {
 }
 
 func (c *Cpu) rts() uint8 {
+	c.bus.ReadData(stackBase | uint16(c.sp))
 	c.sp++
-	addrHi := uint16(c.bus.ReadData(stackBase | uint16(c.sp)))
+	addrLo := uint16(c.bus.ReadData(stackBase | uint16(c.sp)))
 	c.sp++
-	addrLo := uint16(c.bus.ReadData(stackBase|uint16(c.sp))) << 8
+	addrHi := uint16(c.bus.ReadData(stackBase|uint16(c.sp))) << 8
 
 	addr := addrHi | addrLo
 
+	c.bus.ReadData(addr)
 	c.pc = addr + 1
 
 	return 0
@@ -416,31 +405,9 @@ func (c *Cpu) rts() uint8 {
 
 func (c *Cpu) sbc() uint8 {
 	// The substraction for unsigned numbers can be achieved with the following formula:
-	// accum + ~memory + (1 - carry)
+	// accum + ~memory + carry
 	c.fetchData()
-	m := ^uint16(c.fetchedData)
-
-	carry := uint16(1)
-	if c.getFlag(carryFlag) {
-		// When substracting, if the carry flag has been set, it means that a borrow has occured.
-		carry = 0
-	}
-
-	result := uint16(c.aReg) + m + carry
-
-	// Set status flags
-	c.setFlag(carryFlag, result > 0xff)                      // if the result didn't fit in one byte, set the carry flag
-	c.setFlag(zeroFlag, result&0x00ff == 0)                  // if the result is zero, set the zero flag
-	c.setFlag(negativeFlag, result&uint16(signMask) != 0x00) // if the leftmost bit in the result is set, set the negative flag
-	// if the accumulator and operand are negative and the result is positive,
-	// or if the accumulator and operand are positive and the result is negative, set the overflow flag
-	c.setFlag(
-		overflowFlag,
-		(c.aReg&signMask != 0 && m&uint16(signMask) != 0 && result&uint16(signMask) == 0) ||
-			(c.aReg&signMask == 0 && m&uint16(signMask) == 0 && result&uint16(signMask) != 0),
-	)
-
-	c.aReg = uint8(result & 0x00ff)
+	c.addWithCarry(^c.fetchedData)
 
 	return 1
 }
@@ -456,6 +423,7 @@ func (c *Cpu) sed() uint8 {
 }
 
 func (c *Cpu) sei() uint8 {
+	c.latchIFlag()
 	c.setFlag(disableInterruptsFlag, true)
 	return 0
 }
@@ -477,6 +445,8 @@ func (c *Cpu) sty() uint8 {
 
 func (c *Cpu) tsx() uint8 {
 	c.xReg = c.sp
+	c.setZeroAndNegative(c.xReg)
+
 	return 0
 }
 
@@ -521,21 +491,23 @@ func (c *Cpu) tya() uint8 {
 	return 0
 }
 
-func (c *Cpu) illegal() uint8 {
-	return 0
-}
-
 func (c *Cpu) branchOn(cond bool) uint8 {
 	if !cond {
 		return 0
 	}
 
 	c.nCycles++
+	c.bus.ReadData(c.pc)
 
 	c.absoluteAddr = c.pc + c.relativeAddr
 
 	if c.absoluteAddr&0xff00 != c.pc&0xff00 {
 		c.nCycles++
+		c.bus.ReadData(c.pc&0xff00 | c.absoluteAddr&0x00ff)
+	} else {
+		// A taken branch that doesn't cross a page doesn't poll for
+		// interrupts on its last cycle.
+		c.pollCycle = 2
 	}
 
 	c.pc = c.absoluteAddr
@@ -543,9 +515,66 @@ func (c *Cpu) branchOn(cond bool) uint8 {
 	return 0
 }
 
+func (c *Cpu) addWithCarry(data uint8) {
+	carry := uint16(0)
+	if c.getFlag(carryFlag) {
+		carry = 1
+	}
+
+	result := uint16(c.aReg) + uint16(data) + carry
+
+	// Set status flags
+	c.setFlag(carryFlag, result > 0xff)                      // if the result didn't fit in one byte, set the carry flag
+	c.setFlag(zeroFlag, result&0x00ff == 0)                  // if the result is zero, set the zero flag
+	c.setFlag(negativeFlag, result&uint16(signMask) != 0x00) // if the leftmost bit in the result is set, set the negative flag
+	// if the accumulator and operand are negative and the result is positive,
+	// or if the accumulator and operand are positive and the result is negative, set the overflow flag
+	c.setFlag(
+		overflowFlag,
+		(c.aReg&signMask != 0 && data&signMask != 0 && result&uint16(signMask) == 0) ||
+			(c.aReg&signMask == 0 && data&signMask == 0 && result&uint16(signMask) != 0),
+	)
+
+	c.aReg = uint8(result & 0x00ff)
+}
+
+func (c *Cpu) compare(reg, data uint8) {
+	c.setFlag(carryFlag, reg >= data)
+	c.setFlag(zeroFlag, reg == data)
+	c.setFlag(negativeFlag, (reg-data)&signMask != 0)
+}
+
+func (c *Cpu) setZeroAndNegative(val uint8) {
+	c.setFlag(zeroFlag, val == 0)
+	c.setFlag(negativeFlag, val&signMask != 0)
+}
+
+// latchIFlag stores the current value of the interrupt disable flag for the
+// interrupt polling of an instruction that changes the flag on its last cycle.
+func (c *Cpu) latchIFlag() {
+	c.iFlagLatched = true
+	c.iFlagAtPoll = c.getFlag(disableInterruptsFlag)
+}
+
+// pulledStatus returns the status register value pulled from the stack. The
+// break and the unused flags don't exist in the register itself.
+func (c *Cpu) pulledStatus(data uint8) uint8 {
+	return data&^uint8(breakFlag) | uint8(unusedFlag)
+}
+
+// modifyMem writes the result of a read-modify-write instruction. The
+// unmodified value is written back first, as the hardware does.
+func (c *Cpu) modifyMem(val uint8) {
+	if c.mode != Accumulator {
+		c.bus.WriteData(c.absoluteAddr, c.fetchedData)
+	}
+
+	c.writeToMem(val)
+}
+
 func (c *Cpu) writeToMem(val uint8) {
-	switch reflect.ValueOf(c.opCodeLookup[c.opCode].addr).Pointer() {
-	case reflect.ValueOf(c.accumulator).Pointer():
+	switch c.mode {
+	case Accumulator:
 		c.aReg = val
 	default:
 		c.bus.WriteData(c.absoluteAddr, val)
@@ -0,0 +1,208 @@
+package cpu
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The single step tests are the per-opcode JSON test vectors of the
+// ProcessorTests project (https://github.com/SingleStepTests/65x02, the
+// nes6502 set). They are not part of the repository; run them with
+//
+//	go test ./emulator/cpu -run ProcessorTests -processortests /path/to/nes6502/v1
+var processorTestsDir = flag.String("processortests", "", "directory of the ProcessorTests JSON files, e.g. a9.json")
+
+// maxReportedFailures is the number of failing tests reported per opcode.
+const maxReportedFailures = 5
+
+type processorTestState struct {
+	PC  uint16      `json:"pc"`
+	S   uint8       `json:"s"`
+	A   uint8       `json:"a"`
+	X   uint8       `json:"x"`
+	Y   uint8       `json:"y"`
+	P   uint8       `json:"p"`
+	RAM [][2]uint16 `json:"ram"`
+}
+
+type processorTest struct {
+	Name    string               `json:"name"`
+	Initial processorTestState   `json:"initial"`
+	Final   processorTestState   `json:"final"`
+	Cycles  [][3]json.RawMessage `json:"cycles"`
+}
+
+type busAccess struct {
+	addr  uint16
+	data  uint8
+	write bool
+}
+
+func (a busAccess) String() string {
+	kind := "read"
+	if a.write {
+		kind = "write"
+	}
+
+	return fmt.Sprintf("%04X %02X %s", a.addr, a.data, kind)
+}
+
+// recordingBus is a flat 64 KiB address space that records every access.
+type recordingBus struct {
+	mem      [0x10000]uint8
+	accesses []busAccess
+}
+
+func (b *recordingBus) ReadData(addr uint16) uint8 {
+	data := b.mem[addr]
+	b.accesses = append(b.accesses, busAccess{addr: addr, data: data})
+
+	return data
+}
+
+func (b *recordingBus) WriteData(addr uint16, data uint8) {
+	b.mem[addr] = data
+	b.accesses = append(b.accesses, busAccess{addr: addr, data: data, write: true})
+}
+
+func TestProcessorTests(t *testing.T) {
+	if *processorTestsDir == "" {
+		t.Skip("no -processortests directory given")
+	}
+
+	for opCode := 0; opCode < 256; opCode++ {
+		opCode := opCode
+		name := fmt.Sprintf("%02x", opCode)
+
+		t.Run(name, func(t *testing.T) {
+			if opCodeLookup[opCode].name == "JAM" {
+				t.Skip("JAM halts the CPU")
+			}
+
+			path := filepath.Join(*processorTestsDir, name+".json")
+
+			tests, err := loadProcessorTests(path)
+			if os.IsNotExist(err) {
+				t.Skip("no test file")
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failures := 0
+
+			for _, test := range tests {
+				mismatches := runProcessorTest(t, path, test)
+				if len(mismatches) == 0 {
+					continue
+				}
+
+				failures++
+				if failures <= maxReportedFailures {
+					t.Errorf("%s:\n\t%s", test.Name, strings.Join(mismatches, "\n\t"))
+				}
+			}
+
+			if failures > maxReportedFailures {
+				t.Errorf("%d of %d tests failed", failures, len(tests))
+			}
+		})
+	}
+}
+
+func loadProcessorTests(path string) ([]processorTest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tests []processorTest
+
+	if err := json.Unmarshal(data, &tests); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return tests, nil
+}
+
+// runProcessorTest runs a single instruction from the initial state and
+// returns the differences to the final state and the bus cycles. A
+// malformed cycle in the test file of path fails t.
+func runProcessorTest(t *testing.T, path string, test processorTest) []string {
+	t.Helper()
+
+	b := &recordingBus{}
+
+	for _, cell := range test.Initial.RAM {
+		b.mem[cell[0]] = uint8(cell[1])
+	}
+
+	c := NewCpu(b)
+	c.pc = test.Initial.PC
+	c.sp = test.Initial.S
+	c.aReg = test.Initial.A
+	c.xReg = test.Initial.X
+	c.yReg = test.Initial.Y
+	c.status = test.Initial.P
+
+	c.Tick()
+	for c.nCycles != 0 {
+		c.Tick()
+	}
+
+	var mismatches []string
+
+	compare := func(reg string, actual, expected uint16) {
+		if actual != expected {
+			mismatches = append(mismatches, fmt.Sprintf("%s = %02X, want %02X", reg, actual, expected))
+		}
+	}
+
+	compare("PC", c.pc, test.Final.PC)
+	compare("S", uint16(c.sp), uint16(test.Final.S))
+	compare("A", uint16(c.aReg), uint16(test.Final.A))
+	compare("X", uint16(c.xReg), uint16(test.Final.X))
+	compare("Y", uint16(c.yReg), uint16(test.Final.Y))
+	compare("P", uint16(c.status), uint16(test.Final.P))
+
+	for _, cell := range test.Final.RAM {
+		compare(fmt.Sprintf("[%04X]", cell[0]), uint16(b.mem[cell[0]]), cell[1])
+	}
+
+	expected := make([]busAccess, len(test.Cycles))
+
+	for i, cycle := range test.Cycles {
+		var kind string
+
+		for j, v := range []interface{}{&expected[i].addr, &expected[i].data, &kind} {
+			if err := json.Unmarshal(cycle[j], v); err != nil {
+				t.Fatalf("%s: %s: cycle %d: %v", path, test.Name, i, err)
+			}
+		}
+
+		expected[i].write = kind == "write"
+	}
+
+	for i := 0; i < len(expected) || i < len(b.accesses); i++ {
+		switch {
+		case i >= len(b.accesses):
+			mismatches = append(mismatches, fmt.Sprintf("cycle %d: missing %s", i, expected[i]))
+		case i >= len(expected):
+			mismatches = append(mismatches, fmt.Sprintf("cycle %d: extra %s", i, b.accesses[i]))
+		case b.accesses[i] != expected[i]:
+			mismatches = append(mismatches, fmt.Sprintf("cycle %d: %s, want %s", i, b.accesses[i], expected[i]))
+		}
+	}
+
+	if ticks := int(c.cycles); ticks != len(expected) {
+		mismatches = append(mismatches, fmt.Sprintf("took %d cycles, want %d", ticks, len(expected)))
+	}
+
+	return mismatches
+}
@@ -0,0 +1,107 @@
+package cpu
+
+// Registers is the state of the CPU registers.
+type Registers struct {
+	A  uint8
+	X  uint8
+	Y  uint8
+	SP uint8
+	PC uint16
+	// P is the status register.
+	P uint8
+}
+
+// Observer is notified before every instruction the CPU executes, e.g. by
+// loggers and profilers. The CPU is in the state the instruction starts
+// from.
+type Observer interface {
+	BeforeInstruction(c *Cpu)
+}
+
+// InterruptObserver is an Observer that is also notified when the CPU loads
+// the program counter from an interrupt vector, including for BRK.
+type InterruptObserver interface {
+	Observer
+	AfterInterrupt(c *Cpu, i Interrupt)
+}
+
+// Interrupt identifies an interrupt sequence.
+type Interrupt uint8
+
+const (
+	NoInterrupt Interrupt = iota
+	NmiInterrupt
+	IrqInterrupt
+	BrkInterrupt
+)
+
+func (i Interrupt) String() string {
+	switch i {
+	case NmiInterrupt:
+		return "NMI"
+	case IrqInterrupt:
+		return "IRQ"
+	case BrkInterrupt:
+		return "BRK"
+	default:
+		return "none"
+	}
+}
+
+// Registers returns the state of the registers.
+func (c *Cpu) Registers() Registers {
+	return Registers{
+		A:  c.aReg,
+		X:  c.xReg,
+		Y:  c.yReg,
+		SP: c.sp,
+		PC: c.pc,
+		P:  c.status,
+	}
+}
+
+// SetRegisters sets the registers. It should only be called between
+// instructions, see InstructionBoundary.
+func (c *Cpu) SetRegisters(r Registers) {
+	c.aReg = r.A
+	c.xReg = r.X
+	c.yReg = r.Y
+	c.sp = r.SP
+	c.pc = r.PC
+	c.status = r.P
+}
+
+// InstructionBoundary tells whether the CPU has finished the current
+// instruction or interrupt sequence and isn't halted, so the next Tick starts
+// a new one.
+func (c *Cpu) InstructionBoundary() bool {
+	return c.nCycles == 0 && c.stallCycles == 0
+}
+
+// InterruptPending tells whether the next instruction boundary starts an
+// interrupt sequence instead of the instruction at the program counter.
+func (c *Cpu) InterruptPending() bool {
+	return c.interruptPending
+}
+
+// Interrupted returns the interrupt whose vector was fetched on the last
+// Tick, or NoInterrupt. The handler is run from the next instruction
+// boundary on.
+func (c *Cpu) Interrupted() Interrupt {
+	return c.interrupted
+}
+
+// AddObserver adds an observer of the instructions.
+func (c *Cpu) AddObserver(o Observer) {
+	c.observers = append(c.observers, o)
+}
+
+// RemoveObserver removes an observer added with AddObserver.
+func (c *Cpu) RemoveObserver(o Observer) {
+	for i := range c.observers {
+		if c.observers[i] == o {
+			c.observers = append(c.observers[:i], c.observers[i+1:]...)
+			return
+		}
+	}
+}
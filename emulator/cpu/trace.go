@@ -0,0 +1,282 @@
+package cpu
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PpuPosition is implemented by the PPU to report the dot and the scanline
+// it is on, for the trace log.
+type PpuPosition interface {
+	Dot() int
+	Scanline() int
+}
+
+// Labels gives the labels of the addresses, e.g. from the debug symbols of
+// the program.
+type Labels interface {
+	Label(addr uint16) (string, bool)
+}
+
+// Tracer writes a line in the nestest.log format for every instruction the
+// CPU executes, e.g.
+//
+//	C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7
+//
+// The state on the line is the state before the instruction is executed.
+type Tracer struct {
+	w      io.Writer
+	ppu    PpuPosition
+	labels Labels
+	err    error
+}
+
+// NewTracer returns a tracer that writes to w. The PPU position is reported
+// as 0,0 if ppu is nil.
+func NewTracer(w io.Writer, ppu PpuPosition) *Tracer {
+	return &Tracer{w: w, ppu: ppu}
+}
+
+// SetLabels makes the tracer print the labels of the operand addresses
+// instead of the addresses. A nil Labels turns the labels off.
+func (t *Tracer) SetLabels(labels Labels) {
+	t.labels = labels
+}
+
+// Err returns the first error returned by the underlying writer. No more
+// lines are written after an error.
+func (t *Tracer) Err() error {
+	return t.err
+}
+
+func (t *Tracer) trace(c *Cpu) {
+	if t.err != nil {
+		return
+	}
+
+	dot, scanline := 0, 0
+	if t.ppu != nil {
+		dot, scanline = t.ppu.Dot(), t.ppu.Scanline()
+	}
+
+	_, t.err = fmt.Fprintf(
+		t.w,
+		"%04X  %-8s %-32s A:%02X X:%02X Y:%02X P:%02X SP:%02X PPU:%3d,%3d CYC:%d\n",
+		c.pc, traceBytes(c), traceDisassembly(c, t.labels),
+		c.aReg, c.xReg, c.yReg, c.status, c.sp,
+		scanline, dot, c.cycles,
+	)
+}
+
+// SetTracer sets the tracer called before every instruction. A nil tracer
+// disables tracing.
+func (c *Cpu) SetTracer(t *Tracer) {
+	c.tracer = t
+}
+
+// peek reads the address without side effects, if the bus can.
+func (c *Cpu) peek(addr uint16) uint8 {
+	if c.peeker != nil {
+		return c.peeker.Peek(addr)
+	}
+
+	return c.bus.ReadData(addr)
+}
+
+func traceBytes(c *Cpu) string {
+	instruction := &opCodeLookup[c.peek(c.pc)]
+
+	var sb strings.Builder
+
+	for i := uint16(0); i < instruction.mode.Length(); i++ {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+
+		fmt.Fprintf(&sb, "%02X", c.peek(c.pc+i))
+	}
+
+	return sb.String()
+}
+
+// traceDisassembly disassembles the instruction at the program counter with
+// the operands resolved against the current state of the CPU. The addresses
+// of the operands are replaced with their labels, if labels are given.
+func traceDisassembly(c *Cpu, labels Labels) string {
+	instruction := &opCodeLookup[c.peek(c.pc)]
+
+	lo := c.peek(c.pc + 1)
+	hi := c.peek(c.pc + 2)
+	word := uint16(lo) | uint16(hi)<<8
+
+	read := c.peek
+	readZeroPageWord := func(ptr uint8) uint16 {
+		return uint16(read(uint16(ptr))) | uint16(read(uint16(ptr+1)))<<8
+	}
+
+	// name returns the label of the operand address, or the address in the
+	// given format.
+	name := func(addr uint16, format string) string {
+		if labels != nil {
+			if label, ok := labels.Label(addr); ok {
+				return label
+			}
+		}
+
+		return fmt.Sprintf(format, addr)
+	}
+
+	var operand string
+
+	switch instruction.mode {
+	case Accumulator:
+		operand = "A"
+	case Immediate:
+		operand = fmt.Sprintf("#$%02X", lo)
+	case ZeroPage:
+		operand = fmt.Sprintf("%s = %02X", name(uint16(lo), "$%02X"), read(uint16(lo)))
+	case XIndexedZeroPage:
+		addr := lo + c.xReg
+		operand = fmt.Sprintf("%s,X @ %02X = %02X", name(uint16(lo), "$%02X"), addr, read(uint16(addr)))
+	case YIndexedZeroPage:
+		addr := lo + c.yReg
+		operand = fmt.Sprintf("%s,Y @ %02X = %02X", name(uint16(lo), "$%02X"), addr, read(uint16(addr)))
+	case Absolute:
+		if instruction.name == "JMP" || instruction.name == "JSR" {
+			operand = name(word, "$%04X")
+		} else {
+			operand = fmt.Sprintf("%s = %02X", name(word, "$%04X"), read(word))
+		}
+	case XIndexedAbsolute:
+		addr := word + uint16(c.xReg)
+		operand = fmt.Sprintf("%s,X @ %04X = %02X", name(word, "$%04X"), addr, read(addr))
+	case YIndexedAbsolute:
+		addr := word + uint16(c.yReg)
+		operand = fmt.Sprintf("%s,Y @ %04X = %02X", name(word, "$%04X"), addr, read(addr))
+	case AbsoluteIndirect:
+		// The high byte of the target is fetched without carrying into the
+		// high byte of the pointer.
+		target := uint16(read(word)) | uint16(read(word&0xff00|uint16(lo+1)))<<8
+		operand = fmt.Sprintf("(%s) = %04X", name(word, "$%04X"), target)
+	case IndexedIndirect:
+		ptr := lo + c.xReg
+		addr := readZeroPageWord(ptr)
+		operand = fmt.Sprintf("(%s,X) @ %02X = %04X = %02X", name(uint16(lo), "$%02X"), ptr, addr, read(addr))
+	case IndirectIndexed:
+		base := readZeroPageWord(lo)
+		addr := base + uint16(c.yReg)
+		operand = fmt.Sprintf("(%s),Y = %04X @ %04X = %02X", name(uint16(lo), "$%02X"), base, addr, read(addr))
+	case Relative:
+		operand = name(c.pc+2+uint16(int8(lo)), "$%04X")
+	}
+
+	// Unofficial opcodes are marked with an asterisk.
+	prefix := " "
+	if instruction.unofficial {
+		prefix = "*"
+	}
+
+	if operand == "" {
+		return prefix + instruction.name
+	}
+
+	return prefix + instruction.name + " " + operand
+}
+
+// MismatchError is returned by a LogComparer when a traced line differs
+// from the reference log.
+type MismatchError struct {
+	Line     int
+	Expected string
+	Actual   string
+	Context  []string
+}
+
+func (e *MismatchError) Error() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "trace mismatch on line %d\n", e.Line)
+
+	for _, line := range e.Context {
+		fmt.Fprintf(&sb, "           %s\n", line)
+	}
+
+	fmt.Fprintf(&sb, "expected:  %s\n", e.Expected)
+	fmt.Fprintf(&sb, "actual:    %s", e.Actual)
+
+	return sb.String()
+}
+
+// LogComparer is an io.Writer that compares the trace written to it line by
+// line against a reference log. The first write that contains a differing
+// line fails with a *MismatchError, which stops the Tracer writing to it.
+type LogComparer struct {
+	reference   *bufio.Scanner
+	contextSize int
+	context     []string
+	line        int
+	partial     []byte
+}
+
+// NewLogComparer returns a comparer that reads the reference log from r and
+// reports up to contextSize matching lines preceding a mismatch.
+func NewLogComparer(r io.Reader, contextSize int) *LogComparer {
+	return &LogComparer{reference: bufio.NewScanner(r), contextSize: contextSize}
+}
+
+// Lines returns the number of lines that have matched the reference so far.
+func (l *LogComparer) Lines() int {
+	return l.line
+}
+
+func (l *LogComparer) Write(p []byte) (int, error) {
+	l.partial = append(l.partial, p...)
+
+	for {
+		idx := bytes.IndexByte(l.partial, '\n')
+		if idx < 0 {
+			return len(p), nil
+		}
+
+		actual := strings.TrimRight(string(l.partial[:idx]), "\r")
+		l.partial = l.partial[idx+1:]
+
+		if err := l.compare(actual); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (l *LogComparer) compare(actual string) error {
+	expected := ""
+
+	if l.reference.Scan() {
+		expected = strings.TrimRight(l.reference.Text(), "\r")
+	} else if err := l.reference.Err(); err != nil {
+		return err
+	}
+
+	if expected != actual {
+		return &MismatchError{
+			Line:     l.line + 1,
+			Expected: expected,
+			Actual:   actual,
+			Context:  append([]string(nil), l.context...),
+		}
+	}
+
+	l.line++
+
+	if l.contextSize > 0 {
+		if len(l.context) == l.contextSize {
+			l.context = l.context[1:]
+		}
+
+		l.context = append(l.context, actual)
+	}
+
+	return nil
+}
@@ -0,0 +1,295 @@
+package cpu
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// ppuStatusAddr is a register of peekBus that has a read side effect like
+// the PPU status register: the read clears bit 7.
+const ppuStatusAddr = 0x2002
+
+// peekBus is a flat 64 KiB address space with a register whose reads have
+// side effects, which Peek doesn't have.
+type peekBus struct {
+	mem         [0x10000]uint8
+	statusReads int
+}
+
+func (b *peekBus) ReadData(addr uint16) uint8 {
+	data := b.mem[addr]
+
+	if addr == ppuStatusAddr {
+		b.statusReads++
+		b.mem[addr] &^= 0x80
+	}
+
+	return data
+}
+
+func (b *peekBus) WriteData(addr uint16, data uint8) {
+	b.mem[addr] = data
+}
+
+func (b *peekBus) Peek(addr uint16) uint8 {
+	return b.mem[addr]
+}
+
+type testPpuPosition struct {
+	dot, scanline int
+}
+
+func (p testPpuPosition) Dot() int {
+	return p.dot
+}
+
+func (p testPpuPosition) Scanline() int {
+	return p.scanline
+}
+
+type testLabels map[uint16]string
+
+func (l testLabels) Label(addr uint16) (string, bool) {
+	label, ok := l[addr]
+	return label, ok
+}
+
+// traceProgram is
+//
+//	$C000  LDA #$05
+//	$C002  STA $0200
+//	$C005  LDX $10
+//	$C007  LDA ($20),Y
+//	$C009  LDA $2002
+//	$C00C  BNE $C000
+//	$C00E  ASL A
+//	$C00F  JMP $C000
+var traceProgram = []uint8{
+	0xa9, 0x05,
+	0x8d, 0x00, 0x02,
+	0xa6, 0x10,
+	0xb1, 0x20,
+	0xad, 0x02, 0x20,
+	0xd0, 0xf2,
+	0x0a,
+	0x4c, 0x00, 0xc0,
+}
+
+func newTraceCpu(labels Labels) (*Cpu, *peekBus, *strings.Builder) {
+	b := &peekBus{}
+	copy(b.mem[0xc000:], traceProgram)
+
+	b.mem[0x0010] = 0x03
+	b.mem[0x0020] = 0x00
+	b.mem[0x0021] = 0x03
+	b.mem[0x0300] = 0x42
+	b.mem[ppuStatusAddr] = 0x80
+	b.mem[0xfffc] = 0x00
+	b.mem[0xfffd] = 0xc0
+
+	var sb strings.Builder
+
+	t := NewTracer(&sb, testPpuPosition{dot: 21, scanline: 0})
+	t.SetLabels(labels)
+
+	c := NewCpu(b)
+	resetCpu(c)
+	c.SetTracer(t)
+
+	return c, b, &sb
+}
+
+// resetCpu resets the CPU and runs the reset sequence.
+func resetCpu(c *Cpu) {
+	c.Reset()
+
+	for c.nCycles != 0 {
+		c.Tick()
+	}
+}
+
+// runInstructions runs the CPU for n instructions.
+func runInstructions(c *Cpu, n int) {
+	for i := 0; i < n; i++ {
+		c.Tick()
+		for c.nCycles != 0 {
+			c.Tick()
+		}
+	}
+}
+
+func TestTracerWritesNestestLines(t *testing.T) {
+	c, _, sb := newTraceCpu(nil)
+
+	runInstructions(c, 7)
+
+	want := []string{
+		"C000  A9 05     LDA #$05                        A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7",
+		"C002  8D 00 02  STA $0200 = 00                  A:05 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:9",
+		"C005  A6 10     LDX $10 = 03                    A:05 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:13",
+		"C007  B1 20     LDA ($20),Y = 0300 @ 0300 = 42  A:05 X:03 Y:00 P:24 SP:FD PPU:  0, 21 CYC:16",
+		"C009  AD 02 20  LDA $2002 = 80                  A:42 X:03 Y:00 P:24 SP:FD PPU:  0, 21 CYC:21",
+		"C00C  D0 F2     BNE $C000                       A:80 X:03 Y:00 P:A4 SP:FD PPU:  0, 21 CYC:25",
+		"C000  A9 05     LDA #$05                        A:80 X:03 Y:00 P:A4 SP:FD PPU:  0, 21 CYC:28",
+	}
+
+	got := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(got), len(want), sb.String())
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d:\ngot  %q\nwant %q", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestTracerHasNoSideEffects(t *testing.T) {
+	c, b, sb := newTraceCpu(nil)
+
+	// Up to the LDA $2002.
+	runInstructions(c, 4)
+
+	if b.statusReads != 0 {
+		t.Fatalf("the status register was read %d times before the LDA", b.statusReads)
+	}
+
+	runInstructions(c, 1)
+
+	if b.statusReads != 1 {
+		t.Errorf("the status register was read %d times, want once by the LDA", b.statusReads)
+	}
+
+	if c.aReg != 0x80 {
+		t.Errorf("the LDA read %02X, want 80", c.aReg)
+	}
+
+	if !strings.Contains(sb.String(), "LDA $2002 = 80") {
+		t.Errorf("the trace doesn't show the status before the read:\n%s", sb.String())
+	}
+}
+
+func TestTracerPrintsLabels(t *testing.T) {
+	c, _, sb := newTraceCpu(testLabels{0x0200: "buffer", 0xc000: "start"})
+
+	runInstructions(c, 6)
+
+	for _, want := range []string{"STA buffer = 00", "BNE start"} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("the trace doesn't contain %q:\n%s", want, sb.String())
+		}
+	}
+}
+
+func TestTracerMarksUnofficialOpCodes(t *testing.T) {
+	b := &peekBus{}
+	// $C000  NOP $10 (unofficial)
+	copy(b.mem[0xc000:], []uint8{0x04, 0x10})
+	b.mem[0xfffd] = 0xc0
+
+	var sb strings.Builder
+
+	c := NewCpu(b)
+	resetCpu(c)
+	c.SetTracer(NewTracer(&sb, nil))
+
+	runInstructions(c, 1)
+
+	want := "C000  04 10    *NOP $10 = 00                    A:00 X:00 Y:00 P:24 SP:FD PPU:  0,  0 CYC:7\n"
+	if sb.String() != want {
+		t.Errorf("got  %q\nwant %q", sb.String(), want)
+	}
+}
+
+func TestLogComparerMatchesInPieces(t *testing.T) {
+	l := NewLogComparer(strings.NewReader("first line\r\nsecond line\r\n"), 2)
+
+	for _, piece := range []string{"first", " line\nsec", "ond line", "\n"} {
+		if n, err := l.Write([]byte(piece)); err != nil || n != len(piece) {
+			t.Fatalf("Write(%q) = %d, %v", piece, n, err)
+		}
+	}
+
+	if l.Lines() != 2 {
+		t.Errorf("got %d lines matched, want 2", l.Lines())
+	}
+}
+
+func TestLogComparerReportsFirstMismatch(t *testing.T) {
+	reference := "line 1\nline 2\nline 3\nline 4\n"
+	l := NewLogComparer(strings.NewReader(reference), 2)
+
+	if _, err := l.Write([]byte("line 1\nline 2\nline 3\nline X\nline 5\n")); err == nil {
+		t.Fatal("no mismatch reported")
+	} else {
+		var mismatch *MismatchError
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("got %T %v, want a *MismatchError", err, err)
+		}
+
+		if mismatch.Line != 4 || mismatch.Expected != "line 4" || mismatch.Actual != "line X" {
+			t.Errorf("got line %d, expected %q, actual %q", mismatch.Line, mismatch.Expected, mismatch.Actual)
+		}
+
+		if got := strings.Join(mismatch.Context, ","); got != "line 2,line 3" {
+			t.Errorf("got context %q, want the two lines before", got)
+		}
+
+		want := "trace mismatch on line 4\n" +
+			"           line 2\n" +
+			"           line 3\n" +
+			"expected:  line 4\n" +
+			"actual:    line X"
+		if mismatch.Error() != want {
+			t.Errorf("got error\n%s\nwant\n%s", mismatch.Error(), want)
+		}
+	}
+
+	if l.Lines() != 3 {
+		t.Errorf("got %d lines matched, want 3", l.Lines())
+	}
+}
+
+func TestLogComparerReportsEndOfReference(t *testing.T) {
+	l := NewLogComparer(strings.NewReader("line 1\n"), 0)
+
+	_, err := l.Write([]byte("line 1\nline 2\n"))
+
+	var mismatch *MismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("got %v, want a *MismatchError", err)
+	}
+
+	if mismatch.Line != 2 || mismatch.Expected != "" || len(mismatch.Context) != 0 {
+		t.Errorf("got %+v", mismatch)
+	}
+}
+
+func TestTracerStopsAtMismatch(t *testing.T) {
+	c, _, _ := newTraceCpu(nil)
+
+	reference := "C000  A9 05     LDA #$05                        A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7\n" +
+		"C002  8D 00 02  STA $0200 = 00                  A:FF X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:9\n"
+	l := NewLogComparer(strings.NewReader(reference), 1)
+
+	tracer := NewTracer(l, testPpuPosition{dot: 21})
+	c.SetTracer(tracer)
+
+	runInstructions(c, 4)
+
+	var mismatch *MismatchError
+	if !errors.As(tracer.Err(), &mismatch) {
+		t.Fatalf("got %v, want a *MismatchError", tracer.Err())
+	}
+
+	if mismatch.Line != 2 {
+		t.Errorf("got the mismatch on line %d, want 2", mismatch.Line)
+	}
+
+	if l.Lines() != 1 {
+		t.Errorf("got %d lines compared after the mismatch, want 1", l.Lines())
+	}
+}
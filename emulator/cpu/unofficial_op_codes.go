@@ -0,0 +1,247 @@
+package cpu
+
+// The unofficial opcodes are side effects of the way the instruction decoder
+// of the 6502 works: most of them run two official operations at once.
+
+// magicConstant is the value the unstable XAA and LAX #imm instructions OR the
+// accumulator with. It varies between chips; this is the most common one.
+const magicConstant uint8 = 0xee
+
+func (c *Cpu) ahx() uint8 {
+	c.storeHighByteAnd(c.aReg & c.xReg)
+	return 0
+}
+
+func (c *Cpu) alr() uint8 {
+	c.fetchData()
+
+	c.aReg &= c.fetchedData
+	c.setFlag(carryFlag, c.aReg&1 != 0)
+	c.aReg >>= 1
+	c.setZeroAndNegative(c.aReg)
+
+	return 0
+}
+
+func (c *Cpu) anc() uint8 {
+	c.fetchData()
+
+	c.aReg &= c.fetchedData
+	c.setZeroAndNegative(c.aReg)
+	c.setFlag(carryFlag, c.aReg&signMask != 0)
+
+	return 0
+}
+
+func (c *Cpu) arr() uint8 {
+	c.fetchData()
+
+	data := c.aReg & c.fetchedData
+	data >>= 1
+	if c.getFlag(carryFlag) {
+		data |= signMask
+	}
+
+	c.aReg = data
+	c.setZeroAndNegative(data)
+	c.setFlag(carryFlag, data&0x40 != 0)
+	c.setFlag(overflowFlag, (data>>6)&1 != (data>>5)&1)
+
+	return 0
+}
+
+func (c *Cpu) axs() uint8 {
+	c.fetchData()
+
+	data := c.aReg & c.xReg
+	c.compare(data, c.fetchedData)
+	c.xReg = data - c.fetchedData
+
+	return 0
+}
+
+func (c *Cpu) dcp() uint8 {
+	c.fetchData()
+
+	data := c.fetchedData - 1
+	c.modifyMem(data)
+	c.compare(c.aReg, data)
+
+	return 0
+}
+
+// ign reads the operand and ignores it.
+func (c *Cpu) ign() uint8 {
+	c.fetchData()
+	return 1
+}
+
+func (c *Cpu) isb() uint8 {
+	c.fetchData()
+
+	data := c.fetchedData + 1
+	c.modifyMem(data)
+	c.addWithCarry(^data)
+
+	return 0
+}
+
+// jam halts the CPU. The opcode is fetched again and again until the CPU is
+// reset.
+func (c *Cpu) jam() uint8 {
+	c.pc--
+	c.pollInterrupts = false
+
+	return 0
+}
+
+func (c *Cpu) las() uint8 {
+	c.fetchData()
+
+	data := c.fetchedData & c.sp
+	c.aReg = data
+	c.xReg = data
+	c.sp = data
+	c.setZeroAndNegative(data)
+
+	return 1
+}
+
+func (c *Cpu) lax() uint8 {
+	c.fetchData()
+
+	c.aReg = c.fetchedData
+	c.xReg = c.fetchedData
+	c.setZeroAndNegative(c.aReg)
+
+	return 1
+}
+
+func (c *Cpu) lxa() uint8 {
+	c.fetchData()
+
+	data := (c.aReg | magicConstant) & c.fetchedData
+	c.aReg = data
+	c.xReg = data
+	c.setZeroAndNegative(data)
+
+	return 0
+}
+
+func (c *Cpu) rla() uint8 {
+	c.fetchData()
+	data := c.fetchedData
+
+	carry := data&signMask != 0
+
+	data <<= 1
+	if c.getFlag(carryFlag) {
+		data |= 1
+	}
+
+	c.setFlag(carryFlag, carry)
+	c.modifyMem(data)
+
+	c.aReg &= data
+	c.setZeroAndNegative(c.aReg)
+
+	return 0
+}
+
+func (c *Cpu) rra() uint8 {
+	c.fetchData()
+	data := c.fetchedData
+
+	carry := data&0x01 != 0
+
+	data >>= 1
+	if c.getFlag(carryFlag) {
+		data |= signMask
+	}
+
+	c.setFlag(carryFlag, carry)
+	c.modifyMem(data)
+
+	c.addWithCarry(data)
+
+	return 0
+}
+
+func (c *Cpu) sax() uint8 {
+	c.writeToMem(c.aReg & c.xReg)
+	return 0
+}
+
+func (c *Cpu) shx() uint8 {
+	c.storeHighByteAnd(c.xReg)
+	return 0
+}
+
+func (c *Cpu) shy() uint8 {
+	c.storeHighByteAnd(c.yReg)
+	return 0
+}
+
+func (c *Cpu) slo() uint8 {
+	c.fetchData()
+	data := c.fetchedData
+
+	c.setFlag(carryFlag, data&signMask != 0)
+	data <<= 1
+	c.modifyMem(data)
+
+	c.aReg |= data
+	c.setZeroAndNegative(c.aReg)
+
+	return 0
+}
+
+func (c *Cpu) sre() uint8 {
+	c.fetchData()
+	data := c.fetchedData
+
+	c.setFlag(carryFlag, data&1 != 0)
+	data >>= 1
+	c.modifyMem(data)
+
+	c.aReg ^= data
+	c.setZeroAndNegative(c.aReg)
+
+	return 0
+}
+
+func (c *Cpu) tas() uint8 {
+	c.sp = c.aReg & c.xReg
+	c.storeHighByteAnd(c.sp)
+
+	return 0
+}
+
+func (c *Cpu) xaa() uint8 {
+	c.fetchData()
+
+	c.aReg = (c.aReg | magicConstant) & c.xReg & c.fetchedData
+	c.setZeroAndNegative(c.aReg)
+
+	return 0
+}
+
+// storeHighByteAnd stores the value ANDed with the high byte of the base
+// address plus one. If the indexing crossed a page, the stored value also
+// replaces the high byte of the effective address.
+func (c *Cpu) storeHighByteAnd(val uint8) {
+	idx := uint16(c.yReg)
+	if c.mode == XIndexedAbsolute {
+		idx = uint16(c.xReg)
+	}
+
+	base := c.absoluteAddr - idx
+	data := val & (uint8(base>>8) + 1)
+
+	addr := c.absoluteAddr
+	if addr&0xff00 != base&0xff00 {
+		addr = uint16(data)<<8 | addr&0x00ff
+	}
+
+	c.bus.WriteData(addr, data)
+}
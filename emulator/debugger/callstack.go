@@ -0,0 +1,202 @@
+package debugger
+
+import (
+	"fmt"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+)
+
+// maxMismatches is the number of the latest mismatched returns kept.
+const maxMismatches = 64
+
+// Frame is a subroutine call or an interrupt on the logical call stack.
+type Frame struct {
+	// Interrupt is the interrupt the handler was entered by, or NoInterrupt
+	// for a JSR.
+	Interrupt cpu.Interrupt
+	// CallSite is the address of the JSR or BRK, or of the instruction the
+	// interrupt was taken before.
+	CallSite uint16
+	// Entry is the address of the routine.
+	Entry uint16
+	// Return is the address the execution is expected to return to.
+	Return uint16
+	// SP is the stack pointer after the return address was pushed. The
+	// frame is left when the stack pointer goes above it.
+	SP uint8
+}
+
+// MismatchKind tells how a return didn't match the call stack.
+type MismatchKind uint8
+
+const (
+	// ReturnWithoutCall is an RTS or an RTI that didn't return from a frame,
+	// e.g. a jump through an address pushed on the stack, the RTS trick of
+	// the jump tables.
+	ReturnWithoutCall MismatchKind = iota
+	// WrongReturnAddress is a return to another address than the one the
+	// frame was called from, i.e. the return address was modified.
+	WrongReturnAddress
+	// WrongReturnKind is an RTS from an interrupt or an RTI from a JSR.
+	WrongReturnKind
+	// FramesDiscarded is the stack pointer moving above frames without
+	// returning from them, e.g. pulling the return address with PLA or
+	// resetting the stack with TXS.
+	FramesDiscarded
+)
+
+func (k MismatchKind) String() string {
+	switch k {
+	case ReturnWithoutCall:
+		return "return without call"
+	case WrongReturnAddress:
+		return "wrong return address"
+	case WrongReturnKind:
+		return "wrong return instruction"
+	case FramesDiscarded:
+		return "frames discarded"
+	default:
+		return "unknown"
+	}
+}
+
+// Mismatch is a return or a stack manipulation that didn't match the call
+// stack.
+type Mismatch struct {
+	Kind MismatchKind
+	// PC is the address of the instruction.
+	PC uint16
+	// Target is the address the execution continued from.
+	Target uint16
+	// Frames are the frames the instruction popped, the outermost first.
+	Frames []Frame
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s at $%04X to $%04X", m.Kind, m.PC, m.Target)
+}
+
+// CallStack returns the logical call stack, the outermost frame first. It is
+// built from the calls, the returns and the interrupts the debugger has
+// stepped, so it is empty when the debugger starts.
+func (d *Debugger) CallStack() []Frame {
+	return append([]Frame(nil), d.frames...)
+}
+
+// Mismatches returns the latest mismatched returns, the oldest first.
+func (d *Debugger) Mismatches() []Mismatch {
+	return append([]Mismatch(nil), d.mismatches...)
+}
+
+// stackUse returns the number of bytes the last instruction or interrupt
+// sequence pushed to and pulled from the stack.
+func (d *Debugger) stackUse() (pushed, pulled int) {
+	if !d.lastInstruction {
+		if d.lastInterrupt != cpu.NoInterrupt {
+			return 3, 0
+		}
+
+		return 0, 0
+	}
+
+	switch d.lastOpCode {
+	case phaOpCode, phpOpCode:
+		return 1, 0
+	case jsrOpCode:
+		return 2, 0
+	case brkOpCode:
+		return 3, 0
+	case plaOpCode, plpOpCode:
+		return 0, 1
+	case rtsOpCode:
+		return 0, 2
+	case rtiOpCode:
+		return 0, 3
+	default:
+		return 0, 0
+	}
+}
+
+// trackStack updates the call stack after a step from the registers before
+// it.
+func (d *Debugger) trackStack(before cpu.Registers) {
+	after := d.cpu.Registers()
+
+	pushed, pulled := d.stackUse()
+	d.stackWrapped = int(before.SP) < pushed || int(before.SP)+pulled > 0xff
+	d.mismatched = false
+
+	switch {
+	case d.lastInterrupt != cpu.NoInterrupt:
+		// The return address of BRK skips its padding byte.
+		ret := before.PC
+		if d.lastInstruction {
+			ret += 2
+		}
+
+		d.frames = append(d.frames, Frame{
+			Interrupt: d.lastInterrupt,
+			CallSite:  before.PC,
+			Entry:     after.PC,
+			Return:    ret,
+			SP:        after.SP,
+		})
+	case d.lastInstruction && d.lastOpCode == jsrOpCode:
+		d.frames = append(d.frames, Frame{
+			Interrupt: cpu.NoInterrupt,
+			CallSite:  before.PC,
+			Entry:     after.PC,
+			Return:    before.PC + 3,
+			SP:        after.SP,
+		})
+	case d.lastInstruction && (d.lastOpCode == rtsOpCode || d.lastOpCode == rtiOpCode):
+		d.returned(before.PC, after)
+	case after.SP > before.SP:
+		if left := d.leave(after.SP); len(left) > 0 {
+			d.mismatch(FramesDiscarded, before.PC, after.PC, left)
+		}
+	}
+}
+
+// returned pops the frames an RTS or an RTI returned from.
+func (d *Debugger) returned(pc uint16, after cpu.Registers) {
+	left := d.leave(after.SP)
+	if len(left) == 0 {
+		d.mismatch(ReturnWithoutCall, pc, after.PC, nil)
+		return
+	}
+
+	innermost := left[len(left)-1]
+	rti := d.lastOpCode == rtiOpCode
+
+	switch {
+	case len(left) > 1:
+		d.mismatch(FramesDiscarded, pc, after.PC, left)
+	case rti != (innermost.Interrupt != cpu.NoInterrupt):
+		d.mismatch(WrongReturnKind, pc, after.PC, left)
+	case innermost.Return != after.PC:
+		d.mismatch(WrongReturnAddress, pc, after.PC, left)
+	}
+}
+
+// leave pops and returns the frames below the stack pointer.
+func (d *Debugger) leave(sp uint8) []Frame {
+	n := len(d.frames)
+	for n > 0 && d.frames[n-1].SP < sp {
+		n--
+	}
+
+	left := append([]Frame(nil), d.frames[n:]...)
+	d.frames = d.frames[:n]
+
+	return left
+}
+
+func (d *Debugger) mismatch(kind MismatchKind, pc, target uint16, frames []Frame) {
+	if len(d.mismatches) == maxMismatches {
+		d.mismatches = d.mismatches[1:]
+	}
+
+	d.mismatches = append(d.mismatches, Mismatch{Kind: kind, PC: pc, Target: target, Frames: frames})
+	d.mismatched = true
+}
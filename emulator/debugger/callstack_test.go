@@ -0,0 +1,250 @@
+package debugger
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/emulator/cpu/asm"
+)
+
+// testMemory is a flat 64 KiB address space.
+type testMemory [0x10000]uint8
+
+func (m *testMemory) ReadData(addr uint16) uint8 {
+	return m[addr]
+}
+
+func (m *testMemory) WriteData(addr uint16, data uint8) {
+	m[addr] = data
+}
+
+func (m *testMemory) Peek(addr uint16) uint8 {
+	return m[addr]
+}
+
+// newTestDebugger assembles the program, resets the CPU to it and returns a
+// debugger stopped on the first instruction.
+func newTestDebugger(t *testing.T, src string) (*Debugger, map[string]uint16) {
+	t.Helper()
+
+	p, err := asm.Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem := &testMemory{}
+	p.Load(mem)
+
+	c := cpu.NewCpu(mem)
+	c.Reset()
+
+	d := New(c, mem, nil, nil)
+	d.StepInto()
+
+	if pc := c.Registers().PC; pc != p.Symbols["reset"] {
+		t.Fatalf("got PC $%04X after the reset, want $%04X", pc, p.Symbols["reset"])
+	}
+
+	return d, p.Symbols
+}
+
+// checkMismatch checks that the execution stops on the mismatch, which is
+// the only one logged.
+func checkMismatch(t *testing.T, d *Debugger, want Mismatch) {
+	t.Helper()
+
+	d.BreakOnMismatch = true
+
+	if reason := d.Continue(); reason != MismatchedReturn {
+		t.Fatalf("got %v, want %v", reason, MismatchedReturn)
+	}
+
+	if pc := d.cpu.Registers().PC; pc != want.Target {
+		t.Errorf("stopped at $%04X, want $%04X", pc, want.Target)
+	}
+
+	if got := d.Mismatches(); len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Errorf("got mismatches %+v, want %+v", got, want)
+	}
+}
+
+func TestCallStack(t *testing.T) {
+	d, sym := newTestDebugger(t, `
+	.org $8000
+reset:	LDX #$ff
+	TXS
+call:	JSR outer
+done:	JMP done
+outer:	JSR inner
+	RTS
+inner:	BRK
+	.byte 0
+	RTS
+irq:	RTI
+
+	.org $fffa
+	.word reset, reset, irq
+`)
+
+	d.BreakOnMismatch = true
+	d.AddBreakpoint(sym["irq"])
+
+	if reason := d.Continue(); reason != Breakpoint {
+		t.Fatalf("got %v, want a breakpoint", reason)
+	}
+
+	want := []Frame{
+		{Interrupt: cpu.NoInterrupt, CallSite: sym["call"], Entry: sym["outer"], Return: sym["done"], SP: 0xfd},
+		{Interrupt: cpu.NoInterrupt, CallSite: sym["outer"], Entry: sym["inner"], Return: sym["outer"] + 3, SP: 0xfb},
+		{Interrupt: cpu.BrkInterrupt, CallSite: sym["inner"], Entry: sym["irq"], Return: sym["inner"] + 2, SP: 0xf8},
+	}
+
+	if got := d.CallStack(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got call stack %+v, want %+v", got, want)
+	}
+
+	d.AddBreakpoint(sym["done"])
+
+	if reason := d.Continue(); reason != Breakpoint {
+		t.Fatalf("got %v, want a breakpoint", reason)
+	}
+
+	if len(d.CallStack()) != 0 || len(d.Mismatches()) != 0 {
+		t.Errorf("got call stack %+v and mismatches %+v after the returns", d.CallStack(), d.Mismatches())
+	}
+}
+
+func TestReturnWithoutCall(t *testing.T) {
+	// The RTS trick jumps to the address pushed on the stack plus one.
+	d, sym := newTestDebugger(t, `
+	.org $8000
+reset:	LDX #$ff
+	TXS
+	JMP trick
+target:	JMP target
+trick:	LDA #>target-1
+	PHA
+	LDA #<target-1
+	PHA
+rts:	RTS
+
+	.org $fffc
+	.word reset
+`)
+
+	checkMismatch(t, d, Mismatch{Kind: ReturnWithoutCall, PC: sym["rts"], Target: sym["target"]})
+}
+
+func TestFramesDiscarded(t *testing.T) {
+	// The subroutine pulls its return address and never returns.
+	d, sym := newTestDebugger(t, `
+	.org $8000
+reset:	LDX #$ff
+	TXS
+call:	JSR sub
+	NOP
+sub:	PLA
+pulled:	PLA
+	JMP sub
+
+	.org $fffc
+	.word reset
+`)
+
+	checkMismatch(t, d, Mismatch{
+		Kind:   FramesDiscarded,
+		PC:     sym["sub"],
+		Target: sym["pulled"],
+		Frames: []Frame{{Interrupt: cpu.NoInterrupt, CallSite: sym["call"], Entry: sym["sub"], Return: sym["call"] + 3, SP: 0xfd}},
+	})
+
+	if len(d.CallStack()) != 0 {
+		t.Errorf("got call stack %+v, want the frame discarded", d.CallStack())
+	}
+}
+
+func TestWrongReturnAddress(t *testing.T) {
+	// The subroutine increments the low byte of its return address on the
+	// stack, so it returns past the NOP.
+	d, sym := newTestDebugger(t, `
+	.org $8000
+reset:	LDX #$ff
+	TXS
+call:	JSR sub
+back:	NOP
+skip:	JMP skip
+sub:	INC $01fe
+rts:	RTS
+
+	.org $fffc
+	.word reset
+`)
+
+	checkMismatch(t, d, Mismatch{
+		Kind:   WrongReturnAddress,
+		PC:     sym["rts"],
+		Target: sym["skip"],
+		Frames: []Frame{{Interrupt: cpu.NoInterrupt, CallSite: sym["call"], Entry: sym["sub"], Return: sym["back"], SP: 0xfd}},
+	})
+}
+
+func TestWrongReturnKind(t *testing.T) {
+	// RTI from a subroutine pulls the status pushed by PHP, and then the
+	// return address of the JSR without adding one to it.
+	d, sym := newTestDebugger(t, `
+	.org $8000
+reset:	LDX #$ff
+	TXS
+call:	JSR sub
+	NOP
+sub:	PHP
+rti:	RTI
+
+	.org $fffc
+	.word reset
+`)
+
+	checkMismatch(t, d, Mismatch{
+		Kind:   WrongReturnKind,
+		PC:     sym["rti"],
+		Target: sym["call"] + 2,
+		Frames: []Frame{{Interrupt: cpu.NoInterrupt, CallSite: sym["call"], Entry: sym["sub"], Return: sym["call"] + 3, SP: 0xfd}},
+	})
+}
+
+func TestBreakOnStackWrap(t *testing.T) {
+	d, sym := newTestDebugger(t, `
+	.org $8000
+reset:	LDX #$01
+	TXS
+	PHA
+	PHA
+pushed:	PLA
+pulled:	JMP pulled
+
+	.org $fffc
+	.word reset
+`)
+
+	d.BreakOnStackWrap = true
+
+	// The second PHA wraps the stack pointer from $00 to $FF, and the PLA
+	// back to $00.
+	for _, want := range []struct {
+		pc uint16
+		sp uint8
+	}{{sym["pushed"], 0xff}, {sym["pulled"], 0x00}} {
+		if reason := d.Continue(); reason != StackWrapped {
+			t.Fatalf("got %v, want %v", reason, StackWrapped)
+		}
+
+		if r := d.cpu.Registers(); r.PC != want.pc || r.SP != want.sp {
+			t.Errorf("stopped at $%04X with SP $%02X, want $%04X and $%02X", r.PC, r.SP, want.pc, want.sp)
+		}
+	}
+
+	if reason := d.StepInto(); reason != Stepped {
+		t.Errorf("got %v on the JMP, want %v", reason, Stepped)
+	}
+}
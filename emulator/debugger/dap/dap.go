@@ -0,0 +1,812 @@
+// Package dap serves the emulator over the Debug Adapter Protocol, so editors
+// can launch a ROM, set breakpoints in its assembly source, step it and
+// inspect the registers and the memory.
+//
+// The CPU is presented as a single thread. The breakpoints are set in the
+// source through a LineMap built from the debug symbols of the program,
+// given as a list of symbol files in the symbols argument of the launch
+// request.
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pqkallio/nes-emulator/emulator/console"
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/emulator/cpu/disasm"
+	"github.com/pqkallio/nes-emulator/emulator/debugger"
+	"github.com/pqkallio/nes-emulator/rom"
+	"github.com/pqkallio/nes-emulator/symbols"
+)
+
+const threadId = 1
+
+// The variable references of the scopes.
+const (
+	registersReference = 1
+	flagsReference     = 2
+)
+
+// maxMemoryRead is the largest memory read served in one response.
+const maxMemoryRead = 0x10000
+
+// maxDisassemble is the largest number of instructions disassembled in one
+// response; the address space holds no more.
+const maxDisassemble = 0x10000
+
+// maxInstructionOffset is the largest instruction offset of a disassembly.
+// Disassembling backwards takes time quadratic in the offset.
+const maxInstructionOffset = 0x400
+
+// flagNames are the names of the status flags, from bit 7 to bit 0. The
+// unused bit 5 is left out of the variables.
+const flagNames = "NV-BDIZC"
+
+// LineMap maps the lines of the source of the program to the addresses of
+// the code generated for them, and back.
+type LineMap interface {
+	// Addrs returns the addresses of the code generated for the line of the
+	// source file.
+	Addrs(path string, line int) []uint16
+	// Line returns the source line the code at the address was generated
+	// for.
+	Line(addr uint16) (path string, line int, ok bool)
+}
+
+// Server serves a single debug session. A new server is needed for each
+// session.
+type Server struct {
+	w  io.Writer
+	mu sync.Mutex
+	// seq is the sequence number of the last message sent.
+	seq int
+
+	nes    *console.Console
+	dbg    *debugger.Debugger
+	lines  LineMap
+	labels cpu.Labels
+
+	stopOnEntry            bool
+	sourceBreakpoints      map[string][]uint16
+	instructionBreakpoints []uint16
+
+	// The run in the background, see resume.
+	running bool
+	run     func() debugger.StopReason
+	done    chan struct{}
+	held    bool
+	heldRun bool
+	// ended is set when the client disconnects; no more events are sent.
+	ended bool
+}
+
+func NewServer() *Server {
+	return &Server{sourceBreakpoints: map[string][]uint16{}}
+}
+
+// ListenAndServe listens on the TCP address, e.g. localhost:4711, and serves
+// the sessions one at a time.
+func ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		err = NewServer().Serve(conn, conn)
+		conn.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Serve serves the session until the client disconnects. Use os.Stdin and
+// os.Stdout to serve over stdio.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.w = w
+	br := bufio.NewReader(r)
+
+	for {
+		data, err := readMessage(br)
+		if errors.Is(err, io.EOF) {
+			s.end()
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			return err
+		}
+
+		if req.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(req)
+
+		var resp response
+		if err != nil {
+			resp = response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: err.Error()}
+		} else {
+			resp = response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: true, Body: body}
+		}
+
+		if err := s.send(&resp); err != nil {
+			return err
+		}
+
+		if err := s.afterResponse(req); err != nil {
+			return err
+		}
+
+		if req.Command == "disconnect" || req.Command == "terminate" {
+			return nil
+		}
+	}
+}
+
+// send sends a response or an event, numbering it.
+func (s *Server) send(message interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+
+	switch m := message.(type) {
+	case *response:
+		m.Seq = s.seq
+	case *event:
+		m.Seq = s.seq
+	}
+
+	return writeMessage(s.w, message)
+}
+
+func (s *Server) sendEvent(name string, body interface{}) error {
+	return s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+// afterResponse sends the events that follow the response to a request.
+func (s *Server) afterResponse(req request) error {
+	switch req.Command {
+	case "initialize":
+		return s.sendEvent("initialized", nil)
+	case "configurationDone":
+		if s.stopOnEntry {
+			return s.sendEvent("stopped", stoppedEvent{Reason: "entry", ThreadId: threadId, AllThreadsStopped: true})
+		}
+
+		s.resume(s.dbg.Continue)
+	case "continue":
+		s.resume(s.dbg.Continue)
+	case "next":
+		s.resume(s.dbg.StepOver)
+	case "stepIn":
+		s.resume(s.dbg.StepInto)
+	case "stepOut":
+		s.resume(s.dbg.StepOut)
+	case "terminate":
+		return s.sendEvent("terminated", nil)
+	}
+
+	return nil
+}
+
+// resume runs the debugger in the background and sends a stopped event when
+// it stops.
+func (s *Server) resume(run func() debugger.StopReason) {
+	done := make(chan struct{})
+
+	s.mu.Lock()
+	s.running = true
+	s.run = run
+	s.done = done
+	s.mu.Unlock()
+
+	go func() {
+		// done is closed after the stopped event is sent, so the event
+		// can't follow the response to a disconnect.
+		defer close(done)
+
+		reason := run()
+
+		s.mu.Lock()
+		s.running = false
+		held := s.held && reason == debugger.Paused
+		s.held = false
+		ended := s.ended
+		s.mu.Unlock()
+
+		s.heldRun = held
+
+		if held || ended {
+			return
+		}
+
+		var name string
+
+		switch reason {
+		case debugger.Breakpoint:
+			name = "breakpoint"
+		case debugger.Paused:
+			name = "pause"
+		case debugger.NmiTaken, debugger.IrqTaken, debugger.StackWrapped, debugger.MismatchedReturn:
+			name = "exception"
+		default:
+			name = "step"
+		}
+
+		_ = s.sendEvent("stopped", stoppedEvent{Reason: name, ThreadId: threadId, AllThreadsStopped: true})
+	}()
+}
+
+// hold pauses the running debugger without telling the client. It returns
+// the run to resume, or nil if nothing was running or the run stopped on
+// its own meanwhile.
+func (s *Server) hold() func() debugger.StopReason {
+	s.mu.Lock()
+
+	if !s.running {
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.held = true
+	done, run := s.done, s.run
+	s.mu.Unlock()
+
+	s.dbg.Pause()
+	<-done
+
+	if !s.heldRun {
+		return nil
+	}
+
+	return run
+}
+
+// end stops the running debugger at the end of the session and waits for
+// it. The client isn't told it stopped.
+func (s *Server) end() {
+	s.mu.Lock()
+	s.ended = true
+	running, done := s.running, s.done
+	s.mu.Unlock()
+
+	if !running {
+		return
+	}
+
+	s.dbg.Pause()
+	<-done
+}
+
+func (s *Server) isRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.running
+}
+
+// pause pauses the debugger if it is running.
+func (s *Server) pause() {
+	if s.dbg != nil && s.isRunning() {
+		s.dbg.Pause()
+	}
+}
+
+// handle runs the request and returns the body of the response.
+func (s *Server) handle(req request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsSetVariable:              true,
+			SupportsReadMemoryRequest:        true,
+			SupportsWriteMemoryRequest:       true,
+			SupportsDisassembleRequest:       true,
+			SupportsInstructionBreakpoints:   true,
+			SupportsTerminateRequest:         true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		return nil, s.launch(args)
+	case "disconnect", "terminate":
+		s.end()
+		return nil, nil
+	case "configurationDone":
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{"threads": []thread{{Id: threadId, Name: "6502"}}}, nil
+	case "pause":
+		s.pause()
+		return nil, nil
+	}
+
+	if s.dbg == nil {
+		return nil, fmt.Errorf("no program launched")
+	}
+
+	if req.Command == "setBreakpoints" || req.Command == "setInstructionBreakpoints" {
+		// The breakpoints can also be set while the program is running.
+		// It is paused for the while.
+		if run := s.hold(); run != nil {
+			defer s.resume(run)
+		}
+
+		return s.handleBreakpoints(req)
+	}
+
+	if s.isRunning() {
+		return nil, fmt.Errorf("%s: the program is running", req.Command)
+	}
+
+	switch req.Command {
+	case "continue":
+		return map[string]bool{"allThreadsContinued": true}, nil
+	case "next", "stepIn", "stepOut":
+		return nil, nil
+	case "stackTrace":
+		return s.stackTrace(), nil
+	case "scopes":
+		return map[string][]scope{"scopes": {
+			{Name: "Registers", VariablesReference: registersReference},
+			{Name: "Flags", VariablesReference: flagsReference},
+		}}, nil
+	case "variables":
+		var args variablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		return map[string][]variable{"variables": s.variables(args.VariablesReference)}, nil
+	case "setVariable":
+		var args setVariableArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		return s.setVariable(args)
+	case "readMemory":
+		var args readMemoryArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		return s.readMemory(args)
+	case "writeMemory":
+		var args writeMemoryArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		return s.writeMemory(args)
+	case "disassemble":
+		var args disassembleArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		return s.disassemble(args)
+	default:
+		return nil, fmt.Errorf("unsupported request %q", req.Command)
+	}
+}
+
+func (s *Server) launch(args launchArguments) error {
+	r, err := rom.ParseNesFile(args.Program)
+	if err != nil {
+		return err
+	}
+
+	nes, err := console.NewConsole(r)
+	if err != nil {
+		return err
+	}
+
+	nes.Reset()
+
+	s.nes = nes
+	s.dbg = debugger.New(nes.Cpu, nes.Bus, nes.Ppu, nes.Tick)
+	s.stopOnEntry = args.StopOnEntry
+
+	if len(args.Symbols) != 0 {
+		table := symbols.NewTable()
+
+		for _, f := range args.Symbols {
+			if err := table.Load(f); err != nil {
+				return err
+			}
+		}
+
+		view := table.View(nes.PrgBank)
+		s.lines = view
+		s.labels = view
+	}
+
+	// Run the reset sequence, so the program stops on the first instruction
+	// of the reset handler.
+	s.dbg.StepInto()
+
+	return nil
+}
+
+func (s *Server) handleBreakpoints(req request) (interface{}, error) {
+	breakpoints := []breakpoint{}
+
+	if req.Command == "setBreakpoints" {
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		var addrs []uint16
+
+		for _, b := range args.Breakpoints {
+			bp := breakpoint{Source: &args.Source, Line: b.Line}
+
+			var lineAddrs []uint16
+			if s.lines != nil {
+				lineAddrs = s.lines.Addrs(args.Source.Path, b.Line)
+			}
+
+			if len(lineAddrs) == 0 {
+				bp.Message = "no code for the line in the debug symbols"
+			} else {
+				bp.Verified = true
+				bp.InstructionReference = reference(lineAddrs[0])
+			}
+
+			addrs = append(addrs, lineAddrs...)
+			breakpoints = append(breakpoints, bp)
+		}
+
+		s.sourceBreakpoints[args.Source.Path] = addrs
+	} else {
+		var args setInstructionBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		s.instructionBreakpoints = nil
+
+		for _, b := range args.Breakpoints {
+			addr, err := parseReference(b.InstructionReference, b.Offset)
+			if err != nil {
+				breakpoints = append(breakpoints, breakpoint{Message: err.Error()})
+				continue
+			}
+
+			s.instructionBreakpoints = append(s.instructionBreakpoints, addr)
+			breakpoints = append(breakpoints, breakpoint{Verified: true, InstructionReference: reference(addr)})
+		}
+	}
+
+	s.updateBreakpoints()
+
+	return map[string][]breakpoint{"breakpoints": breakpoints}, nil
+}
+
+// updateBreakpoints sets the breakpoints of the debugger to the source and
+// the instruction breakpoints.
+func (s *Server) updateBreakpoints() {
+	for _, addr := range s.dbg.Breakpoints() {
+		s.dbg.RemoveBreakpoint(addr)
+	}
+
+	for _, addrs := range s.sourceBreakpoints {
+		for _, addr := range addrs {
+			s.dbg.AddBreakpoint(addr)
+		}
+	}
+
+	for _, addr := range s.instructionBreakpoints {
+		s.dbg.AddBreakpoint(addr)
+	}
+}
+
+// stackTrace returns the call stack of the debugger, the current
+// instruction first and then the call sites. A frame is named by the
+// routine it is in, or by its address outside the known routines.
+func (s *Server) stackTrace() interface{} {
+	calls := s.dbg.CallStack()
+	pc := s.nes.Cpu.Registers().PC
+
+	frames := make([]stackFrame, 0, len(calls)+1)
+
+	for i := len(calls); i >= 0; i-- {
+		name := s.name(pc)
+		if i > 0 {
+			name = s.name(calls[i-1].Entry)
+		}
+
+		frames = append(frames, s.stackFrame(len(frames), name, pc))
+
+		if i > 0 {
+			pc = calls[i-1].CallSite
+		}
+	}
+
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+func (s *Server) stackFrame(id int, name string, pc uint16) stackFrame {
+	frame := stackFrame{
+		Id:                          id,
+		Name:                        name,
+		InstructionPointerReference: reference(pc),
+	}
+
+	if s.lines != nil {
+		if path, line, ok := s.lines.Line(pc); ok {
+			frame.Source = &source{Path: path}
+			frame.Line = line
+			frame.Column = 1
+		}
+	}
+
+	return frame
+}
+
+// name returns the label of the address, or the address.
+func (s *Server) name(addr uint16) string {
+	if s.labels != nil {
+		if label, ok := s.labels.Label(addr); ok {
+			return label
+		}
+	}
+
+	return fmt.Sprintf("$%04X", addr)
+}
+
+func (s *Server) variables(ref int) []variable {
+	r := s.nes.Cpu.Registers()
+
+	switch ref {
+	case registersReference:
+		return []variable{
+			{Name: "A", Value: fmt.Sprintf("$%02X", r.A)},
+			{Name: "X", Value: fmt.Sprintf("$%02X", r.X)},
+			{Name: "Y", Value: fmt.Sprintf("$%02X", r.Y)},
+			{Name: "SP", Value: fmt.Sprintf("$%02X", r.SP), MemoryReference: reference(0x0100 + uint16(r.SP))},
+			{Name: "PC", Value: fmt.Sprintf("$%04X", r.PC), MemoryReference: reference(r.PC)},
+			{Name: "P", Value: fmt.Sprintf("$%02X", r.P)},
+		}
+	case flagsReference:
+		var flags []variable
+
+		for i, name := range flagNames {
+			if name == '-' {
+				continue
+			}
+
+			value := "0"
+			if r.P&(0x80>>i) != 0 {
+				value = "1"
+			}
+
+			flags = append(flags, variable{Name: string(name), Value: value})
+		}
+
+		return flags
+	default:
+		return nil
+	}
+}
+
+func (s *Server) setVariable(args setVariableArguments) (interface{}, error) {
+	value, err := parseNumber(args.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	r := s.nes.Cpu.Registers()
+
+	switch args.VariablesReference {
+	case registersReference:
+		switch args.Name {
+		case "A":
+			r.A = uint8(value)
+		case "X":
+			r.X = uint8(value)
+		case "Y":
+			r.Y = uint8(value)
+		case "SP":
+			r.SP = uint8(value)
+		case "PC":
+			r.PC = uint16(value)
+		case "P":
+			r.P = uint8(value)
+		default:
+			return nil, fmt.Errorf("unknown register %q", args.Name)
+		}
+	case flagsReference:
+		i := strings.Index(flagNames, args.Name)
+		if len(args.Name) != 1 || i < 0 || args.Name == "-" {
+			return nil, fmt.Errorf("unknown flag %q", args.Name)
+		}
+
+		r.P &^= 0x80 >> i
+		if value != 0 {
+			r.P |= 0x80 >> i
+		}
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+
+	s.nes.Cpu.SetRegisters(r)
+
+	for _, v := range s.variables(args.VariablesReference) {
+		if v.Name == args.Name {
+			return map[string]string{"value": v.Value}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *Server) readMemory(args readMemoryArguments) (interface{}, error) {
+	addr, err := parseReference(args.MemoryReference, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Count < 0 {
+		return nil, fmt.Errorf("invalid count %d", args.Count)
+	}
+
+	count := args.Count
+	if count > maxMemoryRead {
+		count = maxMemoryRead
+	}
+
+	data := make([]byte, count)
+	for i := range data {
+		data[i] = s.nes.Bus.Peek(addr + uint16(i))
+	}
+
+	return map[string]string{
+		"address": reference(addr),
+		"data":    base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
+
+func (s *Server) writeMemory(args writeMemoryArguments) (interface{}, error) {
+	addr, err := parseReference(args.MemoryReference, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(args.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, b := range data {
+		s.nes.Bus.WriteData(addr+uint16(i), b)
+	}
+
+	return map[string]int{"bytesWritten": len(data)}, nil
+}
+
+func (s *Server) disassemble(args disassembleArguments) (interface{}, error) {
+	addr, err := parseReference(args.MemoryReference, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.InstructionCount < 0 {
+		return nil, fmt.Errorf("invalid instruction count %d", args.InstructionCount)
+	}
+
+	if args.InstructionOffset < -maxInstructionOffset || args.InstructionOffset > maxInstructionOffset {
+		return nil, fmt.Errorf("invalid instruction offset %d", args.InstructionOffset)
+	}
+
+	count := args.InstructionCount
+	if count > maxDisassemble {
+		count = maxDisassemble
+	}
+
+	mem := s.nes.Bus
+
+	if args.InstructionOffset < 0 {
+		addr = disasm.Backtrack(mem, addr, -args.InstructionOffset)
+	}
+
+	for i := 0; i < args.InstructionOffset; i++ {
+		addr += uint16(disasm.Decode(mem, addr).Length())
+	}
+
+	instructions := make([]disassembledInstruction, count)
+
+	for i := range instructions {
+		instruction := disasm.Decode(mem, addr)
+
+		var bytes []string
+		for _, b := range instruction.Bytes {
+			bytes = append(bytes, fmt.Sprintf("%02X", b))
+		}
+
+		instructions[i] = disassembledInstruction{
+			Address:          reference(addr),
+			InstructionBytes: strings.Join(bytes, " "),
+			Instruction:      instruction.Format(s.labels),
+		}
+
+		if s.labels != nil {
+			instructions[i].Symbol, _ = s.labels.Label(addr)
+		}
+
+		if s.lines != nil {
+			if path, line, ok := s.lines.Line(addr); ok {
+				instructions[i].Location = &source{Path: path}
+				instructions[i].Line = line
+			}
+		}
+
+		addr += uint16(instruction.Length())
+	}
+
+	return map[string][]disassembledInstruction{"instructions": instructions}, nil
+}
+
+// reference returns the memory reference of an address, e.g. 0xC000.
+func reference(addr uint16) string {
+	return fmt.Sprintf("0x%04X", addr)
+}
+
+func parseReference(ref string, offset int) (uint16, error) {
+	addr, err := parseNumber(ref)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint16(addr + offset), nil
+}
+
+// parseNumber parses a number given in hex as $C000 or 0xC000, or in
+// decimal.
+func parseNumber(s string) (int, error) {
+	base := 10
+
+	switch {
+	case strings.HasPrefix(s, "$"):
+		s, base = s[1:], 16
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		s, base = s[2:], 16
+	}
+
+	n, err := strconv.ParseInt(s, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+
+	return int(n), nil
+}
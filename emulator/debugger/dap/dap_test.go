@@ -0,0 +1,394 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testProgram is
+//
+//	$8000  LDA #$05
+//	$8002  STA $0200
+//	$8005  INX
+//	$8006  JMP $8005
+var testProgram = []uint8{0xa9, 0x05, 0x8d, 0x00, 0x02, 0xe8, 0x4c, 0x05, 0x80}
+
+// writeTestRom writes an NROM-128 ROM of the test program and returns its
+// path.
+func writeTestRom(t *testing.T) string {
+	t.Helper()
+
+	header := []byte{'N', 'E', 'S', 0x1a, 1, 1, 0x00, 0x08, 0, 0, 0, 0, 0, 0, 0, 0}
+	prg := make([]byte, 0x4000)
+	chr := make([]byte, 0x2000)
+
+	copy(prg, testProgram)
+	// The reset vector at $FFFC points to $8000.
+	prg[0x3ffc] = 0x00
+	prg[0x3ffd] = 0x80
+
+	path := filepath.Join(t.TempDir(), "test.nes")
+	if err := os.WriteFile(path, append(append(header, prg...), chr...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// message is a response or an event received by the client.
+type message struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client is a scripted DAP client.
+type client struct {
+	t   *testing.T
+	w   io.Writer
+	r   *bufio.Reader
+	seq int
+}
+
+func (c *client) receive() message {
+	c.t.Helper()
+
+	data, err := readMessage(c.r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	var m message
+	if err := json.Unmarshal(data, &m); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return m
+}
+
+// request sends the request and returns the response to it.
+func (c *client) request(command string, args interface{}) message {
+	c.t.Helper()
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	c.seq++
+
+	if err := writeMessage(c.w, request{Seq: c.seq, Type: "request", Command: command, Arguments: data}); err != nil {
+		c.t.Fatal(err)
+	}
+
+	m := c.receive()
+	if m.Type != "response" || m.RequestSeq != c.seq || m.Command != command {
+		c.t.Fatalf("%s: got %+v, want the response", command, m)
+	}
+
+	return m
+}
+
+// succeed sends the request and decodes the body of the successful
+// response.
+func (c *client) succeed(command string, args interface{}, body interface{}) {
+	c.t.Helper()
+
+	m := c.request(command, args)
+	if !m.Success {
+		c.t.Fatalf("%s failed: %s", command, m.Message)
+	}
+
+	if body != nil {
+		if err := json.Unmarshal(m.Body, body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// fail sends the request and checks that it fails.
+func (c *client) fail(command string, args interface{}) {
+	c.t.Helper()
+
+	if m := c.request(command, args); m.Success || m.Message == "" {
+		c.t.Errorf("%s %+v: got %+v, want a failure", command, args, m)
+	}
+}
+
+// event reads the next message, which must be the event.
+func (c *client) event(name string) message {
+	c.t.Helper()
+
+	m := c.receive()
+	if m.Type != "event" || m.Event != name {
+		c.t.Fatalf("got %+v, want the %s event", m, name)
+	}
+
+	return m
+}
+
+// startServer starts serving a session and returns the server and its
+// client. The result of Serve is sent to the channel.
+func startServer(t *testing.T) (*Server, *client, <-chan error) {
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+	served := make(chan error, 1)
+	s := NewServer()
+
+	go func() {
+		served <- s.Serve(serverR, serverW)
+		serverW.Close()
+	}()
+
+	return s, &client{t: t, w: clientW, r: bufio.NewReader(clientR)}, served
+}
+
+// checkEnded checks that the session ended with the program stopped and
+// without sending more messages.
+func checkEnded(t *testing.T, s *Server, c *client, served <-chan error) {
+	t.Helper()
+
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+
+	if s.done != nil {
+		select {
+		case <-s.done:
+		default:
+			t.Error("the program is still running")
+		}
+	}
+
+	if data, err := readMessage(c.r); !errors.Is(err, io.EOF) {
+		t.Errorf("got %s, %v after the session ended", data, err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	program := writeTestRom(t)
+	s, c, served := startServer(t)
+
+	var caps capabilities
+	c.succeed("initialize", map[string]string{"adapterID": "nes"}, &caps)
+	if !caps.SupportsReadMemoryRequest || !caps.SupportsDisassembleRequest {
+		t.Errorf("got capabilities %+v", caps)
+	}
+
+	c.event("initialized")
+
+	c.fail("readMemory", readMemoryArguments{MemoryReference: "0x8000", Count: 1})
+
+	c.succeed("launch", launchArguments{Program: program, StopOnEntry: true}, nil)
+	c.succeed("configurationDone", nil, nil)
+
+	var stopped stoppedEvent
+	if err := json.Unmarshal(c.event("stopped").Body, &stopped); err != nil {
+		t.Fatal(err)
+	}
+
+	if stopped.Reason != "entry" || stopped.ThreadId != threadId {
+		t.Errorf("got stopped event %+v", stopped)
+	}
+
+	var trace struct {
+		StackFrames []stackFrame `json:"stackFrames"`
+	}
+	c.succeed("stackTrace", map[string]int{"threadId": threadId}, &trace)
+	if len(trace.StackFrames) != 1 || trace.StackFrames[0].InstructionPointerReference != "0x8000" {
+		t.Errorf("got stack trace %+v", trace.StackFrames)
+	}
+
+	var memory struct {
+		Address string `json:"address"`
+		Data    string `json:"data"`
+	}
+	c.succeed("readMemory", readMemoryArguments{MemoryReference: "0x8000", Offset: 2, Count: 3}, &memory)
+	if data, _ := base64.StdEncoding.DecodeString(memory.Data); memory.Address != "0x8002" || string(data) != string(testProgram[2:5]) {
+		t.Errorf("got memory %+v", memory)
+	}
+
+	c.fail("readMemory", readMemoryArguments{MemoryReference: "0x8000", Count: -1})
+
+	c.succeed("readMemory", readMemoryArguments{MemoryReference: "0x0000", Count: 1 << 30}, &memory)
+	if data, _ := base64.StdEncoding.DecodeString(memory.Data); len(data) != maxMemoryRead {
+		t.Errorf("got %d bytes read, want %d", len(data), maxMemoryRead)
+	}
+
+	var disassembly struct {
+		Instructions []disassembledInstruction `json:"instructions"`
+	}
+	c.succeed("disassemble", disassembleArguments{MemoryReference: "0x8000", InstructionCount: 4}, &disassembly)
+
+	want := []disassembledInstruction{
+		{Address: "0x8000", InstructionBytes: "A9 05", Instruction: "LDA #$05"},
+		{Address: "0x8002", InstructionBytes: "8D 00 02", Instruction: "STA $0200"},
+		{Address: "0x8005", InstructionBytes: "E8", Instruction: "INX"},
+		{Address: "0x8006", InstructionBytes: "4C 05 80", Instruction: "JMP $8005"},
+	}
+
+	if len(disassembly.Instructions) != len(want) {
+		t.Fatalf("got %d instructions, want %d", len(disassembly.Instructions), len(want))
+	}
+
+	for i := range want {
+		if disassembly.Instructions[i] != want[i] {
+			t.Errorf("instruction %d: got %+v, want %+v", i, disassembly.Instructions[i], want[i])
+		}
+	}
+
+	c.succeed("disassemble", disassembleArguments{MemoryReference: "0x8009", InstructionOffset: -2, InstructionCount: 1}, &disassembly)
+	if len(disassembly.Instructions) != 1 || disassembly.Instructions[0].Address != "0x8005" {
+		t.Errorf("got %+v two instructions before $8009", disassembly.Instructions)
+	}
+
+	c.fail("disassemble", disassembleArguments{MemoryReference: "0x8000", InstructionCount: -1})
+	c.fail("disassemble", disassembleArguments{MemoryReference: "0x8000", InstructionOffset: 1 << 30, InstructionCount: 1})
+	c.fail("disassemble", disassembleArguments{MemoryReference: "0x8000", InstructionOffset: -1 << 30, InstructionCount: 1})
+
+	c.succeed("disassemble", disassembleArguments{MemoryReference: "0x8000", InstructionCount: 1 << 30}, &disassembly)
+	if len(disassembly.Instructions) != maxDisassemble {
+		t.Errorf("got %d instructions, want %d", len(disassembly.Instructions), maxDisassemble)
+	}
+
+	c.succeed("setInstructionBreakpoints", setInstructionBreakpointsArguments{
+		Breakpoints: []instructionBreakpoint{{InstructionReference: "0x8006"}},
+	}, nil)
+	c.succeed("continue", map[string]int{"threadId": threadId}, nil)
+
+	if err := json.Unmarshal(c.event("stopped").Body, &stopped); err != nil {
+		t.Fatal(err)
+	}
+
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("got stopped event %+v, want a breakpoint", stopped)
+	}
+
+	c.succeed("readMemory", readMemoryArguments{MemoryReference: "0x0200", Count: 1}, &memory)
+	if memory.Data != base64.StdEncoding.EncodeToString([]byte{0x05}) {
+		t.Errorf("got $0200 %q, want 05", memory.Data)
+	}
+
+	var vars struct {
+		Variables []variable `json:"variables"`
+	}
+	c.succeed("variables", variablesArguments{VariablesReference: registersReference}, &vars)
+
+	for _, v := range vars.Variables {
+		if v.Name == "X" && v.Value != "$01" {
+			t.Errorf("got X %s, want $01", v.Value)
+		}
+	}
+
+	c.succeed("disconnect", nil, nil)
+	checkEnded(t, s, c, served)
+}
+
+func TestServerEndWhileRunning(t *testing.T) {
+	program := writeTestRom(t)
+
+	for _, command := range []string{"disconnect", "terminate"} {
+		t.Run(command, func(t *testing.T) {
+			s, c, served := startServer(t)
+
+			c.succeed("initialize", map[string]string{"adapterID": "nes"}, nil)
+			c.event("initialized")
+			c.succeed("launch", launchArguments{Program: program}, nil)
+			c.succeed("configurationDone", nil, nil)
+
+			// The program loops until it is stopped; the pause must not be
+			// reported.
+			c.succeed(command, nil, nil)
+
+			if command == "terminate" {
+				c.event("terminated")
+			}
+
+			checkEnded(t, s, c, served)
+		})
+	}
+}
+
+// testListing is the asm6 listing of the test program.
+const testListing = `08000                           reset:
+08000 A9 05                             lda #$05
+08002 8D 00 02                          sta $0200
+08005                           loop:
+08005 E8                                inx
+08006 4C 05 80                          jmp loop
+`
+
+func TestServerSymbols(t *testing.T) {
+	program := writeTestRom(t)
+
+	listing := filepath.Join(t.TempDir(), "test.lst")
+	if err := os.WriteFile(listing, []byte(testListing), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, c, served := startServer(t)
+
+	c.succeed("initialize", map[string]string{"adapterID": "nes"}, nil)
+	c.event("initialized")
+	c.succeed("launch", launchArguments{Program: program, StopOnEntry: true, Symbols: []string{listing}}, nil)
+
+	var breakpoints struct {
+		Breakpoints []breakpoint `json:"breakpoints"`
+	}
+	c.succeed("setBreakpoints", setBreakpointsArguments{
+		Source:      source{Path: listing},
+		Breakpoints: []sourceBreakpoint{{Line: 6}, {Line: 4}},
+	}, &breakpoints)
+
+	if len(breakpoints.Breakpoints) != 2 {
+		t.Fatalf("got breakpoints %+v", breakpoints.Breakpoints)
+	}
+
+	if b := breakpoints.Breakpoints[0]; !b.Verified || b.InstructionReference != "0x8006" {
+		t.Errorf("line 6: got %+v, want verified at $8006", b)
+	}
+
+	if b := breakpoints.Breakpoints[1]; b.Verified {
+		t.Errorf("line 4: got %+v, want unverified", b)
+	}
+
+	c.succeed("configurationDone", nil, nil)
+	c.event("stopped")
+
+	var trace struct {
+		StackFrames []stackFrame `json:"stackFrames"`
+	}
+	c.succeed("stackTrace", map[string]int{"threadId": threadId}, &trace)
+	if len(trace.StackFrames) != 1 || trace.StackFrames[0].Name != "reset" || trace.StackFrames[0].Line != 2 {
+		t.Errorf("got stack trace %+v, want reset at line 2", trace.StackFrames)
+	}
+
+	c.succeed("continue", map[string]int{"threadId": threadId}, nil)
+
+	var stopped stoppedEvent
+	if err := json.Unmarshal(c.event("stopped").Body, &stopped); err != nil {
+		t.Fatal(err)
+	}
+
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("got stopped event %+v, want a breakpoint", stopped)
+	}
+
+	c.succeed("stackTrace", map[string]int{"threadId": threadId}, &trace)
+	if len(trace.StackFrames) != 1 || trace.StackFrames[0].Line != 6 || trace.StackFrames[0].Source == nil || trace.StackFrames[0].Source.Path != listing {
+		t.Errorf("got stack trace %+v, want line 6 of the listing", trace.StackFrames)
+	}
+
+	c.succeed("disconnect", nil, nil)
+	checkEnded(t, s, c, served)
+}
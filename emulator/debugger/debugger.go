@@ -0,0 +1,287 @@
+// Package debugger controls the execution of the CPU for debugging: it stops
+// on breakpoints and interrupts, and steps the program an instruction at a
+// time.
+package debugger
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+)
+
+const (
+	brkOpCode uint8 = 0x00
+	phpOpCode uint8 = 0x08
+	jsrOpCode uint8 = 0x20
+	plpOpCode uint8 = 0x28
+	rtiOpCode uint8 = 0x40
+	phaOpCode uint8 = 0x48
+	rtsOpCode uint8 = 0x60
+	plaOpCode uint8 = 0x68
+)
+
+const scanlinesPerFrame = 262
+
+// Memory is the memory the debugger inspects. *bus.Bus implements it.
+type Memory interface {
+	Peek(addr uint16) uint8
+}
+
+// StopReason tells why the execution stopped.
+type StopReason uint8
+
+const (
+	// Stepped is returned when a step or a run to a cycle or a scanline has
+	// finished.
+	Stepped StopReason = iota
+	Breakpoint
+	NmiTaken
+	IrqTaken
+	Paused
+	// StackWrapped is returned when the stack pointer wraps around the
+	// stack page, see BreakOnStackWrap.
+	StackWrapped
+	// MismatchedReturn is returned when a return doesn't match the call
+	// stack, see BreakOnMismatch.
+	MismatchedReturn
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case Stepped:
+		return "stepped"
+	case Breakpoint:
+		return "breakpoint"
+	case NmiTaken:
+		return "NMI"
+	case IrqTaken:
+		return "IRQ"
+	case Paused:
+		return "paused"
+	case StackWrapped:
+		return "stack wrapped"
+	case MismatchedReturn:
+		return "mismatched return"
+	default:
+		return "unknown"
+	}
+}
+
+// Debugger runs the system an instruction at a time. The execution always
+// stops between instructions, so the registers can be read and modified
+// through the Registers and SetRegisters methods of the CPU.
+//
+// Only Pause may be called while the system is running.
+type Debugger struct {
+	cpu  *cpu.Cpu
+	mem  Memory
+	ppu  cpu.PpuPosition
+	tick func()
+
+	breakpoints map[uint16]bool
+
+	// BreakOnNmi and BreakOnIrq make the execution stop on the first
+	// instruction of the interrupt handler.
+	BreakOnNmi bool
+	BreakOnIrq bool
+	// BreakOnStackWrap makes the execution stop after an instruction that
+	// wrapped the stack pointer from $0100 to $01FF or back, i.e. over- or
+	// underflowed the stack.
+	BreakOnStackWrap bool
+	// BreakOnMismatch makes the execution stop after a return or a stack
+	// manipulation that didn't match the call stack.
+	BreakOnMismatch bool
+
+	pauseRequested int32
+
+	// The last instruction stepped and the interrupt taken during it.
+	lastOpCode      uint8
+	lastInstruction bool
+	lastInterrupt   cpu.Interrupt
+
+	frames       []Frame
+	mismatches   []Mismatch
+	stackWrapped bool
+	mismatched   bool
+}
+
+// New returns a debugger for the CPU. The tick function advances the whole
+// system by one CPU cycle, e.g. ticks the CPU once and the PPU three times.
+// If tick is nil, only the CPU is ticked. The PPU may be nil if running to a
+// scanline isn't needed.
+func New(c *cpu.Cpu, mem Memory, ppu cpu.PpuPosition, tick func()) *Debugger {
+	if tick == nil {
+		tick = c.Tick
+	}
+
+	return &Debugger{
+		cpu:         c,
+		mem:         mem,
+		ppu:         ppu,
+		tick:        tick,
+		breakpoints: map[uint16]bool{},
+	}
+}
+
+// AddBreakpoint makes the execution stop before the instruction at the
+// address is executed.
+func (d *Debugger) AddBreakpoint(addr uint16) {
+	d.breakpoints[addr] = true
+}
+
+// RemoveBreakpoint removes the breakpoint at the address. It returns false if
+// there is no breakpoint at the address.
+func (d *Debugger) RemoveBreakpoint(addr uint16) bool {
+	if !d.breakpoints[addr] {
+		return false
+	}
+
+	delete(d.breakpoints, addr)
+
+	return true
+}
+
+// Breakpoints returns the breakpoint addresses in ascending order.
+func (d *Debugger) Breakpoints() []uint16 {
+	addrs := make([]uint16, 0, len(d.breakpoints))
+	for addr := range d.breakpoints {
+		addrs = append(addrs, addr)
+	}
+
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+	return addrs
+}
+
+// Pause stops Continue, or any of the other runs, at the next instruction
+// boundary. It can be called from another goroutine. If nothing is running,
+// the next run stops after its first instruction.
+func (d *Debugger) Pause() {
+	atomic.StoreInt32(&d.pauseRequested, 1)
+}
+
+// Continue runs until a breakpoint is hit, a watched interrupt is taken or
+// the execution is paused.
+func (d *Debugger) Continue() StopReason {
+	return d.run(func() bool { return false })
+}
+
+// StepInto runs a single instruction, or an interrupt sequence if one is
+// pending.
+func (d *Debugger) StepInto() StopReason {
+	return d.run(func() bool { return true })
+}
+
+// StepOver runs a single instruction like StepInto, but runs a subroutine
+// called with JSR to its return.
+func (d *Debugger) StepOver() StopReason {
+	regs := d.cpu.Registers()
+
+	if d.cpu.InterruptPending() || d.mem.Peek(regs.PC) != jsrOpCode {
+		return d.StepInto()
+	}
+
+	// Compare the stack pointer too, so a recursive call to the subroutine
+	// doesn't stop the execution.
+	returnAddr := regs.PC + 3
+
+	return d.run(func() bool {
+		r := d.cpu.Registers()
+		return r.PC == returnAddr && r.SP == regs.SP
+	})
+}
+
+// StepOut runs until the current subroutine or interrupt handler returns with
+// RTS or RTI.
+func (d *Debugger) StepOut() StopReason {
+	sp := d.cpu.Registers().SP
+
+	return d.run(func() bool {
+		returned := d.lastInstruction && (d.lastOpCode == rtsOpCode || d.lastOpCode == rtiOpCode)
+		return returned && d.cpu.Registers().SP > sp
+	})
+}
+
+// RunToCycle runs until the CPU cycle count reaches the given cycle. The
+// execution stops on the first instruction boundary at or after the cycle.
+func (d *Debugger) RunToCycle(cycle uint64) StopReason {
+	return d.run(func() bool { return d.cpu.Cycles() >= cycle })
+}
+
+// RunToScanline runs until the PPU enters the given scanline. If the PPU is
+// already on the scanline, the execution stops on it on the next frame.
+func (d *Debugger) RunToScanline(scanline int) (StopReason, error) {
+	if d.ppu == nil {
+		return Stepped, fmt.Errorf("no PPU to run to a scanline on")
+	}
+
+	if scanline < 0 || scanline >= scanlinesPerFrame {
+		return Stepped, fmt.Errorf("invalid scanline %d", scanline)
+	}
+
+	left := d.ppu.Scanline() != scanline
+
+	return d.run(func() bool {
+		if !left {
+			left = d.ppu.Scanline() != scanline
+			return false
+		}
+
+		return d.ppu.Scanline() == scanline
+	}), nil
+}
+
+// run steps the system an instruction at a time until done returns true or
+// another reason to stop comes up. The first instruction is always run, so a
+// breakpoint on the current instruction doesn't stop the execution.
+func (d *Debugger) run(done func() bool) StopReason {
+	defer atomic.StoreInt32(&d.pauseRequested, 0)
+
+	for {
+		d.step()
+
+		switch {
+		case d.lastInterrupt == cpu.NmiInterrupt && d.BreakOnNmi:
+			return NmiTaken
+		case d.lastInterrupt == cpu.IrqInterrupt && d.BreakOnIrq:
+			return IrqTaken
+		case d.stackWrapped && d.BreakOnStackWrap:
+			return StackWrapped
+		case d.mismatched && d.BreakOnMismatch:
+			return MismatchedReturn
+		case done():
+			return Stepped
+		case d.breakpoints[d.cpu.Registers().PC] && !d.cpu.InterruptPending():
+			return Breakpoint
+		case atomic.LoadInt32(&d.pauseRequested) != 0:
+			return Paused
+		}
+	}
+}
+
+// step runs the system to the next instruction boundary.
+func (d *Debugger) step() {
+	before := d.cpu.Registers()
+
+	d.lastInstruction = d.cpu.InstructionBoundary() && !d.cpu.InterruptPending()
+	if d.lastInstruction {
+		d.lastOpCode = d.mem.Peek(d.cpu.Registers().PC)
+	}
+
+	d.lastInterrupt = cpu.NoInterrupt
+
+	for {
+		d.tick()
+
+		if interrupt := d.cpu.Interrupted(); interrupt != cpu.NoInterrupt {
+			d.lastInterrupt = interrupt
+		}
+
+		if d.cpu.InstructionBoundary() {
+			d.trackStack(before)
+			return
+		}
+	}
+}
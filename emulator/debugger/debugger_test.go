@@ -0,0 +1,325 @@
+package debugger
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+)
+
+// debuggerProgram loops calling a subroutine two levels deep, and has a
+// recursive subroutine and the interrupt handlers.
+const debuggerProgram = `
+	.org $8000
+reset:	LDX #$ff
+	TXS
+	LDX #$00
+loop:	INX
+	JSR sub
+after:	NOP
+	JMP loop
+
+sub:	JSR leaf
+subret:	RTS
+leaf:	INY
+	RTS
+
+recurse:	JSR count
+rdone:	JMP rdone
+count:	DEX
+	BEQ cret
+inner:	JSR count
+back:	NOP
+cret:	RTS
+
+nmi:	NOP
+	RTI
+irq:	RTI
+
+	.org $fffa
+	.word nmi, reset, irq
+`
+
+// testPpu is a PPU position advanced three dots a CPU cycle.
+type testPpu struct {
+	dots int
+}
+
+func (p *testPpu) Dot() int {
+	return p.dots % 341
+}
+
+func (p *testPpu) Scanline() int {
+	return p.dots / 341 % scanlinesPerFrame
+}
+
+// setPc moves the CPU to the address with the registers otherwise kept.
+func setPc(d *Debugger, pc uint16) {
+	r := d.cpu.Registers()
+	r.PC = pc
+	d.cpu.SetRegisters(r)
+}
+
+func TestBreakpoints(t *testing.T) {
+	d, sym := newTestDebugger(t, debuggerProgram)
+
+	d.AddBreakpoint(0x9000)
+	d.AddBreakpoint(sym["after"])
+	d.AddBreakpoint(sym["loop"])
+
+	if got, want := d.Breakpoints(), []uint16{sym["loop"], sym["after"], 0x9000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got breakpoints %x, want %x", got, want)
+	}
+
+	// The breakpoint stops the execution before the instruction, and the
+	// next run starts by running it.
+	for _, want := range []struct {
+		pc uint16
+		x  uint8
+	}{{sym["loop"], 0}, {sym["after"], 1}, {sym["loop"], 1}, {sym["after"], 2}} {
+		if reason := d.Continue(); reason != Breakpoint {
+			t.Fatalf("got %v, want %v", reason, Breakpoint)
+		}
+
+		if r := d.cpu.Registers(); r.PC != want.pc || r.X != want.x {
+			t.Errorf("stopped at $%04X with X %d, want $%04X and %d", r.PC, r.X, want.pc, want.x)
+		}
+	}
+
+	if !d.RemoveBreakpoint(sym["loop"]) || d.RemoveBreakpoint(sym["loop"]) {
+		t.Error("the breakpoint wasn't removed once")
+	}
+
+	if reason := d.Continue(); reason != Breakpoint || d.cpu.Registers().PC != sym["after"] {
+		t.Errorf("got %v at $%04X, want the breakpoint at $%04X", reason, d.cpu.Registers().PC, sym["after"])
+	}
+}
+
+func TestStepOver(t *testing.T) {
+	d, sym := newTestDebugger(t, debuggerProgram)
+	setPc(d, sym["loop"])
+
+	// An instruction that isn't a JSR is stepped into.
+	if reason := d.StepOver(); reason != Stepped || d.cpu.Registers().PC != sym["loop"]+1 {
+		t.Fatalf("got %v at $%04X after INX", reason, d.cpu.Registers().PC)
+	}
+
+	sp := d.cpu.Registers().SP
+
+	if reason := d.StepOver(); reason != Stepped {
+		t.Fatalf("got %v, want %v", reason, Stepped)
+	}
+
+	if r := d.cpu.Registers(); r.PC != sym["after"] || r.SP != sp || r.Y != 1 {
+		t.Errorf("got PC $%04X SP $%02X Y %d, want $%04X $%02X 1", r.PC, r.SP, r.Y, sym["after"], sp)
+	}
+
+	// A breakpoint in the subroutine stops the step.
+	d.AddBreakpoint(sym["leaf"])
+	setPc(d, sym["loop"]+1)
+
+	if reason := d.StepOver(); reason != Breakpoint || d.cpu.Registers().PC != sym["leaf"] {
+		t.Errorf("got %v at $%04X, want the breakpoint in the subroutine", reason, d.cpu.Registers().PC)
+	}
+}
+
+func TestStepOverRecursion(t *testing.T) {
+	d, sym := newTestDebugger(t, debuggerProgram)
+
+	r := d.cpu.Registers()
+	r.PC = sym["recurse"]
+	r.X = 3
+	d.cpu.SetRegisters(r)
+
+	for d.cpu.Registers().PC != sym["inner"] {
+		d.StepInto()
+	}
+
+	// The deeper calls return to the same address with the stack pointer
+	// lower, which doesn't stop the step.
+	sp := d.cpu.Registers().SP
+
+	if reason := d.StepOver(); reason != Stepped {
+		t.Fatalf("got %v, want %v", reason, Stepped)
+	}
+
+	if r := d.cpu.Registers(); r.PC != sym["back"] || r.SP != sp || r.X != 0 {
+		t.Errorf("got PC $%04X SP $%02X X %d, want $%04X $%02X 0", r.PC, r.SP, r.X, sym["back"], sp)
+	}
+}
+
+func TestStepOut(t *testing.T) {
+	d, sym := newTestDebugger(t, debuggerProgram)
+	setPc(d, sym["loop"]+1)
+
+	for d.cpu.Registers().PC != sym["leaf"] {
+		d.StepInto()
+	}
+
+	// Each step out returns from one subroutine.
+	for _, want := range []uint16{sym["subret"], sym["after"]} {
+		if reason := d.StepOut(); reason != Stepped || d.cpu.Registers().PC != want {
+			t.Errorf("got %v at $%04X, want $%04X", reason, d.cpu.Registers().PC, want)
+		}
+	}
+
+	// The interrupt handlers return with RTI.
+	d.BreakOnNmi = true
+	d.cpu.SetNmiLine(true)
+
+	if reason := d.Continue(); reason != NmiTaken || d.cpu.Registers().PC != sym["nmi"] {
+		t.Fatalf("got %v at $%04X, want the NMI handler", reason, d.cpu.Registers().PC)
+	}
+
+	returnAddr := uint16(d.mem.Peek(0x0100+uint16(d.cpu.Registers().SP+2))) |
+		uint16(d.mem.Peek(0x0100+uint16(d.cpu.Registers().SP+3)))<<8
+
+	if reason := d.StepOut(); reason != Stepped || d.cpu.Registers().PC != returnAddr {
+		t.Errorf("got %v at $%04X, want the return to $%04X", reason, d.cpu.Registers().PC, returnAddr)
+	}
+}
+
+func TestRunToCycle(t *testing.T) {
+	d, _ := newTestDebugger(t, debuggerProgram)
+
+	target := d.cpu.Cycles() + 100
+
+	if reason := d.RunToCycle(target); reason != Stepped {
+		t.Fatalf("got %v, want %v", reason, Stepped)
+	}
+
+	// The execution stops on the first instruction boundary at the cycle.
+	if cycles := d.cpu.Cycles(); cycles < target || cycles >= target+7 || !d.cpu.InstructionBoundary() {
+		t.Errorf("stopped at cycle %d, want the boundary at or after %d", cycles, target)
+	}
+
+	// A cycle in the past stops after one instruction.
+	before := d.cpu.Cycles()
+	d.RunToCycle(0)
+
+	if d.cpu.Cycles()-before > 7 {
+		t.Errorf("ran %d cycles to a past cycle", d.cpu.Cycles()-before)
+	}
+}
+
+func TestRunToScanline(t *testing.T) {
+	d, _ := newTestDebugger(t, debuggerProgram)
+
+	if _, err := d.RunToScanline(10); err == nil {
+		t.Error("ran to a scanline without a PPU")
+	}
+
+	ppu := &testPpu{}
+	c := d.cpu
+	d.ppu = ppu
+	d.tick = func() {
+		c.Tick()
+		ppu.dots += 3
+	}
+
+	for _, scanline := range []int{-1, scanlinesPerFrame} {
+		if _, err := d.RunToScanline(scanline); err == nil {
+			t.Errorf("ran to scanline %d", scanline)
+		}
+	}
+
+	if reason, err := d.RunToScanline(10); err != nil || reason != Stepped || ppu.Scanline() != 10 {
+		t.Fatalf("got %v, %v on scanline %d, want scanline 10", reason, err, ppu.Scanline())
+	}
+
+	// From the scanline, the execution runs to it on the next frame.
+	frame := ppu.dots / (341 * scanlinesPerFrame)
+
+	if reason, err := d.RunToScanline(10); err != nil || reason != Stepped || ppu.Scanline() != 10 {
+		t.Fatalf("got %v, %v on scanline %d, want scanline 10", reason, err, ppu.Scanline())
+	}
+
+	if got := ppu.dots / (341 * scanlinesPerFrame); got != frame+1 {
+		t.Errorf("got frame %d, want %d", got, frame+1)
+	}
+}
+
+func TestPause(t *testing.T) {
+	d, sym := newTestDebugger(t, debuggerProgram)
+
+	// A pause requested before the run stops it after one instruction.
+	d.Pause()
+
+	if reason := d.Continue(); reason != Paused || d.cpu.Registers().PC != sym["reset"]+2 {
+		t.Errorf("got %v at $%04X, want paused after one instruction", reason, d.cpu.Registers().PC)
+	}
+
+	// The request is cleared by the run it stopped.
+	if reason := d.StepInto(); reason != Stepped {
+		t.Errorf("got %v, want %v", reason, Stepped)
+	}
+
+	stopped := make(chan StopReason)
+
+	go func() {
+		stopped <- d.Continue()
+	}()
+
+	d.Pause()
+
+	if reason := <-stopped; reason != Paused {
+		t.Errorf("got %v, want %v", reason, Paused)
+	}
+
+	if !d.cpu.InstructionBoundary() {
+		t.Error("paused between instructions")
+	}
+}
+
+func TestBreakOnInterrupts(t *testing.T) {
+	d, sym := newTestDebugger(t, debuggerProgram)
+	d.AddBreakpoint(sym["after"])
+
+	// An interrupt that isn't watched doesn't stop the execution.
+	d.cpu.SetNmiLine(true)
+
+	if reason := d.Continue(); reason != Breakpoint {
+		t.Fatalf("got %v, want %v", reason, Breakpoint)
+	}
+
+	d.cpu.SetNmiLine(false)
+	d.StepInto()
+	d.cpu.SetNmiLine(true)
+	d.BreakOnNmi = true
+
+	if reason := d.Continue(); reason != NmiTaken || d.cpu.Registers().PC != sym["nmi"] {
+		t.Errorf("got %v at $%04X, want the NMI handler", reason, d.cpu.Registers().PC)
+	}
+
+	// The IRQ is taken once the interrupts are enabled.
+	d.BreakOnIrq = true
+	d.cpu.SetIrqLine(true)
+
+	if reason := d.Continue(); reason != Breakpoint {
+		t.Fatalf("got %v with the interrupts disabled, want %v", reason, Breakpoint)
+	}
+
+	r := d.cpu.Registers()
+	r.P &^= 0x04
+	d.cpu.SetRegisters(r)
+
+	if reason := d.Continue(); reason != IrqTaken || d.cpu.Registers().PC != sym["irq"] {
+		t.Errorf("got %v at $%04X, want the IRQ handler", reason, d.cpu.Registers().PC)
+	}
+}
+
+func TestSetRegisters(t *testing.T) {
+	d, sym := newTestDebugger(t, debuggerProgram)
+
+	d.cpu.SetRegisters(cpu.Registers{A: 1, X: 2, Y: 0x7f, SP: 0xf0, PC: sym["leaf"], P: 0x24})
+
+	if reason := d.StepInto(); reason != Stepped {
+		t.Fatalf("got %v, want %v", reason, Stepped)
+	}
+
+	// INY runs from the registers set; it sets the negative flag.
+	want := cpu.Registers{A: 1, X: 2, Y: 0x80, SP: 0xf0, PC: sym["leaf"] + 1, P: 0xa4}
+	if r := d.cpu.Registers(); r != want {
+		t.Errorf("got %+v, want %+v", r, want)
+	}
+}
@@ -0,0 +1,567 @@
+// Package gdb serves the CPU over the GDB remote serial protocol, so GDB and
+// the front-ends built on it can attach to the emulator.
+//
+// The registers are numbered a, x, y, p, sp and pc; pc is 16 bits and the
+// others 8 bits. The layout is also served as a target description.
+package gdb
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pqkallio/nes-emulator/emulator/bus"
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/emulator/debugger"
+)
+
+const targetXml = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.nes-emulator.6502">
+    <reg name="a" bitsize="8" regnum="0" type="uint8"/>
+    <reg name="x" bitsize="8" regnum="1" type="uint8"/>
+    <reg name="y" bitsize="8" regnum="2" type="uint8"/>
+    <reg name="p" bitsize="8" regnum="3" type="uint8"/>
+    <reg name="sp" bitsize="8" regnum="4" type="uint8"/>
+    <reg name="pc" bitsize="16" regnum="5" type="code_ptr"/>
+  </feature>
+</target>
+`
+
+// maxMemoryRead is the largest memory read served in one packet.
+const maxMemoryRead = 0x800
+
+// Stop replies.
+const (
+	stoppedTrap      = "S05"
+	stoppedInterrupt = "S02"
+	errorReply       = "E01"
+)
+
+// Watchpoint types of the Z packets.
+const (
+	softwareBreakpoint = 0
+	hardwareBreakpoint = 1
+	writeWatchpoint    = 2
+	readWatchpoint     = 3
+	accessWatchpoint   = 4
+)
+
+type watchKey struct {
+	kind   int
+	addr   uint16
+	length int
+}
+
+// Server serves one client at a time.
+type Server struct {
+	dbg *debugger.Debugger
+	cpu *cpu.Cpu
+	bus *bus.Bus
+
+	// breakpoints are the breakpoints set by the client.
+	breakpoints map[uint16]bool
+	watchpoints map[watchKey]int
+	// watchHit is the stop reply of the watchpoint hit since the target was
+	// resumed, if any.
+	watchHit string
+	running  bool
+	lastStop string
+	noAck    bool
+}
+
+// NewServer returns a server for the debugger. The memory is read and
+// written through the bus, and the watchpoints are set on it.
+func NewServer(d *debugger.Debugger, c *cpu.Cpu, b *bus.Bus) *Server {
+	return &Server{
+		dbg:         d,
+		cpu:         c,
+		bus:         b,
+		breakpoints: map[uint16]bool{},
+		watchpoints: map[watchKey]int{},
+		lastStop:    stoppedTrap,
+	}
+}
+
+// ListenAndServe listens on the TCP address, e.g. localhost:2345, and serves
+// the clients one at a time. A client's error is logged and the next client
+// is accepted.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		err = s.Serve(conn)
+		conn.Close()
+
+		if err != nil {
+			log.Printf("gdb: %s: %v", conn.RemoteAddr(), err)
+		}
+	}
+}
+
+// Serve serves a client until it detaches, kills the target or closes the
+// connection. The breakpoints and watchpoints set by the client are removed
+// when it's done.
+func (s *Server) Serve(conn io.ReadWriter) error {
+	s.noAck = false
+
+	defer s.clearBreakpoints()
+
+	packets := make(chan packet)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+
+	defer close(done)
+
+	go func() {
+		r := bufio.NewReader(conn)
+
+		for {
+			p, err := readPacket(r)
+			if err != nil {
+				readErr <- err
+				close(packets)
+
+				return
+			}
+
+			select {
+			case packets <- p:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for p := range packets {
+		if p.interrupt {
+			continue
+		}
+
+		if !s.noAck {
+			ack := "+"
+			if !p.valid {
+				ack = "-"
+			}
+
+			if _, err := io.WriteString(conn, ack); err != nil {
+				return err
+			}
+
+			if !p.valid {
+				continue
+			}
+		}
+
+		var reply string
+
+		switch {
+		case strings.HasPrefix(p.data, "c"), strings.HasPrefix(p.data, "s"):
+			if err := s.setPc(p.data[1:]); err != nil {
+				reply = errorReply
+				break
+			}
+
+			reply = s.resume(p.data[0] == 's', packets)
+		case strings.HasPrefix(p.data, "D"):
+			return writePacket(conn, "OK")
+		case p.data == "k":
+			return nil
+		default:
+			reply = s.handle(p.data)
+		}
+
+		if err := writePacket(conn, reply); err != nil {
+			return err
+		}
+
+		if p.data == "QStartNoAckMode" {
+			s.noAck = true
+		}
+	}
+
+	if err := <-readErr; !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+// resume runs the target until it stops and returns the stop reply. An
+// interrupt from the client pauses the target.
+func (s *Server) resume(step bool, packets <-chan packet) string {
+	s.watchHit = ""
+	s.running = true
+
+	defer func() {
+		s.running = false
+	}()
+
+	stopped := make(chan debugger.StopReason, 1)
+
+	go func() {
+		if step {
+			stopped <- s.dbg.StepInto()
+		} else {
+			stopped <- s.dbg.Continue()
+		}
+	}()
+
+	for {
+		select {
+		case reason := <-stopped:
+			s.lastStop = s.stopReply(reason)
+			return s.lastStop
+		case p, ok := <-packets:
+			if !ok || p.interrupt {
+				s.dbg.Pause()
+			}
+
+			if !ok {
+				packets = nil
+			}
+		}
+	}
+}
+
+func (s *Server) stopReply(reason debugger.StopReason) string {
+	switch {
+	case s.watchHit != "":
+		return s.watchHit
+	case reason == debugger.Paused:
+		return stoppedInterrupt
+	default:
+		return stoppedTrap
+	}
+}
+
+// handle runs a command that doesn't resume the target and returns the
+// reply. An empty reply tells the client the command isn't supported.
+func (s *Server) handle(data string) string {
+	switch {
+	case data == "?":
+		return s.lastStop
+	case data == "g":
+		return s.readRegisters()
+	case strings.HasPrefix(data, "G"):
+		return s.writeRegisters(data[1:])
+	case strings.HasPrefix(data, "p"):
+		return s.readRegister(data[1:])
+	case strings.HasPrefix(data, "P"):
+		return s.writeRegister(data[1:])
+	case strings.HasPrefix(data, "m"):
+		return s.readMemory(data[1:])
+	case strings.HasPrefix(data, "M"):
+		return s.writeMemory(data[1:])
+	case strings.HasPrefix(data, "Z"):
+		return s.insertBreakpoint(data[1:])
+	case strings.HasPrefix(data, "z"):
+		return s.removeBreakpoint(data[1:])
+	case strings.HasPrefix(data, "H"):
+		return "OK"
+	case strings.HasPrefix(data, "qSupported"):
+		return fmt.Sprintf("PacketSize=%x;QStartNoAckMode+;qXfer:features:read+", 2*maxMemoryRead+16)
+	case data == "QStartNoAckMode":
+		return "OK"
+	case data == "qAttached":
+		return "1"
+	case strings.HasPrefix(data, "qXfer:features:read:target.xml:"):
+		return s.readTargetXml(strings.TrimPrefix(data, "qXfer:features:read:target.xml:"))
+	default:
+		return ""
+	}
+}
+
+func (s *Server) readRegisters() string {
+	r := s.cpu.Registers()
+	return fmt.Sprintf("%02x%02x%02x%02x%02x%02x%02x", r.A, r.X, r.Y, r.P, r.SP, uint8(r.PC), uint8(r.PC>>8))
+}
+
+func (s *Server) writeRegisters(data string) string {
+	b, err := hex.DecodeString(data)
+	if err != nil || len(b) != 7 {
+		return errorReply
+	}
+
+	s.cpu.SetRegisters(cpu.Registers{
+		A:  b[0],
+		X:  b[1],
+		Y:  b[2],
+		P:  b[3],
+		SP: b[4],
+		PC: uint16(b[5]) | uint16(b[6])<<8,
+	})
+
+	return "OK"
+}
+
+func (s *Server) readRegister(data string) string {
+	n, err := strconv.ParseUint(data, 16, 8)
+	if err != nil || n > 5 {
+		return errorReply
+	}
+
+	registers := s.readRegisters()
+	if n == 5 {
+		return registers[10:]
+	}
+
+	return registers[2*n : 2*n+2]
+}
+
+func (s *Server) writeRegister(data string) string {
+	n, value, ok := cut(data, "=")
+	if !ok {
+		return errorReply
+	}
+
+	i, err := strconv.ParseUint(n, 16, 8)
+	if err != nil || i > 5 {
+		return errorReply
+	}
+
+	registers := s.readRegisters()
+
+	width := 2
+	if i == 5 {
+		width = 4
+	}
+
+	if len(value) != width {
+		return errorReply
+	}
+
+	return s.writeRegisters(registers[:2*i] + value + registers[2*int(i)+width:])
+}
+
+// parseRange parses the addr,length of the memory and breakpoint packets.
+func parseRange(data string) (uint16, int, error) {
+	a, l, ok := cut(data, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range %q", data)
+	}
+
+	addr, err := strconv.ParseUint(a, 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	length, err := strconv.ParseUint(l, 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return uint16(addr), int(length), nil
+}
+
+func (s *Server) readMemory(data string) string {
+	addr, length, err := parseRange(data)
+	if err != nil || length > maxMemoryRead {
+		return errorReply
+	}
+
+	b := make([]uint8, length)
+	for i := range b {
+		b[i] = s.bus.Peek(addr + uint16(i))
+	}
+
+	return hex.EncodeToString(b)
+}
+
+func (s *Server) writeMemory(data string) string {
+	r, values, ok := cut(data, ":")
+	if !ok {
+		return errorReply
+	}
+
+	addr, length, err := parseRange(r)
+	if err != nil {
+		return errorReply
+	}
+
+	b, err := hex.DecodeString(values)
+	if err != nil || len(b) != length {
+		return errorReply
+	}
+
+	for i, value := range b {
+		s.bus.WriteData(addr+uint16(i), value)
+	}
+
+	return "OK"
+}
+
+// parseBreakpoint parses the type,addr,kind of the Z and z packets. The kind
+// of a watchpoint is the length of the watched range.
+func parseBreakpoint(data string) (watchKey, error) {
+	t, r, ok := cut(data, ",")
+	if !ok {
+		return watchKey{}, fmt.Errorf("invalid breakpoint %q", data)
+	}
+
+	kind, err := strconv.Atoi(t)
+	if err != nil {
+		return watchKey{}, err
+	}
+
+	// Drop the conditions and the commands of the breakpoint.
+	r, _, _ = cut(r, ";")
+
+	addr, length, err := parseRange(r)
+	if err != nil {
+		return watchKey{}, err
+	}
+
+	return watchKey{kind: kind, addr: addr, length: length}, nil
+}
+
+func (s *Server) insertBreakpoint(data string) string {
+	key, err := parseBreakpoint(data)
+	if err != nil {
+		return errorReply
+	}
+
+	var kind bus.AccessKind
+	var name string
+
+	switch key.kind {
+	case softwareBreakpoint, hardwareBreakpoint:
+		s.dbg.AddBreakpoint(key.addr)
+		s.breakpoints[key.addr] = true
+
+		return "OK"
+	case writeWatchpoint:
+		kind, name = bus.Write, "watch"
+	case readWatchpoint:
+		kind, name = bus.Read, "rwatch"
+	case accessWatchpoint:
+		kind, name = bus.Read|bus.Write, "awatch"
+	default:
+		return ""
+	}
+
+	if key.length < 1 || int(key.addr)+key.length > 0x10000 {
+		return errorReply
+	}
+
+	if _, ok := s.watchpoints[key]; ok {
+		return "OK"
+	}
+
+	s.watchpoints[key] = s.bus.AddWatchpoint(bus.Watchpoint{
+		Start: key.addr,
+		End:   key.addr + uint16(key.length-1),
+		Kind:  kind,
+		Callback: func(a bus.Access) {
+			// The memory written by the client doesn't trigger the
+			// watchpoints.
+			if s.running && s.watchHit == "" {
+				s.watchHit = fmt.Sprintf("T05%s:%x;", name, a.Addr)
+				s.dbg.Pause()
+			}
+		},
+	})
+
+	return "OK"
+}
+
+func (s *Server) removeBreakpoint(data string) string {
+	key, err := parseBreakpoint(data)
+	if err != nil {
+		return errorReply
+	}
+
+	switch key.kind {
+	case softwareBreakpoint, hardwareBreakpoint:
+		s.dbg.RemoveBreakpoint(key.addr)
+		delete(s.breakpoints, key.addr)
+
+		return "OK"
+	case writeWatchpoint, readWatchpoint, accessWatchpoint:
+		if id, ok := s.watchpoints[key]; ok {
+			s.bus.RemoveWatchpoint(id)
+			delete(s.watchpoints, key)
+		}
+
+		return "OK"
+	default:
+		return ""
+	}
+}
+
+// clearBreakpoints removes the breakpoints and watchpoints set by the
+// client.
+func (s *Server) clearBreakpoints() {
+	for addr := range s.breakpoints {
+		s.dbg.RemoveBreakpoint(addr)
+		delete(s.breakpoints, addr)
+	}
+
+	for key, id := range s.watchpoints {
+		s.bus.RemoveWatchpoint(id)
+		delete(s.watchpoints, key)
+	}
+}
+
+func (s *Server) readTargetXml(data string) string {
+	offset, length, err := parseRange(data)
+	if err != nil {
+		return errorReply
+	}
+
+	if offset >= uint16(len(targetXml)) {
+		return "l"
+	}
+
+	chunk := targetXml[offset:]
+	if len(chunk) <= length {
+		return "l" + chunk
+	}
+
+	return "m" + chunk[:length]
+}
+
+// setPc sets the program counter to the optional address of the c and s
+// packets.
+func (s *Server) setPc(addr string) error {
+	if addr == "" {
+		return nil
+	}
+
+	pc, err := strconv.ParseUint(addr, 16, 16)
+	if err != nil {
+		return err
+	}
+
+	r := s.cpu.Registers()
+	r.PC = uint16(pc)
+	s.cpu.SetRegisters(r)
+
+	return nil
+}
+
+// cut slices s around the first instance of sep.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
+}
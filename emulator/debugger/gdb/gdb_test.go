@@ -0,0 +1,204 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/emulator/bus"
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/emulator/debugger"
+	"github.com/pqkallio/nes-emulator/emulator/ram"
+)
+
+// testProgram is
+//
+//	$8000  LDA #$05
+//	$8002  STA $0200
+//	$8005  INX
+//	$8006  JMP $8005
+var testProgram = []uint8{0xa9, 0x05, 0x8d, 0x00, 0x02, 0xe8, 0x4c, 0x05, 0x80}
+
+// client is a scripted GDB client.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *client) send(data string) {
+	c.t.Helper()
+
+	if err := writePacket(c.conn, data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// reply reads the acknowledgement of the sent packet and the reply to it.
+func (c *client) reply() string {
+	c.t.Helper()
+
+	if ack, err := c.r.ReadByte(); err != nil || ack != '+' {
+		c.t.Fatalf("got ack %q, %v", ack, err)
+	}
+
+	p, err := readPacket(c.r)
+	if err != nil || !p.valid {
+		c.t.Fatalf("got packet %+v, %v", p, err)
+	}
+
+	if _, err := c.conn.Write([]byte("+")); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return p.data
+}
+
+func (c *client) exchange(data, want string) {
+	c.t.Helper()
+
+	c.send(data)
+
+	if got := c.reply(); got != want {
+		c.t.Errorf("%s: got %q, want %q", data, got, want)
+	}
+}
+
+// newTestServer returns a server of the test program and a client connected
+// to it. The result of Serve is sent to the channel.
+func newTestServer(t *testing.T) (*Server, *client, <-chan error) {
+	b := bus.NewBus()
+	prg := ram.NewRam(0x8000)
+	_ = b.Map(0x0000, 0x1fff, 0x07ff, ram.NewRam(0x800))
+	_ = b.Map(0x8000, 0xffff, 0x7fff, prg)
+
+	for i, data := range testProgram {
+		prg.Write(uint16(i), data)
+	}
+
+	prg.Write(0xfffc, 0x00)
+	prg.Write(0xfffd, 0x80)
+
+	c := cpu.NewCpu(b)
+	c.Reset()
+
+	server := NewServer(debugger.New(c, b, nil, nil), c, b)
+
+	serverConn, clientConn := net.Pipe()
+	served := make(chan error, 1)
+
+	go func() {
+		served <- server.Serve(serverConn)
+	}()
+
+	return server, &client{t: t, conn: clientConn, r: bufio.NewReader(clientConn)}, served
+}
+
+func TestServer(t *testing.T) {
+	_, cl, served := newTestServer(t)
+	clientConn := cl.conn
+
+	cl.send("qSupported:swbreak+")
+	if reply := cl.reply(); !strings.Contains(reply, "qXfer:features:read+") {
+		t.Errorf("qSupported: got %q", reply)
+	}
+
+	cl.exchange("?", "S05")
+	cl.exchange("g", "000000"+"24"+"fd"+"0080")
+	cl.exchange("p5", "0080")
+
+	cl.exchange("Z2,0200,1", "OK")
+	cl.exchange("c", "T05watch:200;")
+	cl.exchange("m0200,1", "05")
+	cl.exchange("z2,0200,1", "OK")
+
+	cl.exchange("Z0,8006,1", "OK")
+	cl.exchange("c", "S05")
+	cl.exchange("p5", "0680")
+	cl.exchange("z0,8006,1", "OK")
+
+	cl.exchange("s", "S05")
+	cl.exchange("p5", "0580")
+
+	cl.exchange("P1=ff", "OK")
+	cl.exchange("g", "05ff00"+"24"+"fd"+"0580")
+	cl.exchange("M0300,2:abcd", "OK")
+	cl.exchange("m0300,2", "abcd")
+
+	cl.send("c")
+	if _, err := clientConn.Write([]byte{interruptByte}); err != nil {
+		t.Fatal(err)
+	}
+
+	if reply := cl.reply(); reply != "S02" {
+		t.Errorf("c interrupted: got %q", reply)
+	}
+
+	cl.send("qXfer:features:read:target.xml:0,10")
+	if reply := cl.reply(); reply != fmt.Sprintf("m%s", targetXml[:0x10]) {
+		t.Errorf("qXfer: got %q", reply)
+	}
+
+	cl.send("k")
+	if _, err := cl.r.ReadByte(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-served; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServerClearsBreakpoints(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(cl *client)
+	}{
+		{"detach", func(cl *client) { cl.exchange("D", "OK") }},
+		{"kill", func(cl *client) {
+			cl.send("k")
+			if _, err := cl.r.ReadByte(); err != nil {
+				cl.t.Fatal(err)
+			}
+		}},
+		{"close", func(cl *client) { cl.conn.Close() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, cl, served := newTestServer(t)
+
+			cl.exchange("Z0,8006,1", "OK")
+			cl.exchange("Z1,8005,1", "OK")
+			cl.exchange("Z2,0200,1", "OK")
+			cl.exchange("Z4,0300,2", "OK")
+
+			ids := []int{}
+			for _, id := range server.watchpoints {
+				ids = append(ids, id)
+			}
+
+			tt.end(cl)
+
+			if err := <-served; err != nil {
+				t.Fatal(err)
+			}
+
+			if got := server.dbg.Breakpoints(); len(got) != 0 {
+				t.Errorf("got breakpoints %x", got)
+			}
+
+			if len(server.watchpoints) != 0 {
+				t.Errorf("got watchpoints %v", server.watchpoints)
+			}
+
+			for _, id := range ids {
+				if server.bus.RemoveWatchpoint(id) {
+					t.Errorf("watchpoint %d left on the bus", id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// interruptByte is sent by the client outside of a packet to stop a running
+// target.
+const interruptByte = 0x03
+
+// packet is a packet of the remote serial protocol, $data#cs, or an
+// interrupt sent outside of a packet.
+type packet struct {
+	data      string
+	valid     bool
+	interrupt bool
+}
+
+// readPacket reads the next packet. The acknowledgements of our packets are
+// skipped.
+func readPacket(r *bufio.Reader) (packet, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+
+		switch b {
+		case interruptByte:
+			return packet{interrupt: true}, nil
+		case '$':
+		default:
+			continue
+		}
+
+		data, err := r.ReadString('#')
+		if err != nil {
+			return packet{}, err
+		}
+
+		data = data[:len(data)-1]
+
+		var cs [2]byte
+		if _, err := io.ReadFull(r, cs[:]); err != nil {
+			return packet{}, err
+		}
+
+		sum, err := strconv.ParseUint(string(cs[:]), 16, 8)
+
+		return packet{data: data, valid: err == nil && uint8(sum) == checksum(data)}, nil
+	}
+}
+
+func writePacket(w io.Writer, data string) error {
+	_, err := fmt.Fprintf(w, "$%s#%02x", data, checksum(data))
+	return err
+}
+
+func checksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+
+	return sum
+}
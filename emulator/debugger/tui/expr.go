@@ -0,0 +1,176 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/emulator/debugger"
+)
+
+// evaluator evaluates the expressions of the commands and the watches. The
+// operands are numbers ($C000, %1010, 0xC000 or decimal), the registers a, x,
+// y, sp, pc and p, [expr] for the byte at an address and {expr} for the
+// little-endian word at an address. They are combined with + and -.
+type evaluator struct {
+	regs cpu.Registers
+	mem  debugger.Memory
+
+	src string
+	pos int
+}
+
+func evaluate(src string, regs cpu.Registers, mem debugger.Memory) (int, error) {
+	e := &evaluator{regs: regs, mem: mem, src: src}
+
+	value, err := e.sum()
+	if err != nil {
+		return 0, err
+	}
+
+	if e.skipSpace(); e.pos != len(e.src) {
+		return 0, fmt.Errorf("unexpected %q in %q", e.src[e.pos:], src)
+	}
+
+	return value, nil
+}
+
+func (e *evaluator) skipSpace() {
+	for e.pos < len(e.src) && e.src[e.pos] == ' ' {
+		e.pos++
+	}
+}
+
+func (e *evaluator) peek() byte {
+	e.skipSpace()
+
+	if e.pos == len(e.src) {
+		return 0
+	}
+
+	return e.src[e.pos]
+}
+
+func (e *evaluator) sum() (int, error) {
+	value, err := e.unary()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		switch e.peek() {
+		case '+', '-':
+			op := e.src[e.pos]
+			e.pos++
+
+			operand, err := e.unary()
+			if err != nil {
+				return 0, err
+			}
+
+			if op == '+' {
+				value += operand
+			} else {
+				value -= operand
+			}
+		default:
+			return value, nil
+		}
+	}
+}
+
+func (e *evaluator) unary() (int, error) {
+	if e.peek() == '-' {
+		e.pos++
+
+		value, err := e.unary()
+
+		return -value, err
+	}
+
+	return e.primary()
+}
+
+func (e *evaluator) primary() (int, error) {
+	switch c := e.peek(); c {
+	case '(', '[', '{':
+		e.pos++
+
+		value, err := e.sum()
+		if err != nil {
+			return 0, err
+		}
+
+		closing := map[byte]byte{'(': ')', '[': ']', '{': '}'}[c]
+		if e.peek() != closing {
+			return 0, fmt.Errorf("missing %q in %q", closing, e.src)
+		}
+
+		e.pos++
+
+		addr := uint16(value)
+
+		switch c {
+		case '[':
+			return int(e.mem.Peek(addr)), nil
+		case '{':
+			return int(e.mem.Peek(addr)) | int(e.mem.Peek(addr+1))<<8, nil
+		default:
+			return value, nil
+		}
+	case 0:
+		return 0, fmt.Errorf("missing operand in %q", e.src)
+	}
+
+	start := e.pos
+	for e.pos < len(e.src) && (e.src[e.pos] == '$' || e.src[e.pos] == '%' || isWordChar(rune(e.src[e.pos]))) {
+		e.pos++
+	}
+
+	word := strings.ToLower(e.src[start:e.pos])
+
+	switch word {
+	case "":
+		return 0, fmt.Errorf("unexpected %q in %q", e.src[e.pos:], e.src)
+	case "a":
+		return int(e.regs.A), nil
+	case "x":
+		return int(e.regs.X), nil
+	case "y":
+		return int(e.regs.Y), nil
+	case "sp":
+		return int(e.regs.SP), nil
+	case "pc":
+		return int(e.regs.PC), nil
+	case "p":
+		return int(e.regs.P), nil
+	}
+
+	return parseNumber(word)
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func parseNumber(word string) (int, error) {
+	base := 10
+
+	switch {
+	case strings.HasPrefix(word, "$"):
+		word, base = word[1:], 16
+	case strings.HasPrefix(word, "0x"):
+		word, base = word[2:], 16
+	case strings.HasPrefix(word, "%"):
+		word, base = word[1:], 2
+	}
+
+	value, err := strconv.ParseInt(word, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", word)
+	}
+
+	return int(value), nil
+}
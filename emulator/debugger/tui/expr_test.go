@@ -0,0 +1,68 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+)
+
+// testMemory is a flat 64 KiB address space.
+type testMemory [0x10000]uint8
+
+func (m *testMemory) ReadData(addr uint16) uint8 {
+	return m[addr]
+}
+
+func (m *testMemory) WriteData(addr uint16, data uint8) {
+	m[addr] = data
+}
+
+func (m *testMemory) Peek(addr uint16) uint8 {
+	return m[addr]
+}
+
+func TestEvaluate(t *testing.T) {
+	mem := &testMemory{}
+	mem[0x0300] = 0x34
+	mem[0x0301] = 0x12
+	mem[0x0302] = 0x56
+	mem[0x0010] = 0x01
+
+	regs := cpu.Registers{A: 0x80, X: 2, Y: 3, SP: 0xfd, PC: 0xc000, P: 0x24}
+
+	tests := []struct {
+		expr string
+		want int
+	}{
+		{"$C000", 0xc000},
+		{"0xc000", 0xc000},
+		{"%1010", 10},
+		{"42", 42},
+		{"a", 0x80},
+		{"X", 2},
+		{"y", 3},
+		{"sp", 0xfd},
+		{"PC", 0xc000},
+		{"p", 0x24},
+		{"[$0300]", 0x34},
+		{"{$0300}", 0x1234},
+		{"[$0300 + x]", 0x56},
+		{"pc + 3 - 1", 0xc002},
+		{"-1", -1},
+		{"a - -(x + 1)", 0x83},
+		{" {$02ff + 1} + [$10] ", 0x1235},
+	}
+
+	for _, test := range tests {
+		got, err := evaluate(test.expr, regs, mem)
+		if err != nil || got != test.want {
+			t.Errorf("%q: got %d, %v, want %d", test.expr, got, err, test.want)
+		}
+	}
+
+	for _, expr := range []string{"", "$", "1 +", "[1", "{1]", "$zz", "%102", "1 2", "q", "a * 2"} {
+		if got, err := evaluate(expr, regs, mem); err == nil {
+			t.Errorf("%q: got %d, want an error", expr, got)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu/disasm"
+)
+
+const (
+	enterAltScreen = "\x1b[?1049h"
+	leaveAltScreen = "\x1b[?1049l"
+	clearScreen    = "\x1b[H\x1b[2J"
+	reverseVideo   = "\x1b[7m"
+	resetVideo     = "\x1b[0m"
+)
+
+const (
+	screenWidth   = 80
+	minHeight     = 24
+	leftWidth     = 46
+	stackWidth    = 12
+	hexRows       = 8
+	stackBase     = 0x0100
+	registersRows = 4
+	// fixedRows is the number of rows besides the disassembly: the title, the
+	// separators, the hex view, the message and the prompt.
+	fixedRows = 1 + 1 + hexRows + 1 + 1 + 1
+)
+
+// draw draws the whole screen:
+//
+//	title
+//	disassembly    | registers
+//	               | stack      watches
+//	---------------------------------------
+//	hex view
+//	---------------------------------------
+//	message
+//	> prompt
+func (u *UI) draw(out io.Writer) error {
+	height := u.Height
+	if height < minHeight {
+		height = minHeight
+	}
+
+	topRows := height - fixedRows
+
+	var sb strings.Builder
+
+	sb.WriteString(clearScreen)
+	sb.WriteString(reverseVideo + pad(" NES debugger", screenWidth) + resetVideo + "\n")
+
+	left := u.disassembly(topRows)
+	right := u.sidePanel(topRows)
+
+	for i := 0; i < topRows; i++ {
+		sb.WriteString(strings.TrimRight(pad(left[i], leftWidth)+"| "+right[i], " ") + "\n")
+	}
+
+	sb.WriteString(strings.Repeat("-", screenWidth) + "\n")
+
+	for _, line := range u.hexView() {
+		sb.WriteString(line + "\n")
+	}
+
+	sb.WriteString(strings.Repeat("-", screenWidth) + "\n")
+	sb.WriteString(truncate(u.message, screenWidth) + "\n")
+	sb.WriteString("> ")
+
+	_, err := io.WriteString(out, sb.String())
+
+	return err
+}
+
+// disassembly returns the lines of the disassembly around the program
+// counter. The current instruction is marked with > and the breakpoints with
+// *.
+func (u *UI) disassembly(rows int) []string {
+	pc := u.cpu.Registers().PC
+	mem := u.mem
+
+	breakpoints := map[uint16]bool{}
+	for _, addr := range u.dbg.Breakpoints() {
+		breakpoints[addr] = true
+	}
+
+	var lines []string
+
+	for addr := disasm.Backtrack(mem, pc, rows/3); len(lines) < rows; {
+		if u.Labels != nil {
+			if label, ok := u.Labels.Label(addr); ok {
+				lines = append(lines, truncate(fmt.Sprintf("        %s:", label), leftWidth))
+				if len(lines) == rows {
+					break
+				}
+			}
+		}
+
+		instruction := disasm.Decode(mem, addr)
+
+		marker := "  "
+		switch {
+		case addr == pc:
+			marker = "> "
+		case breakpoints[addr]:
+			marker = "* "
+		}
+
+		var bytes []string
+		for _, b := range instruction.Bytes {
+			bytes = append(bytes, fmt.Sprintf("%02X", b))
+		}
+
+		line := fmt.Sprintf("%s%04X  %-8s  %s", marker, addr, strings.Join(bytes, " "), instruction.Format(u.Labels))
+		lines = append(lines, truncate(line, leftWidth))
+		addr += uint16(instruction.Length())
+	}
+
+	return lines
+}
+
+// sidePanel returns the lines of the registers, the stack and the watches.
+func (u *UI) sidePanel(rows int) []string {
+	regs := u.cpu.Registers()
+
+	lines := make([]string, rows)
+	lines[0] = fmt.Sprintf("PC:%04X  A:%02X  X:%02X  Y:%02X", regs.PC, regs.A, regs.X, regs.Y)
+	lines[1] = fmt.Sprintf("SP:%02X    P:%02X  %s", regs.SP, regs.P, flags(regs.P))
+
+	lines[2] = fmt.Sprintf("CYC:%d", u.cpu.Cycles())
+	if u.ppu != nil {
+		lines[2] += fmt.Sprintf("  PPU:%3d,%3d", u.ppu.Scanline(), u.ppu.Dot())
+	}
+
+	lines[registersRows] = pad("Stack", stackWidth) + "Watches"
+
+	for i := 0; registersRows+1+i < rows; i++ {
+		var stack, watch string
+
+		if sp := int(regs.SP) + 1 + i; sp <= 0xff {
+			addr := uint16(stackBase + sp)
+			stack = fmt.Sprintf("%04X: %02X", addr, u.mem.Peek(addr))
+		}
+
+		if i < len(u.watches) {
+			watch = fmt.Sprintf("%d: %s = ", i+1, u.watches[i])
+
+			if value, err := u.evaluate(u.watches[i]); err != nil {
+				watch += err.Error()
+			} else {
+				watch += fmt.Sprintf("$%02X (%d)", value, value)
+			}
+		}
+
+		lines[registersRows+1+i] = pad(stack, stackWidth) + watch
+	}
+
+	for i := range lines {
+		lines[i] = truncate(lines[i], screenWidth-leftWidth-2)
+	}
+
+	return lines
+}
+
+// flags returns the status flags as NV-BDIZC, a set flag in upper case.
+func flags(p uint8) string {
+	const names = "nv-bdizc"
+
+	var sb strings.Builder
+
+	for i, name := range names {
+		if p&(0x80>>i) != 0 {
+			sb.WriteString(strings.ToUpper(string(name)))
+		} else {
+			sb.WriteRune(name)
+		}
+	}
+
+	return sb.String()
+}
+
+// hexView returns the lines of the hex view of the memory.
+func (u *UI) hexView() []string {
+	lines := make([]string, hexRows)
+
+	for row := range lines {
+		addr := u.memAddr + uint16(row*16)
+
+		var hex, text strings.Builder
+
+		for i := uint16(0); i < 16; i++ {
+			b := u.mem.Peek(addr + i)
+			fmt.Fprintf(&hex, " %02X", b)
+
+			if b >= 0x20 && b < 0x7f {
+				text.WriteByte(b)
+			} else {
+				text.WriteByte('.')
+			}
+		}
+
+		lines[row] = fmt.Sprintf("%04X %s  %s", addr, hex.String(), text.String())
+	}
+
+	return lines
+}
+
+func pad(s string, width int) string {
+	s = truncate(s, width)
+	return s + strings.Repeat(" ", width-len(s))
+}
+
+func truncate(s string, width int) string {
+	if len(s) > width {
+		return s[:width]
+	}
+
+	return s
+}
@@ -0,0 +1,252 @@
+// Package tui is a full-screen terminal interface for the debugger. It only
+// uses ANSI escape sequences and reads whole lines from the terminal, so it
+// works over SSH without putting the terminal in raw mode.
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/emulator/debugger"
+)
+
+const helpText = "b/d addr: add/delete breakpoint  s: step  n: next  o: out  c: continue  " +
+	"m addr: memory  w expr, wd n: watch  r reg value  cycle n  line n  nmi  irq  bt  wrap  mis  q"
+
+// UI is the terminal debugger. Every command runs the debugger, or changes
+// the view, and redraws the screen.
+type UI struct {
+	dbg *debugger.Debugger
+	cpu *cpu.Cpu
+	mem debugger.Memory
+	ppu cpu.PpuPosition
+
+	// Height is the number of rows of the terminal, at least 24.
+	Height int
+	// Labels, if set, label the disassembly.
+	Labels cpu.Labels
+
+	memAddr     uint16
+	watches     []string
+	message     string
+	lastCommand string
+}
+
+// New returns a UI for the debugger. The PPU may be nil.
+func New(d *debugger.Debugger, c *cpu.Cpu, mem debugger.Memory, ppu cpu.PpuPosition) *UI {
+	return &UI{dbg: d, cpu: c, mem: mem, ppu: ppu, Height: 24, message: helpText}
+}
+
+// Run reads commands from in and draws the screen to out until the q command
+// or the end of the input. An empty line repeats the previous command.
+//
+// Continue runs until a breakpoint is hit; call Pause of the debugger, e.g.
+// on SIGINT, to stop it.
+func (u *UI) Run(in io.Reader, out io.Writer) error {
+	if _, err := io.WriteString(out, enterAltScreen); err != nil {
+		return err
+	}
+
+	defer io.WriteString(out, leaveAltScreen)
+
+	scanner := bufio.NewScanner(in)
+
+	for {
+		if err := u.draw(out); err != nil {
+			return err
+		}
+
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = u.lastCommand
+		}
+
+		u.lastCommand = line
+
+		if line == "q" {
+			return nil
+		}
+
+		u.message = u.execute(line, out)
+	}
+}
+
+// execute runs the command and returns the message to show.
+func (u *UI) execute(line string, out io.Writer) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return helpText
+	}
+
+	cmd, args := fields[0], strings.Join(fields[1:], " ")
+
+	switch cmd {
+	case "s":
+		return u.stopped(u.dbg.StepInto())
+	case "n":
+		return u.stopped(u.dbg.StepOver())
+	case "o":
+		return u.stopped(u.dbg.StepOut())
+	case "c":
+		u.message = "running, interrupt to pause"
+		_ = u.draw(out)
+
+		return u.stopped(u.dbg.Continue())
+	case "nmi":
+		u.dbg.BreakOnNmi = !u.dbg.BreakOnNmi
+		return fmt.Sprintf("break on NMI: %t", u.dbg.BreakOnNmi)
+	case "irq":
+		u.dbg.BreakOnIrq = !u.dbg.BreakOnIrq
+		return fmt.Sprintf("break on IRQ: %t", u.dbg.BreakOnIrq)
+	case "wrap":
+		u.dbg.BreakOnStackWrap = !u.dbg.BreakOnStackWrap
+		return fmt.Sprintf("break on stack wrap: %t", u.dbg.BreakOnStackWrap)
+	case "mis":
+		u.dbg.BreakOnMismatch = !u.dbg.BreakOnMismatch
+		return fmt.Sprintf("break on mismatched return: %t", u.dbg.BreakOnMismatch)
+	case "bt":
+		return u.backtrace()
+	case "w":
+		if _, err := u.evaluate(args); err != nil {
+			return err.Error()
+		}
+
+		u.watches = append(u.watches, args)
+
+		return fmt.Sprintf("watch %d: %s", len(u.watches), args)
+	case "r":
+		return u.setRegister(fields[1:])
+	case "h", "help":
+		return helpText
+	case "b", "d", "m", "wd", "cycle", "line":
+	default:
+		return fmt.Sprintf("unknown command %q; %s", cmd, helpText)
+	}
+
+	value, err := u.evaluate(args)
+	if err != nil {
+		return err.Error()
+	}
+
+	addr := uint16(value)
+
+	switch cmd {
+	case "b":
+		u.dbg.AddBreakpoint(addr)
+		return fmt.Sprintf("breakpoint at $%04X", addr)
+	case "d":
+		if !u.dbg.RemoveBreakpoint(addr) {
+			return fmt.Sprintf("no breakpoint at $%04X", addr)
+		}
+
+		return fmt.Sprintf("deleted breakpoint at $%04X", addr)
+	case "m":
+		u.memAddr = addr
+		return fmt.Sprintf("memory at $%04X", addr)
+	case "wd":
+		if value < 1 || value > len(u.watches) {
+			return fmt.Sprintf("no watch %d", value)
+		}
+
+		u.watches = append(u.watches[:value-1], u.watches[value:]...)
+
+		return fmt.Sprintf("deleted watch %d", value)
+	case "cycle":
+		return u.stopped(u.dbg.RunToCycle(uint64(value)))
+	default: // line
+		reason, err := u.dbg.RunToScanline(value)
+		if err != nil {
+			return err.Error()
+		}
+
+		return u.stopped(reason)
+	}
+}
+
+func (u *UI) evaluate(expr string) (int, error) {
+	if expr == "" {
+		return 0, fmt.Errorf("missing argument")
+	}
+
+	return evaluate(expr, u.cpu.Registers(), u.mem)
+}
+
+func (u *UI) stopped(reason debugger.StopReason) string {
+	if reason == debugger.MismatchedReturn {
+		mismatches := u.dbg.Mismatches()
+		return mismatches[len(mismatches)-1].String()
+	}
+
+	return fmt.Sprintf("%s at $%04X", reason, u.cpu.Registers().PC)
+}
+
+// backtrace returns the call stack on a line, the outermost routine first.
+func (u *UI) backtrace() string {
+	frames := u.dbg.CallStack()
+	if len(frames) == 0 {
+		return "no calls on the call stack"
+	}
+
+	names := make([]string, len(frames))
+
+	for i, f := range frames {
+		names[i] = u.name(f.Entry)
+		if f.Interrupt != cpu.NoInterrupt {
+			names[i] = f.Interrupt.String() + " " + names[i]
+		}
+	}
+
+	return strings.Join(names, " > ")
+}
+
+// name returns the label of the address, or the address.
+func (u *UI) name(addr uint16) string {
+	if u.Labels != nil {
+		if label, ok := u.Labels.Label(addr); ok {
+			return label
+		}
+	}
+
+	return fmt.Sprintf("$%04X", addr)
+}
+
+func (u *UI) setRegister(args []string) string {
+	if len(args) < 2 {
+		return "usage: r a|x|y|sp|pc|p value"
+	}
+
+	value, err := u.evaluate(strings.Join(args[1:], " "))
+	if err != nil {
+		return err.Error()
+	}
+
+	regs := u.cpu.Registers()
+
+	switch strings.ToLower(args[0]) {
+	case "a":
+		regs.A = uint8(value)
+	case "x":
+		regs.X = uint8(value)
+	case "y":
+		regs.Y = uint8(value)
+	case "sp":
+		regs.SP = uint8(value)
+	case "pc":
+		regs.PC = uint16(value)
+	case "p":
+		regs.P = uint8(value)
+	default:
+		return fmt.Sprintf("unknown register %q", args[0])
+	}
+
+	u.cpu.SetRegisters(regs)
+
+	return fmt.Sprintf("%s = $%X", strings.ToUpper(args[0]), value)
+}
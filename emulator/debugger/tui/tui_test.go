@@ -0,0 +1,101 @@
+package tui
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/emulator/debugger"
+)
+
+// newTestUI returns a UI of a CPU running NOPs from $8000.
+func newTestUI(t *testing.T) (*UI, *debugger.Debugger, *cpu.Cpu) {
+	t.Helper()
+
+	mem := &testMemory{}
+	for addr := 0x8000; addr < 0xfffa; addr++ {
+		mem[addr] = 0xea
+	}
+
+	mem[0xfffd] = 0x80
+
+	c := cpu.NewCpu(mem)
+	c.Reset()
+
+	d := debugger.New(c, mem, nil, nil)
+	d.StepInto()
+
+	if pc := c.Registers().PC; pc != 0x8000 {
+		t.Fatalf("got PC $%04X after the reset, want $8000", pc)
+	}
+
+	return New(d, c, mem, nil), d, c
+}
+
+func TestRun(t *testing.T) {
+	u, d, c := newTestUI(t)
+
+	// The empty line repeats the step.
+	in := strings.NewReader("b $C000\nm $0300\nr a 10\ns\n\nq\ns\n")
+
+	var out bytes.Buffer
+	if err := u.Run(in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := d.Breakpoints(); !reflect.DeepEqual(got, []uint16{0xc000}) {
+		t.Errorf("got breakpoints %x, want [c000]", got)
+	}
+
+	if u.memAddr != 0x0300 {
+		t.Errorf("got the memory at $%04X, want $0300", u.memAddr)
+	}
+
+	// The commands after q aren't run.
+	if r := c.Registers(); r.A != 10 || r.PC != 0x8002 {
+		t.Errorf("got A %d and PC $%04X, want 10 and $8002", r.A, r.PC)
+	}
+
+	screen := out.String()
+
+	for _, want := range []string{enterAltScreen, "breakpoint at $C000", "\n0300  00 00", "A = $A", "stepped at $8002", leaveAltScreen} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("no %q on the screen", want)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	u, d, _ := newTestUI(t)
+
+	tests := []struct {
+		line, want string
+	}{
+		{"b", "missing argument"},
+		{"b $zz", `invalid number "zz"`},
+		{"d $C000", "no breakpoint at $C000"},
+		{"b pc + 2", "breakpoint at $8002"},
+		{"c", "breakpoint at $8002"},
+		{"d $8002", "deleted breakpoint at $8002"},
+		{"r a", "usage: r a|x|y|sp|pc|p value"},
+		{"r q 1", `unknown register "q"`},
+		{"r pc $8010", "PC = $8010"},
+		{"w [$0300]", "watch 1: [$0300]"},
+		{"wd 2", "no watch 2"},
+		{"wd 1", "deleted watch 1"},
+		{"nmi", "break on NMI: true"},
+		{"jump", `unknown command "jump"; ` + helpText},
+	}
+
+	for _, test := range tests {
+		if got := u.execute(test.line, &bytes.Buffer{}); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.line, got, test.want)
+		}
+	}
+
+	if !d.BreakOnNmi || len(u.watches) != 0 {
+		t.Errorf("got break on NMI %t and %d watches", d.BreakOnNmi, len(u.watches))
+	}
+}
@@ -0,0 +1,234 @@
+package input
+
+import (
+	"io"
+
+	"github.com/pqkallio/nes-emulator/wav"
+)
+
+const (
+	// cpuFrequency is the clock rate of the CPU in Hz.
+	cpuFrequency = 1789773
+	// tapeLevel is the amplitude of the signal recorded to the tape.
+	tapeLevel = 0.5
+	// tapeBufferSize is the number of samples buffered before they are
+	// written to the tape.
+	tapeBufferSize = 4096
+)
+
+// Clock counts the CPU cycles. *console.Console and *cpu.Cpu implement it.
+// The count may go down, as the CPU's does on a reset; that is taken as the
+// clock restarting from zero.
+type Clock interface {
+	Cycles() uint64
+}
+
+// DataRecorder is the Famicom Data Recorder, the cassette deck plugged into
+// the Family BASIC keyboard, with WAV files as tapes. It records the level
+// the program writes to OUT2 of $4016 and plays back on D1 of $4016.
+type DataRecorder struct {
+	clock Clock
+	// last is the clock's count when it was last read, and cycles the
+	// number of cycles since the tape was started.
+	last   uint64
+	cycles uint64
+
+	// tape holds the samples played back, sampled at tapeRate.
+	tape     []float32
+	tapeRate int
+	playing  bool
+
+	writer    *wav.Writer
+	rate      int
+	recording bool
+	level     bool
+	// written is the number of samples recorded, including the buffered.
+	written uint64
+	buf     []float32
+}
+
+// NewDataRecorder returns a data recorder with no tape playing, timed by
+// the clock.
+func NewDataRecorder(clock Clock) *DataRecorder {
+	return &DataRecorder{clock: clock}
+}
+
+// Play plays the tape back from the start, a WAV file read from r. The
+// first channel of the file is played. What is playing or recording is
+// stopped first.
+func (d *DataRecorder) Play(r io.Reader) error {
+	if err := d.Stop(); err != nil {
+		return err
+	}
+
+	wr, err := wav.NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	var tape []float32
+
+	frame := make([]float32, wr.Channels())
+
+	for {
+		n, err := wr.ReadSamples(frame)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if n < len(frame) {
+			break
+		}
+
+		tape = append(tape, frame[0])
+	}
+
+	d.tape = tape
+	d.tapeRate = wr.Rate()
+	d.startTape()
+	d.playing = true
+
+	return nil
+}
+
+// Record records to a tape, a mono WAV file of the sample rate written to
+// w. What is playing or recording is stopped first. Stop finishes the file.
+func (d *DataRecorder) Record(w io.WriteSeeker, rate int) error {
+	if err := d.Stop(); err != nil {
+		return err
+	}
+
+	ww, err := wav.NewWriter(w, rate, 1)
+	if err != nil {
+		return err
+	}
+
+	d.writer = ww
+	d.rate = rate
+	d.startTape()
+	d.written = 0
+	d.buf = d.buf[:0]
+	d.recording = true
+
+	return nil
+}
+
+// Stop stops playing or recording. A recording is written up to the current
+// cycle and its WAV file finished; the first error writing it is returned.
+func (d *DataRecorder) Stop() error {
+	d.playing = false
+	d.tape = nil
+
+	if !d.recording {
+		return nil
+	}
+
+	err := d.catchUp()
+	if flushErr := d.flush(); err == nil {
+		err = flushErr
+	}
+
+	if closeErr := d.writer.Close(); err == nil {
+		err = closeErr
+	}
+
+	d.writer = nil
+	d.recording = false
+
+	return err
+}
+
+// Playing returns whether a tape is playing. It stops at the end of the
+// tape.
+func (d *DataRecorder) Playing() bool {
+	return d.playing && d.position(d.tapeRate) < uint64(len(d.tape))
+}
+
+// Recording returns whether the data recorder is recording.
+func (d *DataRecorder) Recording() bool {
+	return d.recording
+}
+
+func (d *DataRecorder) startTape() {
+	d.last = d.clock.Cycles()
+	d.cycles = 0
+}
+
+// elapsed returns the number of cycles since the tape was started.
+func (d *DataRecorder) elapsed() uint64 {
+	now := d.clock.Cycles()
+
+	if now >= d.last {
+		d.cycles += now - d.last
+	} else {
+		d.cycles += now
+	}
+
+	d.last = now
+
+	return d.cycles
+}
+
+// position returns the sample of the tape of the sample rate at the current
+// cycle.
+func (d *DataRecorder) position(rate int) uint64 {
+	return d.elapsed() * uint64(rate) / cpuFrequency
+}
+
+// write sets the level of the signal recorded. The previous level is
+// recorded up to the write on every write, so a reset in between loses at
+// most the cycles since the last.
+func (d *DataRecorder) write(level bool) {
+	if d.recording {
+		// A write error is returned by Stop.
+		_ = d.catchUp()
+	}
+
+	d.level = level
+}
+
+// catchUp records the current level up to the current cycle.
+func (d *DataRecorder) catchUp() error {
+	sample := float32(-tapeLevel)
+	if d.level {
+		sample = tapeLevel
+	}
+
+	for end := d.position(d.rate); d.written < end; d.written++ {
+		d.buf = append(d.buf, sample)
+
+		if len(d.buf) == tapeBufferSize {
+			if err := d.flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *DataRecorder) flush() error {
+	if len(d.buf) == 0 {
+		return nil
+	}
+
+	err := d.writer.WriteSamples(d.buf)
+	d.buf = d.buf[:0]
+
+	return err
+}
+
+// read returns the level of the signal played back, low when no tape is
+// playing.
+func (d *DataRecorder) read() bool {
+	if !d.playing {
+		return false
+	}
+
+	i := d.position(d.tapeRate)
+	if i >= uint64(len(d.tape)) {
+		return false
+	}
+
+	return d.tape[i] > 0
+}
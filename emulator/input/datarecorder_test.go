@@ -0,0 +1,259 @@
+package input
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/wav"
+)
+
+const testTapeRate = 44100
+
+// testClock is a clock advanced by the tests.
+type testClock struct {
+	cycles uint64
+}
+
+func (c *testClock) Cycles() uint64 {
+	return c.cycles
+}
+
+func createTape(t *testing.T) *os.File {
+	t.Helper()
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "tape.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { f.Close() })
+
+	return f
+}
+
+// readTape returns the samples of the tape.
+func readTape(t *testing.T, f *os.File) []float32 {
+	t.Helper()
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := wav.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Rate() != testTapeRate || r.Channels() != 1 {
+		t.Fatalf("got %d Hz, %d channels, want %d Hz mono", r.Rate(), r.Channels(), testTapeRate)
+	}
+
+	var samples []float32
+
+	buf := make([]float32, 1024)
+
+	for {
+		n, err := r.ReadSamples(buf)
+		samples = append(samples, buf[:n]...)
+
+		if err == io.EOF {
+			return samples
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// record records the levels, each held for the cycles, and stops the
+// recording cycles after the last.
+func record(t *testing.T, d *DataRecorder, clock *testClock, levels []bool, cycles uint64) {
+	t.Helper()
+
+	for _, level := range levels {
+		d.write(level)
+		clock.cycles += cycles
+	}
+
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDataRecorderRecordsUpToStop(t *testing.T) {
+	clock := &testClock{cycles: 12345}
+	d := NewDataRecorder(clock)
+	f := createTape(t)
+
+	if err := d.Record(f, testTapeRate); err != nil {
+		t.Fatal(err)
+	}
+
+	d.write(true)
+	clock.cycles += cpuFrequency / 2
+	d.write(false)
+	// The level is held until the recording is stopped, 2 s after the start.
+	clock.cycles += 2*cpuFrequency - cpuFrequency/2
+
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Recording() {
+		t.Error("still recording after Stop")
+	}
+
+	samples := readTape(t, f)
+
+	if got, want := len(samples), 2*testTapeRate; got != want {
+		t.Fatalf("got %d samples, want %d", got, want)
+	}
+
+	for i, want := range []struct {
+		sample int
+		high   bool
+	}{
+		{0, true},
+		{testTapeRate/2 - 2, true},
+		{testTapeRate/2 + 1, false},
+		{2*testTapeRate - 1, false},
+	} {
+		if got := samples[want.sample] > 0; got != want.high {
+			t.Errorf("%d: sample %d is %v, want high %v", i, want.sample, samples[want.sample], want.high)
+		}
+	}
+}
+
+func TestDataRecorderPlaysBackRecording(t *testing.T) {
+	clock := &testClock{}
+	d := NewDataRecorder(clock)
+	f := createTape(t)
+
+	if err := d.Record(f, testTapeRate); err != nil {
+		t.Fatal(err)
+	}
+
+	// A square wave of 1 kHz.
+	levels := make([]bool, 20)
+	for i := range levels {
+		levels[i] = i%2 == 0
+	}
+
+	const halfPeriod = cpuFrequency / 2000
+
+	record(t, d, clock, levels, halfPeriod)
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Play(f); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range levels {
+		// The middle of the half period.
+		clock.cycles += halfPeriod / 2
+
+		if !d.Playing() {
+			t.Fatalf("%d: the tape stopped", i)
+		}
+
+		if got := d.read(); got != want {
+			t.Errorf("%d: got %v, want %v", i, got, want)
+		}
+
+		clock.cycles += halfPeriod - halfPeriod/2
+	}
+
+	clock.cycles += halfPeriod
+
+	if d.Playing() {
+		t.Error("playing past the end of the tape")
+	}
+
+	if d.read() {
+		t.Error("read high past the end of the tape")
+	}
+}
+
+func TestDataRecorderKeepsTimeOverReset(t *testing.T) {
+	clock := &testClock{cycles: 1000000}
+	d := NewDataRecorder(clock)
+	f := createTape(t)
+
+	if err := d.Record(f, testTapeRate); err != nil {
+		t.Fatal(err)
+	}
+
+	// The program writes the level every 1000 cycles, and the CPU's cycle
+	// count is cleared by a reset halfway.
+	const (
+		writeCycles = 1000
+		writes      = 2 * cpuFrequency / writeCycles
+	)
+
+	for i := 0; i < writes; i++ {
+		if i == writes/2 {
+			clock.cycles = 0
+		}
+
+		d.write(i%2 == 0)
+		clock.cycles += writeCycles
+	}
+
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	samples := readTape(t, f)
+
+	// The cycles from the last write to the reset are lost.
+	want := writes * writeCycles * testTapeRate / cpuFrequency
+	lost := writeCycles*testTapeRate/cpuFrequency + 1
+
+	if got := len(samples); got < want-lost || got > want {
+		t.Fatalf("got %d samples, want %d-%d", got, want-lost, want)
+	}
+}
+
+func TestDataRecorderPlaysFirstChannel(t *testing.T) {
+	f := createTape(t)
+
+	w, err := wav.NewWriter(f, testTapeRate, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteSamples([]float32{0.5, -0.5, -0.5, 0.5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := &testClock{}
+	d := NewDataRecorder(clock)
+
+	if err := d.Play(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if !d.read() {
+		t.Error("first sample read low, want high")
+	}
+
+	clock.cycles += cpuFrequency / testTapeRate * 3 / 2
+
+	if d.read() {
+		t.Error("second sample read high, want low")
+	}
+}
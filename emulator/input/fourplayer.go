@@ -0,0 +1,142 @@
+package input
+
+// fourScoreSignatures identify the Four Score to the program: after the two
+// joypads, the reads of $4016 return 0, 0, 0, 1, 0, 0, 0, 0 and the reads of
+// $4017 0, 0, 1, 0, 0, 0, 0, 0.
+var fourScoreSignatures = [2]uint8{0x08, 0x04}
+
+// FourScore is the NES Four Score adapter, which plugs into both ports. The
+// reads of a port shift out the buttons of two joypads, players 1 and 3 on
+// the first port and 2 and 4 on the second, then a signature, then ones.
+type FourScore struct {
+	joypads [4]*Joypad
+	ports   [2]*fourScorePort
+}
+
+type fourScorePort struct {
+	joypads   [2]*Joypad
+	signature uint8
+	strobe    bool
+	shift     uint32
+}
+
+// NewFourScore returns a Four Score with four joypads.
+func NewFourScore() *FourScore {
+	f := &FourScore{}
+
+	for i := range f.joypads {
+		f.joypads[i] = NewJoypad()
+	}
+
+	for i := range f.ports {
+		f.ports[i] = &fourScorePort{
+			joypads:   [2]*Joypad{f.joypads[i], f.joypads[i+2]},
+			signature: fourScoreSignatures[i],
+		}
+	}
+
+	return f
+}
+
+// Port returns the half of the adapter to plug into the port, 0 or 1.
+func (f *FourScore) Port(port int) Device {
+	return f.ports[port]
+}
+
+// Joypad returns the joypad of the player, 0-3, or nil if there is no such
+// player.
+func (f *FourScore) Joypad(player int) *Joypad {
+	if player < 0 || player >= len(f.joypads) {
+		return nil
+	}
+
+	return f.joypads[player]
+}
+
+func (p *fourScorePort) Write(out uint8) {
+	strobe := out&0x01 != 0
+
+	// Like the joypads, the adapter latches until the strobe goes low.
+	if p.strobe || strobe {
+		p.shift = uint32(p.joypads[0].buttons) | uint32(p.joypads[1].buttons)<<8 | uint32(p.signature)<<16
+	}
+
+	p.strobe = strobe
+}
+
+func (p *fourScorePort) Read() uint8 {
+	data := p.Peek()
+
+	if !p.strobe {
+		p.shift = p.shift>>1 | 1<<23
+	}
+
+	return data
+}
+
+func (p *fourScorePort) Peek() uint8 {
+	if p.strobe {
+		return uint8(p.joypads[0].buttons & ButtonA)
+	}
+
+	return uint8(p.shift & 0x01)
+}
+
+func (p *fourScorePort) players() []*Joypad {
+	return p.joypads[:]
+}
+
+// FamicomFourPlayers is the Famicom's four player adapter, which plugs into
+// the expansion port. The joypads of players 3 and 4 are read on D1 of
+// $4016 and $4017, next to the Famicom's own joypads on D0.
+type FamicomFourPlayers struct {
+	joypads [2]*Joypad
+	ports   [2]*famicomFourPlayersPort
+}
+
+type famicomFourPlayersPort struct {
+	joypad *Joypad
+}
+
+// NewFamicomFourPlayers returns a four player adapter with two joypads.
+func NewFamicomFourPlayers() *FamicomFourPlayers {
+	f := &FamicomFourPlayers{}
+
+	for i := range f.joypads {
+		f.joypads[i] = NewJoypad()
+		f.ports[i] = &famicomFourPlayersPort{joypad: f.joypads[i]}
+	}
+
+	return f
+}
+
+// Port returns the lines of the adapter read at the port, 0 or 1.
+func (f *FamicomFourPlayers) Port(port int) Device {
+	return f.ports[port]
+}
+
+// Joypad returns the joypad of player 3, 0, or player 4, 1, or nil for
+// other values.
+func (f *FamicomFourPlayers) Joypad(i int) *Joypad {
+	if i < 0 || i >= len(f.joypads) {
+		return nil
+	}
+
+	return f.joypads[i]
+}
+
+func (p *famicomFourPlayersPort) Write(out uint8) {
+	p.joypad.Write(out)
+}
+
+func (p *famicomFourPlayersPort) Read() uint8 {
+	return p.joypad.Read() << 1
+}
+
+func (p *famicomFourPlayersPort) Peek() uint8 {
+	return p.joypad.Peek() << 1
+}
+
+func (p *famicomFourPlayersPort) players() []*Joypad {
+	return []*Joypad{p.joypad}
+}
@@ -0,0 +1,149 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+// readPorts strobes the ports and returns the reads of a port.
+func readPorts(p *Ports, addr uint16, reads int) []uint8 {
+	p.Write(port1Register, 1)
+	p.Write(port1Register, 0)
+
+	var data []uint8
+	for i := 0; i < reads; i++ {
+		data = append(data, p.Read(addr))
+	}
+
+	return data
+}
+
+// serial returns the bits of the values read one by one, the least
+// significant bit first.
+func serial(values ...uint8) []uint8 {
+	var bits []uint8
+
+	for _, v := range values {
+		for i := 0; i < 8; i++ {
+			bits = append(bits, v>>i&1)
+		}
+	}
+
+	return bits
+}
+
+// playerButtons are distinct buttons for each player.
+var playerButtons = [4]Buttons{
+	ButtonA | ButtonRight,
+	ButtonB | ButtonLeft,
+	ButtonSelect | ButtonDown,
+	ButtonStart | ButtonUp,
+}
+
+func TestFourScore(t *testing.T) {
+	p := NewPorts(newTestCpu(), &testFrameCounter{})
+	p.PlugDefault(rom.FourScore, nil, nil)
+
+	for player, b := range playerButtons {
+		p.SetButtons(player, b)
+	}
+
+	// Each port shifts out two joypads and the signature, then ones.
+	tests := []struct {
+		addr uint16
+		want []uint8
+	}{
+		{port1Register, serial(uint8(playerButtons[0]), uint8(playerButtons[2]), 0x08, 0xff)},
+		{port2Register, serial(uint8(playerButtons[1]), uint8(playerButtons[3]), 0x04, 0xff)},
+	}
+
+	for _, tt := range tests {
+		for i, data := range readPorts(p, tt.addr, len(tt.want)) {
+			if data != tt.want[i] {
+				t.Errorf("$%04X read %d: got %d, want %d", tt.addr, i, data, tt.want[i])
+			}
+		}
+	}
+
+	f := NewFourScore()
+
+	for player := 0; player < 4; player++ {
+		if f.Joypad(player) == nil {
+			t.Errorf("no joypad for player %d", player)
+		}
+	}
+
+	for _, player := range []int{-1, 4} {
+		if f.Joypad(player) != nil {
+			t.Errorf("got a joypad for player %d", player)
+		}
+	}
+}
+
+func TestFamicomFourPlayers(t *testing.T) {
+	p := NewPorts(newTestCpu(), &testFrameCounter{})
+	p.PlugDefault(rom.FamicomFourPlayers, nil, nil)
+
+	for player, b := range playerButtons {
+		p.SetButtons(player, b)
+	}
+
+	// The Famicom's joypads are read on D0 and the adapter's on D1.
+	for port, addr := range []uint16{port1Register, port2Register} {
+		d0 := serial(uint8(playerButtons[port]), 0xff)
+		d1 := serial(uint8(playerButtons[port+2]), 0xff)
+
+		for i, data := range readPorts(p, addr, len(d0)) {
+			if want := d0[i] | d1[i]<<1; data != want {
+				t.Errorf("$%04X read %d: got %02b, want %02b", addr, i, data, want)
+			}
+		}
+	}
+
+	f := NewFamicomFourPlayers()
+
+	for _, i := range []int{-1, 2} {
+		if f.Joypad(i) != nil {
+			t.Errorf("got a joypad for %d", i)
+		}
+	}
+}
+
+func TestPortsJoypad(t *testing.T) {
+	p := NewPorts(newTestCpu(), &testFrameCounter{})
+
+	// Without an adapter, players 3 and 4 have no joypads.
+	p.PlugDefault(rom.StandardControllers, nil, nil)
+
+	for player := 0; player < 2; player++ {
+		if j := p.Joypad(player); j == nil || j != p.Device(player) {
+			t.Errorf("player %d: got %p, want the joypad of port %d", player+1, j, player)
+		}
+	}
+
+	for _, player := range []int{-1, 2, 3} {
+		if p.Joypad(player) != nil {
+			t.Errorf("player %d: got a joypad", player+1)
+		}
+	}
+
+	f := NewFourScore()
+	p.PlugAdapter(f)
+
+	for player := 0; player < 5; player++ {
+		if j, want := p.Joypad(player), f.Joypad(player); j != want {
+			t.Errorf("Four Score player %d: got %p, want %p", player+1, j, want)
+		}
+	}
+
+	p.PlugDefault(rom.FamicomFourPlayers, nil, nil)
+	fam := p.Expansion().(*FamicomFourPlayers)
+
+	want := []*Joypad{p.Device(0).(*Joypad), p.Device(1).(*Joypad), fam.Joypad(0), fam.Joypad(1), nil}
+	for player, w := range want {
+		if j := p.Joypad(player); j != w {
+			t.Errorf("Famicom player %d: got %p, want %p", player+1, j, w)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package input
+
+// Buttons are the buttons held on a joypad, in the order they are read.
+type Buttons uint8
+
+const (
+	ButtonA Buttons = 1 << iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+// Joypad is the standard controller. While the strobe is high, it latches
+// the buttons continuously and the reads return A. After the strobe goes
+// low, the reads shift the buttons out one by one on D0, A, B, Select,
+// Start, Up, Down, Left, Right, and then ones.
+type Joypad struct {
+	buttons Buttons
+	strobe  bool
+	shift   uint8
+}
+
+// NewJoypad returns a joypad with no buttons held.
+func NewJoypad() *Joypad {
+	return &Joypad{}
+}
+
+// SetButtons sets the buttons held. The program sees them the next time it
+// strobes the joypad.
+func (j *Joypad) SetButtons(b Buttons) {
+	j.buttons = b
+}
+
+// Buttons returns the buttons held.
+func (j *Joypad) Buttons() Buttons {
+	return j.buttons
+}
+
+func (j *Joypad) players() []*Joypad {
+	return []*Joypad{j}
+}
+
+func (j *Joypad) Write(out uint8) {
+	strobe := out&0x01 != 0
+
+	// The buttons are latched until the strobe goes low, so the reads
+	// start from the buttons held then.
+	if j.strobe || strobe {
+		j.shift = uint8(j.buttons)
+	}
+
+	j.strobe = strobe
+}
+
+func (j *Joypad) Read() uint8 {
+	data := j.Peek()
+
+	if !j.strobe {
+		j.shift = j.shift>>1 | 0x80
+	}
+
+	return data
+}
+
+func (j *Joypad) Peek() uint8 {
+	if j.strobe {
+		return uint8(j.buttons & ButtonA)
+	}
+
+	return j.shift & 0x01
+}
@@ -0,0 +1,78 @@
+package input
+
+import "testing"
+
+// readJoypad strobes the joypad and returns the bits read on D0.
+func readJoypad(j *Joypad, reads int) []uint8 {
+	j.Write(1)
+	j.Write(0)
+
+	var bits []uint8
+	for i := 0; i < reads; i++ {
+		bits = append(bits, j.Read())
+	}
+
+	return bits
+}
+
+func TestJoypadShiftOrder(t *testing.T) {
+	// The buttons are read in the order A, B, Select, Start, Up, Down,
+	// Left, Right, and the reads after them return ones.
+	for i := 0; i < 8; i++ {
+		j := NewJoypad()
+		j.SetButtons(1 << i)
+
+		for read, bit := range readJoypad(j, 11) {
+			var want uint8
+			if read == i || read >= 8 {
+				want = 1
+			}
+
+			if bit != want {
+				t.Errorf("button %d, read %d: got %d, want %d", i, read, bit, want)
+			}
+		}
+	}
+}
+
+func TestJoypadStrobe(t *testing.T) {
+	j := NewJoypad()
+	j.SetButtons(ButtonA | ButtonStart)
+	j.Write(1)
+
+	// While the strobe is high, the reads return A without shifting.
+	for i := 0; i < 3; i++ {
+		if data := j.Read(); data != 1 {
+			t.Errorf("read %d: got %d while the strobe is high, want A", i, data)
+		}
+	}
+
+	// The buttons held when the strobe goes low are shifted out.
+	j.SetButtons(ButtonB | ButtonStart)
+	j.Write(0)
+
+	if data := j.Read(); data != 0 {
+		t.Errorf("got A %d, want the buttons latched when the strobe went low", data)
+	}
+
+	if data := j.Read(); data != 1 {
+		t.Errorf("got B %d, want the buttons latched when the strobe went low", data)
+	}
+
+	// Writing the strobe low again doesn't reload the buttons.
+	j.SetButtons(ButtonSelect)
+	j.Write(0)
+
+	if data := j.Read(); data != 0 {
+		t.Errorf("got Select %d after the strobe stayed low, want 0", data)
+	}
+
+	// Peek doesn't shift.
+	if peek := j.Peek(); peek != 1 {
+		t.Errorf("got Start %d, want 1", peek)
+	}
+
+	if data := j.Read(); data != 1 {
+		t.Errorf("got Start %d after Peek, want 1", data)
+	}
+}
@@ -0,0 +1,386 @@
+package input
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// keyboardReset, keyboardColumn and keyboardEnable are the lines the
+	// keyboard is controlled by, OUT0-OUT2. A reset selects the first row, and
+	// the column going from 1 to 0 selects the next.
+	keyboardReset  uint8 = 0b0000_0001
+	keyboardColumn uint8 = 0b0000_0010
+	keyboardEnable uint8 = 0b0000_0100
+	// keyboardLines are the lines the keys of the selected row and column
+	// are read on, D1-D4 of $4017, low while a key is pressed.
+	keyboardLines uint8 = 0b0001_1110
+	// tapeLine is the line the data recorder is read on, D1 of $4016.
+	tapeLine uint8 = 0b0000_0010
+
+	keyboardRows = 9
+	// typeScans is the number of times the program scans the keyboard while
+	// a typed key is held, and again after it is released.
+	typeScans = 3
+)
+
+// Key is a key of the Family BASIC keyboard. The keys are numbered in the
+// order of the matrix: each of the nine rows has two columns of four keys.
+type Key uint8
+
+const (
+	KeyRightBracket Key = iota
+	KeyLeftBracket
+	KeyReturn
+	KeyF8
+	KeyStop
+	KeyYen
+	KeyRightShift
+	KeyKana
+
+	KeySemicolon
+	KeyColon
+	KeyAt
+	KeyF7
+	KeyCaret
+	KeyMinus
+	KeySlash
+	KeyUnderscore
+
+	KeyK
+	KeyL
+	KeyO
+	KeyF6
+	Key0
+	KeyP
+	KeyComma
+	KeyPeriod
+
+	KeyJ
+	KeyU
+	KeyI
+	KeyF5
+	Key8
+	Key9
+	KeyN
+	KeyM
+
+	KeyH
+	KeyG
+	KeyY
+	KeyF4
+	Key6
+	Key7
+	KeyV
+	KeyB
+
+	KeyD
+	KeyR
+	KeyT
+	KeyF3
+	Key4
+	Key5
+	KeyC
+	KeyF
+
+	KeyA
+	KeyS
+	KeyW
+	KeyF2
+	Key3
+	KeyE
+	KeyZ
+	KeyX
+
+	KeyCtr
+	KeyQ
+	KeyEsc
+	KeyF1
+	Key2
+	Key1
+	KeyGrph
+	KeyLeftShift
+
+	KeyLeft
+	KeyRight
+	KeyUp
+	KeyClrHome
+	KeyIns
+	KeyDel
+	KeySpace
+	KeyDown
+
+	keyCount
+)
+
+var keyNames = [keyCount]string{
+	"]", "[", "Return", "F8", "Stop", "Yen", "RightShift", "Kana",
+	";", ":", "@", "F7", "^", "-", "/", "_",
+	"K", "L", "O", "F6", "0", "P", ",", ".",
+	"J", "U", "I", "F5", "8", "9", "N", "M",
+	"H", "G", "Y", "F4", "6", "7", "V", "B",
+	"D", "R", "T", "F3", "4", "5", "C", "F",
+	"A", "S", "W", "F2", "3", "E", "Z", "X",
+	"Ctr", "Q", "Esc", "F1", "2", "1", "Grph", "LeftShift",
+	"Left", "Right", "Up", "ClrHome", "Ins", "Del", "Space", "Down",
+}
+
+func (k Key) String() string {
+	if k >= keyCount {
+		return fmt.Sprintf("Key(%d)", uint8(k))
+	}
+
+	return keyNames[k]
+}
+
+// KeyByName returns the key of the name, as returned by String, ignoring
+// the case, e.g. to map the keys of the host's keyboard by their names.
+func KeyByName(name string) (Key, bool) {
+	for k, n := range keyNames {
+		if strings.EqualFold(n, name) {
+			return Key(k), true
+		}
+	}
+
+	return 0, false
+}
+
+// shiftedRunes are the characters typed with a shift key held.
+var shiftedRunes = map[rune]Key{
+	'!': Key1, '"': Key2, '#': Key3, '$': Key4, '%': Key5,
+	'&': Key6, '\'': Key7, '(': Key8, ')': Key9, '=': KeyMinus,
+	'*': KeyColon, '+': KeySemicolon, '<': KeyComma, '>': KeyPeriod, '?': KeySlash,
+}
+
+// KeysForRune returns the keys to press together to type the character.
+// The letters are typed in upper case, as Family BASIC only has those, and
+// a newline is typed with Return.
+func KeysForRune(r rune) ([]Key, bool) {
+	switch r {
+	case '\n':
+		return []Key{KeyReturn}, true
+	case ' ':
+		return []Key{KeySpace}, true
+	case '¥':
+		return []Key{KeyYen}, true
+	}
+
+	if k, ok := shiftedRunes[r]; ok {
+		return []Key{KeyLeftShift, k}, true
+	}
+
+	r = unicode.ToUpper(r)
+
+	for k, n := range keyNames {
+		if len(n) == 1 && rune(n[0]) == r {
+			return []Key{Key(k)}, true
+		}
+	}
+
+	return nil, false
+}
+
+// Keyboard is the Family BASIC keyboard, which plugs into the expansion
+// port. The program selects a row and a column of the key matrix through
+// $4016 and reads its four keys on $4017. The data recorder plugs into the
+// keyboard.
+type Keyboard struct {
+	pressed [keyCount]bool
+	// typed are the keys of the characters to type, pressed one character
+	// at a time.
+	typed    [][]Key
+	scans    int
+	row      int
+	column   int
+	enabled  bool
+	out      uint8
+	recorder *DataRecorder
+	ports    [2]*keyboardPort
+}
+
+type keyboardPort struct {
+	k *Keyboard
+	// matrix is set for the half read at $4017.
+	matrix bool
+}
+
+// NewKeyboard returns a keyboard with no keys pressed and no data recorder.
+func NewKeyboard() *Keyboard {
+	k := &Keyboard{}
+	k.ports = [2]*keyboardPort{{k: k}, {k: k, matrix: true}}
+
+	return k
+}
+
+// Port returns the lines of the keyboard read at the port, 0 or 1.
+func (k *Keyboard) Port(port int) Device {
+	return k.ports[port]
+}
+
+// SetDataRecorder plugs the data recorder into the keyboard, or unplugs it
+// if the recorder is nil.
+func (k *Keyboard) SetDataRecorder(d *DataRecorder) {
+	k.recorder = d
+}
+
+// DataRecorder returns the data recorder plugged into the keyboard, or nil.
+func (k *Keyboard) DataRecorder() *DataRecorder {
+	return k.recorder
+}
+
+// Press presses the key.
+func (k *Keyboard) Press(key Key) {
+	if key < keyCount {
+		k.pressed[key] = true
+	}
+}
+
+// Release releases the key.
+func (k *Keyboard) Release(key Key) {
+	if key < keyCount {
+		k.pressed[key] = false
+	}
+}
+
+// Pressed returns whether the key is pressed.
+func (k *Keyboard) Pressed(key Key) bool {
+	return key < keyCount && k.pressed[key]
+}
+
+// ReleaseAll releases all the keys.
+func (k *Keyboard) ReleaseAll() {
+	k.pressed = [keyCount]bool{}
+}
+
+// Type types the text, one character at a time: the keys of a character
+// are held while the program scans the keyboard a few times and released
+// for as long before the next. The keys pressed with Press stay pressed.
+// It returns an error, and types nothing, if the keyboard has no keys for
+// a character.
+func (k *Keyboard) Type(text string) error {
+	var typed [][]Key
+
+	for _, r := range text {
+		keys, ok := KeysForRune(r)
+		if !ok {
+			return fmt.Errorf("no keys for %q", r)
+		}
+
+		typed = append(typed, keys)
+	}
+
+	k.typed = append(k.typed, typed...)
+
+	return nil
+}
+
+// Typing returns whether some of the text passed to Type is still to be
+// typed.
+func (k *Keyboard) Typing() bool {
+	return len(k.typed) > 0
+}
+
+func (k *Keyboard) write(out uint8) {
+	if out&keyboardReset != 0 && k.out&keyboardReset == 0 {
+		k.scanned()
+	}
+
+	column := int(out&keyboardColumn) >> 1
+
+	switch {
+	case out&keyboardReset != 0:
+		k.row = 0
+	case k.column == 1 && column == 0:
+		k.row++
+	}
+
+	k.column = column
+	k.enabled = out&keyboardEnable != 0
+	k.out = out
+
+	if k.recorder != nil {
+		k.recorder.write(out&keyboardEnable != 0)
+	}
+}
+
+// scanned moves on with the typing when the program starts a new scan of
+// the keyboard.
+func (k *Keyboard) scanned() {
+	if len(k.typed) == 0 {
+		return
+	}
+
+	if k.scans == 2*typeScans {
+		k.scans = 0
+		k.typed = k.typed[1:]
+
+		if len(k.typed) == 0 {
+			return
+		}
+	}
+
+	k.scans++
+}
+
+// isPressed returns whether the key is pressed, either with Press or being
+// typed.
+func (k *Keyboard) isPressed(key Key) bool {
+	if k.pressed[key] {
+		return true
+	}
+
+	if len(k.typed) > 0 && k.scans > 0 && k.scans <= typeScans {
+		for _, t := range k.typed[0] {
+			if t == key {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matrix returns the lines of the selected row and column.
+func (k *Keyboard) matrix() uint8 {
+	if !k.enabled {
+		return 0
+	}
+
+	data := keyboardLines
+
+	if k.row < keyboardRows {
+		first := Key(k.row*8 + k.column*4)
+
+		for i := Key(0); i < 4; i++ {
+			if k.isPressed(first + i) {
+				data &^= 0b10 << i
+			}
+		}
+	}
+
+	return data
+}
+
+func (p *keyboardPort) Write(out uint8) {
+	// Both halves see the lines; the keyboard takes them once.
+	if p.matrix {
+		p.k.write(out)
+	}
+}
+
+func (p *keyboardPort) Read() uint8 {
+	return p.Peek()
+}
+
+func (p *keyboardPort) Peek() uint8 {
+	if p.matrix {
+		return p.k.matrix()
+	}
+
+	if p.k.recorder != nil && p.k.recorder.read() {
+		return tapeLine
+	}
+
+	return 0
+}
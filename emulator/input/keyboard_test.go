@@ -0,0 +1,166 @@
+package input
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+// keyboardLayout is the key matrix of the keyboard as documented on the
+// nesdev wiki: the keys of each row, column 0 then column 1, read on D1 to
+// D4.
+var keyboardLayout = [keyboardRows][8]string{
+	{"]", "[", "Return", "F8", "Stop", "Yen", "RightShift", "Kana"},
+	{";", ":", "@", "F7", "^", "-", "/", "_"},
+	{"K", "L", "O", "F6", "0", "P", ",", "."},
+	{"J", "U", "I", "F5", "8", "9", "N", "M"},
+	{"H", "G", "Y", "F4", "6", "7", "V", "B"},
+	{"D", "R", "T", "F3", "4", "5", "C", "F"},
+	{"A", "S", "W", "F2", "3", "E", "Z", "X"},
+	{"Ctr", "Q", "Esc", "F1", "2", "1", "Grph", "LeftShift"},
+	{"Left", "Right", "Up", "ClrHome", "Ins", "Del", "Space", "Down"},
+}
+
+// newKeyboardPorts returns the ports with joypads and the keyboard plugged
+// in.
+func newKeyboardPorts() (*Ports, *Keyboard) {
+	p := NewPorts(newTestCpu(), &testFrameCounter{})
+	p.PlugDefault(rom.StandardControllers, nil, nil)
+
+	k := NewKeyboard()
+	p.SetExpansion(k)
+
+	return p, k
+}
+
+// scanKeyboard scans the keyboard like Family BASIC: it resets to the first
+// row, then selects column 0 and column 1 of each row in turn. It returns
+// the keyboard lines read.
+func scanKeyboard(p *Ports) [keyboardRows][2]uint8 {
+	var lines [keyboardRows][2]uint8
+
+	p.Write(port1Register, keyboardEnable|keyboardReset)
+
+	for row := range lines {
+		for column := range lines[row] {
+			p.Write(port1Register, keyboardEnable|uint8(column)<<1)
+			lines[row][column] = p.Read(port2Register) & keyboardLines
+		}
+	}
+
+	p.Write(port1Register, keyboardEnable)
+
+	return lines
+}
+
+func TestKeyboardMatrix(t *testing.T) {
+	p, k := newKeyboardPorts()
+
+	for row, keys := range keyboardLayout {
+		for i, name := range keys {
+			key, ok := KeyByName(name)
+			if !ok {
+				t.Fatalf("no key %s", name)
+			}
+
+			k.Press(key)
+			lines := scanKeyboard(p)
+			k.Release(key)
+
+			// The line of the pressed key is low, the others high.
+			for r := range lines {
+				for column, data := range lines[r] {
+					want := keyboardLines
+					if r == row && column == i/4 {
+						want &^= 0b10 << (i % 4)
+					}
+
+					if data != want {
+						t.Errorf("%s pressed: row %d column %d: got %05b, want %05b", name, r, column, data, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestKeyboardDisabled(t *testing.T) {
+	p, k := newKeyboardPorts()
+	k.Press(KeyA)
+
+	p.Write(port1Register, keyboardReset)
+	p.Write(port1Register, 0)
+
+	if data := p.Read(port2Register) & keyboardLines; data != 0 {
+		t.Errorf("got %05b with the keyboard disabled, want 0", data)
+	}
+
+	// The tape is read on D1 of $4016, low with no data recorder.
+	if data := p.Read(port1Register) & tapeLine; data != 0 {
+		t.Errorf("got tape line %02b without a data recorder", data)
+	}
+}
+
+func TestKeyboardType(t *testing.T) {
+	p, k := newKeyboardPorts()
+
+	if err := k.Type("a!"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each character is held for typeScans scans and released for as many.
+	a := func(lines [keyboardRows][2]uint8) bool { return lines[6][0]&0b10 == 0 }
+	bang := func(lines [keyboardRows][2]uint8) bool {
+		return lines[7][1]&0b0100 == 0 && lines[7][1]&0b1_0000 == 0
+	}
+
+	for scan := 1; scan <= 4*typeScans+1; scan++ {
+		lines := scanKeyboard(p)
+
+		wantA := scan <= typeScans
+		wantBang := scan > 2*typeScans && scan <= 3*typeScans
+
+		if a(lines) != wantA || bang(lines) != wantBang {
+			t.Errorf("scan %d: got A %t and ! %t, want %t and %t", scan, a(lines), bang(lines), wantA, wantBang)
+		}
+
+		if k.Typing() != (scan <= 4*typeScans) {
+			t.Errorf("scan %d: got typing %t", scan, k.Typing())
+		}
+	}
+
+	if err := k.Type("a~"); err == nil || k.Typing() {
+		t.Errorf("got %v and typing %t for a character with no keys", err, k.Typing())
+	}
+}
+
+func TestKeysForRune(t *testing.T) {
+	tests := []struct {
+		r    rune
+		want []Key
+	}{
+		{'a', []Key{KeyA}},
+		{'A', []Key{KeyA}},
+		{'7', []Key{Key7}},
+		{'@', []Key{KeyAt}},
+		{'\n', []Key{KeyReturn}},
+		{' ', []Key{KeySpace}},
+		{'¥', []Key{KeyYen}},
+		{'!', []Key{KeyLeftShift, Key1}},
+		{'\'', []Key{KeyLeftShift, Key7}},
+		{'=', []Key{KeyLeftShift, KeyMinus}},
+		{'+', []Key{KeyLeftShift, KeySemicolon}},
+		{'?', []Key{KeyLeftShift, KeySlash}},
+		{'~', nil},
+		{'é', nil},
+	}
+
+	for _, tt := range tests {
+		keys, ok := KeysForRune(tt.r)
+
+		if ok != (tt.want != nil) || !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("%q: got %v %t, want %v", tt.r, keys, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Package input emulates the controller ports at $4016 and $4017 and the
+// devices plugged into them: the joypads, the four player adapters, the
+// Zapper, the Arkanoid controllers, the Power Pad, and the Family BASIC
+// keyboard with the data recorder.
+package input
+
+import (
+	"fmt"
+
+	"github.com/pqkallio/nes-emulator/emulator/bus"
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+const (
+	port1Register uint16 = 0x4016
+	port2Register uint16 = 0x4017
+	// portDriven are the data lines the ports drive on a read, D0-D4; the
+	// top three bits are open bus.
+	portDriven uint8 = 0b0001_1111
+	// outMask are the OUT0-OUT2 lines written through $4016. OUT0 is the
+	// strobe of the controllers.
+	outMask uint8 = 0b0000_0111
+)
+
+// Device is plugged into a controller port.
+type Device interface {
+	// Write sets the levels of the OUT0-OUT2 lines, written to $4016.
+	Write(out uint8)
+	// Read returns the levels of the port's data lines D0-D4, read at $4016
+	// for the first port and $4017 for the second. The read clocks the
+	// device.
+	Read() uint8
+	// Peek returns what Read would return without clocking the device.
+	Peek() uint8
+}
+
+// Adapter is a device read at both ports, e.g. the Four Score, which plugs
+// into both, or the devices of the Famicom's expansion port. Port returns
+// the lines of the device read at the port, 0 or 1.
+type Adapter interface {
+	Port(port int) Device
+}
+
+// joypads is implemented by the devices with joypads. They return the
+// joypads read at the port in the order of the players: the port's player,
+// then the player two after it.
+type joypads interface {
+	players() []*Joypad
+}
+
+// Ports are the two controller ports and the Famicom's expansion port,
+// whose lines are read at both. They are mapped over $4016-$4017; the
+// writes to $4017 go to the APU's frame counter, which shares the address.
+type Ports struct {
+	devices      [2]Device
+	expansion    Adapter
+	out          uint8
+	frameCounter bus.Device
+
+	cpu *cpu.Cpu
+	// readPort is the port the current instruction read, or -1.
+	readPort int
+}
+
+// NewPorts returns the ports with nothing plugged in. The writes to $4017
+// are passed on to frameCounter. The ports must be added as an observer of
+// c for the DMC conflicts to be emulated.
+func NewPorts(c *cpu.Cpu, frameCounter bus.Device) *Ports {
+	return &Ports{cpu: c, frameCounter: frameCounter, readPort: -1}
+}
+
+// Plug plugs the device into the port, 0 or 1, or unplugs the port if the
+// device is nil.
+func (p *Ports) Plug(port int, d Device) error {
+	if port < 0 || port >= len(p.devices) {
+		return fmt.Errorf("invalid controller port %d", port)
+	}
+
+	p.devices[port] = d
+
+	if d != nil {
+		d.Write(p.out)
+	}
+
+	return nil
+}
+
+// PlugAdapter plugs the adapter into both ports.
+func (p *Ports) PlugAdapter(a Adapter) {
+	for port := range p.devices {
+		p.devices[port] = a.Port(port)
+		p.devices[port].Write(p.out)
+	}
+}
+
+// Device returns the device plugged into the port, or nil.
+func (p *Ports) Device(port int) Device {
+	if port < 0 || port >= len(p.devices) {
+		return nil
+	}
+
+	return p.devices[port]
+}
+
+// SetExpansion plugs the device into the expansion port, or unplugs it if
+// the device is nil. Its lines are read with the ports'.
+func (p *Ports) SetExpansion(a Adapter) {
+	p.expansion = a
+
+	if a != nil {
+		for port := range p.devices {
+			a.Port(port).Write(p.out)
+		}
+	}
+}
+
+// Expansion returns the device plugged into the expansion port, or nil.
+func (p *Ports) Expansion() Adapter {
+	return p.expansion
+}
+
+// PlugDefault plugs in the devices the game expects by the default
+// expansion device of its header: joypads, unless it names a device that
+// is emulated. The Zappers follow the beam and the data recorder is timed
+// by the clock. The Zappers sense no light, see NewZapper. Both sides of
+// the Power Pad plug in the same mat, see PowerPad.
+func (p *Ports) PlugDefault(device rom.ExpansionDevice, beam Beam, clock Clock) {
+	p.devices = [2]Device{NewJoypad(), NewJoypad()}
+	p.expansion = nil
+
+	switch device {
+	case rom.FourScore:
+		p.PlugAdapter(NewFourScore())
+	case rom.FamicomFourPlayers:
+		p.SetExpansion(NewFamicomFourPlayers())
+	case rom.Zapper:
+		p.devices[1] = NewZapper(beam)
+	case rom.TwoZappers:
+		p.devices = [2]Device{NewZapper(beam), NewZapper(beam)}
+	case rom.PowerPadSideA, rom.PowerPadSideB:
+		p.devices[1] = NewPowerPad()
+	case rom.ArkanoidVausNes:
+		p.devices[1] = NewVaus()
+	case rom.ArkanoidVausFamicom:
+		p.SetExpansion(NewFamicomVaus())
+	case rom.FamilyBasicKeyboard:
+		k := NewKeyboard()
+		k.SetDataRecorder(NewDataRecorder(clock))
+		p.SetExpansion(k)
+	}
+
+	for _, d := range p.devices {
+		d.Write(p.out)
+	}
+}
+
+// Joypad returns the joypad of the player, 0-3, or nil if there is none.
+// Players 1 and 2 are the joypads plugged into the ports, players 3 and 4
+// those of a four player adapter.
+func (p *Ports) Joypad(player int) *Joypad {
+	if player < 0 {
+		return nil
+	}
+
+	port, i := player%2, player/2
+
+	var players []*Joypad
+
+	if j, ok := p.devices[port].(joypads); ok {
+		players = append(players, j.players()...)
+	}
+
+	if p.expansion != nil {
+		if j, ok := p.expansion.Port(port).(joypads); ok {
+			players = append(players, j.players()...)
+		}
+	}
+
+	if i >= len(players) {
+		return nil
+	}
+
+	return players[i]
+}
+
+// SetButtons sets the buttons held on the joypad of the player, 0-3, e.g.
+// once a frame. It does nothing if the player has no joypad.
+func (p *Ports) SetButtons(player int, b Buttons) {
+	if j := p.Joypad(player); j != nil {
+		j.SetButtons(b)
+	}
+}
+
+func (p *Ports) Write(addr uint16, data uint8) {
+	switch addr {
+	case port1Register:
+		p.out = data & outMask
+
+		for port, d := range p.devices {
+			if d != nil {
+				d.Write(p.out)
+			}
+
+			if p.expansion != nil {
+				p.expansion.Port(port).Write(p.out)
+			}
+		}
+	case port2Register:
+		p.frameCounter.Write(addr, data)
+	}
+}
+
+func (p *Ports) Read(addr uint16) uint8 {
+	data, _ := p.ReadDriven(addr)
+	return data
+}
+
+func (p *Ports) ReadDriven(addr uint16) (uint8, uint8) {
+	port := int(addr - port1Register)
+
+	p.readPort = port
+
+	var data uint8
+
+	if d := p.devices[port]; d != nil {
+		data = d.Read()
+	}
+
+	if p.expansion != nil {
+		data |= p.expansion.Port(port).Read()
+	}
+
+	return data & portDriven, portDriven
+}
+
+func (p *Ports) PeekDriven(addr uint16) (uint8, uint8) {
+	port := int(addr - port1Register)
+
+	var data uint8
+
+	if d := p.devices[port]; d != nil {
+		data = d.Peek()
+	}
+
+	if p.expansion != nil {
+		data |= p.expansion.Port(port).Peek()
+	}
+
+	return data & portDriven, portDriven
+}
+
+// Power lowers the OUT lines, like turning the console off and on. The
+// devices latch their state first, so they start from the same state
+// every time.
+func (p *Ports) Power() {
+	p.Write(port1Register, 1)
+	p.Write(port1Register, 0)
+	p.readPort = -1
+}
+
+func (p *Ports) BeforeInstruction(c *cpu.Cpu) {
+	p.readPort = -1
+}
+
+func (p *Ports) AfterInterrupt(c *cpu.Cpu, i cpu.Interrupt) {
+	p.readPort = -1
+}
+
+// DmcDma is called when the DMC halts the CPU to fetch a sample byte. The
+// DMA halts the CPU on a read cycle and the CPU repeats the read when it
+// resumes, so if the CPU was reading a port, the device is clocked once
+// more and the program misses a bit. The read of an instruction is on its
+// last cycle.
+func (p *Ports) DmcDma() {
+	if p.readPort < 0 || !p.cpu.InstructionBoundary() {
+		return
+	}
+
+	p.ReadDriven(port1Register + uint16(p.readPort))
+}
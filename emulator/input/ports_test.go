@@ -0,0 +1,180 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+)
+
+// testDevice records the OUT lines written to it and drives data on every
+// line, including the open bus ones.
+type testDevice struct {
+	out   uint8
+	data  uint8
+	reads int
+}
+
+func (d *testDevice) Write(out uint8) {
+	d.out = out
+}
+
+func (d *testDevice) Read() uint8 {
+	d.reads++
+	return d.data
+}
+
+func (d *testDevice) Peek() uint8 {
+	return d.data
+}
+
+type testAdapter [2]*testDevice
+
+func (a *testAdapter) Port(port int) Device {
+	return a[port]
+}
+
+// testFrameCounter records the writes passed on to the frame counter.
+type testFrameCounter struct {
+	writes []uint8
+}
+
+func (f *testFrameCounter) Read(addr uint16) uint8 {
+	return 0
+}
+
+func (f *testFrameCounter) Write(addr uint16, data uint8) {
+	f.writes = append(f.writes, data)
+}
+
+type testMemory [0x10000]uint8
+
+func (m *testMemory) ReadData(addr uint16) uint8 {
+	return m[addr]
+}
+
+func (m *testMemory) WriteData(addr uint16, data uint8) {
+	m[addr] = data
+}
+
+// newTestCpu returns a CPU that has run its reset sequence, so it is on an
+// instruction boundary.
+func newTestCpu() *cpu.Cpu {
+	c := cpu.NewCpu(&testMemory{})
+	c.Reset()
+
+	for !c.InstructionBoundary() {
+		c.Tick()
+	}
+
+	return c
+}
+
+func TestPortsWrite(t *testing.T) {
+	frameCounter := &testFrameCounter{}
+	p := NewPorts(newTestCpu(), frameCounter)
+
+	devices := [2]*testDevice{{}, {}}
+	expansion := &testAdapter{{}, {}}
+
+	for port, d := range devices {
+		if err := p.Plug(port, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p.SetExpansion(expansion)
+
+	// The OUT lines are the low three bits of $4016, seen by every device.
+	p.Write(port1Register, 0xfd)
+
+	for port := range devices {
+		if devices[port].out != 0x05 || expansion[port].out != 0x05 {
+			t.Errorf("port %d: got OUT %d and %d, want 5", port, devices[port].out, expansion[port].out)
+		}
+	}
+
+	if len(frameCounter.writes) != 0 {
+		t.Errorf("got frame counter writes %v from $4016", frameCounter.writes)
+	}
+
+	// $4017 is the frame counter's.
+	p.Write(port2Register, 0xc0)
+
+	if len(frameCounter.writes) != 1 || frameCounter.writes[0] != 0xc0 {
+		t.Errorf("got frame counter writes %v, want [$C0]", frameCounter.writes)
+	}
+
+	if devices[0].out != 0x05 || devices[1].out != 0x05 {
+		t.Error("a write to $4017 reached the devices")
+	}
+
+	if err := p.Plug(2, devices[0]); err == nil {
+		t.Error("plugged into port 2")
+	}
+}
+
+func TestPortsReadDriven(t *testing.T) {
+	p := NewPorts(newTestCpu(), &testFrameCounter{})
+
+	device := &testDevice{data: 0xe1}
+	expansion := &testAdapter{{data: 0x02}, {data: 0xf0}}
+
+	_ = p.Plug(0, device)
+	p.SetExpansion(expansion)
+
+	// The device and the expansion port share the lines; D5-D7 are open
+	// bus.
+	tests := []struct {
+		addr uint16
+		want uint8
+	}{
+		{port1Register, 0x03},
+		{port2Register, 0x10},
+	}
+
+	for _, tt := range tests {
+		if data, driven := p.PeekDriven(tt.addr); data != tt.want || driven != portDriven {
+			t.Errorf("peek $%04X: got $%02X driven $%02X, want $%02X $%02X", tt.addr, data, driven, tt.want, portDriven)
+		}
+
+		if data, driven := p.ReadDriven(tt.addr); data != tt.want || driven != portDriven {
+			t.Errorf("read $%04X: got $%02X driven $%02X, want $%02X $%02X", tt.addr, data, driven, tt.want, portDriven)
+		}
+	}
+
+	if device.reads != 1 {
+		t.Errorf("got %d device reads, want 1", device.reads)
+	}
+}
+
+func TestPortsDmcDma(t *testing.T) {
+	c := newTestCpu()
+	p := NewPorts(c, &testFrameCounter{})
+
+	j := NewJoypad()
+	_ = p.Plug(0, j)
+
+	j.SetButtons(ButtonB | ButtonStart)
+	p.Write(port1Register, 1)
+	p.Write(port1Register, 0)
+
+	// The DMA after the read of A repeats it, so B is read next.
+	if data := p.Read(port1Register); data != 0 {
+		t.Fatalf("got A %d, want 0", data)
+	}
+
+	p.DmcDma()
+	p.BeforeInstruction(c)
+
+	if data := p.Read(port1Register); data != 0 {
+		t.Errorf("got %d after the DMA, want Select", data)
+	}
+
+	// A DMA during another instruction doesn't clock the joypad.
+	p.BeforeInstruction(c)
+	p.DmcDma()
+
+	if data := p.Read(port1Register); data != 1 {
+		t.Errorf("got %d, want Start", data)
+	}
+}
@@ -0,0 +1,95 @@
+package input
+
+const (
+	powerPadD3 uint8 = 0b0000_1000
+	powerPadD4 uint8 = 0b0001_0000
+)
+
+// The buttons of the Power Pad in the order they are shifted out on D3 and
+// D4.
+var (
+	powerPadD3Order = [8]uint{2, 1, 5, 9, 6, 10, 11, 7}
+	powerPadD4Order = [4]uint{4, 3, 12, 8}
+)
+
+// PowerPad is the Power Pad mat, 12 buttons read eight on D3 and four on D4.
+//
+// The mat has two sides, A and B, but they are the same buttons: side A is
+// side B turned over, with fewer of its buttons printed. The buttons are
+// numbered as on side B whichever side the game uses.
+type PowerPad struct {
+	buttons uint16
+	strobe  bool
+	d3      uint8
+	d4      uint8
+}
+
+// NewPowerPad returns a Power Pad with no buttons stepped on.
+func NewPowerPad() *PowerPad {
+	return &PowerPad{}
+}
+
+// SetButtons sets the buttons stepped on, bit n-1 for button n.
+func (p *PowerPad) SetButtons(buttons uint16) {
+	p.buttons = buttons
+}
+
+func (p *PowerPad) Write(out uint8) {
+	p.strobe = out&0x01 != 0
+
+	if p.strobe {
+		p.d3, p.d4 = p.latched()
+	}
+}
+
+// latched returns the shift registers loaded with the buttons. The reads
+// after the buttons return ones.
+func (p *PowerPad) latched() (d3, d4 uint8) {
+	d4 = 0xf0
+
+	for i, button := range powerPadD3Order {
+		if p.buttons&(1<<(button-1)) != 0 {
+			d3 |= 1 << i
+		}
+	}
+
+	for i, button := range powerPadD4Order {
+		if p.buttons&(1<<(button-1)) != 0 {
+			d4 |= 1 << i
+		}
+	}
+
+	return d3, d4
+}
+
+func (p *PowerPad) Read() uint8 {
+	data := p.Peek()
+
+	if !p.strobe {
+		p.d3 = p.d3>>1 | 0x80
+		p.d4 = p.d4>>1 | 0x80
+	}
+
+	return data
+}
+
+// Peek returns the first button of each register while the strobe is high,
+// like the joypad's A.
+func (p *PowerPad) Peek() uint8 {
+	d3, d4 := p.d3, p.d4
+	if p.strobe {
+		d3, d4 = p.latched()
+	}
+
+	var data uint8
+
+	if d3&0x01 != 0 {
+		data |= powerPadD3
+	}
+
+	if d4&0x01 != 0 {
+		data |= powerPadD4
+	}
+
+	return data
+}
@@ -0,0 +1,57 @@
+package input
+
+import "testing"
+
+// readPowerPad strobes the Power Pad and returns the bits read on D3 and D4
+// over the reads.
+func readPowerPad(p *PowerPad, reads int) (d3, d4 []bool) {
+	p.Write(1)
+	p.Write(0)
+
+	for i := 0; i < reads; i++ {
+		data := p.Read()
+		d3 = append(d3, data&powerPadD3 != 0)
+		d4 = append(d4, data&powerPadD4 != 0)
+	}
+
+	return d3, d4
+}
+
+func TestPowerPadShiftOrder(t *testing.T) {
+	// Each button, numbered as on side B, is read on its line and bit; the
+	// reads after the buttons return ones.
+	for button := uint(1); button <= 12; button++ {
+		p := NewPowerPad()
+		p.SetButtons(1 << (button - 1))
+
+		d3, d4 := readPowerPad(p, 10)
+
+		for i := 0; i < 10; i++ {
+			want3 := i >= 8 || powerPadD3Order[i] == button
+			want4 := i >= 4 || powerPadD4Order[i] == button
+
+			if d3[i] != want3 || d4[i] != want4 {
+				t.Errorf("button %d, read %d: got D3 %v D4 %v, want %v %v", button, i, d3[i], d4[i], want3, want4)
+			}
+		}
+	}
+}
+
+func TestPowerPadStrobeHigh(t *testing.T) {
+	p := NewPowerPad()
+	// Buttons 2 and 4 are the first of D3 and D4.
+	p.SetButtons(1<<1 | 1<<3)
+	p.Write(1)
+
+	for i := 0; i < 3; i++ {
+		if data := p.Read(); data != powerPadD3|powerPadD4 {
+			t.Errorf("read %d: got $%02X while the strobe is high", i, data)
+		}
+	}
+
+	p.SetButtons(0)
+
+	if data := p.Read(); data != 0 {
+		t.Errorf("got $%02X, want the buttons reloaded while the strobe is high", data)
+	}
+}
@@ -0,0 +1,152 @@
+package input
+
+const (
+	// vausNesData and vausNesFire are the lines of the NES Vaus, D3 and D4.
+	vausNesData uint8 = 0b0000_1000
+	vausNesFire uint8 = 0b0001_0000
+	// vausFamicomLine is the line the Famicom Vaus is read on, D1 of $4016
+	// for the button and of $4017 for the knob.
+	vausFamicomLine uint8 = 0b0000_0010
+)
+
+// vaus is the Arkanoid controller, a knob and a button. The strobe latches
+// the position of the knob, which the reads shift out inverted, the most
+// significant bit first.
+type vaus struct {
+	position uint8
+	fire     bool
+	strobe   bool
+	shift    uint8
+}
+
+// SetPosition sets the position of the knob. The controllers give about 98
+// to 242 from the left end to the right.
+func (v *vaus) SetPosition(position uint8) {
+	v.position = position
+}
+
+// SetFire presses or releases the button.
+func (v *vaus) SetFire(pressed bool) {
+	v.fire = pressed
+}
+
+func (v *vaus) write(out uint8) {
+	v.strobe = out&0x01 != 0
+
+	if v.strobe {
+		v.shift = ^v.position
+	}
+}
+
+// readBit returns the next bit of the knob position.
+func (v *vaus) readBit() bool {
+	bit := v.peekBit()
+
+	if !v.strobe {
+		v.shift <<= 1
+	}
+
+	return bit
+}
+
+func (v *vaus) peekBit() bool {
+	return v.shift&0x80 != 0
+}
+
+// Vaus is the NES Arkanoid controller, read on D3 for the knob and D4 for
+// the button.
+type Vaus struct {
+	vaus
+}
+
+// NewVaus returns a NES Vaus with the knob at the left end.
+func NewVaus() *Vaus {
+	return &Vaus{vaus{position: 98}}
+}
+
+func (v *Vaus) Write(out uint8) {
+	v.write(out)
+}
+
+func (v *Vaus) Read() uint8 {
+	return v.lines(v.readBit())
+}
+
+func (v *Vaus) Peek() uint8 {
+	return v.lines(v.peekBit())
+}
+
+func (v *Vaus) lines(bit bool) uint8 {
+	var data uint8
+
+	if bit {
+		data |= vausNesData
+	}
+
+	if v.fire {
+		data |= vausNesFire
+	}
+
+	return data
+}
+
+// FamicomVaus is the Famicom Arkanoid controller, which plugs into the
+// expansion port. The button is read on D1 of $4016 and the knob on D1 of
+// $4017.
+type FamicomVaus struct {
+	vaus
+	ports [2]*famicomVausPort
+}
+
+type famicomVausPort struct {
+	v    *FamicomVaus
+	knob bool
+}
+
+// NewFamicomVaus returns a Famicom Vaus with the knob at the left end.
+func NewFamicomVaus() *FamicomVaus {
+	v := &FamicomVaus{vaus: vaus{position: 98}}
+	v.ports = [2]*famicomVausPort{{v: v}, {v: v, knob: true}}
+
+	return v
+}
+
+// Port returns the lines of the controller read at the port, 0 or 1.
+func (v *FamicomVaus) Port(port int) Device {
+	return v.ports[port]
+}
+
+func (p *famicomVausPort) Write(out uint8) {
+	// Both halves see the strobe; the knob is latched once.
+	if p.knob {
+		p.v.write(out)
+	}
+}
+
+func (p *famicomVausPort) Read() uint8 {
+	if !p.knob {
+		return p.Peek()
+	}
+
+	if p.v.readBit() {
+		return vausFamicomLine
+	}
+
+	return 0
+}
+
+func (p *famicomVausPort) Peek() uint8 {
+	if p.knob {
+		if p.v.peekBit() {
+			return vausFamicomLine
+		}
+
+		return 0
+	}
+
+	if p.v.fire {
+		return vausFamicomLine
+	}
+
+	return 0
+}
@@ -0,0 +1,71 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+// vausBits are the bits of the knob position 0xa5 as they are read,
+// inverted and the most significant bit first.
+var vausBits = []bool{false, true, false, true, true, false, true, false}
+
+func TestVaus(t *testing.T) {
+	p := NewPorts(newTestCpu(), &testFrameCounter{})
+	p.PlugDefault(rom.ArkanoidVausNes, nil, nil)
+
+	v := p.Device(1).(*Vaus)
+	v.SetPosition(0xa5)
+	v.SetFire(true)
+
+	// The knob is read on D3 and the button on D4 of $4017.
+	for i, data := range readPorts(p, port2Register, len(vausBits)) {
+		if got := data&vausNesData != 0; got != vausBits[i] {
+			t.Errorf("read %d: got knob bit %t, want %t", i, got, vausBits[i])
+		}
+
+		if data&vausNesFire == 0 {
+			t.Errorf("read %d: got $%02X, want the button pressed", i, data)
+		}
+	}
+
+	// While the strobe is high, the reads return the first bit.
+	v.SetPosition(0x00)
+	v.SetFire(false)
+	p.Write(port1Register, 1)
+
+	for i := 0; i < 3; i++ {
+		if data := p.Read(port2Register); data != vausNesData {
+			t.Errorf("read %d: got $%02X while the strobe is high, want $%02X", i, data, vausNesData)
+		}
+	}
+}
+
+func TestFamicomVaus(t *testing.T) {
+	p := NewPorts(newTestCpu(), &testFrameCounter{})
+	p.PlugDefault(rom.ArkanoidVausFamicom, nil, nil)
+
+	v := p.Expansion().(*FamicomVaus)
+	v.SetPosition(0xa5)
+	v.SetFire(true)
+
+	// The button is read on D1 of $4016, which isn't clocked by the reads.
+	for i, data := range readPorts(p, port1Register, 3) {
+		if data&vausFamicomLine == 0 {
+			t.Errorf("$4016 read %d: got $%02X, want the button pressed", i, data)
+		}
+	}
+
+	// The knob is read on D1 of $4017.
+	for i, data := range readPorts(p, port2Register, len(vausBits)) {
+		if got := data&vausFamicomLine != 0; got != vausBits[i] {
+			t.Errorf("$4017 read %d: got knob bit %t, want %t", i, got, vausBits[i])
+		}
+	}
+
+	v.SetFire(false)
+
+	if data := p.Read(port1Register); data&vausFamicomLine != 0 {
+		t.Errorf("got $%02X, want the button released", data)
+	}
+}
@@ -0,0 +1,119 @@
+package input
+
+import "image/color"
+
+const (
+	// zapperNoLight is set on D3 while the Zapper's photodiode sees no
+	// light.
+	zapperNoLight uint8 = 0b0000_1000
+	// zapperTrigger is set on D4 while the trigger is pulled.
+	zapperTrigger uint8 = 0b0001_0000
+	// zapperSenseScanlines is the number of scanlines the photodiode keeps
+	// sensing a bright pixel after the beam has drawn it.
+	zapperSenseScanlines = 20
+	// zapperBrightness is the brightness, the average of the red, green and
+	// blue components, a pixel needs for the photodiode to react to it.
+	zapperBrightness = 85
+
+	screenWidth  = 256
+	screenHeight = 240
+)
+
+// Beam is the position of the PPU's beam. *ppu.Ppu implements it.
+type Beam interface {
+	// Dot returns the dot the PPU is on; the visible pixels are drawn on
+	// dots 1-256.
+	Dot() int
+	// Scanline returns the scanline the PPU is on; the visible scanlines
+	// are 0-239.
+	Scanline() int
+}
+
+// FrameBuffer is the picture the PPU draws.
+type FrameBuffer interface {
+	// Pixel returns the color of the pixel as last drawn, 0 <= x < 256 and
+	// 0 <= y < 240.
+	Pixel(x, y int) color.RGBA
+}
+
+// Zapper is the light gun. The photodiode senses light when the beam has
+// just drawn a bright pixel where the gun is aimed, which the program finds
+// by flashing targets on the screen. It is read on D3, 0 when light is
+// sensed, and the trigger on D4.
+type Zapper struct {
+	beam        Beam
+	frameBuffer FrameBuffer
+
+	x, y    int
+	trigger bool
+}
+
+// NewZapper returns a Zapper that follows the beam, aimed off the screen.
+// It sees nothing until it's given a frame buffer to look at.
+//
+// The PPU doesn't draw a picture yet, so the console gives the Zappers
+// none and they never sense light; only the trigger works. Light sensing
+// waits for a PPU that renders.
+func NewZapper(beam Beam) *Zapper {
+	return &Zapper{beam: beam, x: -1, y: -1}
+}
+
+// SetFrameBuffer sets the picture the Zapper sees, which must be the one the
+// beam draws.
+func (z *Zapper) SetFrameBuffer(fb FrameBuffer) {
+	z.frameBuffer = fb
+}
+
+// Aim aims the Zapper at the pixel. A position outside the 256x240 picture
+// is off the screen.
+func (z *Zapper) Aim(x, y int) {
+	z.x = x
+	z.y = y
+}
+
+// SetTrigger pulls or releases the trigger.
+func (z *Zapper) SetTrigger(pulled bool) {
+	z.trigger = pulled
+}
+
+func (z *Zapper) Write(out uint8) {}
+
+func (z *Zapper) Read() uint8 {
+	return z.Peek()
+}
+
+func (z *Zapper) Peek() uint8 {
+	var data uint8
+
+	if !z.lightSensed() {
+		data |= zapperNoLight
+	}
+
+	if z.trigger {
+		data |= zapperTrigger
+	}
+
+	return data
+}
+
+// lightSensed tells whether the beam has drawn the pixel the Zapper is aimed
+// at within the last scanlines and the pixel is bright enough.
+func (z *Zapper) lightSensed() bool {
+	if z.frameBuffer == nil || z.x < 0 || z.x >= screenWidth || z.y < 0 || z.y >= screenHeight {
+		return false
+	}
+
+	scanline, dot := z.beam.Scanline(), z.beam.Dot()
+
+	if scanline < z.y || scanline-z.y >= zapperSenseScanlines {
+		return false
+	}
+
+	if scanline == z.y && dot <= z.x+1 {
+		return false
+	}
+
+	c := z.frameBuffer.Pixel(z.x, z.y)
+
+	return (int(c.R)+int(c.G)+int(c.B))/3 >= zapperBrightness
+}
@@ -0,0 +1,77 @@
+package input
+
+import (
+	"image/color"
+	"testing"
+)
+
+type testBeam struct {
+	dot, scanline int
+}
+
+func (b *testBeam) Dot() int {
+	return b.dot
+}
+
+func (b *testBeam) Scanline() int {
+	return b.scanline
+}
+
+// testFrameBuffer is white in the rectangle and black elsewhere.
+type testFrameBuffer struct {
+	x0, y0, x1, y1 int
+}
+
+func (fb testFrameBuffer) Pixel(x, y int) color.RGBA {
+	if x >= fb.x0 && x < fb.x1 && y >= fb.y0 && y < fb.y1 {
+		return color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	}
+
+	return color.RGBA{A: 0xff}
+}
+
+func TestZapperSeesNothingWithoutFrameBuffer(t *testing.T) {
+	beam := &testBeam{dot: 100, scanline: 101}
+	z := NewZapper(beam)
+	z.Aim(50, 100)
+
+	if z.Read()&zapperNoLight == 0 {
+		t.Error("light sensed without a frame buffer")
+	}
+
+	z.SetTrigger(true)
+
+	if data := z.Read(); data != zapperNoLight|zapperTrigger {
+		t.Errorf("got $%02X with the trigger pulled, want $%02X", data, zapperNoLight|zapperTrigger)
+	}
+}
+
+func TestZapperSensesLightAfterBeam(t *testing.T) {
+	beam := &testBeam{}
+	z := NewZapper(beam)
+	z.SetFrameBuffer(testFrameBuffer{x0: 40, y0: 90, x1: 60, y1: 110})
+
+	for _, test := range []struct {
+		name          string
+		x, y          int
+		dot, scanline int
+		light         bool
+	}{
+		{"before the beam", 50, 100, 10, 100, false},
+		// The pixel x is drawn on dot x+1.
+		{"as the beam draws the pixel", 50, 100, 51, 100, false},
+		{"just after the beam", 50, 100, 52, 100, true},
+		{"a scanline later", 50, 100, 0, 101, true},
+		{"still glowing", 50, 100, 0, 100 + zapperSenseScanlines - 1, true},
+		{"faded", 50, 100, 0, 100 + zapperSenseScanlines, false},
+		{"dark pixel", 20, 100, 0, 101, false},
+		{"off the screen", -1, 100, 0, 101, false},
+	} {
+		z.Aim(test.x, test.y)
+		beam.dot, beam.scanline = test.dot, test.scanline
+
+		if light := z.Peek()&zapperNoLight == 0; light != test.light {
+			t.Errorf("%s: light sensed %v, want %v", test.name, light, test.light)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+// Package mapper implements the cartridge boards, which map the ROM and the
+// RAM of the cartridge to the address space of the CPU.
+package mapper
+
+import (
+	"fmt"
+
+	"github.com/pqkallio/nes-emulator/emulator/bus"
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+// Mapper is a cartridge board. It is mapped to the bus over $6000-$FFFF and
+// is passed the full CPU address.
+type Mapper interface {
+	bus.Device
+	// PrgOffset returns the offset into the PRG ROM the address is mapped
+	// to, or -1 if no PRG ROM is mapped at the address.
+	PrgOffset(addr uint16) int
+	// Power puts the board in the power-up state. The PRG RAM is cleared
+	// unless it is battery-backed.
+	Power()
+}
+
+// NewMapper returns the mapper of the board the ROM file declares.
+func NewMapper(r *rom.ROM) (Mapper, error) {
+	switch r.MapperNumber() {
+	case 0:
+		return newNrom(r)
+	default:
+		return nil, fmt.Errorf("mapper %d is not supported", r.MapperNumber())
+	}
+}
@@ -0,0 +1,56 @@
+package mapper
+
+import (
+	"fmt"
+
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+// nrom is the board without bank switching, mapper 0. The 16 KiB PRG ROM of
+// NROM-128 is mirrored over $8000-$FFFF. Family Basic carts have 8 KiB of PRG
+// RAM at $6000-$7FFF; it is emulated for all the boards.
+type nrom struct {
+	prg    []uint8
+	chr    []uint8
+	prgRam [0x2000]uint8
+	// battery tells whether the PRG RAM is battery-backed and kept over
+	// a power cycle.
+	battery bool
+}
+
+func newNrom(r *rom.ROM) (*nrom, error) {
+	prg := r.PrgROM()
+	if len(prg) != rom.PrgROMBankSize && len(prg) != 2*rom.PrgROMBankSize {
+		return nil, fmt.Errorf("invalid NROM PRG ROM size %d", len(prg))
+	}
+
+	return &nrom{prg: prg, chr: r.ChrROM(), battery: r.HasBattery()}, nil
+}
+
+func (m *nrom) Read(addr uint16) uint8 {
+	if addr < 0x8000 {
+		return m.prgRam[addr&0x1fff]
+	}
+
+	return m.prg[m.PrgOffset(addr)]
+}
+
+func (m *nrom) Write(addr uint16, data uint8) {
+	if addr < 0x8000 {
+		m.prgRam[addr&0x1fff] = data
+	}
+}
+
+func (m *nrom) Power() {
+	if !m.battery {
+		m.prgRam = [0x2000]uint8{}
+	}
+}
+
+func (m *nrom) PrgOffset(addr uint16) int {
+	if addr < 0x8000 {
+		return -1
+	}
+
+	return int(addr-0x8000) % len(m.prg)
+}
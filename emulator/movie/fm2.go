@@ -0,0 +1,349 @@
+// Package movie records and plays back input movies in the .fm2 text format
+// of FCEUX: the buttons of the joypads and the reset and power commands of
+// every frame from the power-on.
+package movie
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pqkallio/nes-emulator/emulator/input"
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+const (
+	// fm2Version is the version of the format written.
+	fm2Version = 3
+	// emuVersion is written as the version of the emulator; the movies are
+	// not made with FCEUX.
+	emuVersion = 0
+
+	// gamepadPort and noPort are the devices of port0 and port1 the movies
+	// can have, a joypad or nothing.
+	gamepadPort = 1
+	noPort      = 0
+
+	// gamepadButtons are the buttons of a joypad in the order they are
+	// written, each as its letter when held and a dot when not.
+	gamepadButtons = "RLDUTSBA"
+)
+
+// Command is an event of a frame, other than the input.
+type Command uint8
+
+const (
+	SoftReset Command = 1 << iota
+	PowerCycle
+	FdsInsert
+	FdsSelect
+	VsInsertCoin
+)
+
+// gamepadOrder are the buttons of gamepadButtons.
+var gamepadOrder = [len(gamepadButtons)]input.Buttons{
+	input.ButtonRight, input.ButtonLeft, input.ButtonDown, input.ButtonUp,
+	input.ButtonStart, input.ButtonSelect, input.ButtonB, input.ButtonA,
+}
+
+// Frame is the input of a frame: the commands run at its start and the
+// buttons held on the joypads of the players, two or four.
+type Frame struct {
+	Commands Command
+	Buttons  [4]input.Buttons
+}
+
+// Movie is an .fm2 movie.
+type Movie struct {
+	// RerecordCount is the number of times the movie was re-recorded.
+	RerecordCount int
+	Pal           bool
+	RomFilename   string
+	// RomChecksum is the MD5 of the ROM's PRG and CHR ROM, as written by
+	// Checksum.
+	RomChecksum string
+	GUID        string
+	// FourScore tells whether the joypads of four players are recorded.
+	FourScore bool
+	// Ports tell whether a joypad is plugged into the ports. They are
+	// ignored with a Four Score.
+	Ports [2]bool
+	// Comments are the comment lines of the header, e.g. "author name".
+	Comments []string
+	Frames   []Frame
+}
+
+// New returns an empty movie of the ROM with joypads in both ports.
+func New(r *rom.ROM, romFilename string) *Movie {
+	return &Movie{
+		RomFilename: romFilename,
+		RomChecksum: Checksum(r),
+		GUID:        newGUID(),
+		Ports:       [2]bool{true, true},
+	}
+}
+
+// Checksum returns the checksum of the ROM as written in the movies.
+func Checksum(r *rom.ROM) string {
+	h := md5.New()
+	h.Write(r.PrgROM())
+	h.Write(r.ChrROM())
+
+	return "base64:" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func newGUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "00000000-0000-0000-0000-000000000000"
+	}
+
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Players returns the number of players whose joypads are recorded.
+func (m *Movie) Players() int {
+	if m.FourScore {
+		return 4
+	}
+
+	return 2
+}
+
+// Read reads an .fm2 movie. Only the movies of joypads starting from the
+// power-on are supported, not the ones with binary input or starting from
+// a savestate.
+func Read(r io.Reader) (*Movie, error) {
+	m := &Movie{}
+	haveVersion := false
+	lineNumber := 0
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if line == "" {
+			continue
+		}
+
+		if line[0] == '|' {
+			f, err := m.parseFrame(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+
+			m.Frames = append(m.Frames, f)
+
+			continue
+		}
+
+		if err := m.parseHeader(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		if strings.HasPrefix(line, "version ") {
+			haveVersion = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !haveVersion {
+		return nil, fmt.Errorf("not an fm2 movie")
+	}
+
+	return m, nil
+}
+
+func (m *Movie) parseHeader(line string) error {
+	key, value := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		key, value = line[:i], line[i+1:]
+	}
+
+	flag := func() (bool, error) {
+		switch value {
+		case "0":
+			return false, nil
+		case "1":
+			return true, nil
+		}
+
+		return false, fmt.Errorf("invalid %s %q", key, value)
+	}
+
+	var err error
+
+	switch key {
+	case "version":
+		var v int
+		if v, err = strconv.Atoi(value); err == nil && v != fm2Version {
+			return fmt.Errorf("unsupported fm2 version %d", v)
+		}
+	case "rerecordCount":
+		m.RerecordCount, err = strconv.Atoi(value)
+	case "palFlag":
+		m.Pal, err = flag()
+	case "romFilename":
+		m.RomFilename = value
+	case "romChecksum":
+		m.RomChecksum = value
+	case "guid":
+		m.GUID = value
+	case "fourscore":
+		m.FourScore, err = flag()
+	case "port0", "port1":
+		port := int(key[4] - '0')
+
+		switch value {
+		case strconv.Itoa(gamepadPort):
+			m.Ports[port] = true
+		case strconv.Itoa(noPort):
+			m.Ports[port] = false
+		default:
+			return fmt.Errorf("unsupported %s device %q", key, value)
+		}
+	case "port2":
+		if value != "0" {
+			return fmt.Errorf("unsupported expansion port device %q", value)
+		}
+	case "binary":
+		var binary bool
+		if binary, err = flag(); err == nil && binary {
+			return fmt.Errorf("binary input is not supported")
+		}
+	case "savestate":
+		return fmt.Errorf("movies starting from a savestate are not supported")
+	case "comment":
+		m.Comments = append(m.Comments, value)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", key, value)
+	}
+
+	return nil
+}
+
+// parseFrame parses an input line: |commands|port0|port1|port2|, or with a
+// Four Score |commands|player1|player2|player3|player4|port2|.
+func (m *Movie) parseFrame(line string) (Frame, error) {
+	var f Frame
+
+	fields := strings.Split(line, "|")
+	if len(fields) < 4 || fields[len(fields)-1] != "" {
+		return f, fmt.Errorf("invalid input %q", line)
+	}
+
+	fields = fields[1 : len(fields)-1]
+
+	commands, err := strconv.Atoi(fields[0])
+	if err != nil || commands < 0 || commands > 0xff {
+		return f, fmt.Errorf("invalid commands %q", fields[0])
+	}
+
+	f.Commands = Command(commands)
+
+	// The fields of the joypads, followed by the expansion port's.
+	pads := fields[1 : len(fields)-1]
+	if len(pads) != m.Players() {
+		return f, fmt.Errorf("invalid input %q", line)
+	}
+
+	for player, pad := range pads {
+		if pad == "" {
+			continue
+		}
+
+		if len(pad) != len(gamepadButtons) {
+			return f, fmt.Errorf("invalid joypad input %q", pad)
+		}
+
+		for i, c := range []byte(pad) {
+			if c != '.' && c != ' ' {
+				f.Buttons[player] |= gamepadOrder[i]
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// Write writes the movie in the .fm2 format.
+func (m *Movie) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	flag := func(b bool) int {
+		if b {
+			return 1
+		}
+
+		return 0
+	}
+
+	port := func(plugged bool) int {
+		if plugged {
+			return gamepadPort
+		}
+
+		return noPort
+	}
+
+	fmt.Fprintf(bw, "version %d\n", fm2Version)
+	fmt.Fprintf(bw, "emuVersion %d\n", emuVersion)
+	fmt.Fprintf(bw, "rerecordCount %d\n", m.RerecordCount)
+	fmt.Fprintf(bw, "palFlag %d\n", flag(m.Pal))
+	fmt.Fprintf(bw, "romFilename %s\n", m.RomFilename)
+	fmt.Fprintf(bw, "romChecksum %s\n", m.RomChecksum)
+	fmt.Fprintf(bw, "guid %s\n", m.GUID)
+	fmt.Fprintf(bw, "fourscore %d\n", flag(m.FourScore))
+	fmt.Fprintf(bw, "microphone 0\n")
+	fmt.Fprintf(bw, "port0 %d\n", port(m.Ports[0] && !m.FourScore))
+	fmt.Fprintf(bw, "port1 %d\n", port(m.Ports[1] && !m.FourScore))
+	fmt.Fprintf(bw, "port2 0\n")
+	fmt.Fprintf(bw, "FDS 0\n")
+	fmt.Fprintf(bw, "NewPPU 0\n")
+
+	for _, c := range m.Comments {
+		fmt.Fprintf(bw, "comment %s\n", c)
+	}
+
+	for _, f := range m.Frames {
+		fmt.Fprintf(bw, "|%d|", f.Commands)
+
+		for player := 0; player < m.Players(); player++ {
+			if m.FourScore || m.Ports[player] {
+				bw.WriteString(gamepad(f.Buttons[player]))
+			}
+
+			bw.WriteByte('|')
+		}
+
+		bw.WriteString("|\n")
+	}
+
+	return bw.Flush()
+}
+
+// gamepad returns the buttons as written in the input lines.
+func gamepad(b input.Buttons) string {
+	var s [len(gamepadButtons)]byte
+
+	for i, button := range gamepadOrder {
+		s[i] = '.'
+		if b&button != 0 {
+			s[i] = gamepadButtons[i]
+		}
+	}
+
+	return string(s[:])
+}
@@ -0,0 +1,164 @@
+package movie
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/emulator/input"
+)
+
+func TestWriteRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		movie Movie
+	}{
+		{"two ports", Movie{
+			RerecordCount: 3,
+			RomFilename:   "game.nes",
+			RomChecksum:   "base64:jjYwGG411HcjG/j9UOVM3Q==",
+			GUID:          "6E5CD7B4-3E4F-49A4-A2D7-B1F1D66DD3F2",
+			Ports:         [2]bool{true, true},
+			Comments:      []string{"author someone", "a second comment"},
+			Frames: []Frame{
+				{Commands: PowerCycle},
+				{Buttons: [4]input.Buttons{input.ButtonStart, input.ButtonA | input.ButtonB}},
+				{Commands: SoftReset, Buttons: [4]input.Buttons{input.ButtonRight | input.ButtonUp}},
+				{},
+			},
+		}},
+		{"one port", Movie{
+			RomFilename: "game.nes",
+			Ports:       [2]bool{true, false},
+			Frames: []Frame{
+				{Buttons: [4]input.Buttons{input.ButtonLeft | input.ButtonDown | input.ButtonSelect}},
+				{},
+			},
+		}},
+		{"second port", Movie{
+			Ports:  [2]bool{false, true},
+			Frames: []Frame{{Buttons: [4]input.Buttons{1: input.ButtonA}}},
+		}},
+		{"Four Score", Movie{
+			FourScore: true,
+			Frames: []Frame{
+				{Buttons: [4]input.Buttons{input.ButtonA, input.ButtonB, input.ButtonStart, input.ButtonSelect}},
+				{Commands: SoftReset, Buttons: [4]input.Buttons{3: 0xff}},
+			},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := test.movie.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := Read(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*m, test.movie) {
+				t.Errorf("got %+v, want %+v", *m, test.movie)
+			}
+		})
+	}
+}
+
+func TestWriteInputLines(t *testing.T) {
+	m := Movie{
+		Ports:  [2]bool{true, false},
+		Frames: []Frame{{Commands: SoftReset, Buttons: [4]input.Buttons{input.ButtonRight | input.ButtonA, input.ButtonB}}},
+	}
+
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The joypad of the empty port isn't written.
+	if !strings.HasSuffix(buf.String(), "\n|1|R......A|||\n") {
+		t.Errorf("got\n%s", buf.String())
+	}
+}
+
+// fceuxMovie is the start of a movie recorded with FCEUX on Windows.
+const fceuxMovie = "version 3\r\n" +
+	"emuVersion 22020\r\n" +
+	"rerecordCount 1234\r\n" +
+	"palFlag 0\r\n" +
+	"romFilename Super Mario Bros.\r\n" +
+	"romChecksum base64:jjYwGG411HcjG/j9UOVM3Q==\r\n" +
+	"guid 6E5CD7B4-3E4F-49A4-A2D7-B1F1D66DD3F2\r\n" +
+	"fourscore 0\r\n" +
+	"microphone 0\r\n" +
+	"port0 1\r\n" +
+	"port1 0\r\n" +
+	"port2 0\r\n" +
+	"FDS 0\r\n" +
+	"NewPPU 0\r\n" +
+	"RAMInitOption 0\r\n" +
+	"RAMInitSeed 0\r\n" +
+	"comment author someone\r\n" +
+	"subtitle 120 Press start\r\n" +
+	"|1|........|||\r\n" +
+	"|0|....T...|||\r\n" +
+	"\r\n" +
+	"|0|R......A|||\r\n"
+
+func TestReadFceuxMovie(t *testing.T) {
+	m, err := Read(strings.NewReader(fceuxMovie))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Movie{
+		RerecordCount: 1234,
+		RomFilename:   "Super Mario Bros.",
+		RomChecksum:   "base64:jjYwGG411HcjG/j9UOVM3Q==",
+		GUID:          "6E5CD7B4-3E4F-49A4-A2D7-B1F1D66DD3F2",
+		Ports:         [2]bool{true, false},
+		Comments:      []string{"author someone"},
+		Frames: []Frame{
+			{Commands: SoftReset},
+			{Buttons: [4]input.Buttons{input.ButtonStart}},
+			{Buttons: [4]input.Buttons{input.ButtonRight | input.ButtonA}},
+		},
+	}
+
+	if !reflect.DeepEqual(*m, want) {
+		t.Errorf("got %+v, want %+v", *m, want)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		movie string
+		want  string
+	}{
+		{"no version", "rerecordCount 1\n|0|........|........||\n", "not an fm2 movie"},
+		{"unsupported version", "version 2\n", "line 1: unsupported fm2 version 2"},
+		{"savestate", "version 3\nsavestate base64:AAAA\n", "line 2: movies starting from a savestate"},
+		{"binary", "version 3\nbinary 1\n", "line 2: binary input is not supported"},
+		{"invalid flag", "version 3\npalFlag 2\n", "line 2: invalid palFlag"},
+		{"zapper", "version 3\nport1 2\n", "line 2: unsupported port1 device"},
+		{"missing joypad", "version 3\n|0|........||\n", "line 2: invalid input"},
+		{"extra joypad", "version 3\nfourscore 0\n|0|........|........|........||\n", "line 3: invalid input"},
+		{"short joypad", "version 3\n|0|.......|........||\n", "line 2: invalid joypad input"},
+		{"invalid commands", "version 3\n|x|........|........||\n", "line 2: invalid commands"},
+		{"unterminated", "version 3\n|0|........|........|", "line 2: invalid input"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(test.movie))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want ...%s...", err, test.want)
+			}
+		})
+	}
+}
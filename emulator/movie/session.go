@@ -0,0 +1,224 @@
+package movie
+
+import (
+	"fmt"
+
+	"github.com/pqkallio/nes-emulator/emulator/console"
+	"github.com/pqkallio/nes-emulator/emulator/input"
+)
+
+// Mode is how a movie is played back.
+type Mode int
+
+const (
+	// ReadOnly plays the movie back as it is.
+	ReadOnly Mode = iota
+	// ReadWrite plays the movie back and lets it be re-recorded.
+	ReadWrite
+)
+
+// Session records or plays back a movie on a console, which it runs a frame
+// at a time from the power-on.
+type Session struct {
+	nes       *console.Console
+	movie     *Movie
+	mode      Mode
+	recording bool
+	// frame is the number of frames run.
+	frame int
+	// commands are recorded and run at the start of the next frame.
+	commands Command
+}
+
+// Record plugs in the joypads of the movie, powers the console on and
+// starts recording to the movie from its first frame. The frames the movie
+// had are discarded. The buttons recorded are the ones held on the joypads
+// of the console's ports, set with their SetButtons.
+func Record(nes *console.Console, m *Movie) (*Session, error) {
+	s := &Session{nes: nes, movie: m, mode: ReadWrite, recording: true}
+
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+
+	m.Frames = nil
+
+	return s, nil
+}
+
+// Play plugs in the joypads of the movie, powers the console on and plays
+// the movie back in the mode. Once the movie ends, the console runs with
+// the buttons held on its joypads.
+func Play(nes *console.Console, m *Movie, mode Mode) (*Session, error) {
+	s := &Session{nes: nes, movie: m, mode: mode}
+
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Session) start() error {
+	if s.movie.Pal {
+		return fmt.Errorf("PAL movies are not supported")
+	}
+
+	ports := s.nes.Input
+	ports.SetExpansion(nil)
+
+	if s.movie.FourScore {
+		ports.PlugAdapter(input.NewFourScore())
+	} else {
+		for port, plugged := range s.movie.Ports {
+			var d input.Device
+			if plugged {
+				d = input.NewJoypad()
+			}
+
+			if err := ports.Plug(port, d); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.power()
+
+	return nil
+}
+
+// power powers the console on with no buttons held.
+func (s *Session) power() {
+	for player := 0; player < s.movie.Players(); player++ {
+		s.nes.Input.SetButtons(player, 0)
+	}
+
+	s.nes.Power()
+	s.frame = 0
+	s.commands = 0
+}
+
+// Movie returns the movie recorded or played back.
+func (s *Session) Movie() *Movie {
+	return s.movie
+}
+
+// Frame returns the number of frames run since the power-on.
+func (s *Session) Frame() int {
+	return s.frame
+}
+
+// Recording returns whether the session records the frames run.
+func (s *Session) Recording() bool {
+	return s.recording
+}
+
+// Finished returns whether the movie played back has ended.
+func (s *Session) Finished() bool {
+	return !s.recording && s.frame >= len(s.movie.Frames)
+}
+
+// Mode returns the mode of the playback.
+func (s *Session) Mode() Mode {
+	return s.mode
+}
+
+// SetMode sets the mode of the playback, e.g. to protect the movie from
+// being re-recorded. A recording is stopped when the mode is set to
+// ReadOnly; the frames recorded are kept and the movie is played back from
+// there.
+func (s *Session) SetMode(mode Mode) {
+	s.mode = mode
+
+	if mode == ReadOnly {
+		s.recording = false
+	}
+}
+
+// Reset presses the reset button at the start of the next frame recorded.
+// It does nothing during the playback.
+func (s *Session) Reset() {
+	if s.recording {
+		s.commands |= SoftReset
+	}
+}
+
+// Power turns the console off and on at the start of the next frame
+// recorded. It does nothing during the playback.
+func (s *Session) Power() {
+	if s.recording {
+		s.commands |= PowerCycle
+	}
+}
+
+// RunFrame runs the console for a frame with the input of the movie's next
+// frame, or, while recording, with the buttons held on the console's
+// joypads and records them.
+func (s *Session) RunFrame() {
+	var f Frame
+
+	switch {
+	case s.recording:
+		f.Commands = s.commands
+		s.commands = 0
+
+		for player := 0; player < s.movie.Players(); player++ {
+			if j := s.nes.Input.Joypad(player); j != nil {
+				f.Buttons[player] = j.Buttons()
+			}
+		}
+
+		s.movie.Frames = append(s.movie.Frames, f)
+	case s.frame < len(s.movie.Frames):
+		f = s.movie.Frames[s.frame]
+
+		for player := 0; player < s.movie.Players(); player++ {
+			s.nes.Input.SetButtons(player, f.Buttons[player])
+		}
+	}
+
+	s.run(f.Commands)
+}
+
+// run runs the commands and the console to the start of the next frame.
+func (s *Session) run(commands Command) {
+	if commands&PowerCycle != 0 {
+		s.nes.Power()
+	} else if commands&SoftReset != 0 {
+		s.nes.Reset()
+	}
+
+	start := s.nes.Ppu.Frame()
+	for s.nes.Ppu.Frame() == start {
+		s.nes.Tick()
+	}
+
+	s.frame++
+}
+
+// Rerecord takes over the movie at the frame: the console is powered on and
+// the movie played back up to the frame, the frames after it are discarded
+// and the session records from there. The re-record count of the movie is
+// incremented. The mode must be ReadWrite.
+func (s *Session) Rerecord(frame int) error {
+	if s.mode != ReadWrite {
+		return fmt.Errorf("the movie is read-only")
+	}
+
+	if frame < 0 || frame > len(s.movie.Frames) {
+		return fmt.Errorf("frame %d is outside the movie of %d frames", frame, len(s.movie.Frames))
+	}
+
+	s.recording = false
+	s.power()
+
+	for s.frame < frame {
+		s.RunFrame()
+	}
+
+	s.movie.Frames = s.movie.Frames[:frame]
+	s.movie.RerecordCount++
+	s.recording = true
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package movie
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/emulator/console"
+	"github.com/pqkallio/nes-emulator/emulator/cpu/asm"
+	"github.com/pqkallio/nes-emulator/emulator/input"
+	"github.com/pqkallio/nes-emulator/rom"
+)
+
+// sessionProgram reads the joypads in a loop and logs their buttons to the
+// RAM, so the RAM tells the input of every frame. It also counts the loops
+// in the PRG RAM and copies the count to $10, so the RAM tells whether the
+// PRG RAM was cleared on the power-on.
+const sessionProgram = `
+	.org $c000
+reset:	SEI
+	LDX #$ff
+	TXS
+loop:	INC $6000
+	LDA $6000
+	STA $10
+	LDA #1
+	STA $4016
+	LDA #0
+	STA $4016
+	LDX #8
+read:	LDA $4016
+	LSR A
+	ROL $00
+	LDA $4017
+	LSR A
+	ROL $01
+	DEX
+	BNE read
+	LDX $02
+	LDA $00
+	STA $0200,X
+	LDA $01
+	STA $0300,X
+	INC $02
+	JMP loop
+
+	.org $fffa
+	.word reset, reset, reset
+`
+
+func newSessionRom(t *testing.T) *rom.ROM {
+	t.Helper()
+
+	p, err := asm.Assemble(sessionProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nes, err := p.NROM(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "session.nes")
+	if err := os.WriteFile(path, nes, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := rom.ParseNesFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func newSessionConsole(t *testing.T, r *rom.ROM) *console.Console {
+	t.Helper()
+
+	nes, err := console.NewConsole(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nes
+}
+
+// ramState returns the internal RAM of the console.
+func ramState(nes *console.Console) []uint8 {
+	state := make([]uint8, 0x800)
+	for i := range state {
+		state[i] = nes.Bus.Peek(uint16(i))
+	}
+
+	return state
+}
+
+// recordFrames records the frames with the buttons returned by the input
+// function, and returns the RAM after each frame.
+func recordFrames(s *Session, nes *console.Console, frames int, buttons func(frame int) (input.Buttons, input.Buttons)) [][]uint8 {
+	var states [][]uint8
+
+	for i := 0; i < frames; i++ {
+		pad0, pad1 := buttons(s.Frame())
+		nes.Input.SetButtons(0, pad0)
+		nes.Input.SetButtons(1, pad1)
+
+		if s.Frame() == 6 {
+			s.Reset()
+		}
+
+		s.RunFrame()
+		states = append(states, ramState(nes))
+	}
+
+	return states
+}
+
+// checkPlayback plays the movie back on a new console and checks the RAM
+// after each frame.
+func checkPlayback(t *testing.T, r *rom.ROM, m *Movie, want [][]uint8) {
+	t.Helper()
+
+	nes := newSessionConsole(t, r)
+
+	s, err := Play(nes, m, ReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range want {
+		s.RunFrame()
+
+		if !bytes.Equal(ramState(nes), want[i]) {
+			t.Fatalf("the RAM differs after frame %d", i)
+		}
+	}
+
+	if !s.Finished() {
+		t.Errorf("the playback isn't finished after %d frames", s.Frame())
+	}
+}
+
+func TestRecordPlayRerecord(t *testing.T) {
+	r := newSessionRom(t)
+	nes := newSessionConsole(t, r)
+	m := New(r, "session.nes")
+
+	s, err := Record(nes, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := recordFrames(s, nes, 12, func(frame int) (input.Buttons, input.Buttons) {
+		return input.Buttons(frame * 3), input.Buttons(0xff - frame)
+	})
+
+	if len(m.Frames) != 12 || m.Frames[6].Commands != SoftReset || m.Frames[5].Buttons[0] != 15 {
+		t.Fatalf("got the frames %+v", m.Frames)
+	}
+
+	// The movie is played back the same after it is saved and loaded.
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkPlayback(t, r, loaded, recorded)
+
+	// A re-record replays the frames before it and records other input
+	// after them.
+	if err := s.Rerecord(8); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Frame() != 8 || !s.Recording() || len(m.Frames) != 8 || m.RerecordCount != 1 {
+		t.Fatalf("at frame %d, recording %v, got %d frames and %d re-records", s.Frame(), s.Recording(), len(m.Frames), m.RerecordCount)
+	}
+
+	if !bytes.Equal(ramState(nes), recorded[7]) {
+		t.Fatal("the RAM differs after the frames replayed")
+	}
+
+	rerecorded := recordFrames(s, nes, 6, func(frame int) (input.Buttons, input.Buttons) {
+		return input.ButtonStart, 0
+	})
+
+	if bytes.Equal(rerecorded[0], recorded[8]) {
+		t.Error("the re-recorded input didn't change the RAM")
+	}
+
+	checkPlayback(t, r, m, append(recorded[:8:8], rerecorded...))
+
+	if err := s.Rerecord(len(m.Frames) + 1); err == nil {
+		t.Error("a frame after the end of the movie was re-recorded")
+	}
+
+	s.SetMode(ReadOnly)
+
+	if err := s.Rerecord(0); err == nil {
+		t.Error("a read-only movie was re-recorded")
+	}
+}
@@ -0,0 +1,38 @@
+package ppu
+
+// ioLatchDecayDots is roughly how long a bit of the I/O latch holds its value
+// without being refreshed, about 600 ms.
+const ioLatchDecayDots = 3_200_000
+
+// ioLatch models the capacitance of the data bus between the CPU and the PPU.
+// Every write to a PPU register and every read of the bits a register drives
+// refreshes the latch. Reading a write-only register, or the bits of a
+// register that are not driven, returns the latch. Each bit decays to zero
+// on its own if it isn't refreshed.
+type ioLatch struct {
+	value     uint8
+	refreshed [8]uint64
+}
+
+// refresh sets the bits of the latch selected by the mask.
+func (l *ioLatch) refresh(data, mask uint8, now uint64) {
+	l.value = l.value&^mask | data&mask
+
+	for bit := 0; bit < 8; bit++ {
+		if mask&(1<<bit) != 0 {
+			l.refreshed[bit] = now
+		}
+	}
+}
+
+// read returns the value of the latch, with the bits that have decayed
+// cleared.
+func (l *ioLatch) read(now uint64) uint8 {
+	for bit := 0; bit < 8; bit++ {
+		if now-l.refreshed[bit] > ioLatchDecayDots {
+			l.value &^= 1 << bit
+		}
+	}
+
+	return l.value
+}
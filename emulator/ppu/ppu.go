@@ -0,0 +1,114 @@
+// Package ppu emulates the 2C02 picture processing unit. Only the timing and
+// the CPU facing register port are emulated so far; there is no rendering.
+package ppu
+
+const (
+	dotsPerScanline    = 341
+	scanlinesPerFrame  = 262
+	vblankScanline     = 241
+	preRenderScanline  = 261
+	showBackgroundFlag = 0b0000_1000
+	showSpritesFlag    = 0b0001_0000
+	nmiEnableFlag      = 0b1000_0000
+)
+
+// Status register flags.
+const (
+	spriteOverflowFlag uint8 = 0b0010_0000
+	spriteZeroHitFlag  uint8 = 0b0100_0000
+	vblankFlag         uint8 = 0b1000_0000
+)
+
+type Ppu struct {
+	dot      int
+	scanline int
+	frame    uint64
+	dots     uint64
+
+	ctrl    uint8
+	mask    uint8
+	status  uint8
+	oamAddr uint8
+	oam     [256]uint8
+
+	// writeToggle selects between the first and the second write to the
+	// $2005 and $2006 registers.
+	writeToggle bool
+
+	ioLatch ioLatch
+}
+
+func NewPpu() *Ppu {
+	return &Ppu{}
+}
+
+// Tick advances the PPU by one dot. The PPU runs three dots per CPU cycle.
+func (p *Ppu) Tick() {
+	p.dots++
+	p.dot++
+
+	if p.dot == dotsPerScanline {
+		p.dot = 0
+		p.scanline++
+
+		if p.scanline == scanlinesPerFrame {
+			p.scanline = 0
+			p.frame++
+
+			// The first dot of odd frames is skipped when rendering is on.
+			if p.frame%2 == 1 && p.renderingEnabled() {
+				p.dot = 1
+			}
+		}
+	}
+
+	if p.dot == 1 {
+		switch p.scanline {
+		case vblankScanline:
+			p.status |= vblankFlag
+		case preRenderScanline:
+			p.status &^= vblankFlag | spriteZeroHitFlag | spriteOverflowFlag
+		}
+	}
+}
+
+// Reset resets the PPU.
+func (p *Ppu) Reset() {
+	p.ctrl = 0
+	p.mask = 0
+	p.writeToggle = false
+	p.dot = 0
+	p.scanline = 0
+}
+
+// Power puts the PPU in the power-up state, like turning the console off
+// and on. The frame count keeps counting.
+func (p *Ppu) Power() {
+	*p = Ppu{frame: p.frame}
+}
+
+// Dot returns the dot the PPU is on, 0-340.
+func (p *Ppu) Dot() int {
+	return p.dot
+}
+
+// Scanline returns the scanline the PPU is on, 0-261. Scanline 261 is the
+// pre-render scanline.
+func (p *Ppu) Scanline() int {
+	return p.scanline
+}
+
+// Frame returns the number of frames the PPU has completed.
+func (p *Ppu) Frame() uint64 {
+	return p.frame
+}
+
+func (p *Ppu) renderingEnabled() bool {
+	return p.mask&(showBackgroundFlag|showSpritesFlag) != 0
+}
+
+// NmiLine tells whether the PPU asserts the NMI line of the CPU. It is
+// asserted during the vertical blank if the NMI is enabled in $2000.
+func (p *Ppu) NmiLine() bool {
+	return p.status&vblankFlag != 0 && p.ctrl&nmiEnableFlag != 0
+}
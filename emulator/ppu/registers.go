@@ -0,0 +1,78 @@
+package ppu
+
+// The registers are mirrored every eight bytes over $2000-$3FFF.
+const (
+	ppuCtrl   uint16 = 0x2000
+	ppuMask   uint16 = 0x2001
+	ppuStatus uint16 = 0x2002
+	oamAddr   uint16 = 0x2003
+	oamData   uint16 = 0x2004
+	ppuScroll uint16 = 0x2005
+	ppuAddr   uint16 = 0x2006
+	ppuData   uint16 = 0x2007
+)
+
+// Read reads a PPU register. The register is selected by the low three bits
+// of the address.
+func (p *Ppu) Read(addr uint16) uint8 {
+	switch 0x2000 | addr&0x0007 {
+	case ppuStatus:
+		// Only the top three bits are driven, the rest come from the latch.
+		data := p.status & 0xe0
+		p.ioLatch.refresh(data, 0xe0, p.dots)
+
+		p.status &^= vblankFlag
+		p.writeToggle = false
+	case oamData:
+		data := p.oam[p.oamAddr]
+		if p.oamAddr&0x03 == 0x02 {
+			// The unused bits of the sprite attributes don't exist.
+			data &= 0xe3
+		}
+
+		p.ioLatch.refresh(data, 0xff, p.dots)
+	}
+
+	// Reading a write-only register returns the latch. The VRAM isn't
+	// emulated yet, so neither is reading $2007.
+	return p.ioLatch.read(p.dots)
+}
+
+// Write writes a PPU register. The register is selected by the low three bits
+// of the address.
+func (p *Ppu) Write(addr uint16, data uint8) {
+	p.ioLatch.refresh(data, 0xff, p.dots)
+
+	switch 0x2000 | addr&0x0007 {
+	case ppuCtrl:
+		p.ctrl = data
+	case ppuMask:
+		p.mask = data
+	case oamAddr:
+		p.oamAddr = data
+	case oamData:
+		p.oam[p.oamAddr] = data
+		p.oamAddr++
+	case ppuScroll, ppuAddr:
+		p.writeToggle = !p.writeToggle
+	}
+}
+
+// Peek returns the value a read of the register would return without
+// clearing the vblank flag or the write toggle.
+func (p *Ppu) Peek(addr uint16) uint8 {
+	latch := p.ioLatch.read(p.dots)
+
+	switch 0x2000 | addr&0x0007 {
+	case ppuStatus:
+		return p.status&0xe0 | latch&0x1f
+	case oamData:
+		if p.oamAddr&0x03 == 0x02 {
+			return p.oam[p.oamAddr] & 0xe3
+		}
+
+		return p.oam[p.oamAddr]
+	default:
+		return latch
+	}
+}
@@ -0,0 +1,59 @@
+package profiler
+
+// The cycle budgets of an NTSC frame.
+const (
+	// FrameCycles is the number of CPU cycles from an NMI to the next,
+	// rounded down from 29780.5.
+	FrameCycles = 29780
+	// VblankCycles is the number of CPU cycles of the vertical blank, the
+	// time the NMI handler has to update the PPU before the rendering
+	// starts, rounded down from 20 scanlines of 341 dots.
+	VblankCycles = 2273
+)
+
+// Frame is the usage of the cycles of a frame. A frame starts with an NMI
+// and ends with the next one.
+type Frame struct {
+	// Number counts the frames from the first NMI profiled.
+	Number int
+	// Start is the CPU cycle the NMI sequence started on.
+	Start uint64
+	// Cycles is the length of the frame.
+	Cycles uint64
+	// Nmi is the number of cycles from the start of the frame until the
+	// NMI handler returned, or the whole frame if it didn't return.
+	Nmi uint64
+	// NmiReturned tells whether the NMI handler returned in the frame.
+	NmiReturned bool
+	// Idle is the number of cycles spent in the idle loop, see AddIdle.
+	Idle uint64
+}
+
+// Busy returns the number of cycles the frame didn't spend idle.
+func (f Frame) Busy() uint64 {
+	return f.Cycles - f.Idle
+}
+
+// OverVblank tells whether the NMI handler ran past the vertical blank.
+func (f Frame) OverVblank() bool {
+	return f.Nmi > VblankCycles
+}
+
+// Frames returns the frames that have ended.
+func (p *Profiler) Frames() []Frame {
+	return p.frames
+}
+
+func (p *Profiler) startFrame(start uint64) {
+	if p.frame != nil {
+		p.frame.Cycles = start - p.frame.Start
+		if !p.frame.NmiReturned {
+			p.frame.Nmi = p.frame.Cycles
+		}
+
+		p.frames = append(p.frames, *p.frame)
+	}
+
+	p.frame = &Frame{Number: p.frameCount, Start: start}
+	p.frameCount++
+}
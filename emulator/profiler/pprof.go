@@ -0,0 +1,252 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// cpuFrequency is the clock rate of the NTSC CPU in Hz.
+const cpuFrequency = 1789773
+
+// Lines gives the source lines of the addresses, e.g. from the debug
+// symbols of the program. *symbols.View implements it.
+type Lines interface {
+	Line(addr uint16) (string, int, bool)
+}
+
+// The field numbers of the messages of profile.proto.
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationId = 1
+	sampleValue      = 2
+
+	locationId      = 1
+	locationAddress = 3
+	locationLine    = 4
+
+	lineFunctionId = 1
+	lineLine       = 2
+
+	functionId        = 1
+	functionName      = 2
+	functionFilename  = 4
+	functionStartLine = 5
+)
+
+// WritePprof writes the profile in the gzipped protocol buffer format of
+// pprof, e.g. for go tool pprof. A sample is the number of cycles spent in
+// an instruction with a call stack. If the labels set with SetLabels also
+// implement Lines, the instructions are mapped to their source lines.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	b := pprofBuilder{p: p, strings: map[string]int{"": 0}, stringTable: []string{""}}
+
+	if lines, ok := p.labels.(Lines); ok {
+		b.lines = lines
+	}
+
+	b.functions = map[Location]uint64{}
+	b.locations = map[locationKey]uint64{}
+
+	cycles := b.string("cycles")
+	count := b.string("count")
+
+	var valueType protoBuffer
+	valueType.varint(valueTypeType, uint64(cycles))
+	valueType.varint(valueTypeUnit, uint64(count))
+
+	b.profile.message(profileSampleType, &valueType)
+
+	if p.root != nil {
+		b.node(p.root, nil)
+	}
+
+	b.profile.append(&b.locationsBuf)
+	b.profile.append(&b.functionsBuf)
+
+	for _, s := range b.stringTable {
+		b.profile.bytes(profileStringTable, []byte(s))
+	}
+
+	b.profile.varint(profileTimeNanos, uint64(time.Now().UnixNano()))
+	b.profile.varint(profileDurationNanos, p.Cycles()*uint64(time.Second)/cpuFrequency)
+	b.profile.message(profilePeriodType, &valueType)
+	b.profile.varint(profilePeriod, 1)
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.profile.data); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// locationKey identifies a location of the profile. The same instruction
+// may be shared by several routines.
+type locationKey struct {
+	loc     Location
+	routine Location
+}
+
+type pprofBuilder struct {
+	p     *Profiler
+	lines Lines
+
+	profile      protoBuffer
+	locationsBuf protoBuffer
+	functionsBuf protoBuffer
+
+	strings     map[string]int
+	stringTable []string
+	functions   map[Location]uint64
+	locations   map[locationKey]uint64
+}
+
+// node adds the samples of the node and its children. The stack holds the
+// location ids of the call sites of the callers, the innermost first.
+func (b *pprofBuilder) node(n *node, stack []uint64) {
+	for loc, cycles := range n.cycles {
+		if cycles == 0 {
+			continue
+		}
+
+		ids := append([]uint64{b.location(loc, n.entry)}, stack...)
+
+		var sample protoBuffer
+		sample.packed(sampleLocationId, ids)
+		sample.packed(sampleValue, []uint64{cycles})
+
+		b.profile.message(profileSample, &sample)
+	}
+
+	for _, child := range n.children {
+		callSite := b.location(child.callSite, n.entry)
+		b.node(child, append([]uint64{callSite}, stack...))
+	}
+}
+
+func (b *pprofBuilder) location(loc, routine Location) uint64 {
+	key := locationKey{loc: loc, routine: routine}
+	if id, ok := b.locations[key]; ok {
+		return id
+	}
+
+	id := uint64(len(b.locations) + 1)
+	b.locations[key] = id
+
+	var line protoBuffer
+	line.varint(lineFunctionId, b.function(routine))
+
+	if b.lines != nil {
+		if _, n, ok := b.lines.Line(loc.Addr); ok {
+			line.varint(lineLine, uint64(n))
+		}
+	}
+
+	var location protoBuffer
+	location.varint(locationId, id)
+	location.varint(locationAddress, uint64(loc.Addr))
+	location.message(locationLine, &line)
+
+	b.locationsBuf.message(profileLocation, &location)
+
+	return id
+}
+
+func (b *pprofBuilder) function(routine Location) uint64 {
+	if id, ok := b.functions[routine]; ok {
+		return id
+	}
+
+	id := uint64(len(b.functions) + 1)
+	b.functions[routine] = id
+
+	var function protoBuffer
+	function.varint(functionId, id)
+	function.varint(functionName, uint64(b.string(b.p.name(routine))))
+
+	if b.lines != nil {
+		if path, n, ok := b.lines.Line(routine.Addr); ok {
+			function.varint(functionFilename, uint64(b.string(path)))
+			function.varint(functionStartLine, uint64(n))
+		}
+	}
+
+	b.functionsBuf.message(profileFunction, &function)
+
+	return id
+}
+
+func (b *pprofBuilder) string(s string) int {
+	if i, ok := b.strings[s]; ok {
+		return i
+	}
+
+	i := len(b.stringTable)
+	b.strings[s] = i
+	b.stringTable = append(b.stringTable, s)
+
+	return i
+}
+
+// protoBuffer encodes a protocol buffer message.
+type protoBuffer struct {
+	data []byte
+}
+
+func (pb *protoBuffer) rawVarint(v uint64) {
+	for v >= 0x80 {
+		pb.data = append(pb.data, byte(v)|0x80)
+		v >>= 7
+	}
+
+	pb.data = append(pb.data, byte(v))
+}
+
+// varint encodes a field of wire type 0. Zero values are omitted like in
+// proto3.
+func (pb *protoBuffer) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	pb.rawVarint(uint64(field) << 3)
+	pb.rawVarint(v)
+}
+
+// bytes encodes a field of wire type 2.
+func (pb *protoBuffer) bytes(field int, b []byte) {
+	pb.rawVarint(uint64(field)<<3 | 2)
+	pb.rawVarint(uint64(len(b)))
+	pb.data = append(pb.data, b...)
+}
+
+func (pb *protoBuffer) message(field int, m *protoBuffer) {
+	pb.bytes(field, m.data)
+}
+
+// packed encodes a packed repeated field of varints.
+func (pb *protoBuffer) packed(field int, values []uint64) {
+	var encoded protoBuffer
+	for _, v := range values {
+		encoded.rawVarint(v)
+	}
+
+	pb.bytes(field, encoded.data)
+}
+
+func (pb *protoBuffer) append(m *protoBuffer) {
+	pb.data = append(pb.data, m.data...)
+}
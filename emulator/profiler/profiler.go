@@ -0,0 +1,267 @@
+// Package profiler attributes the cycles the CPU runs to the instructions
+// and to the routines they were called from. It follows JSR, RTS, RTI and
+// the interrupts to build a call tree, which is reported as a text summary
+// or as a pprof profile, and it measures how the frames use their cycles.
+package profiler
+
+import (
+	"fmt"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+)
+
+const (
+	brkOpCode uint8 = 0x00
+	jsrOpCode uint8 = 0x20
+	rtiOpCode uint8 = 0x40
+	rtsOpCode uint8 = 0x60
+)
+
+const (
+	stackBase uint16 = 0x0100
+	// interruptCycles is the length of the interrupt sequence.
+	interruptCycles = 7
+)
+
+// Memory is the memory the profiler reads the instructions and the stack
+// from. *bus.Bus implements it.
+type Memory interface {
+	Peek(addr uint16) uint8
+}
+
+// Location is an address of the CPU address space and the PRG ROM bank
+// mapped at it, or -1 outside the PRG ROM.
+type Location struct {
+	Addr uint16
+	Bank int
+}
+
+func (l Location) String() string {
+	if l.Bank < 0 {
+		return fmt.Sprintf("$%04X", l.Addr)
+	}
+
+	return fmt.Sprintf("%02X:%04X", l.Bank, l.Addr)
+}
+
+// node is a routine in the call tree: the routine entered at entry from the
+// call site of the parent routine.
+type node struct {
+	parent   *node
+	entry    Location
+	callSite Location
+	// entrySp is the stack pointer after the return address was pushed.
+	// The routine has returned when the stack pointer is above it.
+	entrySp  uint8
+	calls    uint64
+	cycles   map[Location]uint64
+	children map[callKey]*node
+}
+
+type callKey struct {
+	entry    Location
+	callSite Location
+}
+
+func newNode(parent *node, entry, callSite Location) *node {
+	return &node{
+		parent:   parent,
+		entry:    entry,
+		callSite: callSite,
+		cycles:   map[Location]uint64{},
+		children: map[callKey]*node{},
+	}
+}
+
+// Profiler profiles the program the CPU runs. It observes the instructions
+// of the CPU; add it with AddObserver of the CPU.
+//
+// The cycles of an instruction are attributed to its address and to the
+// routines on the call stack. The cycles of an interrupt sequence are
+// attributed to the first instruction of the handler.
+type Profiler struct {
+	mem    Memory
+	bank   func(addr uint16) int
+	labels cpu.Labels
+
+	root    *node
+	current *node
+
+	started    bool
+	startCycle uint64
+	lastCycle  uint64
+	last       Location
+	lastOpCode uint8
+	interrupt  cpu.Interrupt
+
+	idle       map[uint16]bool
+	frame      *Frame
+	nmi        *node
+	frameCount int
+	frames     []Frame
+}
+
+// New returns a profiler that reads the memory through mem. The bank
+// function returns the PRG ROM bank mapped at an address, or -1; a nil
+// function maps every address to -1.
+func New(mem Memory, bank func(addr uint16) int) *Profiler {
+	if bank == nil {
+		bank = func(uint16) int { return -1 }
+	}
+
+	p := &Profiler{mem: mem, bank: bank, idle: map[uint16]bool{}}
+	p.Reset()
+
+	return p
+}
+
+// Reset discards the profile. The profiling starts again from the next
+// instruction, in the routine it is in.
+func (p *Profiler) Reset() {
+	p.root = nil
+	p.current = nil
+	p.started = false
+	p.interrupt = cpu.NoInterrupt
+	p.frame = nil
+	p.nmi = nil
+	p.frameCount = 0
+	p.frames = nil
+}
+
+// AddIdle marks the addresses from start to end, inclusive, as the loop the
+// program waits for the NMI in. The cycles spent there are counted as idle
+// in the frames.
+func (p *Profiler) AddIdle(start, end uint16) {
+	for addr := int(start); addr <= int(end); addr++ {
+		p.idle[uint16(addr)] = true
+	}
+}
+
+func (p *Profiler) location(addr uint16) Location {
+	return Location{Addr: addr, Bank: p.bank(addr)}
+}
+
+// BeforeInstruction attributes the cycles of the previous instruction and
+// follows the calls and the returns it made.
+func (p *Profiler) BeforeInstruction(c *cpu.Cpu) {
+	regs := c.Registers()
+	now := c.Cycles()
+	here := p.location(regs.PC)
+
+	if !p.started {
+		p.started = true
+		p.startCycle = now
+		p.root = newNode(nil, here, here)
+		p.root.calls = 1
+		p.current = p.root
+	} else {
+		p.account(now, regs, here)
+	}
+
+	p.lastCycle = now
+	p.last = here
+	p.lastOpCode = p.mem.Peek(regs.PC)
+	p.interrupt = cpu.NoInterrupt
+}
+
+// AfterInterrupt records the interrupt, which is handled when the first
+// instruction of the handler is reached.
+func (p *Profiler) AfterInterrupt(c *cpu.Cpu, i cpu.Interrupt) {
+	p.interrupt = i
+}
+
+func (p *Profiler) account(now uint64, regs cpu.Registers, here Location) {
+	cycles := now - p.lastCycle
+
+	// A hardware interrupt sequence is run after the previous instruction.
+	// BRK is an instruction, even if an NMI hijacked it.
+	hardwareInterrupt := p.interrupt != cpu.NoInterrupt && p.lastOpCode != brkOpCode
+	if hardwareInterrupt {
+		cycles -= interruptCycles
+	}
+
+	p.addCycles(p.last, cycles)
+
+	// The stack pointer right after the previous instruction.
+	sp := regs.SP
+	if p.interrupt != cpu.NoInterrupt {
+		sp += 3
+	}
+
+	switch p.lastOpCode {
+	case jsrOpCode:
+		if p.interrupt == cpu.NoInterrupt {
+			p.call(here, p.last, sp, cpu.NoInterrupt, now)
+		} else {
+			// The routine was interrupted before its first instruction.
+			entry := p.location(p.returnAddress(regs.SP))
+			p.call(entry, p.last, sp, cpu.NoInterrupt, now)
+		}
+	case rtsOpCode, rtiOpCode:
+		p.returnTo(sp, now)
+	}
+
+	if p.interrupt != cpu.NoInterrupt {
+		callSite := p.last
+		if hardwareInterrupt {
+			callSite = p.location(p.returnAddress(regs.SP))
+		}
+
+		p.call(here, callSite, regs.SP, p.interrupt, now)
+
+		if hardwareInterrupt {
+			p.addCycles(here, interruptCycles)
+		}
+	}
+}
+
+// returnAddress returns the address an interrupt returns to, from the frame
+// it pushed.
+func (p *Profiler) returnAddress(sp uint8) uint16 {
+	lo := p.mem.Peek(stackBase + uint16(sp+2))
+	hi := p.mem.Peek(stackBase + uint16(sp+3))
+
+	return uint16(lo) | uint16(hi)<<8
+}
+
+func (p *Profiler) addCycles(loc Location, cycles uint64) {
+	p.current.cycles[loc] += cycles
+
+	if p.frame != nil && p.idle[loc.Addr] {
+		p.frame.Idle += cycles
+	}
+}
+
+func (p *Profiler) call(entry, callSite Location, sp uint8, interrupt cpu.Interrupt, now uint64) {
+	key := callKey{entry: entry, callSite: callSite}
+
+	child, ok := p.current.children[key]
+	if !ok {
+		child = newNode(p.current, entry, callSite)
+		p.current.children[key] = child
+	}
+
+	child.calls++
+	child.entrySp = sp
+	p.current = child
+
+	if interrupt == cpu.NmiInterrupt {
+		p.startFrame(now - interruptCycles)
+		p.nmi = child
+	}
+}
+
+// returnTo leaves the routines whose return addresses are above the stack
+// pointer. Returning with a manipulated stack, e.g. to jump with RTS, stays
+// in the routine.
+func (p *Profiler) returnTo(sp uint8, now uint64) {
+	for p.current.parent != nil && p.current.entrySp < sp {
+		if p.current == p.nmi {
+			p.nmi = nil
+			p.frame.Nmi = now - p.frame.Start
+			p.frame.NmiReturned = true
+		}
+
+		p.current = p.current.parent
+	}
+}
@@ -0,0 +1,413 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+	"github.com/pqkallio/nes-emulator/emulator/cpu/asm"
+)
+
+// profiledProgram calls leaf from outer and from the reset handler, then
+// waits for the NMI in the idle loop. leaf is in the second bank.
+const profiledProgram = `
+	.org $8000
+reset:	LDX #$ff
+	TXS
+	JSR outer
+	JSR leaf
+idle:	JMP idle
+
+outer:	JSR leaf
+	NOP
+	RTS
+
+nmi:	NOP
+	RTI
+
+	.org $c000
+leaf:	NOP
+	RTS
+
+	.org $fffa
+	.word nmi, reset, nmi
+`
+
+// testMemory is a flat 64 KiB address space.
+type testMemory [0x10000]uint8
+
+func (m *testMemory) ReadData(addr uint16) uint8 {
+	return m[addr]
+}
+
+func (m *testMemory) WriteData(addr uint16, data uint8) {
+	m[addr] = data
+}
+
+func (m *testMemory) Peek(addr uint16) uint8 {
+	return m[addr]
+}
+
+// testLabels names the addresses with the symbols of the program.
+type testLabels map[uint16]string
+
+func (l testLabels) Label(addr uint16) (string, bool) {
+	label, ok := l[addr]
+	return label, ok
+}
+
+// testBank maps $8000-$BFFF to bank 0 and $C000-$FFFF to bank 1.
+func testBank(addr uint16) int {
+	if addr < 0x8000 {
+		return -1
+	}
+
+	return int(addr-0x8000) / 0x4000
+}
+
+// newProfiledCpu returns a CPU that has run its reset sequence with the
+// profiler observing it.
+func newProfiledCpu(t *testing.T) (*cpu.Cpu, *Profiler, map[string]uint16) {
+	t.Helper()
+
+	program, err := asm.Assemble(profiledProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem := &testMemory{}
+	program.Load(mem)
+
+	c := cpu.NewCpu(mem)
+	c.Reset()
+
+	for !c.InstructionBoundary() {
+		c.Tick()
+	}
+
+	p := New(mem, testBank)
+	c.AddObserver(p)
+
+	labels := testLabels{}
+	for name, addr := range program.Symbols {
+		labels[addr] = name
+	}
+
+	p.SetLabels(labels)
+
+	return c, p, program.Symbols
+}
+
+// runInstruction runs the CPU to the next instruction boundary.
+func runInstruction(c *cpu.Cpu) {
+	c.Tick()
+
+	for !c.InstructionBoundary() {
+		c.Tick()
+	}
+}
+
+// runTo runs the CPU until it is about to run the instruction at the
+// address.
+func runTo(c *cpu.Cpu, addr uint16) {
+	runInstruction(c)
+
+	for c.Registers().PC != addr || c.InterruptPending() {
+		runInstruction(c)
+	}
+}
+
+func TestProfilerAttribution(t *testing.T) {
+	c, p, sym := newProfiledCpu(t)
+
+	runTo(c, sym["idle"])
+	// An instruction is accounted when the next one starts, so the first
+	// JMP is in once the second one has run.
+	runInstruction(c)
+	runInstruction(c)
+
+	routines := map[string]Routine{}
+	for _, r := range p.Routines() {
+		routines[r.Name] = r
+	}
+
+	// leaf runs NOP and RTS, 8 cycles, twice; outer runs JSR, NOP and RTS,
+	// 14 cycles. The reset handler runs LDX, TXS, the JSRs and a JMP.
+	tests := []struct {
+		name               string
+		entry              Location
+		calls, self, total uint64
+	}{
+		{"leaf", Location{sym["leaf"], 1}, 2, 16, 16},
+		{"outer", Location{sym["outer"], 0}, 1, 14, 22},
+		{"reset", Location{sym["reset"], 0}, 1, 19, 19 + 22 + 8},
+	}
+
+	for _, tt := range tests {
+		r, ok := routines[tt.name]
+		if !ok {
+			t.Errorf("no routine %s", tt.name)
+			continue
+		}
+
+		if r.Entry != tt.entry || r.Calls != tt.calls || r.Self != tt.self || r.Total != tt.total {
+			t.Errorf("%s: got %+v, want entry %v, %d calls, self %d, total %d", tt.name, r, tt.entry, tt.calls, tt.self, tt.total)
+		}
+	}
+
+	if p.Cycles() != 19+22+8 {
+		t.Errorf("got %d cycles profiled, want %d", p.Cycles(), 19+22+8)
+	}
+
+	hotspots := map[Location]Hotspot{}
+	for _, h := range p.Hotspots() {
+		hotspots[h.Location] = h
+	}
+
+	for _, want := range []Hotspot{
+		{Location{sym["leaf"], 1}, "leaf", "leaf", 4},
+		{Location{sym["leaf"] + 1, 1}, "01:C001", "leaf", 12},
+		{Location{sym["outer"], 0}, "outer", "outer", 6},
+		{Location{sym["idle"], 0}, "idle", "reset", 3},
+	} {
+		if got := hotspots[want.Location]; got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestProfilerFrames(t *testing.T) {
+	c, p, sym := newProfiledCpu(t)
+	p.AddIdle(sym["idle"], sym["idle"]+2)
+
+	runTo(c, sym["idle"])
+
+	// nmi runs two NMIs apart, and returns 15 cycles after its sequence
+	// started: 7 for the sequence, 2 for NOP and 6 for RTI.
+	var starts []uint64
+
+	for frame := 0; frame < 3; frame++ {
+		for i := 0; i < 50*(frame+1); i++ {
+			runInstruction(c)
+		}
+
+		c.SetNmiLine(true)
+		runInstruction(c)
+
+		if !c.InterruptPending() {
+			t.Fatal("no NMI pending")
+		}
+
+		starts = append(starts, c.Cycles())
+		c.SetNmiLine(false)
+		runTo(c, sym["idle"])
+	}
+
+	frames := p.Frames()
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+
+	for i, f := range frames {
+		want := Frame{
+			Number:      i,
+			Start:       starts[i],
+			Cycles:      starts[i+1] - starts[i],
+			Nmi:         15,
+			NmiReturned: true,
+			Idle:        starts[i+1] - starts[i] - 15,
+		}
+
+		if f != want {
+			t.Errorf("frame %d: got %+v, want %+v", i, f, want)
+		}
+
+		if f.Busy() != 15 || f.OverVblank() {
+			t.Errorf("frame %d: got busy %d, over the vblank %t", i, f.Busy(), f.OverVblank())
+		}
+	}
+
+	if !(Frame{Nmi: VblankCycles + 1}).OverVblank() {
+		t.Error("an NMI handler longer than the vblank isn't over it")
+	}
+}
+
+// protoField is a field of a protocol buffer message.
+type protoField struct {
+	num   int
+	value uint64
+	data  []byte
+}
+
+// decodeProto decodes the fields of a message of varints and
+// length-delimited fields.
+func decodeProto(t *testing.T, data []byte) []protoField {
+	t.Helper()
+
+	varint := func() uint64 {
+		var v uint64
+
+		for shift := 0; ; shift += 7 {
+			if len(data) == 0 {
+				t.Fatal("truncated varint")
+			}
+
+			b := data[0]
+			data = data[1:]
+			v |= uint64(b&0x7f) << shift
+
+			if b < 0x80 {
+				return v
+			}
+		}
+	}
+
+	var fields []protoField
+
+	for len(data) > 0 {
+		key := varint()
+		f := protoField{num: int(key >> 3)}
+
+		switch key & 7 {
+		case 0:
+			f.value = varint()
+		case 2:
+			n := varint()
+			if n > uint64(len(data)) {
+				t.Fatalf("field %d: %d bytes past the end", f.num, n)
+			}
+
+			f.data, data = data[:n], data[n:]
+		default:
+			t.Fatalf("field %d: unexpected wire type %d", f.num, key&7)
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+// decodePacked decodes a packed repeated field of varints.
+func decodePacked(t *testing.T, data []byte) []uint64 {
+	t.Helper()
+
+	var values []uint64
+	var v uint64
+	var shift uint
+
+	for _, b := range data {
+		v |= uint64(b&0x7f) << shift
+		shift += 7
+
+		if b < 0x80 {
+			values = append(values, v)
+			v, shift = 0, 0
+		}
+	}
+
+	return values
+}
+
+func TestWritePprof(t *testing.T) {
+	c, p, sym := newProfiledCpu(t)
+
+	runTo(c, sym["idle"])
+	runInstruction(c)
+	runInstruction(c)
+
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var strings []string
+	var samples, locations, functions []protoField
+
+	for _, f := range decodeProto(t, data) {
+		switch f.num {
+		case profileStringTable:
+			strings = append(strings, string(f.data))
+		case profileSample:
+			samples = append(samples, f)
+		case profileLocation:
+			locations = append(locations, f)
+		case profileFunction:
+			functions = append(functions, f)
+		}
+	}
+
+	if len(strings) < 3 || strings[0] != "" || strings[1] != "cycles" || strings[2] != "count" {
+		t.Fatalf("got string table %q", strings)
+	}
+
+	// The samples add up to the cycles profiled, and the deepest stack is
+	// leaf called from outer called from reset.
+	var total uint64
+	deepest := 0
+
+	for _, s := range samples {
+		for _, f := range decodeProto(t, s.data) {
+			switch f.num {
+			case sampleValue:
+				for _, v := range decodePacked(t, f.data) {
+					total += v
+				}
+			case sampleLocationId:
+				if n := len(decodePacked(t, f.data)); n > deepest {
+					deepest = n
+				}
+			}
+		}
+	}
+
+	if total != p.Cycles() {
+		t.Errorf("got %d cycles in the samples, want %d", total, p.Cycles())
+	}
+
+	if deepest != 3 {
+		t.Errorf("got the deepest stack of %d locations, want 3", deepest)
+	}
+
+	addrs := map[uint64]bool{}
+	for _, l := range locations {
+		for _, f := range decodeProto(t, l.data) {
+			if f.num == locationAddress {
+				addrs[f.value] = true
+			}
+		}
+	}
+
+	for _, name := range []string{"leaf", "outer", "idle"} {
+		if !addrs[uint64(sym[name])] {
+			t.Errorf("no location at %s", name)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, fn := range functions {
+		for _, f := range decodeProto(t, fn.data) {
+			if f.num == functionName && int(f.value) < len(strings) {
+				names[strings[f.value]] = true
+			}
+		}
+	}
+
+	for _, name := range []string{"reset", "outer", "leaf"} {
+		if !names[name] {
+			t.Errorf("no function %s in %v", name, names)
+		}
+	}
+}
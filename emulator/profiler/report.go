@@ -0,0 +1,270 @@
+package profiler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pqkallio/nes-emulator/emulator/cpu"
+)
+
+// Routine is the profile of a routine, aggregated over the call sites.
+type Routine struct {
+	Entry Location
+	Name  string
+	Calls uint64
+	// Self is the number of cycles spent in the instructions of the
+	// routine.
+	Self uint64
+	// Total also includes the cycles of the routines it called.
+	Total uint64
+}
+
+// Hotspot is the number of cycles spent in an instruction.
+type Hotspot struct {
+	Location Location
+	Name     string
+	// Routine is the name of the routine the instruction was run in the
+	// most cycles.
+	Routine string
+	Cycles  uint64
+}
+
+// SetLabels makes the profiler name the routines and the instructions with
+// the labels. A nil Labels names them with their addresses.
+func (p *Profiler) SetLabels(labels cpu.Labels) {
+	p.labels = labels
+}
+
+func (p *Profiler) name(loc Location) string {
+	if p.labels != nil {
+		if label, ok := p.labels.Label(loc.Addr); ok {
+			return label
+		}
+	}
+
+	return loc.String()
+}
+
+// Cycles returns the number of cycles profiled.
+func (p *Profiler) Cycles() uint64 {
+	if !p.started {
+		return 0
+	}
+
+	return p.lastCycle - p.startCycle
+}
+
+// Routines returns the routines, the most expensive including the routines
+// they called first.
+func (p *Profiler) Routines() []Routine {
+	if p.root == nil {
+		return nil
+	}
+
+	routines := map[Location]*Routine{}
+	onStack := map[Location]int{}
+
+	var walk func(n *node) uint64
+	walk = func(n *node) uint64 {
+		r, ok := routines[n.entry]
+		if !ok {
+			r = &Routine{Entry: n.entry, Name: p.name(n.entry)}
+			routines[n.entry] = r
+		}
+
+		total := uint64(0)
+		for _, cycles := range n.cycles {
+			total += cycles
+		}
+
+		r.Self += total
+		r.Calls += n.calls
+
+		onStack[n.entry]++
+		for _, child := range n.children {
+			total += walk(child)
+		}
+		onStack[n.entry]--
+
+		// A recursive call is already included in the outermost call.
+		if onStack[n.entry] == 0 {
+			r.Total += total
+		}
+
+		return total
+	}
+
+	walk(p.root)
+
+	result := make([]Routine, 0, len(routines))
+	for _, r := range routines {
+		result = append(result, *r)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+
+		return less(result[i].Entry, result[j].Entry)
+	})
+
+	return result
+}
+
+// Hotspots returns the instructions, the most expensive first.
+func (p *Profiler) Hotspots() []Hotspot {
+	if p.root == nil {
+		return nil
+	}
+
+	type spot struct {
+		cycles    uint64
+		routine   Location
+		inRoutine uint64
+	}
+
+	spots := map[Location]*spot{}
+
+	var walk func(n *node)
+	walk = func(n *node) {
+		for loc, cycles := range n.cycles {
+			s, ok := spots[loc]
+			if !ok {
+				s = &spot{}
+				spots[loc] = s
+			}
+
+			s.cycles += cycles
+			if cycles > s.inRoutine {
+				s.routine, s.inRoutine = n.entry, cycles
+			}
+		}
+
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+
+	walk(p.root)
+
+	result := make([]Hotspot, 0, len(spots))
+	for loc, s := range spots {
+		result = append(result, Hotspot{
+			Location: loc,
+			Name:     p.name(loc),
+			Routine:  p.name(s.routine),
+			Cycles:   s.cycles,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cycles != result[j].Cycles {
+			return result[i].Cycles > result[j].Cycles
+		}
+
+		return less(result[i].Location, result[j].Location)
+	})
+
+	return result
+}
+
+func less(a, b Location) bool {
+	if a.Bank != b.Bank {
+		return a.Bank < b.Bank
+	}
+
+	return a.Addr < b.Addr
+}
+
+// WriteReport writes a summary of the profile: the n most expensive
+// routines and instructions, and the usage of the frame budgets.
+func (p *Profiler) WriteReport(w io.Writer, n int) error {
+	bw := bufio.NewWriter(w)
+	total := p.Cycles()
+
+	percent := func(cycles uint64) float64 {
+		if total == 0 {
+			return 0
+		}
+
+		return 100 * float64(cycles) / float64(total)
+	}
+
+	fmt.Fprintf(bw, "%d cycles\n\n", total)
+	fmt.Fprintf(bw, "%10s %6s %10s %6s %8s  %s\n", "self", "self%", "total", "total%", "calls", "routine")
+
+	for i, r := range p.Routines() {
+		if i == n {
+			break
+		}
+
+		fmt.Fprintf(bw, "%10d %5.1f%% %10d %5.1f%% %8d  %s\n",
+			r.Self, percent(r.Self), r.Total, percent(r.Total), r.Calls, r.Name)
+	}
+
+	fmt.Fprintf(bw, "\n%10s %6s  %-12s %s\n", "cycles", "%", "address", "routine")
+
+	for i, h := range p.Hotspots() {
+		if i == n {
+			break
+		}
+
+		fmt.Fprintf(bw, "%10d %5.1f%%  %-12s %s\n", h.Cycles, percent(h.Cycles), h.Name, h.Routine)
+	}
+
+	writeFrames(bw, p.frames)
+
+	return bw.Flush()
+}
+
+func writeFrames(w io.Writer, frames []Frame) {
+	if len(frames) == 0 {
+		fmt.Fprintf(w, "\nno complete frames\n")
+		return
+	}
+
+	var nmi, busy []uint64
+	overVblank, nmiNotReturned := 0, 0
+
+	for _, f := range frames {
+		nmi = append(nmi, f.Nmi)
+		busy = append(busy, f.Busy())
+
+		if f.OverVblank() {
+			overVblank++
+		}
+
+		if !f.NmiReturned {
+			nmiNotReturned++
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d frames %17s %8s %8s %8s\n", len(frames), "min", "avg", "max", "budget")
+	writeStats(w, "NMI handler", nmi, VblankCycles)
+	writeStats(w, "busy", busy, FrameCycles)
+	fmt.Fprintf(w, "NMI handler past vblank in %d frames, not returned in %d frames\n", overVblank, nmiNotReturned)
+}
+
+func writeStats(w io.Writer, name string, values []uint64, budget uint64) {
+	lo, hi, sum := values[0], values[0], uint64(0)
+
+	for _, v := range values {
+		if v < lo {
+			lo = v
+		}
+
+		if v > hi {
+			hi = v
+		}
+
+		sum += v
+	}
+
+	avg := sum / uint64(len(values))
+
+	fmt.Fprintf(w, "%-24s %8d %8d %8d %8d (%.0f%% max)\n",
+		name, lo, avg, hi, budget, 100*float64(hi)/float64(budget))
+}
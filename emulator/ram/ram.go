@@ -1,64 +1,36 @@
 package ram
 
-var (
-	ppuStart          uint16 = 0x2000
-	apuAndIOStart     uint16 = 0x4000
-	apuAndIOTestStart uint16 = 0x4018
-	cartridgeStart    uint16 = 0x4020
-)
+import "fmt"
 
+// Ram is a block of memory that can be mapped to the bus. Its size is a
+// power of two and it is indexed with the low bits of the address, so it
+// can be mapped at any address aligned to its size.
 type Ram struct {
-	internal     [0x800]uint8
-	ppuRam       [0x8]uint8
-	apuAndIO     [0x18]uint8
-	apuAndIOTest [0x8]uint8
-	cartridge    [0xbfe0]uint8
+	data []uint8
+	mask uint16
 }
 
-func NewRam() *Ram {
-	return &Ram{}
+// NewRam returns a RAM of the given size. It panics if the size is not a
+// power of two between 1 and 64 KiB.
+func NewRam(size int) *Ram {
+	if size <= 0 || size > 0x10000 || size&(size-1) != 0 {
+		panic(fmt.Sprintf("invalid RAM size %d", size))
+	}
+
+	return &Ram{data: make([]uint8, size), mask: uint16(size - 1)}
 }
 
-func (r *Ram) Write(addr uint16, data uint8) {
-	switch {
-	case addr < ppuStart:
-		addr %= 0x800
-		r.internal[addr] = data
-	case addr < apuAndIOStart:
-		addr -= ppuStart
-		addr %= 0x8
-		r.ppuRam[addr] = data
-	case addr < apuAndIOTestStart:
-		addr -= apuAndIOStart
-		addr %= 0x18
-		r.apuAndIO[addr] = data
-	case addr < cartridgeStart:
-		addr -= apuAndIOTestStart
-		r.apuAndIOTest[addr] = data
-	default:
-		addr -= cartridgeStart
-		r.cartridge[addr] = data
+// Clear zeroes the RAM.
+func (r *Ram) Clear() {
+	for i := range r.data {
+		r.data[i] = 0
 	}
 }
 
+func (r *Ram) Write(addr uint16, data uint8) {
+	r.data[addr&r.mask] = data
+}
+
 func (r *Ram) Read(addr uint16) uint8 {
-	switch {
-	case addr < ppuStart:
-		addr %= 0x800
-		return r.internal[addr]
-	case addr < apuAndIOStart:
-		addr -= ppuStart
-		addr %= 0x8
-		return r.ppuRam[addr]
-	case addr < apuAndIOTestStart:
-		addr -= apuAndIOStart
-		addr %= 0x18
-		return r.apuAndIO[addr]
-	case addr < cartridgeStart:
-		addr -= apuAndIOTestStart
-		return r.apuAndIOTest[addr]
-	default:
-		addr -= cartridgeStart
-		return r.cartridge[addr]
-	}
+	return r.data[addr&r.mask]
 }
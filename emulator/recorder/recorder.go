@@ -0,0 +1,115 @@
+// Package recorder records the audio output of the APU to WAV files.
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pqkallio/nes-emulator/emulator/apu"
+	"github.com/pqkallio/nes-emulator/wav"
+)
+
+// DefaultSampleRate is the sample rate of the recordings unless another is
+// given.
+const DefaultSampleRate = 44100
+
+// Recorder records the mixed output of an APU to a WAV file, and optionally
+// each channel alone to a file of its own.
+type Recorder struct {
+	apu    *apu.Apu
+	tracks []*track
+}
+
+type track struct {
+	file      *os.File
+	writer    *wav.Writer
+	recording *apu.Recording
+}
+
+// Start starts recording the mixed output of a to the file. With stems, the
+// channels are recorded too, to files named after the file and the channel,
+// e.g. music.pulse1.wav for music.wav.
+func Start(a *apu.Apu, filename string, rate int, stems bool) (*Recorder, error) {
+	r := &Recorder{apu: a}
+
+	outputs := []apu.Output{apu.MixedOutput}
+	if stems {
+		outputs = append(outputs, apu.Stems...)
+	}
+
+	for _, output := range outputs {
+		name := filename
+		if output != apu.MixedOutput {
+			name = StemFilename(filename, output)
+		}
+
+		if err := r.start(output, name, rate); err != nil {
+			r.Stop()
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// StemFilename returns the name of the file the output is recorded to when
+// the mixed output is recorded to filename.
+func StemFilename(filename string, output apu.Output) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "." + output.String() + ext
+}
+
+func (r *Recorder) start(output apu.Output, filename string, rate int) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	w, err := wav.NewWriter(f, rate, 1)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	recording, err := r.apu.Record(output, rate, w)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.tracks = append(r.tracks, &track{
+		file:      f,
+		writer:    w,
+		recording: recording,
+	})
+
+	return nil
+}
+
+// Stop stops the recordings and closes the files. It returns the first
+// error of any of them.
+func (r *Recorder) Stop() error {
+	var firstErr error
+
+	for _, t := range r.tracks {
+		err := r.apu.StopRecording(t.recording)
+
+		// The writer is closed even when the recording failed.
+		if closeErr := t.writer.Close(); err == nil {
+			err = closeErr
+		}
+
+		if closeErr := t.file.Close(); err == nil {
+			err = closeErr
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	r.tracks = nil
+
+	return firstErr
+}
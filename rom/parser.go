@@ -81,7 +81,7 @@ func parsePrgRom(rom *ROM, contents []byte) (int, error) {
 		prgRomOffset += 512
 	}
 
-	prgRomEnd := int(prgRomOffset) + prgRomSize*16384
+	prgRomEnd := int(prgRomOffset) + prgRomSize*PrgROMBankSize
 
 	prgRom := contents[prgRomOffset:prgRomEnd]
 
@@ -132,7 +132,7 @@ func readFile(filepath string) ([]byte, error) {
 		return nil, fmt.Errorf("ROM file is not a valid NES file")
 	}
 
-	if (romFile[flags7]>>2)&0x03 != 0x10 {
+	if (romFile[flags7]>>2)&0x03 != 0x02 {
 		return nil, fmt.Errorf("only ROM files of type NES 2.0 are supported at the moment")
 	}
 
@@ -31,6 +31,17 @@ type ROM struct {
 	defaultExpansionDeviceFlags uint8
 }
 
+// PrgROMBankSize is the size of a PRG ROM bank in bytes.
+const PrgROMBankSize = 16384
+
+func (r *ROM) PrgROM() []uint8 {
+	return r.prgROM
+}
+
+func (r *ROM) ChrROM() []uint8 {
+	return r.chrROM
+}
+
 func (r *ROM) NameTableMirroringType() NameTableMirroringType {
 	return NameTableMirroringType(r.flags6 & 0x01)
 }
@@ -58,3 +69,39 @@ func (r *ROM) ConsoleType() ConsoleType {
 func (r *ROM) SubMapperNumber() uint8 {
 	return (r.mapperFlags & 0xf0) >> 4
 }
+
+// IsNes20 tells whether the header is in the NES 2.0 format.
+func (r *ROM) IsNes20() bool {
+	return r.flags7&0x0c == 0x08
+}
+
+// ExpansionDevice is the input device a game expects to be plugged in.
+type ExpansionDevice uint8
+
+// Some of the default expansion devices of NES 2.0.
+const (
+	UnspecifiedDevice   ExpansionDevice = 0x00
+	StandardControllers ExpansionDevice = 0x01
+	FourScore           ExpansionDevice = 0x02
+	FamicomFourPlayers  ExpansionDevice = 0x03
+	VsSystem            ExpansionDevice = 0x04
+	VsSystemReversed    ExpansionDevice = 0x05
+	VsZapper            ExpansionDevice = 0x07
+	Zapper              ExpansionDevice = 0x08
+	TwoZappers          ExpansionDevice = 0x09
+	PowerPadSideA       ExpansionDevice = 0x0b
+	PowerPadSideB       ExpansionDevice = 0x0c
+	ArkanoidVausNes     ExpansionDevice = 0x0f
+	ArkanoidVausFamicom ExpansionDevice = 0x10
+	FamilyBasicKeyboard ExpansionDevice = 0x23
+)
+
+// DefaultExpansionDevice returns the input device the game expects, or
+// UnspecifiedDevice if the header isn't in the NES 2.0 format.
+func (r *ROM) DefaultExpansionDevice() ExpansionDevice {
+	if !r.IsNes20() {
+		return UnspecifiedDevice
+	}
+
+	return ExpansionDevice(r.defaultExpansionDeviceFlags & 0x3f)
+}
@@ -0,0 +1,218 @@
+package symbols
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// nesHeaderSize is the size of the iNES header preceding the PRG ROM in the
+// output file of ld65.
+const nesHeaderSize = 16
+
+// lineTypeMacro is the type of the lines in the body of a macro. They are
+// left out, so the code maps to the line that invoked the macro.
+const lineTypeMacro = 2
+
+type dbgSegment struct {
+	start uint16
+	// prgOffset is the offset of the segment in the PRG ROM, or -1 if the
+	// segment isn't written to the ROM.
+	prgOffset int
+}
+
+type dbgSpan struct {
+	seg   int
+	start int
+}
+
+type dbgLine struct {
+	file  int
+	line  int
+	spans []int
+}
+
+// loadDbg loads the debug info written by ld65 with --dbgfile. The banks are
+// taken from the offsets of the segments in the output file, which is
+// expected to be a .nes file.
+func (t *Table) loadDbg(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	files := map[int]string{}
+	segments := map[int]dbgSegment{}
+	spans := map[int]dbgSpan{}
+
+	var lines []dbgLine
+
+	type dbgSym struct {
+		name string
+		val  uint16
+		seg  int
+	}
+
+	var syms []dbgSym
+
+	scanner := bufio.NewScanner(f)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		kind, fields, err := parseDbgLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", filename, lineNumber, err)
+		}
+
+		id, _ := fields.int("id")
+
+		switch kind {
+		case "version":
+			if major, _ := fields.int("major"); major != 2 {
+				return fmt.Errorf("%s: unsupported debug info version %d", filename, major)
+			}
+		case "file":
+			files[id] = fields["name"]
+		case "seg":
+			start, _ := fields.int("start")
+			seg := dbgSegment{start: uint16(start), prgOffset: -1}
+
+			if offset, ok := fields.int("ooffs"); ok && fields["type"] == "ro" {
+				seg.prgOffset = offset - nesHeaderSize
+			}
+
+			segments[id] = seg
+		case "span":
+			seg, _ := fields.int("seg")
+			start, _ := fields.int("start")
+			spans[id] = dbgSpan{seg: seg, start: start}
+		case "line":
+			if lineType, _ := fields.int("type"); lineType == lineTypeMacro {
+				continue
+			}
+
+			l := dbgLine{}
+			l.file, _ = fields.int("file")
+			l.line, _ = fields.int("line")
+			l.spans = fields.ints("span")
+
+			lines = append(lines, l)
+		case "sym":
+			if fields["type"] != "lab" {
+				continue
+			}
+
+			val, _ := fields.int("val")
+			seg, ok := fields.int("seg")
+			if !ok {
+				seg = -1
+			}
+
+			syms = append(syms, dbgSym{name: fields["name"], val: uint16(val), seg: seg})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	bankOf := func(seg int, addr uint16) int {
+		s, ok := segments[seg]
+		if !ok || s.prgOffset < 0 {
+			return NoBank
+		}
+
+		return (s.prgOffset + int(addr-s.start)) / BankSize
+	}
+
+	for _, sym := range syms {
+		t.AddSymbol(Symbol{Name: sym.name, Addr: sym.val, Bank: bankOf(sym.seg, sym.val)})
+	}
+
+	for _, l := range lines {
+		for _, id := range l.spans {
+			span, ok := spans[id]
+			if !ok {
+				continue
+			}
+
+			addr := segments[span.seg].start + uint16(span.start)
+			t.AddLine(Line{Path: files[l.file], Line: l.line, Addr: addr, Bank: bankOf(span.seg, addr)})
+		}
+	}
+
+	return nil
+}
+
+// dbgFields are the key=value fields of a line of the debug info.
+type dbgFields map[string]string
+
+func (f dbgFields) int(key string) (int, bool) {
+	n, err := strconv.ParseInt(f[key], 0, 64)
+	return int(n), err == nil
+}
+
+// ints returns a list of numbers separated with +, e.g. span=1+2+3.
+func (f dbgFields) ints(key string) []int {
+	if f[key] == "" {
+		return nil
+	}
+
+	var ns []int
+
+	for _, s := range strings.Split(f[key], "+") {
+		if n, err := strconv.Atoi(s); err == nil {
+			ns = append(ns, n)
+		}
+	}
+
+	return ns
+}
+
+// parseDbgLine parses a line of the debug info, e.g.
+//
+//	sym	id=0,name="reset",addrsize=absolute,scope=0,def=1,val=0xC000,seg=0,type=lab
+func parseDbgLine(line string) (string, dbgFields, error) {
+	kind, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		kind, rest = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	fields := dbgFields{}
+
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			return "", nil, fmt.Errorf("invalid field %q", rest)
+		}
+
+		key := rest[:eq]
+		rest = rest[eq+1:]
+
+		var value string
+
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return "", nil, fmt.Errorf("unterminated string in %q", line)
+			}
+
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+
+			value, rest = rest[:end], rest[end:]
+		}
+
+		fields[key] = value
+		rest = strings.TrimPrefix(rest, ",")
+	}
+
+	return kind, fields, nil
+}
@@ -0,0 +1,109 @@
+package symbols
+
+import (
+	"strings"
+	"testing"
+)
+
+// dbgFixture is the debug info of a 48 KiB PRG ROM: BANK0 and BANK1 are
+// both at $8000 in the PRG ROM banks 0 and 1, CODE is at $C000 in bank 2
+// and BSS is in the RAM.
+const dbgFixture = `version	major=2,minor=0
+info	csym=0,file=2,lib=0,line=4,mod=1,scope=1,seg=4,span=4,sym=6,type=4
+file	id=0,name="src/main.s",size=412,mtime=0x6503A1B2,mod=0
+file	id=1,name="src/bank1.s",size=120,mtime=0x6503A1B2,mod=0
+mod	id=0,name="main.o",file=0
+seg	id=0,name="BANK0",start=0x008000,size=0x0004,addrsize=absolute,type=ro,oname="game.nes",ooffs=16
+seg	id=1,name="BANK1",start=0x008000,size=0x0003,addrsize=absolute,type=ro,oname="game.nes",ooffs=16400
+seg	id=2,name="CODE",start=0x00C000,size=0x0002,addrsize=absolute,type=ro,oname="game.nes",ooffs=32784
+seg	id=3,name="BSS",start=0x000300,size=0x0010,addrsize=absolute,type=rw
+span	id=0,seg=0,start=0,size=1
+span	id=1,seg=1,start=0,size=3
+span	id=2,seg=0,start=1,size=3
+span	id=3,seg=2,start=0,size=2
+line	id=0,file=0,line=5,span=0
+line	id=1,file=1,line=3,span=1
+line	id=2,file=0,line=20,type=2,span=2
+line	id=3,file=0,line=6,span=2+3
+sym	id=0,name="reset",addrsize=absolute,scope=0,def=0,ref=3,val=0x8000,seg=0,type=lab
+sym	id=1,name="reset",addrsize=absolute,scope=0,def=1,val=0x8000,seg=1,type=lab
+sym	id=2,name="main",addrsize=absolute,scope=0,def=0,val=0x8000,seg=0,type=lab
+sym	id=3,name="buffer",addrsize=absolute,scope=0,def=0,val=0x300,seg=3,type=lab
+sym	id=4,name="SIZE",addrsize=zeropage,scope=0,def=0,val=0x10,type=equ
+sym	id=5,name="vector",addrsize=absolute,scope=0,def=0,val=0xFFFA,type=lab
+`
+
+func TestLoadDbg(t *testing.T) {
+	table := NewTable()
+	if err := table.Load(writeFixture(t, "game.dbg", dbgFixture)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same address has a label in each bank, and the label defined
+	// later takes precedence in a bank.
+	checkSymbol(t, table, 0x8000, 0, "main")
+	checkSymbol(t, table, 0x8000, 1, "reset")
+	checkSymbol(t, table, 0x8000, 2, "")
+	checkSymbol(t, table, 0xc000, 1, "")
+
+	// The labels outside of the PRG ROM match every bank.
+	checkSymbol(t, table, 0x0300, 3, "buffer")
+	checkSymbol(t, table, 0xfffa, 0, "vector")
+
+	// The equates aren't labels.
+	checkSymbol(t, table, 0x0010, NoBank, "")
+
+	lines := []struct {
+		addr uint16
+		bank int
+		path string
+		line int
+	}{
+		{0x8000, 0, "src/main.s", 5},
+		{0x8000, 1, "src/bank1.s", 3},
+		// The line of the macro body is left out for the line invoking
+		// the macro.
+		{0x8001, 0, "src/main.s", 6},
+		{0xc000, 2, "src/main.s", 6},
+	}
+
+	for _, want := range lines {
+		l, ok := table.Line(want.addr, want.bank)
+		if !ok || l.Path != want.path || l.Line != want.line {
+			t.Errorf("$%04X in bank %d: got %s:%d, %v, want %s:%d", want.addr, want.bank, l.Path, l.Line, ok, want.path, want.line)
+		}
+	}
+
+	if _, ok := table.Line(0x8000, 2); ok {
+		t.Error("got a line of $8000 in bank 2")
+	}
+
+	if got := table.Lines("main.s", 20); len(got) != 0 {
+		t.Errorf("got the lines %+v of a macro body", got)
+	}
+
+	if got := table.Lines("main.s", 6); len(got) != 2 || got[0].Addr != 0x8001 || got[1].Addr != 0xc000 {
+		t.Errorf("got the lines %+v of main.s:6", got)
+	}
+}
+
+func TestLoadDbgMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unsupported version", "version\tmajor=3,minor=0\n", "unsupported debug info version 3"},
+		{"field without value", "version\tmajor=2,minor=0\nfile\tid=0,name\n", "game.dbg:2: invalid field"},
+		{"unterminated string", "version\tmajor=2,minor=0\nsym\tid=0,name=\"reset,val=0x8000\n", "game.dbg:2: unterminated string"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewTable().Load(writeFixture(t, "game.dbg", test.content))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want ...%s...", err, test.want)
+			}
+		})
+	}
+}
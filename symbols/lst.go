@@ -0,0 +1,96 @@
+package symbols
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadLst loads a listing written by asm6 with -l or -L, e.g.
+//
+//	0C000                           reset:
+//	0C000 78                                sei
+//
+// The listing doesn't tell the source file or the bank, so the lines are the
+// lines of the listing itself, and the symbols have no bank.
+func (t *Table) loadLst(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		addr, hasCode, text, ok := parseLstLine(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		if hasCode {
+			t.AddLine(Line{Path: filename, Line: lineNumber, Addr: addr, Bank: NoBank})
+		}
+
+		if label := lstLabel(text); label != "" {
+			t.AddSymbol(Symbol{Name: label, Addr: addr, Bank: NoBank})
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseLstLine splits a line of the listing into the address, whether code
+// or data was assembled on the line, and the source text.
+func parseLstLine(line string) (uint16, bool, string, bool) {
+	if len(line) < 5 {
+		return 0, false, "", false
+	}
+
+	addr, err := strconv.ParseUint(line[:5], 16, 32)
+	if err != nil {
+		return 0, false, "", false
+	}
+
+	rest := line[5:]
+	hasCode := false
+
+	// The bytes are separated by single spaces, and the source text follows
+	// after a wider gap.
+	for len(rest) >= 3 && rest[0] == ' ' && isHexByte(rest[1:3]) && (len(rest) == 3 || rest[3] == ' ') {
+		hasCode = true
+		rest = rest[3:]
+
+		if strings.HasPrefix(rest, "  ") {
+			break
+		}
+	}
+
+	return uint16(addr), hasCode, strings.TrimSpace(rest), true
+}
+
+func isHexByte(s string) bool {
+	_, err := strconv.ParseUint(s, 16, 8)
+	return err == nil
+}
+
+// lstLabel returns the label defined on the source line, if any: a name
+// followed by a colon. The local labels of asm6 start with @.
+func lstLabel(text string) string {
+	end := strings.IndexByte(text, ':')
+	if end <= 0 {
+		return ""
+	}
+
+	label := text[:end]
+	for i, r := range label {
+		isStart := r == '_' || r == '@' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		if !isStart && (i == 0 || r < '0' || r > '9') {
+			return ""
+		}
+	}
+
+	return label
+}
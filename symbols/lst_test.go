@@ -0,0 +1,51 @@
+package symbols
+
+import "testing"
+
+// lstFixture is a listing of asm6. The local label @loop is defined twice.
+const lstFixture = `00000                           ; the header
+0C000                           reset:
+0C000 78                                sei
+0C001 D8                                cld
+0C002 A9 3A                             lda #':'
+0C004                           @loop:
+0C004 4C 04 C0                          jmp @loop
+0C007                           nmi:
+0C007 40                                rti
+0C008                           @loop:
+0C008 4C 08 C0                          jmp @loop
+0FFFA 07 C0 00 C0 00 C0                 .dw nmi, reset, reset
+This line isn't in the listing format.
+0C00Z 00                                brk
+`
+
+func TestLoadLst(t *testing.T) {
+	path := writeFixture(t, "game.lst", lstFixture)
+
+	table := NewTable()
+	if err := table.Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The symbols have no bank, so they match every bank.
+	checkSymbol(t, table, 0xc000, 3, "reset")
+	checkSymbol(t, table, 0xc004, 0, "@loop")
+	checkSymbol(t, table, 0xc007, 0, "nmi")
+	checkSymbol(t, table, 0xc008, 0, "@loop")
+	checkSymbol(t, table, 0xc002, 0, "")
+	checkSymbol(t, table, 0x0000, 0, "")
+
+	lines := map[uint16]int{0xc000: 3, 0xc002: 5, 0xc004: 7, 0xc007: 9, 0xfffa: 12}
+	for addr, want := range lines {
+		if l, ok := table.Line(addr, 1); !ok || l.Line != want {
+			t.Errorf("$%04X: got line %d, %v, want %d", addr, l.Line, ok, want)
+		}
+	}
+
+	// The lines of the labels and the malformed lines have no code.
+	for _, line := range []int{1, 2, 6, 8, 13, 14} {
+		if got := table.Lines(path, line); len(got) != 0 {
+			t.Errorf("line %d: got %+v, want no code", line, got)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package symbols
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// loadNl loads an FCEUX name list. The bank is taken from the file name:
+// game.nes.ram.nl lists the RAM, and game.nes.N.nl the PRG ROM bank N, N in
+// hex. A line lists the address, the label and the comment, e.g.
+//
+//	$C000#reset#The reset handler
+//
+// An address followed by a size, e.g. $0300/10, labels a range as an array.
+func (t *Table) loadNl(filename string) error {
+	bank := NoBank
+
+	parts := strings.Split(filepath.Base(filename), ".")
+	if len(parts) >= 3 {
+		if n, err := strconv.ParseUint(parts[len(parts)-2], 16, 16); err == nil {
+			bank = int(n)
+		}
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "$") {
+			continue
+		}
+
+		fields := strings.SplitN(line, "#", 3)
+		if len(fields) < 2 {
+			return fmt.Errorf("%s:%d: invalid line %q", filename, lineNumber, line)
+		}
+
+		addrField, sizeField := fields[0][1:], "1"
+		if i := strings.IndexByte(addrField, '/'); i >= 0 {
+			addrField, sizeField = addrField[:i], addrField[i+1:]
+		}
+
+		addr, err := strconv.ParseUint(addrField, 16, 16)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid address %q", filename, lineNumber, addrField)
+		}
+
+		size, err := strconv.ParseUint(sizeField, 16, 16)
+		if err != nil || size == 0 {
+			return fmt.Errorf("%s:%d: invalid size %q", filename, lineNumber, sizeField)
+		}
+
+		var comment string
+		if len(fields) == 3 {
+			comment = strings.TrimSuffix(fields[2], "#")
+		}
+
+		name := fields[1]
+		if name == "" {
+			continue
+		}
+
+		for i := uint64(0); i < size && addr+i <= 0xffff; i++ {
+			s := Symbol{Name: name, Addr: uint16(addr + i), Bank: bank, Comment: comment}
+			if i > 0 {
+				s.Name = fmt.Sprintf("%s+%d", name, i)
+			}
+
+			t.AddSymbol(s)
+		}
+	}
+
+	return scanner.Err()
+}
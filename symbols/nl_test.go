@@ -0,0 +1,72 @@
+package symbols
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadNl(t *testing.T) {
+	files := map[string]string{
+		"game.nes.ram.nl": "$0000#temp#Scratch#\n$0300/10#buffer#\n$0010##No name\n",
+		"game.nes.0.nl":   "$8000#reset0#The reset handler of bank 0#\r\n$8003#loop#\r\n$8003#main#\r\n",
+		"game.nes.1.nl":   "; not a symbol\n\n$8000#reset1#\n",
+		"game.nes.A.nl":   "$8000#resetA#\n",
+	}
+
+	table := NewTable()
+
+	for name, content := range files {
+		if err := table.Load(writeFixture(t, name, content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkSymbol(t, table, 0x8000, 0, "reset0")
+	checkSymbol(t, table, 0x8000, 1, "reset1")
+	checkSymbol(t, table, 0x8000, 10, "resetA")
+	checkSymbol(t, table, 0x8000, 2, "")
+
+	// The label listed later takes precedence.
+	checkSymbol(t, table, 0x8003, 0, "main")
+
+	// The RAM symbols match every bank, and the arrays label their bytes.
+	checkSymbol(t, table, 0x0000, 5, "temp")
+	checkSymbol(t, table, 0x0300, 0, "buffer")
+	checkSymbol(t, table, 0x030f, 0, "buffer+15")
+	checkSymbol(t, table, 0x0310, 0, "")
+	checkSymbol(t, table, 0x0010, 0, "")
+
+	if s, _ := table.Symbol(0x8000, 0); s.Comment != "The reset handler of bank 0" {
+		t.Errorf("got comment %q", s.Comment)
+	}
+
+	if s, _ := table.Symbol(0x0000, NoBank); s.Comment != "Scratch" {
+		t.Errorf("got comment %q", s.Comment)
+	}
+}
+
+func TestLoadNlMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"no label", "$8000", "invalid line"},
+		{"invalid address", "$80G0#reset#", "invalid address"},
+		{"address too large", "$10000#reset#", "invalid address"},
+		{"zero size", "$0300/0#buffer#", "invalid size"},
+		{"invalid size", "$0300/zz#buffer#", "invalid size"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeFixture(t, "game.nes.0.nl", "$8000#reset#\n"+test.line+"\n")
+
+			err := NewTable().Load(path)
+			if err == nil || !strings.Contains(err.Error(), filepath.Base(path)+":2: "+test.want) {
+				t.Errorf("got %v, want ...:2: %s...", err, test.want)
+			}
+		})
+	}
+}
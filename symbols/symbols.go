@@ -0,0 +1,213 @@
+// Package symbols loads the debug symbols of a program: the labels of the
+// addresses and the source lines the code was assembled from. The symbols
+// are bank aware, so the same CPU address can have a different label in
+// each PRG ROM bank.
+//
+// The supported formats are the debug info of ld65 (.dbg), the listings of
+// asm6 (.lst) and the name lists of FCEUX (.nl).
+package symbols
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// NoBank is the bank of the symbols that are not in the PRG ROM, e.g. in the
+// RAM, and of the symbols whose bank isn't known. They match the address in
+// every bank.
+const NoBank = -1
+
+// BankSize is the size of the banks the symbols are grouped in, 16 KiB of
+// PRG ROM. It is the bank size of the FCEUX name lists.
+const BankSize = 0x4000
+
+// Symbol is a label of an address.
+type Symbol struct {
+	Name    string
+	Addr    uint16
+	Bank    int
+	Comment string
+}
+
+// Line is a source line the code at an address was assembled from.
+type Line struct {
+	Path string
+	Line int
+	Addr uint16
+	Bank int
+}
+
+// Table holds the symbols and the lines of a program.
+type Table struct {
+	symbols map[uint16][]Symbol
+	lines   map[uint16][]Line
+	// byPath lists the lines of each source file.
+	byPath map[string][]Line
+}
+
+func NewTable() *Table {
+	return &Table{
+		symbols: map[uint16][]Symbol{},
+		lines:   map[uint16][]Line{},
+		byPath:  map[string][]Line{},
+	}
+}
+
+// Load loads the symbols of the file into the table. The format is chosen
+// by the extension of the file.
+func (t *Table) Load(filename string) error {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".dbg":
+		return t.loadDbg(filename)
+	case ".lst":
+		return t.loadLst(filename)
+	case ".nl":
+		return t.loadNl(filename)
+	default:
+		return fmt.Errorf("%s: unknown symbol file format", filename)
+	}
+}
+
+// AddSymbol adds a label to the table. A symbol added later takes
+// precedence.
+func (t *Table) AddSymbol(s Symbol) {
+	t.symbols[s.Addr] = append([]Symbol{s}, t.symbols[s.Addr]...)
+}
+
+// AddLine adds a source line to the table.
+func (t *Table) AddLine(l Line) {
+	l.Path = filepath.ToSlash(filepath.Clean(l.Path))
+
+	t.lines[l.Addr] = append(t.lines[l.Addr], l)
+	t.byPath[l.Path] = append(t.byPath[l.Path], l)
+}
+
+// Symbol returns the symbol of the address in the bank.
+func (t *Table) Symbol(addr uint16, bank int) (Symbol, bool) {
+	return matchSymbol(t.symbols[addr], bank)
+}
+
+// Line returns the source line of the address in the bank.
+func (t *Table) Line(addr uint16, bank int) (Line, bool) {
+	return matchLine(t.lines[addr], bank)
+}
+
+// Lines returns the addresses assembled from the line of the source file.
+// The path matches the path of the source file if one is a suffix of the
+// other, as the paths in the symbols are often relative to the directory
+// the program was built in.
+func (t *Table) Lines(filename string, line int) []Line {
+	filename = filepath.ToSlash(filepath.Clean(filename))
+
+	var lines []Line
+
+	for p, pathLines := range t.byPath {
+		if !samePath(p, filename) {
+			continue
+		}
+
+		for _, l := range pathLines {
+			if l.Line == line {
+				lines = append(lines, l)
+			}
+		}
+	}
+
+	return lines
+}
+
+func samePath(a, b string) bool {
+	return a == b || strings.HasSuffix(a, "/"+b) || strings.HasSuffix(b, "/"+a)
+}
+
+// matchSymbol returns the symbol of the bank, or else the first one of no
+// bank.
+func matchSymbol(symbols []Symbol, bank int) (Symbol, bool) {
+	var fallback *Symbol
+
+	for i := range symbols {
+		switch symbols[i].Bank {
+		case bank:
+			return symbols[i], true
+		case NoBank:
+			if fallback == nil {
+				fallback = &symbols[i]
+			}
+		}
+	}
+
+	if fallback != nil {
+		return *fallback, true
+	}
+
+	return Symbol{}, false
+}
+
+// matchLine returns the line of the bank, or else the first one of no bank.
+func matchLine(lines []Line, bank int) (Line, bool) {
+	var fallback *Line
+
+	for i := range lines {
+		switch lines[i].Bank {
+		case bank:
+			return lines[i], true
+		case NoBank:
+			if fallback == nil {
+				fallback = &lines[i]
+			}
+		}
+	}
+
+	if fallback != nil {
+		return *fallback, true
+	}
+
+	return Line{}, false
+}
+
+// View is the table as seen by the CPU: the bank of an address is the bank
+// mapped at it.
+type View struct {
+	table *Table
+	bank  func(addr uint16) int
+}
+
+// View returns a view of the table. The bank function returns the bank
+// mapped at an address, or NoBank. A nil function maps every address to
+// NoBank.
+func (t *Table) View(bank func(addr uint16) int) *View {
+	if bank == nil {
+		bank = func(uint16) int { return NoBank }
+	}
+
+	return &View{table: t, bank: bank}
+}
+
+// Label returns the label of the address.
+func (v *View) Label(addr uint16) (string, bool) {
+	s, ok := v.table.Symbol(addr, v.bank(addr))
+	return s.Name, ok
+}
+
+// Line returns the source line of the address.
+func (v *View) Line(addr uint16) (string, int, bool) {
+	l, ok := v.table.Line(addr, v.bank(addr))
+	return l.Path, l.Line, ok
+}
+
+// Addrs returns the addresses assembled from the line of the source file.
+func (v *View) Addrs(filename string, line int) []uint16 {
+	var addrs []uint16
+
+	seen := map[uint16]bool{}
+
+	for _, l := range v.table.Lines(filename, line) {
+		if !seen[l.Addr] {
+			seen[l.Addr] = true
+			addrs = append(addrs, l.Addr)
+		}
+	}
+
+	return addrs
+}
@@ -0,0 +1,74 @@
+package symbols
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFixture writes the symbol file to a temporary directory and returns
+// its path.
+func writeFixture(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// checkSymbol checks the name of the symbol of the address in the bank, ""
+// for no symbol.
+func checkSymbol(t *testing.T, table *Table, addr uint16, bank int, want string) {
+	t.Helper()
+
+	s, ok := table.Symbol(addr, bank)
+	if want == "" && ok {
+		t.Errorf("$%04X in bank %d: got %q, want no symbol", addr, bank, s.Name)
+	} else if want != "" && (!ok || s.Name != want) {
+		t.Errorf("$%04X in bank %d: got %q, %v, want %q", addr, bank, s.Name, ok, want)
+	}
+}
+
+func TestLoadUnknownFormat(t *testing.T) {
+	if err := NewTable().Load(writeFixture(t, "game.sym", "")); err == nil {
+		t.Error("a .sym file was loaded")
+	}
+}
+
+func TestView(t *testing.T) {
+	table := NewTable()
+	table.AddSymbol(Symbol{Name: "reset0", Addr: 0x8000, Bank: 0})
+	table.AddSymbol(Symbol{Name: "reset1", Addr: 0x8000, Bank: 1})
+	table.AddSymbol(Symbol{Name: "temp", Addr: 0x0000, Bank: NoBank})
+	table.AddLine(Line{Path: "src/./main.s", Line: 3, Addr: 0x8000, Bank: 1})
+	table.AddLine(Line{Path: "src/main.s", Line: 3, Addr: 0x8000, Bank: 0})
+
+	bank := 1
+	v := table.View(func(uint16) int { return bank })
+
+	if label, ok := v.Label(0x8000); !ok || label != "reset1" {
+		t.Errorf("got label %q, %v in bank 1, want reset1", label, ok)
+	}
+
+	if label, ok := v.Label(0x0000); !ok || label != "temp" {
+		t.Errorf("got label %q, %v, want temp", label, ok)
+	}
+
+	bank = 0
+
+	if label, ok := v.Label(0x8000); !ok || label != "reset0" {
+		t.Errorf("got label %q, %v in bank 0, want reset0", label, ok)
+	}
+
+	if path, line, ok := v.Line(0x8000); !ok || path != "src/main.s" || line != 3 {
+		t.Errorf("got line %s:%d, %v, want src/main.s:3", path, line, ok)
+	}
+
+	// The address is in both banks, but listed once.
+	if addrs := v.Addrs("/home/user/game/src/main.s", 3); len(addrs) != 1 || addrs[0] != 0x8000 {
+		t.Errorf("got addresses %X, want [8000]", addrs)
+	}
+}
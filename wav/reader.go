@@ -0,0 +1,140 @@
+package wav
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Reader reads the samples of an 8-bit or 16-bit PCM WAV file. The samples
+// of the channels are interleaved.
+type Reader struct {
+	r             *bufio.Reader
+	rate          int
+	channels      int
+	bitsPerSample int
+	// remaining is the number of bytes of samples left in the data chunk.
+	remaining uint32
+}
+
+// NewReader reads the header of a WAV file from r up to the samples and
+// returns a reader for them.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	var riff [12]byte
+	if _, err := io.ReadFull(br, riff[:]); err != nil {
+		return nil, fmt.Errorf("reading the WAV header: %w", err)
+	}
+
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+
+	wr := &Reader{r: br}
+	haveFormat := false
+
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(br, chunk[:]); err != nil {
+			return nil, fmt.Errorf("reading the WAV chunks: %w", err)
+		}
+
+		id := string(chunk[0:4])
+		size := binary.LittleEndian.Uint32(chunk[4:])
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("invalid WAV format chunk of %d bytes", size)
+			}
+
+			format := make([]byte, size)
+			if _, err := io.ReadFull(br, format); err != nil {
+				return nil, fmt.Errorf("reading the WAV format: %w", err)
+			}
+
+			if f := binary.LittleEndian.Uint16(format[0:]); f != pcmFormat {
+				return nil, fmt.Errorf("unsupported WAV format %d", f)
+			}
+
+			wr.channels = int(binary.LittleEndian.Uint16(format[2:]))
+			wr.rate = int(binary.LittleEndian.Uint32(format[4:]))
+			wr.bitsPerSample = int(binary.LittleEndian.Uint16(format[14:]))
+
+			if wr.bitsPerSample != 8 && wr.bitsPerSample != 16 {
+				return nil, fmt.Errorf("unsupported WAV sample size of %d bits", wr.bitsPerSample)
+			}
+
+			if wr.channels <= 0 || wr.rate <= 0 {
+				return nil, fmt.Errorf("invalid WAV format: %d Hz, %d channels", wr.rate, wr.channels)
+			}
+
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return nil, errors.New("WAV data before the format")
+			}
+
+			wr.remaining = size
+
+			return wr, nil
+		default:
+			if _, err := br.Discard(int(size)); err != nil {
+				return nil, fmt.Errorf("skipping the WAV chunk %q: %w", id, err)
+			}
+		}
+
+		// The chunks are padded to an even size.
+		if size%2 != 0 {
+			if _, err := br.Discard(1); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// Rate returns the sample rate.
+func (r *Reader) Rate() int {
+	return r.rate
+}
+
+// Channels returns the number of channels.
+func (r *Reader) Channels() int {
+	return r.channels
+}
+
+// ReadSamples reads samples, -1 to 1, into samples and returns the number
+// read. At the end of the samples it returns io.EOF.
+func (r *Reader) ReadSamples(samples []float32) (int, error) {
+	size := uint32(r.bitsPerSample / 8)
+
+	n := 0
+	for ; n < len(samples) && r.remaining >= size; n++ {
+		var buf [2]byte
+		if _, err := io.ReadFull(r.r, buf[:size]); err != nil {
+			if err == io.EOF {
+				// The data chunk is shorter than its size.
+				err = io.ErrUnexpectedEOF
+			}
+
+			return n, err
+		}
+
+		r.remaining -= size
+
+		if size == 1 {
+			samples[n] = float32(int(buf[0])-0x80) / 0x80
+		} else {
+			samples[n] = float32(int16(binary.LittleEndian.Uint16(buf[:]))) / 0x8000
+		}
+	}
+
+	if n == 0 && len(samples) > 0 {
+		return 0, io.EOF
+	}
+
+	return n, nil
+}
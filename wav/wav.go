@@ -0,0 +1,131 @@
+// Package wav reads and writes PCM WAV files. It writes 16-bit samples and
+// reads 8-bit and 16-bit ones.
+package wav
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	headerSize    = 44
+	pcmFormat     = 1
+	bitsPerSample = 16
+	// riffSizeOffset and dataSizeOffset are the offsets of the sizes in the
+	// header, filled in when the file is closed.
+	riffSizeOffset = 4
+	dataSizeOffset = 40
+)
+
+// Writer writes samples to a WAV file. The samples of the channels are
+// interleaved.
+type Writer struct {
+	w        io.WriteSeeker
+	bw       *bufio.Writer
+	channels int
+	// dataSize is the number of bytes of samples written.
+	dataSize uint32
+	err      error
+}
+
+// NewWriter writes the header of a WAV file of the given sample rate and
+// number of channels to w and returns a writer for the samples.
+func NewWriter(w io.WriteSeeker, rate, channels int) (*Writer, error) {
+	if rate <= 0 || channels <= 0 {
+		return nil, fmt.Errorf("invalid WAV format: %d Hz, %d channels", rate, channels)
+	}
+
+	blockAlign := channels * bitsPerSample / 8
+
+	var header [headerSize]byte
+
+	copy(header[0:], "RIFF")
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], pcmFormat)
+	binary.LittleEndian.PutUint16(header[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(rate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(rate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:], bitsPerSample)
+	copy(header[36:], "data")
+
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+
+	return &Writer{w: w, bw: bufio.NewWriter(w), channels: channels}, nil
+}
+
+// WriteSamples writes the samples, -1 to 1, as 16-bit integers. The samples
+// out of the range are clipped.
+func (w *Writer) WriteSamples(samples []float32) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	var buf [2]byte
+
+	for _, s := range samples {
+		switch {
+		case s > 1:
+			s = 1
+		case s < -1:
+			s = -1
+		}
+
+		binary.LittleEndian.PutUint16(buf[:], uint16(int16(s*0x7fff)))
+
+		if _, err := w.bw.Write(buf[:]); err != nil {
+			w.err = err
+			return err
+		}
+	}
+
+	w.dataSize += uint32(2 * len(samples))
+
+	return nil
+}
+
+// Close fills in the sizes in the header. It doesn't close the underlying
+// writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if err := w.bw.Flush(); err != nil {
+		return err
+	}
+
+	// A frame of all the channels is never split.
+	frameSize := uint32(2 * w.channels)
+	w.dataSize -= w.dataSize % frameSize
+
+	sizes := []struct {
+		offset int64
+		size   uint32
+	}{
+		{riffSizeOffset, headerSize - 8 + w.dataSize},
+		{dataSizeOffset, w.dataSize},
+	}
+
+	for _, s := range sizes {
+		if _, err := w.w.Seek(s.offset, io.SeekStart); err != nil {
+			return err
+		}
+
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], s.size)
+
+		if _, err := w.w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.w.Seek(0, io.SeekEnd)
+
+	return err
+}
@@ -0,0 +1,146 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes the samples to a WAV file and returns its contents.
+func writeFile(t *testing.T, rate, channels int, samples ...[]float32) []byte {
+	t.Helper()
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	w, err := NewWriter(f, rate, channels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range samples {
+		if err := w.WriteSamples(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestWriterHeader(t *testing.T) {
+	data := writeFile(t, 44100, 2, []float32{0, 0.5}, []float32{-0.5, 1, -1, 0})
+
+	if len(data) != headerSize+12 {
+		t.Fatalf("got %d bytes, want %d", len(data), headerSize+12)
+	}
+
+	want := []byte{
+		'R', 'I', 'F', 'F', 48, 0, 0, 0, 'W', 'A', 'V', 'E',
+		'f', 'm', 't', ' ', 16, 0, 0, 0,
+		1, 0, // PCM
+		2, 0, // channels
+		0x44, 0xac, 0, 0, // 44100 Hz
+		0x10, 0xb1, 0x02, 0, // 176400 bytes per second
+		4, 0, // block align
+		16, 0, // bits per sample
+		'd', 'a', 't', 'a', 12, 0, 0, 0,
+	}
+
+	if !bytes.Equal(data[:headerSize], want) {
+		t.Errorf("got header\n% X\nwant\n% X", data[:headerSize], want)
+	}
+}
+
+func TestWriterSizesOfPartialFrame(t *testing.T) {
+	// The fifth sample is half a stereo frame, which is left out of the
+	// sizes.
+	data := writeFile(t, 8000, 2, []float32{0, 0, 0}, []float32{0, 0})
+
+	if riff, size := binary.LittleEndian.Uint32(data[riffSizeOffset:]), binary.LittleEndian.Uint32(data[dataSizeOffset:]); riff != 44 || size != 8 {
+		t.Errorf("got RIFF size %d and data size %d, want 44 and 8", riff, size)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	data := writeFile(t, 48000, 1)
+
+	if len(data) != headerSize || binary.LittleEndian.Uint32(data[riffSizeOffset:]) != 36 || binary.LittleEndian.Uint32(data[dataSizeOffset:]) != 0 {
+		t.Errorf("got %d bytes and header % X", len(data), data)
+	}
+}
+
+func TestWriterSamples(t *testing.T) {
+	data := writeFile(t, 8000, 1, []float32{0, 0.5, -0.5, 1, -1, 2, -2})
+
+	want := []int16{0, 0x3fff, -0x3fff, 0x7fff, -0x7fff, 0x7fff, -0x7fff}
+
+	for i, w := range want {
+		if got := int16(binary.LittleEndian.Uint16(data[headerSize+2*i:])); got != w {
+			t.Errorf("sample %d: got %d, want %d", i, got, w)
+		}
+	}
+}
+
+func TestWriterInvalidFormat(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if _, err := NewWriter(f, 0, 1); err == nil {
+		t.Error("a rate of 0 was accepted")
+	}
+
+	if _, err := NewWriter(f, 44100, 0); err == nil {
+		t.Error("no channels were accepted")
+	}
+}
+
+func TestReadWritten(t *testing.T) {
+	samples := []float32{0, 0.25, -0.25, 0.5, -0.5, 0.75}
+	data := writeFile(t, 22050, 3, samples)
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Rate() != 22050 || r.Channels() != 3 {
+		t.Errorf("got %d Hz and %d channels, want 22050 Hz and 3", r.Rate(), r.Channels())
+	}
+
+	got := make([]float32, 10)
+
+	n, err := r.ReadSamples(got)
+	if err != nil || n != len(samples) {
+		t.Fatalf("read %d samples, %v, want %d", n, err, len(samples))
+	}
+
+	for i, want := range samples {
+		if diff := got[i] - want; diff < -1e-4 || diff > 1e-4 {
+			t.Errorf("sample %d: got %f, want %f", i, got[i], want)
+		}
+	}
+
+	if _, err := r.ReadSamples(got); err != io.EOF {
+		t.Errorf("got %v at the end, want io.EOF", err)
+	}
+}